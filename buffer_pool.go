@@ -51,13 +51,17 @@ func (b *packetBuffer) Release() {
 }
 
 func (b *packetBuffer) putBack() {
-	if cap(b.Slice) != int(protocol.MaxReceivePacketSize) {
+	switch cap(b.Slice) {
+	case int(protocol.MaxReceivePacketSize):
+		bufferPool.Put(b)
+	case int(protocol.MaxPacketBufferSize):
+		largeBufferPool.Put(b)
+	default:
 		panic("putPacketBuffer called with packet of wrong size!")
 	}
-	bufferPool.Put(b)
 }
 
-var bufferPool sync.Pool
+var bufferPool, largeBufferPool sync.Pool
 
 func getPacketBuffer() *packetBuffer {
 	buf := bufferPool.Get().(*packetBuffer)
@@ -66,10 +70,32 @@ func getPacketBuffer() *packetBuffer {
 	return buf
 }
 
+// getLargePacketBuffer returns a buffer that is large enough to hold jumbo packets.
+// It is only used if the path MTU exceeds the size of the default buffers.
+func getLargePacketBuffer() *packetBuffer {
+	buf := largeBufferPool.Get().(*packetBuffer)
+	buf.refCount = 1
+	buf.Slice = buf.Slice[:protocol.MaxPacketBufferSize]
+	return buf
+}
+
+// getPacketBufferForSize returns a buffer that is large enough to hold packets of the given size.
+func getPacketBufferForSize(size protocol.ByteCount) *packetBuffer {
+	if size > protocol.MaxReceivePacketSize {
+		return getLargePacketBuffer()
+	}
+	return getPacketBuffer()
+}
+
 func init() {
 	bufferPool.New = func() interface{} {
 		return &packetBuffer{
 			Slice: make([]byte, 0, protocol.MaxReceivePacketSize),
 		}
 	}
+	largeBufferPool.New = func() interface{} {
+		return &packetBuffer{
+			Slice: make([]byte, 0, protocol.MaxPacketBufferSize),
+		}
+	}
 }
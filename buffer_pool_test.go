@@ -13,11 +13,27 @@ var _ = Describe("Buffer Pool", func() {
 		Expect(buf.Slice).To(HaveCap(int(protocol.MaxReceivePacketSize)))
 	})
 
+	It("returns large buffers", func() {
+		buf := getLargePacketBuffer()
+		Expect(buf.Slice).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+		Expect(buf.Slice).To(HaveLen(int(protocol.MaxPacketBufferSize)))
+	})
+
+	It("returns buffers large enough for a packet size", func() {
+		Expect(getPacketBufferForSize(protocol.MaxReceivePacketSize).Slice).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+		Expect(getPacketBufferForSize(protocol.MaxReceivePacketSize + 1).Slice).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+	})
+
 	It("releases buffers", func() {
 		buf := getPacketBuffer()
 		buf.Release()
 	})
 
+	It("releases large buffers", func() {
+		buf := getLargePacketBuffer()
+		buf.Release()
+	})
+
 	It("panics if wrong-sized buffers are passed", func() {
 		buf := getPacketBuffer()
 		buf.Slice = make([]byte, 10)
@@ -50,7 +50,7 @@ var _ packetHandler = &client{}
 
 var (
 	// make it possible to mock connection ID generation in the tests
-	generateConnectionID           = protocol.GenerateConnectionID
+	generateConnectionID           = generateConnectionIDWith
 	generateConnectionIDForInitial = protocol.GenerateConnectionIDForInitial
 )
 
@@ -124,7 +124,13 @@ func dialContext(
 		return nil, errors.New("quic: NextProtos not set in tls.Config")
 	}
 	config = populateClientConfig(config, createdPacketConn)
-	packetHandlers, err := getMultiplexer().AddConn(pconn, config.ConnectionIDLength, config.StatelessResetKey)
+	if err := validateReceiveWindows(config); err != nil {
+		return nil, err
+	}
+	if err := validateConnectionIDLength(config, protocol.PerspectiveClient); err != nil {
+		return nil, err
+	}
+	packetHandlers, err := getMultiplexer().AddConn(pconn, config.ConnectionIDLength, getStatelessResetKeys(config), protocol.ByteCount(config.MaxPacketSize), !config.DisablePathMTUDiscovery)
 	if err != nil {
 		return nil, err
 	}
@@ -167,7 +173,7 @@ func newClient(
 		}
 	}
 
-	srcConnID, err := generateConnectionID(config.ConnectionIDLength)
+	srcConnID, err := generateConnectionID(config.ConnectionIDGenerator)
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +184,7 @@ func newClient(
 	c := &client{
 		srcConnID:         srcConnID,
 		destConnID:        destConnID,
-		conn:              &conn{pconn: pconn, currentAddr: remoteAddr},
+		conn:              newConn(pconn, remoteAddr, packetInfo{}),
 		createdPacketConn: createdPacketConn,
 		tlsConf:           tlsConf,
 		config:            config,
@@ -229,22 +235,61 @@ func populateClientConfig(config *Config, createdPacketConn bool) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	maxPacketSize := protocol.ByteCount(config.MaxPacketSize)
+	if maxPacketSize == 0 {
+		maxPacketSize = protocol.MaxReceivePacketSize
+	} else if maxPacketSize < protocol.MinInitialPacketSize {
+		maxPacketSize = protocol.MinInitialPacketSize
+	} else if maxPacketSize > protocol.MaxPacketBufferSize {
+		maxPacketSize = protocol.MaxPacketBufferSize
+	}
 	connIDLen := config.ConnectionIDLength
 	if connIDLen == 0 && !createdPacketConn {
 		connIDLen = protocol.DefaultConnectionIDLength
 	}
+	connIDGenerator := config.ConnectionIDGenerator
+	if connIDGenerator == nil {
+		connIDGenerator = &protocol.DefaultConnectionIDGenerator{ConnLen: connIDLen}
+	} else {
+		connIDLen = connIDGenerator.ConnectionIDLen()
+	}
+	tokenStore := config.TokenStore
+	if tokenStore == nil {
+		tokenStore = getDefaultTokenStore()
+	}
+	bdpAutoTuningHeadroom := config.BDPAutoTuningHeadroom
+	if bdpAutoTuningHeadroom <= 0 {
+		bdpAutoTuningHeadroom = protocol.DefaultBDPAutoTuningHeadroom
+	}
+	congestionControl := config.CongestionControl
+	if congestionControl == 0 {
+		congestionControl = protocol.CongestionControlBBR
+	}
 
 	return &Config{
 		Versions:                              versions,
 		HandshakeTimeout:                      handshakeTimeout,
 		IdleTimeout:                           idleTimeout,
 		ConnectionIDLength:                    connIDLen,
+		ConnectionIDGenerator:                 connIDGenerator,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+		InitialStreamReceiveWindow:            config.InitialStreamReceiveWindow,
+		InitialConnectionReceiveWindow:        config.InitialConnectionReceiveWindow,
+		EnableBDPAutoTuning:                   config.EnableBDPAutoTuning,
+		BDPAutoTuningHeadroom:                 bdpAutoTuningHeadroom,
+		ReceiveWindowBudget:                   config.ReceiveWindowBudget,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
 		KeepAlive:                             config.KeepAlive,
+		EnableDatagrams:                       config.EnableDatagrams,
+		TokenStore:                            tokenStore,
 		StatelessResetKey:                     config.StatelessResetKey,
+		PreviousStatelessResetKeys:            config.PreviousStatelessResetKeys,
+		KeyUpdateInterval:                     config.KeyUpdateInterval,
+		MaxPacketSize:                         uint64(maxPacketSize),
+		DisablePathMTUDiscovery:               config.DisablePathMTUDiscovery,
+		CongestionControl:                     congestionControl,
 	}
 }
 
@@ -348,24 +393,34 @@ func (c *client) handleVersionNegotiationPacket(p *receivedPacket) {
 }
 
 func (c *client) createNewTLSSession(version protocol.VersionNumber) error {
+	initialStreamReceiveWindow, initialConnectionReceiveWindow := getInitialReceiveWindows(c.config)
 	params := &handshake.TransportParameters{
-		InitialMaxStreamDataBidiRemote: protocol.InitialMaxStreamData,
-		InitialMaxStreamDataBidiLocal:  protocol.InitialMaxStreamData,
-		InitialMaxStreamDataUni:        protocol.InitialMaxStreamData,
-		InitialMaxData:                 protocol.InitialMaxData,
+		InitialMaxStreamDataBidiRemote: protocol.ByteCount(initialStreamReceiveWindow),
+		InitialMaxStreamDataBidiLocal:  protocol.ByteCount(initialStreamReceiveWindow),
+		InitialMaxStreamDataUni:        protocol.ByteCount(initialStreamReceiveWindow),
+		InitialMaxData:                 protocol.ByteCount(initialConnectionReceiveWindow),
 		IdleTimeout:                    c.config.IdleTimeout,
 		MaxBidiStreamNum:               protocol.StreamNum(c.config.MaxIncomingStreams),
 		MaxUniStreamNum:                protocol.StreamNum(c.config.MaxIncomingUniStreams),
 		MaxAckDelay:                    protocol.MaxAckDelayInclGranularity,
 		AckDelayExponent:               protocol.AckDelayExponent,
+		ActiveConnectionIDLimit:        protocol.MaxActiveConnectionIDs,
+		MaxPacketSize:                  protocol.ByteCount(c.config.MaxPacketSize),
 		DisableMigration:               true,
+		InitialSourceConnectionID:      c.srcConnID,
+	}
+	if c.config.EnableDatagrams {
+		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
 	}
 
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	runner := &runner{
-		packetHandlerManager:    c.packetHandlers,
-		onHandshakeCompleteImpl: func(_ Session) { close(c.handshakeChan) },
+	runner := &clientRunner{
+		runner: runner{
+			packetHandlerManager:    c.packetHandlers,
+			onHandshakeCompleteImpl: func(_ Session) { close(c.handshakeChan) },
+		},
+		client: c,
 	}
 	sess, err := newClientSession(
 		c.conn,
@@ -388,6 +443,103 @@ func (c *client) createNewTLSSession(version protocol.VersionNumber) error {
 	return nil
 }
 
+// The clientRunner is the sessionRunner of client sessions.
+// It keeps track of the connection IDs issued to the server,
+// and allows the session to migrate to a new net.PacketConn.
+type clientRunner struct {
+	mutex sync.Mutex
+	runner
+
+	client            *client
+	connIDs           map[string] /* string(ConnectionID)*/ packetHandler // connection IDs issued after the handshake
+	newPacketHandlers packetHandlerManager                                // only set while migrating to a new net.PacketConn
+}
+
+var _ packetConnMigrator = &clientRunner{}
+
+func (r *clientRunner) Add(connID protocol.ConnectionID, handler packetHandler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.connIDs == nil {
+		r.connIDs = make(map[string]packetHandler)
+	}
+	r.connIDs[string(connID)] = handler
+	r.packetHandlerManager.Add(connID, handler)
+	if r.newPacketHandlers != nil {
+		r.newPacketHandlers.Add(connID, handler)
+	}
+}
+
+func (r *clientRunner) Retire(connID protocol.ConnectionID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.connIDs, string(connID))
+	r.packetHandlerManager.Retire(connID)
+	if r.newPacketHandlers != nil {
+		r.newPacketHandlers.Retire(connID)
+	}
+}
+
+func (r *clientRunner) Remove(connID protocol.ConnectionID) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.connIDs, string(connID))
+	r.packetHandlerManager.Remove(connID)
+	if r.newPacketHandlers != nil {
+		r.newPacketHandlers.Remove(connID)
+	}
+}
+
+func (r *clientRunner) AddPacketConn(pconn net.PacketConn) error {
+	c := r.client
+	packetHandlers, err := getMultiplexer().AddConn(pconn, c.config.ConnectionIDLength, getStatelessResetKeys(c.config), protocol.ByteCount(c.config.MaxPacketSize), !c.config.DisablePathMTUDiscovery)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	packetHandlers.Add(c.srcConnID, c)
+	for connID, handler := range r.connIDs {
+		packetHandlers.Add(protocol.ConnectionID(connID), handler)
+	}
+	r.newPacketHandlers = packetHandlers
+	return nil
+}
+
+func (r *clientRunner) RemovePacketConn(net.PacketConn) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.removeAllConnIDs(r.newPacketHandlers)
+	r.newPacketHandlers = nil
+}
+
+func (r *clientRunner) SwitchPacketConn(net.PacketConn) {
+	r.mutex.Lock()
+	c := r.client
+	oldPacketHandlers := r.packetHandlerManager
+	r.removeAllConnIDs(oldPacketHandlers)
+	newPacketHandlers := r.newPacketHandlers
+	r.packetHandlerManager = newPacketHandlers
+	r.newPacketHandlers = nil
+	r.mutex.Unlock()
+
+	// This is called from the session's run loop, which is executed in the same go routine
+	// that closes the packet handlers when the session is closed (see establishSecureConnection).
+	c.packetHandlers = newPacketHandlers
+	if c.createdPacketConn {
+		// The new net.PacketConn was passed in by the application. We must not close it.
+		c.createdPacketConn = false
+		oldPacketHandlers.Close()
+	}
+}
+
+func (r *clientRunner) removeAllConnIDs(packetHandlers packetHandlerManager) {
+	packetHandlers.Remove(r.client.srcConnID)
+	for connID := range r.connIDs {
+		packetHandlers.Remove(protocol.ConnectionID(connID))
+	}
+}
+
 func (c *client) Close() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
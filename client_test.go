@@ -102,13 +102,13 @@ var _ = Describe("Client", func() {
 	})
 
 	Context("Dialing", func() {
-		var origGenerateConnectionID func(int) (protocol.ConnectionID, error)
+		var origGenerateConnectionID func(ConnectionIDGenerator) (protocol.ConnectionID, error)
 		var origGenerateConnectionIDForInitial func() (protocol.ConnectionID, error)
 
 		BeforeEach(func() {
 			origGenerateConnectionID = generateConnectionID
 			origGenerateConnectionIDForInitial = generateConnectionIDForInitial
-			generateConnectionID = func(int) (protocol.ConnectionID, error) {
+			generateConnectionID = func(ConnectionIDGenerator) (protocol.ConnectionID, error) {
 				return connID, nil
 			}
 			generateConnectionIDForInitial = func() (protocol.ConnectionID, error) {
@@ -129,7 +129,7 @@ var _ = Describe("Client", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
 			manager.EXPECT().Close()
-			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 			remoteAddrChan := make(chan string, 1)
 			newClientSession = func(
@@ -159,7 +159,7 @@ var _ = Describe("Client", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
 			manager.EXPECT().Close()
-			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 			hostnameChan := make(chan string, 1)
 			newClientSession = func(
@@ -189,7 +189,7 @@ var _ = Describe("Client", func() {
 		It("returns after the handshake is complete", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 			run := make(chan struct{})
 			newClientSession = func(
@@ -225,7 +225,7 @@ var _ = Describe("Client", func() {
 		It("returns an error that occurs while waiting for the connection to become secure", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 			testErr := errors.New("early handshake error")
 			newClientSession = func(
@@ -259,7 +259,7 @@ var _ = Describe("Client", func() {
 		It("closes the session when the context is canceled", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 			sessionRunning := make(chan struct{})
 			defer close(sessionRunning)
@@ -307,7 +307,7 @@ var _ = Describe("Client", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(connID, gomock.Any())
 			manager.EXPECT().Retire(connID)
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 			var runner sessionRunner
 			sess := NewMockQuicSession(mockCtrl)
@@ -348,7 +348,7 @@ var _ = Describe("Client", func() {
 			}
 
 			manager := NewMockPacketHandlerManager(mockCtrl)
-			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
 
 			var conn connection
@@ -399,12 +399,15 @@ var _ = Describe("Client", func() {
 		Context("quic.Config", func() {
 			It("setups with the right values", func() {
 				config := &Config{
-					HandshakeTimeout:      1337 * time.Minute,
-					IdleTimeout:           42 * time.Hour,
-					MaxIncomingStreams:    1234,
-					MaxIncomingUniStreams: 4321,
-					ConnectionIDLength:    13,
-					StatelessResetKey:     []byte("foobar"),
+					HandshakeTimeout:        1337 * time.Minute,
+					IdleTimeout:             42 * time.Hour,
+					MaxIncomingStreams:      1234,
+					MaxIncomingUniStreams:   4321,
+					ConnectionIDLength:      13,
+					StatelessResetKey:       []byte("foobar"),
+					KeyUpdateInterval:       1000,
+					MaxPacketSize:           9000,
+					DisablePathMTUDiscovery: true,
 				}
 				c := populateClientConfig(config, false)
 				Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -413,17 +416,52 @@ var _ = Describe("Client", func() {
 				Expect(c.MaxIncomingUniStreams).To(Equal(4321))
 				Expect(c.ConnectionIDLength).To(Equal(13))
 				Expect(c.StatelessResetKey).To(Equal([]byte("foobar")))
+				Expect(c.KeyUpdateInterval).To(BeEquivalentTo(1000))
+				Expect(c.MaxPacketSize).To(BeEquivalentTo(9000))
+				Expect(c.DisablePathMTUDiscovery).To(BeTrue())
+			})
+
+			It("limits the max packet size", func() {
+				Expect(populateClientConfig(&Config{MaxPacketSize: 1000}, false).MaxPacketSize).To(BeEquivalentTo(protocol.MinInitialPacketSize))
+				Expect(populateClientConfig(&Config{MaxPacketSize: 1 << 16}, false).MaxPacketSize).To(BeEquivalentTo(protocol.MaxPacketBufferSize))
 			})
 
 			It("errors when the Config contains an invalid version", func() {
 				manager := NewMockPacketHandlerManager(mockCtrl)
-				mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+				mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 				version := protocol.VersionNumber(0x1234)
 				_, err := Dial(packetConn, nil, "localhost:1234", tlsConf, &Config{Versions: []protocol.VersionNumber{version}})
 				Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 			})
 
+			It("errors when the connection ID length is invalid", func() {
+				_, err := Dial(packetConn, nil, "localhost:1234", tlsConf, &Config{ConnectionIDLength: 3})
+				Expect(err).To(MatchError("quic: invalid connection ID length: 3 (must be between 4 and 18 bytes)"))
+				_, err = Dial(packetConn, nil, "localhost:1234", tlsConf, &Config{
+					Versions:              []protocol.VersionNumber{protocol.VersionDraft29},
+					ConnectionIDGenerator: &protocol.DefaultConnectionIDGenerator{ConnLen: 21},
+				})
+				Expect(err).To(MatchError("quic: invalid connection ID length: 21 (must be between 4 and 20 bytes)"))
+			})
+
+			It("errors when the initial flow control window is larger than the maximum window", func() {
+				_, err := Dial(packetConn, nil, "localhost:1234", tlsConf, &Config{
+					InitialStreamReceiveWindow:        2000,
+					MaxReceiveStreamFlowControlWindow: 1000,
+				})
+				Expect(err).To(MatchError("quic: InitialStreamReceiveWindow (2000) larger than MaxReceiveStreamFlowControlWindow (1000)"))
+			})
+
+			It("doesn't use default initial flow control windows larger than the maximum windows", func() {
+				streamWindow, connWindow := getInitialReceiveWindows(populateClientConfig(&Config{
+					MaxReceiveStreamFlowControlWindow:     1000,
+					MaxReceiveConnectionFlowControlWindow: 2000,
+				}, false))
+				Expect(streamWindow).To(BeEquivalentTo(1000))
+				Expect(connWindow).To(BeEquivalentTo(2000))
+			})
+
 			It("erros when the tls.Config doesn't contain NextProtos", func() {
 				_, err := Dial(packetConn, nil, "localhost:1234", &tls.Config{}, nil)
 				Expect(err).To(MatchError("quic: NextProtos not set in tls.Config"))
@@ -449,6 +487,19 @@ var _ = Describe("Client", func() {
 				Expect(c.MaxIncomingUniStreams).To(BeZero())
 			})
 
+			It("uses the length of the connection IDs generated by the ConnectionIDGenerator", func() {
+				config := &Config{ConnectionIDGenerator: &protocol.DefaultConnectionIDGenerator{ConnLen: 6}}
+				c := populateClientConfig(config, true)
+				Expect(c.ConnectionIDLength).To(Equal(6))
+				Expect(c.ConnectionIDGenerator).To(Equal(config.ConnectionIDGenerator))
+			})
+
+			It("uses the default token store if no token store is set", func() {
+				Expect(populateClientConfig(&Config{}, false).TokenStore).To(BeIdenticalTo(getDefaultTokenStore()))
+				tokenStore := NewLRUTokenStore(1, 1)
+				Expect(populateClientConfig(&Config{TokenStore: tokenStore}, false).TokenStore).To(BeIdenticalTo(tokenStore))
+			})
+
 			It("uses 0-byte connection IDs when dialing an address", func() {
 				config := &Config{}
 				c := populateClientConfig(config, true)
@@ -460,19 +511,43 @@ var _ = Describe("Client", func() {
 				Expect(c.Versions).To(Equal(protocol.SupportedVersions))
 				Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 				Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+				Expect(c.MaxPacketSize).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+				streamWindow, connWindow := getInitialReceiveWindows(c)
+				Expect(streamWindow).To(BeEquivalentTo(protocol.InitialMaxStreamData))
+				Expect(connWindow).To(BeEquivalentTo(protocol.InitialMaxData))
+				Expect(c.CongestionControl).To(Equal(CongestionControlBBR))
+				Expect(c.EnableBDPAutoTuning).To(BeFalse())
+				Expect(c.BDPAutoTuningHeadroom).To(Equal(protocol.DefaultBDPAutoTuningHeadroom))
+			})
+
+			It("uses the receive window auto-tuning options", func() {
+				budget := NewReceiveWindowBudget(1 << 20)
+				c := populateClientConfig(&Config{
+					EnableBDPAutoTuning:   true,
+					BDPAutoTuningHeadroom: 1.5,
+					ReceiveWindowBudget:   budget,
+				}, false)
+				Expect(c.EnableBDPAutoTuning).To(BeTrue())
+				Expect(c.BDPAutoTuningHeadroom).To(Equal(1.5))
+				Expect(c.ReceiveWindowBudget).To(BeIdenticalTo(budget))
 			})
 		})
 
 		It("creates new TLS sessions with the right parameters", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(connID, gomock.Any())
-			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
-			config := &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}}
+			config := &Config{
+				Versions:                       []protocol.VersionNumber{protocol.VersionTLS},
+				InitialStreamReceiveWindow:     1 << 20,
+				InitialConnectionReceiveWindow: 3 << 20,
+			}
 			c := make(chan struct{})
 			var cconn connection
 			var version protocol.VersionNumber
 			var conf *Config
+			var tp *handshake.TransportParameters
 			newClientSession = func(
 				connP connection,
 				_ sessionRunner,
@@ -489,6 +564,7 @@ var _ = Describe("Client", func() {
 				cconn = connP
 				version = versionP
 				conf = configP
+				tp = params
 				close(c)
 				// TODO: check connection IDs?
 				sess := NewMockQuicSession(mockCtrl)
@@ -501,6 +577,10 @@ var _ = Describe("Client", func() {
 			Expect(cconn.(*conn).pconn).To(Equal(packetConn))
 			Expect(version).To(Equal(config.Versions[0]))
 			Expect(conf.Versions).To(Equal(config.Versions))
+			Expect(tp.InitialMaxStreamDataBidiLocal).To(Equal(protocol.ByteCount(1 << 20)))
+			Expect(tp.InitialMaxStreamDataBidiRemote).To(Equal(protocol.ByteCount(1 << 20)))
+			Expect(tp.InitialMaxStreamDataUni).To(Equal(protocol.ByteCount(1 << 20)))
+			Expect(tp.InitialMaxData).To(Equal(protocol.ByteCount(3 << 20)))
 		})
 
 		Context("version negotiation", func() {
@@ -518,7 +598,7 @@ var _ = Describe("Client", func() {
 			It("returns an error that occurs during version negotiation", func() {
 				manager := NewMockPacketHandlerManager(mockCtrl)
 				manager.EXPECT().Add(connID, gomock.Any())
-				mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+				mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
 
 				testErr := errors.New("early handshake error")
 				newClientSession = func(
@@ -616,6 +696,24 @@ var _ = Describe("Client", func() {
 				Expect(cl.version).To(Equal(protocol.VersionNumber(1234)))
 			})
 
+			It("falls back to an older draft version, if the server doesn't support the newest one", func() {
+				phm := NewMockPacketHandlerManager(mockCtrl)
+				cl.packetHandlers = phm
+
+				sess := NewMockQuicSession(mockCtrl)
+				destroyed := make(chan struct{})
+				sess.EXPECT().closeForRecreating().Do(func() {
+					close(destroyed)
+				})
+				cl.session = sess
+				cl.version = protocol.VersionDraft29
+				cl.config = &Config{Versions: []protocol.VersionNumber{protocol.VersionDraft29, protocol.VersionDraft23, protocol.VersionTLS}}
+				cl.handlePacket(composeVersionNegotiationPacket(connID, []protocol.VersionNumber{protocol.VersionTLS, protocol.VersionDraft23}))
+				Eventually(destroyed).Should(BeClosed())
+				Expect(cl.version).To(Equal(protocol.VersionDraft23))
+				Expect(cl.initialVersion).To(Equal(protocol.VersionDraft29))
+			})
+
 			It("drops version negotiation packets that contain the offered version", func() {
 				cl.config = &Config{}
 				ver := cl.version
@@ -629,4 +727,86 @@ var _ = Describe("Client", func() {
 		Expect(cl.version).ToNot(BeZero())
 		Expect(cl.GetVersion()).To(Equal(cl.version))
 	})
+
+	Context("migrating to a new net.PacketConn", func() {
+		var (
+			r             *clientRunner
+			oldManager    *MockPacketHandlerManager
+			newManager    *MockPacketHandlerManager
+			newPacketConn *mockPacketConn
+		)
+
+		BeforeEach(func() {
+			cl.config = &Config{ConnectionIDLength: 8}
+			oldManager = NewMockPacketHandlerManager(mockCtrl)
+			newManager = NewMockPacketHandlerManager(mockCtrl)
+			cl.packetHandlers = oldManager
+			r = &clientRunner{
+				runner: runner{packetHandlerManager: oldManager},
+				client: cl,
+			}
+			newPacketConn = newMockPacketConn()
+		})
+
+		It("switches to the new net.PacketConn", func() {
+			mockMultiplexer.EXPECT().AddConn(newPacketConn, 8, gomock.Any(), gomock.Any(), gomock.Any()).Return(newManager, nil)
+			newManager.EXPECT().Add(connID, cl)
+			Expect(r.AddPacketConn(newPacketConn)).To(Succeed())
+			oldManager.EXPECT().Remove(connID)
+			r.SwitchPacketConn(newPacketConn)
+			Expect(r.packetHandlerManager).To(Equal(newManager))
+			Expect(cl.packetHandlers).To(Equal(newManager))
+			// the session is now removed from the new packet handler map
+			newManager.EXPECT().Retire(connID)
+			r.Retire(connID)
+		})
+
+		It("closes the old net.PacketConn, if it was created by the client", func() {
+			cl.createdPacketConn = true
+			mockMultiplexer.EXPECT().AddConn(newPacketConn, 8, gomock.Any(), gomock.Any(), gomock.Any()).Return(newManager, nil)
+			newManager.EXPECT().Add(connID, cl)
+			Expect(r.AddPacketConn(newPacketConn)).To(Succeed())
+			oldManager.EXPECT().Remove(connID)
+			oldManager.EXPECT().Close()
+			r.SwitchPacketConn(newPacketConn)
+			Expect(cl.createdPacketConn).To(BeFalse())
+		})
+
+		It("removes the session from the new net.PacketConn when the migration fails", func() {
+			mockMultiplexer.EXPECT().AddConn(newPacketConn, 8, gomock.Any(), gomock.Any(), gomock.Any()).Return(newManager, nil)
+			newManager.EXPECT().Add(connID, cl)
+			Expect(r.AddPacketConn(newPacketConn)).To(Succeed())
+			newManager.EXPECT().Remove(connID)
+			r.RemovePacketConn(newPacketConn)
+			Expect(r.packetHandlerManager).To(Equal(oldManager))
+		})
+
+		It("moves connection IDs issued after the handshake to the new net.PacketConn", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			issuedConnID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+			oldManager.EXPECT().Add(issuedConnID, sess)
+			r.Add(issuedConnID, sess)
+			mockMultiplexer.EXPECT().AddConn(newPacketConn, 8, gomock.Any(), gomock.Any(), gomock.Any()).Return(newManager, nil)
+			newManager.EXPECT().Add(connID, cl)
+			newManager.EXPECT().Add(issuedConnID, sess)
+			Expect(r.AddPacketConn(newPacketConn)).To(Succeed())
+			// connection IDs issued during the migration are added to both net.PacketConns
+			otherConnID := protocol.ConnectionID{0xc0, 0xff, 0xee}
+			oldManager.EXPECT().Add(otherConnID, sess)
+			newManager.EXPECT().Add(otherConnID, sess)
+			r.Add(otherConnID, sess)
+			oldManager.EXPECT().Remove(connID)
+			oldManager.EXPECT().Remove(issuedConnID)
+			oldManager.EXPECT().Remove(otherConnID)
+			r.SwitchPacketConn(newPacketConn)
+			newManager.EXPECT().Retire(issuedConnID)
+			r.Retire(issuedConnID)
+			Expect(r.connIDs).To(HaveLen(1))
+		})
+
+		It("returns errors from the multiplexer", func() {
+			mockMultiplexer.EXPECT().AddConn(newPacketConn, 8, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("multiplexer error"))
+			Expect(r.AddPacketConn(newPacketConn)).To(MatchError("multiplexer error"))
+		})
+	})
 })
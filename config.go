@@ -0,0 +1,89 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/DrakenLibra/gt-bbr/internal/flowcontrol"
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/utils"
+)
+
+// getInitialReceiveWindows returns the initial stream- and connection-level flow control windows of a populated config.
+// The populated config only contains the initial windows that were set explicitly.
+// If not set, the default values are used, but never more than the maximum windows.
+// This way, the defaults follow the maximum windows when GetConfigForClient overrides them.
+func getInitialReceiveWindows(config *Config) (uint64 /* stream */, uint64 /* connection */) {
+	streamWindow := config.InitialStreamReceiveWindow
+	if streamWindow == 0 {
+		streamWindow = utils.MinUint64(protocol.InitialMaxStreamData, config.MaxReceiveStreamFlowControlWindow)
+	}
+	connWindow := config.InitialConnectionReceiveWindow
+	if connWindow == 0 {
+		connWindow = utils.MinUint64(protocol.InitialMaxData, config.MaxReceiveConnectionFlowControlWindow)
+	}
+	return streamWindow, connWindow
+}
+
+// validateReceiveWindows checks that the explicitly set initial flow control windows don't exceed the maximum windows.
+// It must be called with a populated config.
+func validateReceiveWindows(config *Config) error {
+	if config.InitialStreamReceiveWindow > config.MaxReceiveStreamFlowControlWindow {
+		return fmt.Errorf("quic: InitialStreamReceiveWindow (%d) larger than MaxReceiveStreamFlowControlWindow (%d)", config.InitialStreamReceiveWindow, config.MaxReceiveStreamFlowControlWindow)
+	}
+	if config.InitialConnectionReceiveWindow > config.MaxReceiveConnectionFlowControlWindow {
+		return fmt.Errorf("quic: InitialConnectionReceiveWindow (%d) larger than MaxReceiveConnectionFlowControlWindow (%d)", config.InitialConnectionReceiveWindow, config.MaxReceiveConnectionFlowControlWindow)
+	}
+	return nil
+}
+
+// validateConnectionIDLength checks that the connection IDs can be encoded in the long header of every version used.
+// Zero-length connection IDs are only allowed for clients.
+// It must be called with a populated config.
+func validateConnectionIDLength(config *Config, pers protocol.Perspective) error {
+	l := config.ConnectionIDLength
+	if l == 0 && pers == protocol.PerspectiveClient {
+		return nil
+	}
+	maxLen := protocol.MaxConnIDLen
+	for _, v := range config.Versions {
+		if !v.HasLengthPrefixedConnectionIDs() {
+			maxLen = protocol.MaxConnIDLenCombined
+		}
+	}
+	if l < protocol.MinConnIDLen || l > maxLen {
+		return fmt.Errorf("quic: invalid connection ID length: %d (must be between %d and %d bytes)", l, protocol.MinConnIDLen, maxLen)
+	}
+	return nil
+}
+
+// generateConnectionIDWith generates a connection ID using the ConnectionIDGenerator.
+// It errors if the connection ID doesn't have the length announced by the generator,
+// since the peer wouldn't be able to parse short header packets sent to this connection ID.
+func generateConnectionIDWith(g ConnectionIDGenerator) (protocol.ConnectionID, error) {
+	connID, err := g.GenerateConnectionID()
+	if err != nil {
+		return nil, err
+	}
+	if connID.Len() != g.ConnectionIDLen() {
+		return nil, fmt.Errorf("quic: ConnectionIDGenerator generated a connection ID of length %d, expected %d", connID.Len(), g.ConnectionIDLen())
+	}
+	return connID, nil
+}
+
+// A ReceiveWindowBudget limits the memory used for receiving stream data by multiple sessions.
+// It accounts for the flow control credit granted to the peers, as well as the data buffered by streams,
+// both in order and out of order.
+// It is safe for concurrent use.
+type ReceiveWindowBudget struct {
+	budget *flowcontrol.WindowBudget
+}
+
+// NewReceiveWindowBudget creates a new budget of maxBytes.
+func NewReceiveWindowBudget(maxBytes uint64) *ReceiveWindowBudget {
+	return &ReceiveWindowBudget{budget: flowcontrol.NewWindowBudget(protocol.ByteCount(maxBytes))}
+}
+
+// Used returns the number of bytes currently used by all sessions.
+func (b *ReceiveWindowBudget) Used() uint64 {
+	return uint64(b.budget.Used())
+}
@@ -7,29 +7,89 @@ import (
 
 type connection interface {
 	Write([]byte) error
+	// WritePackets writes multiple packets.
+	// On Linux, they are sent using a single system call, if possible.
+	WritePackets([][]byte) error
 	Read([]byte) (int, net.Addr, error)
 	Close() error
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	SetCurrentRemoteAddr(net.Addr)
+	// SetPacketConn replaces the underlying net.PacketConn, and returns the previous one.
+	// It is used when a client migrates to a new local address.
+	SetPacketConn(net.PacketConn) net.PacketConn
+}
+
+// packetInfo is the local address and interface that a packet was received on.
+// It is only available on Linux, for connections bound to an unspecified address (e.g. 0.0.0.0).
+type packetInfo struct {
+	addr    net.IP
+	ifIndex uint32
 }
 
 type conn struct {
 	mutex sync.RWMutex
 
 	pconn       net.PacketConn
+	batchConn   *batchConn // nil if the pconn doesn't support batched writes
 	currentAddr net.Addr
+
+	// If the connection is bound to an unspecified address,
+	// packets are sent from the local address that the first packet was received on.
+	localInfo packetInfo
+	oob       []byte
 }
 
 var _ connection = &conn{}
 
+func newConn(pconn net.PacketConn, remoteAddr net.Addr, info packetInfo) *conn {
+	return &conn{
+		pconn:       pconn,
+		batchConn:   newBatchConn(pconn),
+		currentAddr: remoteAddr,
+		localInfo:   info,
+		oob:         info.OOB(),
+	}
+}
+
 func (c *conn) Write(p []byte) error {
-	_, err := c.pconn.WriteTo(p, c.currentAddr)
-	return err
+	c.mutex.RLock()
+	pconn := c.pconn
+	addr := c.currentAddr
+	oob := c.oob
+	c.mutex.RUnlock()
+	return writePacket(pconn, p, addr, oob)
+}
+
+// WritePackets writes the packets to the current remote address.
+// Packets that exceed the MTU of the interface are dropped.
+// In that case, the error is returned after all other packets were written.
+func (c *conn) WritePackets(packets [][]byte) error {
+	c.mutex.RLock()
+	pconn := c.pconn
+	batchConn := c.batchConn
+	addr := c.currentAddr
+	oob := c.oob
+	c.mutex.RUnlock()
+	if batchConn != nil && len(packets) > 1 {
+		return batchConn.WritePackets(packets, addr, oob)
+	}
+	var msgSizeErr error
+	for _, p := range packets {
+		if err := writePacket(pconn, p, addr, oob); err != nil {
+			if !isMsgSizeErr(err) {
+				return err
+			}
+			if msgSizeErr == nil {
+				msgSizeErr = err
+			}
+		}
+	}
+	return msgSizeErr
 }
 
 func (c *conn) Read(p []byte) (int, net.Addr, error) {
-	return c.pconn.ReadFrom(p)
+	return c.packetConn().ReadFrom(p)
 }
 
 func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
@@ -38,8 +98,41 @@ func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
 	c.mutex.Unlock()
 }
 
+func (c *conn) SetPacketConn(pconn net.PacketConn) net.PacketConn {
+	batchConn := newBatchConn(pconn)
+	c.mutex.Lock()
+	old := c.pconn
+	c.pconn = pconn
+	c.batchConn = batchConn
+	c.localInfo = packetInfo{}
+	c.oob = nil
+	c.mutex.Unlock()
+	return old
+}
+
+func (c *conn) packetConn() net.PacketConn {
+	c.mutex.RLock()
+	pconn := c.pconn
+	c.mutex.RUnlock()
+	return pconn
+}
+
+// LocalAddr returns the local address.
+// If the connection is bound to an unspecified address, it returns the address that packets are sent from.
 func (c *conn) LocalAddr() net.Addr {
-	return c.pconn.LocalAddr()
+	c.mutex.RLock()
+	pconn := c.pconn
+	info := c.localInfo
+	c.mutex.RUnlock()
+	addr := pconn.LocalAddr()
+	if info.addr == nil {
+		return addr
+	}
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return addr
+	}
+	return &net.UDPAddr{IP: info.addr, Port: udpAddr.Port}
 }
 
 func (c *conn) RemoteAddr() net.Addr {
@@ -50,5 +143,20 @@ func (c *conn) RemoteAddr() net.Addr {
 }
 
 func (c *conn) Close() error {
-	return c.pconn.Close()
+	return c.packetConn().Close()
+}
+
+// writePacket writes a packet to addr.
+// The oob contains the control message selecting the local address the packet is sent from.
+func writePacket(pconn net.PacketConn, p []byte, addr net.Addr, oob []byte) error {
+	if len(oob) > 0 {
+		udpConn, ok := pconn.(*net.UDPConn)
+		udpAddr, isUDPAddr := addr.(*net.UDPAddr)
+		if ok && isUDPAddr {
+			_, _, err := udpConn.WriteMsgUDP(p, oob, udpAddr)
+			return err
+		}
+	}
+	_, err := pconn.WriteTo(p, addr)
+	return err
 }
@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+package quic
+
+import (
+	"net"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+)
+
+// batchConn is only implemented on Linux.
+// On other platforms, packets are read and written one by one.
+type batchConn struct{}
+
+func newBatchConn(net.PacketConn) *batchConn { return nil }
+
+func (*batchConn) ReadPackets(protocol.ByteCount, func(net.Addr, packetInfo, *packetBuffer, []byte)) error {
+	panic("batchConn not supported")
+}
+
+func (*batchConn) WritePackets([][]byte, net.Addr, []byte) error {
+	panic("batchConn not supported")
+}
+
+// OOB is only implemented on Linux.
+// On other platforms, the local address of received packets is not known.
+func (packetInfo) OOB() []byte { return nil }
@@ -0,0 +1,262 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// UDP socket options that are not defined in the syscall package.
+const (
+	udpSegment = 103 // UDP_SEGMENT, used for GSO
+	udpGRO     = 104 // UDP_GRO
+)
+
+// groBufferSize is the size of the buffers used for reading when GRO is enabled.
+// The kernel coalesces packets into datagrams of up to 64 KB.
+const groBufferSize = 1 << 16
+
+// controlMessageBufferSize is the size of the buffer used for receiving control messages.
+// It is large enough to hold the GRO segment size and the packet info.
+const controlMessageBufferSize = 128
+
+// maxGSODatagramSize is the maximum size of a datagram that is split into packets by GSO.
+// It is the largest UDP payload that fits into an IPv4 packet.
+const maxGSODatagramSize = 65507
+
+// A batchPacketConn reads and writes multiple packets using a single system call.
+// It is implemented by ipv4.PacketConn and ipv6.PacketConn, which use recvmmsg and sendmmsg.
+type batchPacketConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// The batchConn reads and writes packets in batches, reducing the number of system calls.
+// If supported by the kernel, it uses UDP generic segmentation offload (GSO) and generic receive offload (GRO):
+// When sending, packets of equal size are passed to the kernel as a single datagram,
+// which is then split into packets by the kernel (or by the NIC).
+// When receiving, the kernel coalesces packets belonging to the same flow,
+// which are then split into the original packets by the batchConn.
+// If the connection is bound to an unspecified address, it reports the local address packets were received on.
+// The reading and the writing side must each only be used from a single goroutine.
+type batchConn struct {
+	conn batchPacketConn
+
+	pktinfo     bool
+	gro         bool
+	readMsgs    []ipv4.Message
+	readBuffers []*packetBuffer // only used if GRO is disabled
+	groBuffers  [][]byte        // only used if GRO is enabled
+
+	gso       bool
+	writeMsgs []ipv4.Message
+	writeOOB  []byte
+}
+
+// newBatchConn creates a new batchConn.
+// It returns nil if the connection is not a UDP connection.
+func newBatchConn(c net.PacketConn) *batchConn {
+	udpConn, ok := c.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+	rawConn, err := udpConn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	bc := &batchConn{}
+	if err := rawConn.Control(func(fd uintptr) {
+		// GRO is supported since Linux 5.0.
+		bc.gro = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpGRO, 1) == nil
+		// GSO is supported since Linux 4.18.
+		// Reading the socket option fails on older kernels.
+		_, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_UDP, udpSegment)
+		bc.gso = err == nil
+	}); err != nil {
+		return nil
+	}
+	bc.pktinfo = enablePacketInfo(udpConn, rawConn)
+	if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() != nil {
+		bc.conn = ipv4.NewPacketConn(udpConn)
+	} else {
+		bc.conn = ipv6.NewPacketConn(udpConn)
+	}
+	return bc
+}
+
+// ReadPackets reads a batch of packets, and calls handle for every packet.
+// The packet buffer is passed to handle, which is responsible for releasing it.
+// Packets larger than maxPacketSize are truncated.
+func (c *batchConn) ReadPackets(maxPacketSize protocol.ByteCount, handle func(net.Addr, packetInfo, *packetBuffer, []byte)) error {
+	if c.readMsgs == nil {
+		c.readMsgs = make([]ipv4.Message, protocol.PacketBatchSize)
+		if c.gro {
+			c.groBuffers = make([][]byte, protocol.PacketBatchSize)
+		} else {
+			c.readBuffers = make([]*packetBuffer, protocol.PacketBatchSize)
+		}
+		for i := range c.readMsgs {
+			c.readMsgs[i].Buffers = make([][]byte, 1)
+			c.readMsgs[i].OOB = make([]byte, controlMessageBufferSize)
+			if c.gro {
+				c.groBuffers[i] = make([]byte, groBufferSize)
+			}
+		}
+	}
+	for i := range c.readMsgs {
+		msg := &c.readMsgs[i]
+		if c.gro {
+			msg.Buffers[0] = c.groBuffers[i]
+		} else {
+			if c.readBuffers[i] == nil {
+				c.readBuffers[i] = getPacketBufferForSize(maxPacketSize)
+			}
+			// The packet size should not exceed the max packet size we advertised.
+			// If it does, we only read a truncated packet, which will then end up undecryptable
+			msg.Buffers[0] = c.readBuffers[i].Slice[:maxPacketSize]
+		}
+		msg.OOB = msg.OOB[:cap(msg.OOB)]
+	}
+	n, err := c.conn.ReadBatch(c.readMsgs, 0)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		msg := &c.readMsgs[i]
+		var segmentSize int
+		var info packetInfo
+		if msg.NN > 0 {
+			segmentSize, info = parseControlMessages(msg.OOB[:msg.NN])
+		}
+		if !c.gro {
+			buffer := c.readBuffers[i]
+			c.readBuffers[i] = nil
+			handle(msg.Addr, info, buffer, buffer.Slice[:msg.N])
+			continue
+		}
+		data := msg.Buffers[0][:msg.N]
+		if segmentSize == 0 { // the datagram contains a single packet
+			segmentSize = len(data)
+		}
+		for len(data) > 0 {
+			size := segmentSize
+			if size > len(data) {
+				size = len(data)
+			}
+			buffer := getPacketBufferForSize(maxPacketSize)
+			l := copy(buffer.Slice[:maxPacketSize], data[:size])
+			handle(msg.Addr, info, buffer, buffer.Slice[:l])
+			data = data[size:]
+		}
+	}
+	return nil
+}
+
+// WritePackets sends packets to addr.
+// The oob is sent with every datagram, it is used to select the local address.
+// If GSO is supported, consecutive packets of equal size are sent as a single datagram.
+// Packets that exceed the MTU of the interface are dropped.
+// In that case, the error is returned after all other packets were sent.
+func (c *batchConn) WritePackets(packets [][]byte, addr net.Addr, oob []byte) error {
+	c.writeMsgs = c.writeMsgs[:0]
+	c.writeOOB = c.writeOOB[:0]
+	for len(packets) > 0 {
+		n := 1
+		if c.gso {
+			n = gsoSegments(packets)
+		}
+		start := len(c.writeOOB)
+		c.writeOOB = append(c.writeOOB, oob...)
+		if n > 1 {
+			c.writeOOB = appendUDPSegmentSizeMsg(c.writeOOB, len(packets[0]))
+		}
+		msg := ipv4.Message{Buffers: packets[:n], Addr: addr, OOB: c.writeOOB[start:]}
+		c.writeMsgs = append(c.writeMsgs, msg)
+		packets = packets[n:]
+	}
+
+	var msgSizeErr error
+	msgs := c.writeMsgs
+	for len(msgs) > 0 {
+		n, err := c.conn.WriteBatch(msgs, 0)
+		if n > 0 {
+			msgs = msgs[n:]
+		}
+		if err == nil {
+			continue
+		}
+		if isMsgSizeErr(err) {
+			if msgSizeErr == nil {
+				msgSizeErr = err
+			}
+			msgs = msgs[1:]
+			continue
+		}
+		if len(msgs[0].Buffers) > 1 && isGSOError(err) {
+			// The NIC doesn't support GSO. Send the remaining packets one by one.
+			c.gso = false
+			var remaining [][]byte
+			for _, msg := range msgs {
+				remaining = append(remaining, msg.Buffers...)
+			}
+			if err := c.WritePackets(remaining, addr, oob); err != nil && !isMsgSizeErr(err) {
+				return err
+			}
+			break
+		}
+		return err
+	}
+	return msgSizeErr
+}
+
+// gsoSegments returns the number of packets at the beginning of packets that can be sent as a single GSO datagram.
+// All packets need to have the same size, except for the last one, which may be smaller.
+func gsoSegments(packets [][]byte) int {
+	size := len(packets[0])
+	total := size
+	n := 1
+	for n < len(packets) && n < protocol.MaxGSOSegments {
+		l := len(packets[n])
+		if l > size || total+l > maxGSODatagramSize {
+			break
+		}
+		total += l
+		n++
+		if l < size {
+			break
+		}
+	}
+	return n
+}
+
+// appendUDPSegmentSizeMsg appends a control message setting the GSO segment size.
+func appendUDPSegmentSizeMsg(b []byte, size int) []byte {
+	const dataLen = 2 // the segment size is an uint16
+	start := len(b)
+	b = append(b, make([]byte, syscall.CmsgSpace(dataLen))...)
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[start]))
+	h.Level = syscall.IPPROTO_UDP
+	h.Type = udpSegment
+	h.SetLen(syscall.CmsgLen(dataLen))
+	*(*uint16)(unsafe.Pointer(&b[start+syscall.CmsgLen(0)])) = uint16(size)
+	return b
+}
+
+// isGSOError checks if an error was caused by the NIC not supporting GSO.
+func isGSOError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EIO
+}
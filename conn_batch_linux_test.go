@@ -0,0 +1,212 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"golang.org/x/net/ipv4"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockBatchPacketConn struct {
+	writeErrs []error
+	written   []ipv4.Message
+}
+
+var _ batchPacketConn = &mockBatchPacketConn{}
+
+func (c *mockBatchPacketConn) ReadBatch([]ipv4.Message, int) (int, error) {
+	panic("not implemented")
+}
+
+// WriteBatch writes one message per call, returning the next error first.
+func (c *mockBatchPacketConn) WriteBatch(ms []ipv4.Message, _ int) (int, error) {
+	if len(c.writeErrs) > 0 {
+		err := c.writeErrs[0]
+		c.writeErrs = c.writeErrs[1:]
+		if err != nil {
+			return -1, err
+		}
+	}
+	msg := ms[0]
+	msg.Buffers = append([][]byte{}, msg.Buffers...)
+	c.written = append(c.written, msg)
+	return 1, nil
+}
+
+var _ = Describe("Batch Conn", func() {
+	packets := func(sizes ...int) [][]byte {
+		p := make([][]byte, len(sizes))
+		for i, s := range sizes {
+			p[i] = bytes.Repeat([]byte{byte(i)}, s)
+		}
+		return p
+	}
+
+	It("is only used for UDP connections", func() {
+		Expect(newBatchConn(newMockPacketConn())).To(BeNil())
+	})
+
+	Context("using a UDP connection", func() {
+		var server, client *net.UDPConn
+
+		BeforeEach(func() {
+			var err error
+			server, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			client, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			server.Close()
+			client.Close()
+		})
+
+		// readPackets reads packets until num packets were received
+		readPackets := func(bc *batchConn, num int) [][]byte {
+			var received [][]byte
+			for len(received) < num {
+				ExpectWithOffset(1, bc.ReadPackets(protocol.MaxReceivePacketSize, func(addr net.Addr, _ packetInfo, buffer *packetBuffer, data []byte) {
+					ExpectWithOffset(3, addr.String()).To(Equal(client.LocalAddr().String()))
+					received = append(received, append([]byte{}, data...))
+					buffer.Release()
+				})).To(Succeed())
+			}
+			return received
+		}
+
+		It("reads a batch of packets", func() {
+			bc := newBatchConn(server)
+			Expect(bc).ToNot(BeNil())
+			for i := 0; i < 3; i++ {
+				_, err := client.WriteTo(bytes.Repeat([]byte{byte(i)}, 100+i), server.LocalAddr())
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(readPackets(bc, 3)).To(Equal(packets(100, 101, 102)))
+		})
+
+		It("truncates packets larger than the max packet size", func() {
+			bc := newBatchConn(server)
+			_, err := client.WriteTo(make([]byte, protocol.MaxReceivePacketSize+100), server.LocalAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(readPackets(bc, 1)[0]).To(HaveLen(int(protocol.MaxReceivePacketSize)))
+		})
+
+		It("writes a batch of packets", func() {
+			sender := newBatchConn(client)
+			sender.gso = false
+			p := packets(100, 200, 300)
+			Expect(sender.WritePackets(p, server.LocalAddr(), nil)).To(Succeed())
+			Expect(readPackets(newBatchConn(server), 3)).To(Equal(p))
+		})
+
+		It("splits packets coalesced by GSO and GRO", func() {
+			sender := newBatchConn(client)
+			if !sender.gso {
+				Skip("GSO not supported")
+			}
+			receiver := newBatchConn(server)
+			p := packets(1000, 1000, 1000, 500, 1200)
+			Expect(sender.WritePackets(p, server.LocalAddr(), nil)).To(Succeed())
+			Expect(readPackets(receiver, 5)).To(Equal(p))
+		})
+
+		It("returns the error when the connection is closed", func() {
+			bc := newBatchConn(server)
+			errChan := make(chan error)
+			go func() {
+				errChan <- bc.ReadPackets(protocol.MaxReceivePacketSize, func(net.Addr, packetInfo, *packetBuffer, []byte) {})
+			}()
+			time.Sleep(10 * time.Millisecond)
+			Expect(server.Close()).To(Succeed())
+			Eventually(errChan).Should(Receive(HaveOccurred()))
+		})
+	})
+
+	Context("coalescing packets using GSO", func() {
+		It("coalesces packets of equal size", func() {
+			Expect(gsoSegments(packets(1000, 1000, 1000))).To(Equal(3))
+		})
+
+		It("ends a datagram with a smaller packet", func() {
+			Expect(gsoSegments(packets(1000, 1000, 500, 1000))).To(Equal(3))
+		})
+
+		It("doesn't coalesce larger packets", func() {
+			Expect(gsoSegments(packets(1000, 1200))).To(Equal(1))
+		})
+
+		It("limits the number of segments", func() {
+			sizes := make([]int, protocol.MaxGSOSegments+10)
+			for i := range sizes {
+				sizes[i] = 10
+			}
+			Expect(gsoSegments(packets(sizes...))).To(Equal(protocol.MaxGSOSegments))
+		})
+
+		It("limits the size of the datagram", func() {
+			sizes := make([]int, protocol.MaxGSOSegments)
+			for i := range sizes {
+				sizes[i] = 1452
+			}
+			Expect(gsoSegments(packets(sizes...))).To(Equal(maxGSODatagramSize / 1452))
+		})
+
+		It("sets the segment size", func() {
+			conn := &mockBatchPacketConn{}
+			bc := &batchConn{conn: conn, gso: true}
+			p := packets(1000, 1000, 500)
+			Expect(bc.WritePackets(p, &net.UDPAddr{}, nil)).To(Succeed())
+			Expect(conn.written).To(HaveLen(1))
+			Expect(conn.written[0].Buffers).To(Equal(p))
+			msgs, err := syscall.ParseSocketControlMessage(conn.written[0].OOB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(msgs).To(HaveLen(1))
+			Expect(msgs[0].Header.Level).To(BeEquivalentTo(syscall.IPPROTO_UDP))
+			Expect(msgs[0].Header.Type).To(BeEquivalentTo(udpSegment))
+		})
+
+		It("disables GSO if the NIC doesn't support it", func() {
+			conn := &mockBatchPacketConn{writeErrs: []error{
+				&net.OpError{Op: "write", Err: os.NewSyscallError("sendmmsg", syscall.EIO)},
+			}}
+			bc := &batchConn{conn: conn, gso: true}
+			p := packets(1000, 1000, 500)
+			Expect(bc.WritePackets(p, &net.UDPAddr{}, nil)).To(Succeed())
+			Expect(bc.gso).To(BeFalse())
+			Expect(conn.written).To(HaveLen(3))
+			for i, msg := range conn.written {
+				Expect(msg.Buffers).To(Equal(p[i : i+1]))
+				Expect(msg.OOB).To(BeEmpty())
+			}
+		})
+	})
+
+	It("continues sending if a packet exceeds the MTU", func() {
+		msgSizeErr := &net.OpError{Op: "write", Err: os.NewSyscallError("sendmmsg", syscall.EMSGSIZE)}
+		conn := &mockBatchPacketConn{writeErrs: []error{nil, msgSizeErr}}
+		bc := &batchConn{conn: conn}
+		p := packets(100, 200, 300)
+		Expect(bc.WritePackets(p, &net.UDPAddr{}, nil)).To(MatchError(msgSizeErr))
+		Expect(conn.written).To(HaveLen(2))
+		Expect(conn.written[0].Buffers).To(Equal(p[:1]))
+		Expect(conn.written[1].Buffers).To(Equal(p[2:]))
+	})
+
+	It("returns other errors", func() {
+		conn := &mockBatchPacketConn{writeErrs: []error{errors.New("test error")}}
+		bc := &batchConn{conn: conn}
+		Expect(bc.WritePackets(packets(100, 200), &net.UDPAddr{}, nil)).To(MatchError("test error"))
+	})
+})
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package quic
+
+import "net"
+
+// setDF is only implemented on Linux.
+// On other platforms, path MTU discovery still works,
+// but probe packets might be fragmented by the operating system.
+func setDF(net.PacketConn) error {
+	return nil
+}
+
+func isMsgSizeErr(error) bool {
+	return false
+}
@@ -0,0 +1,49 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// setDF sets the Don't Fragment bit on packets sent on the connection.
+// This is required for path MTU discovery: if packets were fragmented,
+// probe packets would be delivered even if they exceed the path MTU.
+func setDF(c net.PacketConn) error {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return errors.New("connection doesn't allow setting socket options")
+	}
+	rawConn, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errDFIPv4, errDFIPv6 error
+	if err := rawConn.Control(func(fd uintptr) {
+		errDFIPv4 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+		errDFIPv6 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+	}); err != nil {
+		return err
+	}
+	// Only one of the options can be set, depending on the address family of the socket.
+	// Dual-stack sockets accept both.
+	if errDFIPv4 != nil && errDFIPv6 != nil {
+		return errDFIPv4
+	}
+	return nil
+}
+
+// isMsgSizeErr checks if an error was caused by a packet exceeding the MTU of the local interface.
+func isMsgSizeErr(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		err = opErr.Err
+	}
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.EMSGSIZE
+}
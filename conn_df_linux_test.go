@@ -0,0 +1,81 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Don't Fragment bit", func() {
+	It("sets the DF bit on a UDP connection", func() {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		Expect(setDF(conn)).To(Succeed())
+	})
+
+	Context("adding connections to the multiplexer", func() {
+		getMTUDiscover := func(conn *net.UDPConn) int {
+			rawConn, err := conn.SyscallConn()
+			Expect(err).ToNot(HaveOccurred())
+			var val int
+			var sockErr error
+			Expect(rawConn.Control(func(fd uintptr) {
+				val, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER)
+			})).To(Succeed())
+			Expect(sockErr).ToNot(HaveOccurred())
+			return val
+		}
+
+		It("sets the DF bit if path MTU discovery is enabled", func() {
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			_, err = getMultiplexer().AddConn(conn, 8, nil, protocol.MaxReceivePacketSize, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getMTUDiscover(conn)).To(Equal(syscall.IP_PMTUDISC_DO))
+		})
+
+		It("doesn't modify the connection if path MTU discovery is disabled", func() {
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			before := getMTUDiscover(conn)
+			Expect(before).ToNot(Equal(syscall.IP_PMTUDISC_DO))
+			_, err = getMultiplexer().AddConn(conn, 8, nil, protocol.MaxReceivePacketSize, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getMTUDiscover(conn)).To(Equal(before))
+		})
+
+		It("sets the DF bit when path MTU discovery is enabled for a connection that was already added", func() {
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			_, err = getMultiplexer().AddConn(conn, 8, nil, protocol.MaxReceivePacketSize, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getMTUDiscover(conn)).ToNot(Equal(syscall.IP_PMTUDISC_DO))
+			_, err = getMultiplexer().AddConn(conn, 8, nil, protocol.MaxReceivePacketSize, true)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getMTUDiscover(conn)).To(Equal(syscall.IP_PMTUDISC_DO))
+		})
+	})
+
+	It("errors if the connection doesn't allow setting socket options", func() {
+		Expect(setDF(newMockPacketConn())).To(MatchError("connection doesn't allow setting socket options"))
+	})
+
+	It("detects EMSGSIZE errors", func() {
+		Expect(isMsgSizeErr(&net.OpError{Op: "write", Err: os.NewSyscallError("sendto", syscall.EMSGSIZE)})).To(BeTrue())
+		Expect(isMsgSizeErr(&net.OpError{Op: "write", Err: os.NewSyscallError("sendto", syscall.ECONNREFUSED)})).To(BeFalse())
+		Expect(isMsgSizeErr(errors.New("foobar"))).To(BeFalse())
+	})
+})
@@ -0,0 +1,102 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/qerr"
+	"github.com/DrakenLibra/gt-bbr/internal/utils"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+)
+
+// The connIDGenerator issues new connection IDs to the peer (using NEW_CONNECTION_ID frames),
+// and handles the retirement of these connection IDs (RETIRE_CONNECTION_ID frames).
+type connIDGenerator struct {
+	generator  ConnectionIDGenerator
+	highestSeq uint64
+
+	activeSrcConnIDs map[uint64]protocol.ConnectionID
+
+	addConnectionID    func(protocol.ConnectionID) [16]byte
+	retireConnectionID func(protocol.ConnectionID)
+	queueControlFrame  func(wire.Frame)
+}
+
+func newConnIDGenerator(
+	initialConnectionID protocol.ConnectionID,
+	generator ConnectionIDGenerator,
+	addConnectionID func(protocol.ConnectionID) [16]byte,
+	retireConnectionID func(protocol.ConnectionID),
+	queueControlFrame func(wire.Frame),
+) *connIDGenerator {
+	m := &connIDGenerator{
+		generator:          generator,
+		activeSrcConnIDs:   make(map[uint64]protocol.ConnectionID),
+		addConnectionID:    addConnectionID,
+		retireConnectionID: retireConnectionID,
+		queueControlFrame:  queueControlFrame,
+	}
+	m.activeSrcConnIDs[0] = initialConnectionID
+	return m
+}
+
+// SetMaxActiveConnIDs is called when the peer's active_connection_id_limit is received.
+// It issues new connection IDs, up to this limit.
+func (m *connIDGenerator) SetMaxActiveConnIDs(limit uint64) error {
+	// If we're using zero-length connection IDs, there's nothing to issue.
+	if m.generator.ConnectionIDLen() == 0 {
+		return nil
+	}
+	// The limit includes the connection ID used during the handshake.
+	for i := uint64(1); i < utils.MinUint64(limit, protocol.MaxIssuedConnectionIDs); i++ {
+		if err := m.issueNewConnID(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Retire handles a RETIRE_CONNECTION_ID frame.
+// A new connection ID is issued for every connection ID that is retired.
+func (m *connIDGenerator) Retire(seq uint64, sentWithDestConnID protocol.ConnectionID) error {
+	if seq > m.highestSeq {
+		return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("tried to retire connection ID %d. Highest issued: %d", seq, m.highestSeq))
+	}
+	connID, ok := m.activeSrcConnIDs[seq]
+	// We might already have deleted this connection ID, if this is a duplicate frame.
+	if !ok {
+		return nil
+	}
+	if connID.Equal(sentWithDestConnID) {
+		return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("tried to retire connection ID %d (%s), which was used as the Destination Connection ID on this packet", seq, connID))
+	}
+	m.retireConnectionID(connID)
+	delete(m.activeSrcConnIDs, seq)
+	return m.issueNewConnID()
+}
+
+func (m *connIDGenerator) issueNewConnID() error {
+	connID, err := generateConnectionIDWith(m.generator)
+	if err != nil {
+		return err
+	}
+	m.highestSeq++
+	m.activeSrcConnIDs[m.highestSeq] = connID
+	m.queueControlFrame(&wire.NewConnectionIDFrame{
+		SequenceNumber:      m.highestSeq,
+		ConnectionID:        connID,
+		StatelessResetToken: m.addConnectionID(connID),
+	})
+	return nil
+}
+
+// RetireAll retires all connection IDs that were issued after the handshake.
+// It is called when the session is closed.
+func (m *connIDGenerator) RetireAll() {
+	for seq, connID := range m.activeSrcConnIDs {
+		if seq == 0 {
+			continue
+		}
+		m.retireConnectionID(connID)
+	}
+}
@@ -0,0 +1,133 @@
+package quic
+
+import (
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/qerr"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A connIDGeneratorWithWrongLen generates connection IDs that are one byte longer than announced.
+type connIDGeneratorWithWrongLen struct {
+	protocol.DefaultConnectionIDGenerator
+}
+
+func (g *connIDGeneratorWithWrongLen) ConnectionIDLen() int { return g.ConnLen - 1 }
+
+var _ = Describe("Connection ID Generator", func() {
+	var (
+		addedConnIDs   []protocol.ConnectionID
+		retiredConnIDs []protocol.ConnectionID
+		queuedFrames   []wire.Frame
+		g              *connIDGenerator
+	)
+	initialConnID := protocol.ConnectionID{1, 1, 1, 1}
+
+	connIDToToken := func(c protocol.ConnectionID) [16]byte {
+		return [16]byte{c[0], c[1], c[2], c[3]}
+	}
+
+	BeforeEach(func() {
+		addedConnIDs = nil
+		retiredConnIDs = nil
+		queuedFrames = nil
+		g = newConnIDGenerator(
+			initialConnID,
+			&protocol.DefaultConnectionIDGenerator{ConnLen: initialConnID.Len()},
+			func(c protocol.ConnectionID) [16]byte {
+				addedConnIDs = append(addedConnIDs, c)
+				return connIDToToken(c)
+			},
+			func(c protocol.ConnectionID) { retiredConnIDs = append(retiredConnIDs, c) },
+			func(f wire.Frame) { queuedFrames = append(queuedFrames, f) },
+		)
+	})
+
+	It("issues new connection IDs", func() {
+		Expect(g.SetMaxActiveConnIDs(4)).To(Succeed())
+		Expect(addedConnIDs).To(HaveLen(3))
+		Expect(queuedFrames).To(HaveLen(3))
+		for i, f := range queuedFrames {
+			Expect(f).To(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+			nf := f.(*wire.NewConnectionIDFrame)
+			Expect(nf.SequenceNumber).To(BeEquivalentTo(i + 1))
+			Expect(nf.ConnectionID.Len()).To(Equal(4))
+			Expect(nf.ConnectionID).To(Equal(addedConnIDs[i]))
+			Expect(nf.StatelessResetToken).To(Equal(connIDToToken(nf.ConnectionID)))
+		}
+	})
+
+	It("uses the ConnectionIDGenerator", func() {
+		g.generator = &protocol.DefaultConnectionIDGenerator{ConnLen: 7}
+		Expect(g.SetMaxActiveConnIDs(2)).To(Succeed())
+		Expect(addedConnIDs).To(HaveLen(1))
+		Expect(addedConnIDs[0].Len()).To(Equal(7))
+	})
+
+	It("errors if a generated connection ID doesn't have the length announced by the ConnectionIDGenerator", func() {
+		g.generator = &connIDGeneratorWithWrongLen{protocol.DefaultConnectionIDGenerator{ConnLen: 8}}
+		Expect(g.SetMaxActiveConnIDs(2)).To(MatchError("quic: ConnectionIDGenerator generated a connection ID of length 8, expected 7"))
+		Expect(addedConnIDs).To(BeEmpty())
+	})
+
+	It("limits the number of connection IDs that it issues", func() {
+		Expect(g.SetMaxActiveConnIDs(9999999)).To(Succeed())
+		Expect(addedConnIDs).To(HaveLen(protocol.MaxIssuedConnectionIDs - 1))
+	})
+
+	It("doesn't issue connection IDs if the peer doesn't support them", func() {
+		Expect(g.SetMaxActiveConnIDs(0)).To(Succeed())
+		Expect(addedConnIDs).To(BeEmpty())
+	})
+
+	It("doesn't issue connection IDs when using zero-length connection IDs", func() {
+		g.generator = &protocol.DefaultConnectionIDGenerator{ConnLen: 0}
+		Expect(g.SetMaxActiveConnIDs(4)).To(Succeed())
+		Expect(addedConnIDs).To(BeEmpty())
+	})
+
+	It("errors if the peer tries to retire a connection ID that wasn't yet issued", func() {
+		Expect(g.Retire(1, protocol.ConnectionID{})).To(MatchError(qerr.Error(qerr.ProtocolViolation, "tried to retire connection ID 1. Highest issued: 0")))
+	})
+
+	It("errors if the peer tries to retire a connection ID in a packet with that connection ID", func() {
+		Expect(g.SetMaxActiveConnIDs(4)).To(Succeed())
+		Expect(queuedFrames).ToNot(BeEmpty())
+		f := queuedFrames[0].(*wire.NewConnectionIDFrame)
+		err := g.Retire(f.SequenceNumber, f.ConnectionID)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("was used as the Destination Connection ID on this packet"))
+	})
+
+	It("issues new connection IDs, when old ones are retired", func() {
+		Expect(g.SetMaxActiveConnIDs(4)).To(Succeed())
+		queuedFrames = nil
+		Expect(g.Retire(3, protocol.ConnectionID{})).To(Succeed())
+		Expect(retiredConnIDs).To(Equal([]protocol.ConnectionID{addedConnIDs[2]}))
+		Expect(queuedFrames).To(HaveLen(1))
+		Expect(queuedFrames[0].(*wire.NewConnectionIDFrame).SequenceNumber).To(BeEquivalentTo(4))
+	})
+
+	It("retires the initial connection ID", func() {
+		Expect(g.Retire(0, protocol.ConnectionID{})).To(Succeed())
+		Expect(retiredConnIDs).To(Equal([]protocol.ConnectionID{initialConnID}))
+		Expect(queuedFrames).To(HaveLen(1))
+	})
+
+	It("ignores duplicate RETIRE_CONNECTION_ID frames", func() {
+		Expect(g.SetMaxActiveConnIDs(4)).To(Succeed())
+		queuedFrames = nil
+		Expect(g.Retire(2, protocol.ConnectionID{})).To(Succeed())
+		Expect(g.Retire(2, protocol.ConnectionID{})).To(Succeed())
+		Expect(retiredConnIDs).To(HaveLen(1))
+		Expect(queuedFrames).To(HaveLen(1))
+	})
+
+	It("retires all issued connection IDs when the session is closed", func() {
+		Expect(g.SetMaxActiveConnIDs(4)).To(Succeed())
+		g.RetireAll()
+		Expect(retiredConnIDs).To(ConsistOf(addedConnIDs[0], addedConnIDs[1], addedConnIDs[2]))
+	})
+})
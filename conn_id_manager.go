@@ -0,0 +1,191 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/qerr"
+	"github.com/DrakenLibra/gt-bbr/internal/utils"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+)
+
+type newConnID struct {
+	SequenceNumber      uint64
+	ConnectionID        protocol.ConnectionID
+	StatelessResetToken [16]byte
+}
+
+// The connIDManager manages the connection IDs issued by the peer.
+// The stateless reset tokens of all connection IDs that were not retired yet are registered,
+// since the peer might send a stateless reset using any of them.
+type connIDManager struct {
+	queue []newConnID // sorted by sequence number
+
+	activeSequenceNumber      uint64
+	highestRetired            uint64
+	activeConnectionID        protocol.ConnectionID
+	activeStatelessResetToken *[16]byte
+
+	addStatelessResetToken    func([16]byte)
+	removeStatelessResetToken func([16]byte)
+	changeConnectionID        func(protocol.ConnectionID)
+	queueControlFrame         func(wire.Frame)
+}
+
+func newConnIDManager(
+	initialDestConnID protocol.ConnectionID,
+	addStatelessResetToken func([16]byte),
+	removeStatelessResetToken func([16]byte),
+	changeConnectionID func(protocol.ConnectionID),
+	queueControlFrame func(wire.Frame),
+) *connIDManager {
+	return &connIDManager{
+		activeConnectionID:        initialDestConnID,
+		addStatelessResetToken:    addStatelessResetToken,
+		removeStatelessResetToken: removeStatelessResetToken,
+		changeConnectionID:        changeConnectionID,
+		queueControlFrame:         queueControlFrame,
+	}
+}
+
+// Add handles a NEW_CONNECTION_ID frame.
+func (h *connIDManager) Add(f *wire.NewConnectionIDFrame) error {
+	if h.activeConnectionID.Len() == 0 {
+		return qerr.Error(qerr.ProtocolViolation, "received NEW_CONNECTION_ID frame, although the peer uses zero-length connection IDs")
+	}
+	if err := h.add(f); err != nil {
+		return err
+	}
+	if len(h.queue) >= protocol.MaxActiveConnectionIDs {
+		return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("peer issued more than %d connection IDs", protocol.MaxActiveConnectionIDs))
+	}
+	return nil
+}
+
+func (h *connIDManager) add(f *wire.NewConnectionIDFrame) error {
+	// If the NEW_CONNECTION_ID frame is reordered, such that its sequence number is smaller than the currently active
+	// connection ID or if it was already retired, send the RETIRE_CONNECTION_ID frame immediately.
+	if f.SequenceNumber < h.activeSequenceNumber || f.SequenceNumber < h.highestRetired {
+		h.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: f.SequenceNumber})
+		return nil
+	}
+
+	// Retire all connection IDs in the queue that the peer asked us to retire.
+	if f.RetirePriorTo > h.highestRetired {
+		var queue []newConnID
+		for _, c := range h.queue {
+			if c.SequenceNumber >= f.RetirePriorTo {
+				queue = append(queue, c)
+				continue
+			}
+			h.removeStatelessResetToken(c.StatelessResetToken)
+			h.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: c.SequenceNumber})
+		}
+		h.queue = queue
+		h.highestRetired = f.RetirePriorTo
+	}
+
+	if f.SequenceNumber == h.activeSequenceNumber {
+		return nil
+	}
+	if err := h.addConnectionID(f.SequenceNumber, f.ConnectionID, f.StatelessResetToken); err != nil {
+		return err
+	}
+
+	// Retire the active connection ID, if necessary.
+	if h.activeSequenceNumber < f.RetirePriorTo {
+		// The queue is guaranteed to have at least one element at this point,
+		// since the connection ID from this frame has a sequence number >= RetirePriorTo.
+		h.updateConnectionID()
+	}
+	return nil
+}
+
+func (h *connIDManager) addConnectionID(seq uint64, connID protocol.ConnectionID, resetToken [16]byte) error {
+	i := 0
+	for ; i < len(h.queue); i++ {
+		c := h.queue[i]
+		if c.SequenceNumber == seq {
+			if !c.ConnectionID.Equal(connID) {
+				return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("received conflicting connection IDs for sequence number %d", seq))
+			}
+			if c.StatelessResetToken != resetToken {
+				return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("received conflicting stateless reset tokens for sequence number %d", seq))
+			}
+			return nil // duplicate frame
+		}
+		if c.SequenceNumber > seq {
+			break
+		}
+	}
+	h.queue = append(h.queue, newConnID{})
+	copy(h.queue[i+1:], h.queue[i:])
+	h.queue[i] = newConnID{
+		SequenceNumber:      seq,
+		ConnectionID:        connID,
+		StatelessResetToken: resetToken,
+	}
+	h.addStatelessResetToken(resetToken)
+	return nil
+}
+
+// updateConnectionID retires the active connection ID, and switches to the next connection ID in the queue.
+func (h *connIDManager) updateConnectionID() {
+	h.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: h.activeSequenceNumber})
+	h.highestRetired = utils.MaxUint64(h.highestRetired, h.activeSequenceNumber)
+	if h.activeStatelessResetToken != nil {
+		h.removeStatelessResetToken(*h.activeStatelessResetToken)
+	}
+
+	front := h.queue[0]
+	h.queue = h.queue[1:]
+	h.activeSequenceNumber = front.SequenceNumber
+	h.activeConnectionID = front.ConnectionID
+	// The stateless reset token was registered when the connection ID was added to the queue.
+	h.activeStatelessResetToken = &front.StatelessResetToken
+	h.changeConnectionID(front.ConnectionID)
+}
+
+// SwitchConnectionID switches to a new connection ID, if the peer provided one.
+// It is used when migrating to a new path, such that the two paths can't be linked by an observer.
+// It returns false if no unused connection ID is available.
+func (h *connIDManager) SwitchConnectionID() bool {
+	if len(h.queue) == 0 {
+		return false
+	}
+	h.updateConnectionID()
+	return true
+}
+
+// ChangeInitialConnID is used when the server changes the connection ID during the handshake.
+func (h *connIDManager) ChangeInitialConnID(newConnID protocol.ConnectionID) {
+	if h.activeSequenceNumber != 0 {
+		panic("expected first connection ID to have sequence number 0")
+	}
+	h.activeConnectionID = newConnID
+}
+
+// SetStatelessResetToken sets the stateless reset token of the connection ID used during the handshake.
+func (h *connIDManager) SetStatelessResetToken(token [16]byte) {
+	if h.activeSequenceNumber != 0 {
+		panic("expected first connection ID to have sequence number 0")
+	}
+	h.activeStatelessResetToken = &token
+	h.addStatelessResetToken(token)
+}
+
+// RemoveStatelessResetTokens removes the stateless reset tokens of all connection IDs.
+// It is called when the session is closed.
+func (h *connIDManager) RemoveStatelessResetTokens() {
+	if h.activeStatelessResetToken != nil {
+		h.removeStatelessResetToken(*h.activeStatelessResetToken)
+	}
+	for _, c := range h.queue {
+		h.removeStatelessResetToken(c.StatelessResetToken)
+	}
+}
+
+// Get returns the active connection ID.
+func (h *connIDManager) Get() protocol.ConnectionID {
+	return h.activeConnectionID
+}
@@ -0,0 +1,180 @@
+package quic
+
+import (
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection ID Manager", func() {
+	var (
+		m             *connIDManager
+		frameQueue    []wire.Frame
+		tokenAdded    *[16]byte
+		removedTokens [][16]byte
+		changedTo     protocol.ConnectionID
+	)
+	initialConnID := protocol.ConnectionID{1, 1, 1, 1}
+
+	BeforeEach(func() {
+		frameQueue = nil
+		tokenAdded = nil
+		removedTokens = nil
+		changedTo = nil
+		m = newConnIDManager(
+			initialConnID,
+			func(token [16]byte) { tokenAdded = &token },
+			func(token [16]byte) { removedTokens = append(removedTokens, token) },
+			func(c protocol.ConnectionID) { changedTo = c },
+			func(f wire.Frame) { frameQueue = append(frameQueue, f) },
+		)
+	})
+
+	It("returns the initial connection ID", func() {
+		Expect(m.Get()).To(Equal(initialConnID))
+	})
+
+	It("changes the initial connection ID", func() {
+		m.ChangeInitialConnID(protocol.ConnectionID{1, 2, 3, 4, 5})
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5}))
+	})
+
+	It("sets the token for the first connection ID", func() {
+		token := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+		m.SetStatelessResetToken(token)
+		Expect(*m.activeStatelessResetToken).To(Equal(token))
+		Expect(*tokenAdded).To(Equal(token))
+	})
+
+	It("switches to a new connection ID, and retires the old one", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{
+			SequenceNumber:      1,
+			ConnectionID:        protocol.ConnectionID{2, 2, 2, 2},
+			StatelessResetToken: [16]byte{0xe},
+		})).To(Succeed())
+		Expect(m.Get()).To(Equal(initialConnID))
+		Expect(m.SwitchConnectionID()).To(BeTrue())
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{2, 2, 2, 2}))
+		Expect(changedTo).To(Equal(protocol.ConnectionID{2, 2, 2, 2}))
+		Expect(*tokenAdded).To(Equal([16]byte{0xe}))
+		Expect(frameQueue).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}))
+		// there are no more connection IDs
+		Expect(m.SwitchConnectionID()).To(BeFalse())
+	})
+
+	It("removes the stateless reset token of the retired connection ID", func() {
+		m.SetStatelessResetToken([16]byte{0xa})
+		Expect(m.Add(&wire.NewConnectionIDFrame{
+			SequenceNumber:      1,
+			ConnectionID:        protocol.ConnectionID{2, 2, 2, 2},
+			StatelessResetToken: [16]byte{0xb},
+		})).To(Succeed())
+		Expect(m.SwitchConnectionID()).To(BeTrue())
+		Expect(removedTokens).To(Equal([][16]byte{{0xa}}))
+		m.RemoveStatelessResetTokens()
+		Expect(removedTokens).To(Equal([][16]byte{{0xa}, {0xb}}))
+	})
+
+	It("registers the stateless reset tokens of all connection IDs", func() {
+		var addedTokens [][16]byte
+		m.addStatelessResetToken = func(token [16]byte) { addedTokens = append(addedTokens, token) }
+		m.SetStatelessResetToken([16]byte{0xa})
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}, StatelessResetToken: [16]byte{0xb}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{3, 3, 3, 3}, StatelessResetToken: [16]byte{0xc}})).To(Succeed())
+		Expect(addedTokens).To(Equal([][16]byte{{0xa}, {0xb}, {0xc}}))
+		// switching to a new connection ID doesn't register the token again
+		Expect(m.SwitchConnectionID()).To(BeTrue())
+		Expect(addedTokens).To(HaveLen(3))
+		m.RemoveStatelessResetTokens()
+		Expect(removedTokens).To(ConsistOf([16]byte{0xa}, [16]byte{0xb}, [16]byte{0xc}))
+	})
+
+	It("removes the stateless reset tokens of connection IDs retired by the peer", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}, StatelessResetToken: [16]byte{0xb}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{3, 3, 3, 3}, StatelessResetToken: [16]byte{0xc}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 3, RetirePriorTo: 2, ConnectionID: protocol.ConnectionID{4, 4, 4, 4}, StatelessResetToken: [16]byte{0xd}})).To(Succeed())
+		Expect(removedTokens).To(Equal([][16]byte{{0xb}}))
+	})
+
+	It("uses connection IDs in the order of their sequence numbers", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{3, 3, 3, 3}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})).To(Succeed())
+		Expect(m.SwitchConnectionID()).To(BeTrue())
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{2, 2, 2, 2}))
+		Expect(m.SwitchConnectionID()).To(BeTrue())
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{3, 3, 3, 3}))
+	})
+
+	It("ignores duplicate NEW_CONNECTION_ID frames", func() {
+		f := &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}}
+		Expect(m.Add(f)).To(Succeed())
+		Expect(m.Add(f)).To(Succeed())
+		Expect(m.queue).To(HaveLen(1))
+	})
+
+	It("rejects conflicting connection IDs for the same sequence number", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})).To(Succeed())
+		err := m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{3, 3, 3, 3}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("received conflicting connection IDs for sequence number 1"))
+	})
+
+	It("rejects conflicting stateless reset tokens for the same sequence number", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})).To(Succeed())
+		err := m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}, StatelessResetToken: [16]byte{1}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("received conflicting stateless reset tokens for sequence number 1"))
+	})
+
+	It("retires connection IDs when requested by the peer", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{3, 3, 3, 3}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{
+			SequenceNumber: 3,
+			RetirePriorTo:  2,
+			ConnectionID:   protocol.ConnectionID{4, 4, 4, 4},
+		})).To(Succeed())
+		Expect(frameQueue).To(ConsistOf(
+			&wire.RetireConnectionIDFrame{SequenceNumber: 0},
+			&wire.RetireConnectionIDFrame{SequenceNumber: 1},
+		))
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{3, 3, 3, 3}))
+		Expect(m.queue).To(HaveLen(1))
+	})
+
+	It("immediately retires connection IDs that were already retired", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{
+			SequenceNumber: 3,
+			RetirePriorTo:  3,
+			ConnectionID:   protocol.ConnectionID{4, 4, 4, 4},
+		})).To(Succeed())
+		frameQueue = nil
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{3, 3, 3, 3}})).To(Succeed())
+		Expect(frameQueue).To(Equal([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 2}}))
+		Expect(m.Get()).To(Equal(protocol.ConnectionID{4, 4, 4, 4}))
+	})
+
+	It("errors when the peer issues too many connection IDs", func() {
+		for i := uint8(1); i < protocol.MaxActiveConnectionIDs; i++ {
+			Expect(m.Add(&wire.NewConnectionIDFrame{
+				SequenceNumber: uint64(i),
+				ConnectionID:   protocol.ConnectionID{i, i, i, i},
+			})).To(Succeed())
+		}
+		err := m.Add(&wire.NewConnectionIDFrame{
+			SequenceNumber: protocol.MaxActiveConnectionIDs,
+			ConnectionID:   protocol.ConnectionID{0xff, 0xff, 0xff, 0xff},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("peer issued more than"))
+	})
+
+	It("errors when the peer uses zero-length connection IDs", func() {
+		m.ChangeInitialConnID(protocol.ConnectionID{})
+		err := m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("zero-length connection IDs"))
+	})
+})
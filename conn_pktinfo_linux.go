@@ -0,0 +1,87 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// enablePacketInfo requests the kernel to report the local address that packets were received on.
+// This is only needed if the connection is bound to an unspecified address,
+// since the kernel might otherwise send packets from a different address than the one the peer sent them to.
+// It returns false if packet info is not needed, or if enabling it failed.
+func enablePacketInfo(c *net.UDPConn, rawConn syscall.RawConn) bool {
+	addr, ok := c.LocalAddr().(*net.UDPAddr)
+	if !ok || !addr.IP.IsUnspecified() {
+		return false
+	}
+	var errIPv4, errIPv6 error
+	if err := rawConn.Control(func(fd uintptr) {
+		errIPv4 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1)
+		if addr.IP.To4() == nil {
+			errIPv6 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVPKTINFO, 1)
+		}
+	}); err != nil {
+		return false
+	}
+	// Dual-stack sockets receive IPv4 and IPv6 packets, and need both options.
+	return errIPv4 == nil && errIPv6 == nil
+}
+
+// parseControlMessages parses the control messages of a received datagram.
+// It returns the GRO segment size (0 if the datagram wasn't coalesced) and the packet info.
+func parseControlMessages(oob []byte) (int, packetInfo) {
+	var segmentSize int
+	var info packetInfo
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, info
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.IPPROTO_UDP && msg.Header.Type == udpGRO && len(msg.Data) >= 4:
+			segmentSize = int(*(*int32)(unsafe.Pointer(&msg.Data[0])))
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_PKTINFO && len(msg.Data) >= syscall.SizeofInet4Pktinfo:
+			pktinfo := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&msg.Data[0]))
+			info.addr = net.IPv4(pktinfo.Addr[0], pktinfo.Addr[1], pktinfo.Addr[2], pktinfo.Addr[3])
+			info.ifIndex = uint32(pktinfo.Ifindex)
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_PKTINFO && len(msg.Data) >= syscall.SizeofInet6Pktinfo:
+			pktinfo := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&msg.Data[0]))
+			info.addr = make(net.IP, net.IPv6len)
+			copy(info.addr, pktinfo.Addr[:])
+			info.ifIndex = pktinfo.Ifindex
+		}
+	}
+	return segmentSize, info
+}
+
+// OOB returns the control message that selects the local address packets are sent from.
+// It returns nil if the local address is not known.
+func (info packetInfo) OOB() []byte {
+	if info.addr == nil {
+		return nil
+	}
+	if ip4 := info.addr.To4(); ip4 != nil {
+		b := make([]byte, syscall.CmsgSpace(syscall.SizeofInet4Pktinfo))
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+		h.Level = syscall.IPPROTO_IP
+		h.Type = syscall.IP_PKTINFO
+		h.SetLen(syscall.CmsgLen(syscall.SizeofInet4Pktinfo))
+		pktinfo := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&b[syscall.CmsgLen(0)]))
+		pktinfo.Ifindex = int32(info.ifIndex)
+		copy(pktinfo.Spec_dst[:], ip4)
+		return b
+	}
+	b := make([]byte, syscall.CmsgSpace(syscall.SizeofInet6Pktinfo))
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = syscall.IPPROTO_IPV6
+	h.Type = syscall.IPV6_PKTINFO
+	h.SetLen(syscall.CmsgLen(syscall.SizeofInet6Pktinfo))
+	pktinfo := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&b[syscall.CmsgLen(0)]))
+	pktinfo.Ifindex = info.ifIndex
+	copy(pktinfo.Addr[:], info.addr.To16())
+	return b
+}
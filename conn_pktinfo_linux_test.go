@@ -0,0 +1,122 @@
+//go:build linux
+// +build linux
+
+package quic
+
+import (
+	"net"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Packet Info", func() {
+	var client *net.UDPConn
+
+	BeforeEach(func() {
+		var err error
+		client, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		client.Close()
+	})
+
+	listen := func(network string, addr *net.UDPAddr) *net.UDPConn {
+		conn, err := net.ListenUDP(network, addr)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return conn
+	}
+
+	// receive sends a packet to the server on port, and returns the packet info reported by the batchConn
+	receive := func(bc *batchConn, port int) packetInfo {
+		_, err := client.WriteTo([]byte("foobar"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		var info packetInfo
+		ExpectWithOffset(1, bc.ReadPackets(protocol.MaxReceivePacketSize, func(_ net.Addr, i packetInfo, buffer *packetBuffer, data []byte) {
+			ExpectWithOffset(2, data).To(Equal([]byte("foobar")))
+			info = i
+			buffer.Release()
+		})).To(Succeed())
+		return info
+	}
+
+	It("doesn't report the packet info if the connection is bound to a specific address", func() {
+		server := listen("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		defer server.Close()
+		bc := newBatchConn(server)
+		Expect(bc.pktinfo).To(BeFalse())
+		Expect(receive(bc, server.LocalAddr().(*net.UDPAddr).Port).addr).To(BeNil())
+	})
+
+	It("reports the packet info on an IPv4 connection", func() {
+		server := listen("udp4", &net.UDPAddr{IP: net.IPv4zero})
+		defer server.Close()
+		bc := newBatchConn(server)
+		Expect(bc.pktinfo).To(BeTrue())
+		info := receive(bc, server.LocalAddr().(*net.UDPAddr).Port)
+		Expect(info.addr.Equal(net.IPv4(127, 0, 0, 1))).To(BeTrue())
+		Expect(info.ifIndex).ToNot(BeZero())
+	})
+
+	It("reports the packet info for IPv4 packets on a dual-stack connection", func() {
+		server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6unspecified})
+		if err != nil {
+			Skip("IPv6 not supported")
+		}
+		defer server.Close()
+		bc := newBatchConn(server)
+		Expect(bc.pktinfo).To(BeTrue())
+		info := receive(bc, server.LocalAddr().(*net.UDPAddr).Port)
+		Expect(info.addr.Equal(net.IPv4(127, 0, 0, 1))).To(BeTrue())
+	})
+
+	Context("sending from the local address", func() {
+		// 127.0.0.2 is a local address, but the kernel would send packets to 127.0.0.1 from 127.0.0.1
+		info := packetInfo{addr: net.IPv4(127, 0, 0, 2)}
+
+		readFrom := func() net.Addr {
+			b := make([]byte, 100)
+			_, addr, err := client.ReadFrom(b)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			return addr
+		}
+
+		It("sends packets", func() {
+			server := listen("udp4", &net.UDPAddr{IP: net.IPv4zero})
+			defer server.Close()
+			Expect(writePacket(server, []byte("foobar"), client.LocalAddr(), info.OOB())).To(Succeed())
+			Expect(readFrom().(*net.UDPAddr).IP.Equal(info.addr)).To(BeTrue())
+		})
+
+		It("sends packets on a dual-stack connection", func() {
+			server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv6unspecified})
+			if err != nil {
+				Skip("IPv6 not supported")
+			}
+			defer server.Close()
+			Expect(writePacket(server, []byte("foobar"), client.LocalAddr(), info.OOB())).To(Succeed())
+			Expect(readFrom().(*net.UDPAddr).IP.Equal(info.addr)).To(BeTrue())
+		})
+
+		It("sends batches of packets", func() {
+			server := listen("udp4", &net.UDPAddr{IP: net.IPv4zero})
+			defer server.Close()
+			c := newConn(server, client.LocalAddr(), info)
+			Expect(c.WritePackets([][]byte{[]byte("foo"), []byte("bar"), []byte("baz")})).To(Succeed())
+			for i := 0; i < 3; i++ {
+				Expect(readFrom().(*net.UDPAddr).IP.Equal(info.addr)).To(BeTrue())
+			}
+		})
+
+		It("reports the local address", func() {
+			server := listen("udp4", &net.UDPAddr{IP: net.IPv4zero})
+			defer server.Close()
+			c := newConn(server, client.LocalAddr(), info)
+			Expect(c.LocalAddr()).To(Equal(&net.UDPAddr{IP: info.addr, Port: server.LocalAddr().(*net.UDPAddr).Port}))
+		})
+	})
+})
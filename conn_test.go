@@ -89,6 +89,15 @@ var _ = Describe("Connection", func() {
 		Expect(write.data).To(Equal([]byte("foobar")))
 	})
 
+	It("writes multiple packets one by one, if the connection doesn't support batching", func() {
+		Expect(c.WritePackets([][]byte{[]byte("foo"), []byte("bar")})).To(Succeed())
+		var write mockPacketConnWrite
+		Expect(packetConn.dataWritten).To(Receive(&write))
+		Expect(write.data).To(Equal([]byte("foo")))
+		Expect(packetConn.dataWritten).To(Receive(&write))
+		Expect(write.data).To(Equal([]byte("bar")))
+	})
+
 	It("reads", func() {
 		packetConn.dataToRead <- []byte("foo")
 		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1336}
@@ -122,6 +131,14 @@ var _ = Describe("Connection", func() {
 		Expect(c.RemoteAddr().String()).To(Equal(addr.String()))
 	})
 
+	It("changes the packet conn", func() {
+		newPacketConn := newMockPacketConn()
+		Expect(c.SetPacketConn(newPacketConn)).To(Equal(packetConn))
+		Expect(c.Write([]byte("foobar"))).To(Succeed())
+		Expect(packetConn.dataWritten).To(BeEmpty())
+		Expect(newPacketConn.dataWritten).To(Receive())
+	})
+
 	It("closes", func() {
 		err := c.Close()
 		Expect(err).ToNot(HaveOccurred())
@@ -3,6 +3,7 @@ package quic
 import (
 	"errors"
 
+	"github.com/DrakenLibra/gt-bbr/internal/flowcontrol"
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 )
@@ -11,14 +12,20 @@ type frameSorter struct {
 	queue   map[protocol.ByteCount][]byte
 	readPos protocol.ByteCount
 	gaps    *utils.ByteIntervalList
+
+	// The memory between the readPos and the highest offset received is reserved from the memory budget.
+	// This includes the gaps, since they will be filled with data.
+	memory        *flowcontrol.WindowBudget
+	highestOffset protocol.ByteCount
 }
 
 var errDuplicateStreamData = errors.New("Duplicate Stream Data")
 
-func newFrameSorter() *frameSorter {
+func newFrameSorter(memory *flowcontrol.WindowBudget) *frameSorter {
 	s := frameSorter{
-		gaps:  utils.NewByteIntervalList(),
-		queue: make(map[protocol.ByteCount][]byte),
+		gaps:   utils.NewByteIntervalList(),
+		queue:  make(map[protocol.ByteCount][]byte),
+		memory: memory,
 	}
 	s.gaps.PushFront(utils.ByteInterval{Start: 0, End: protocol.MaxByteCount})
 	return &s
@@ -139,6 +146,12 @@ func (s *frameSorter) push(data []byte, offset protocol.ByteCount) error {
 	}
 
 	s.queue[offset] = data
+	if end > s.highestOffset {
+		if s.memory != nil {
+			s.memory.ForceReserve(end - s.highestOffset)
+		}
+		s.highestOffset = end
+	}
 	return nil
 }
 
@@ -150,9 +163,23 @@ func (s *frameSorter) Pop() (protocol.ByteCount, []byte) {
 	delete(s.queue, s.readPos)
 	offset := s.readPos
 	s.readPos += protocol.ByteCount(len(data))
+	if s.memory != nil {
+		s.memory.Release(protocol.ByteCount(len(data)))
+	}
 	return offset, data
 }
 
+// Clear drops all queued data, and releases the memory reserved for it.
+// It is used when the data won't be read any more.
+// Data pushed afterwards isn't accounted for.
+func (s *frameSorter) Clear() {
+	if s.memory != nil {
+		s.memory.Release(s.highestOffset - s.readPos)
+		s.memory = nil
+	}
+	s.queue = make(map[protocol.ByteCount][]byte)
+}
+
 // HasMoreData says if there is any more data queued at *any* offset.
 func (s *frameSorter) HasMoreData() bool {
 	return len(s.queue) > 0
@@ -3,6 +3,7 @@ package quic
 import (
 	"bytes"
 
+	"github.com/DrakenLibra/gt-bbr/internal/flowcontrol"
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 	. "github.com/onsi/ginkgo"
@@ -22,7 +23,7 @@ var _ = Describe("STREAM frame sorter", func() {
 	}
 
 	BeforeEach(func() {
-		s = newFrameSorter()
+		s = newFrameSorter(nil)
 	})
 
 	It("returns nil when empty", func() {
@@ -414,4 +415,45 @@ var _ = Describe("STREAM frame sorter", func() {
 			})
 		})
 	})
+
+	Context("memory accounting", func() {
+		var memory *flowcontrol.WindowBudget
+
+		BeforeEach(func() {
+			memory = flowcontrol.NewWindowBudget(0)
+			s = newFrameSorter(memory)
+		})
+
+		It("reserves memory for in-order data", func() {
+			Expect(s.Push([]byte("foobar"), 0)).To(Succeed())
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(6)))
+			Expect(s.Push([]byte("foobar"), 0)).To(Succeed()) // duplicate
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(6)))
+			s.Pop()
+			Expect(memory.Used()).To(BeZero())
+		})
+
+		It("reserves memory for out-of-order data, including the gaps", func() {
+			Expect(s.Push([]byte("foobar"), 10)).To(Succeed())
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(16)))
+			Expect(s.Push([]byte("foo"), 3)).To(Succeed())
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(16)))
+			Expect(s.Push([]byte("foo"), 0)).To(Succeed())
+			s.Pop()
+			s.Pop()
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(10)))
+		})
+
+		It("releases the memory when cleared", func() {
+			Expect(s.Push([]byte("foo"), 0)).To(Succeed())
+			Expect(s.Push([]byte("foobar"), 10)).To(Succeed())
+			s.Pop()
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(13)))
+			s.Clear()
+			Expect(memory.Used()).To(BeZero())
+			Expect(s.HasMoreData()).To(BeFalse())
+			Expect(s.Push([]byte("foobar"), 20)).To(Succeed())
+			Expect(memory.Used()).To(BeZero())
+		})
+	})
 })
@@ -0,0 +1,142 @@
+package quic
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+)
+
+type rateLimitResult uint8
+
+const (
+	rateLimitAllowed rateLimitResult = iota
+	rateLimitedSource
+	rateLimitedSubnet
+)
+
+// A tokenBucket allows rate events per second, with bursts of up to rate events.
+type tokenBucket struct {
+	tokens     float64
+	lastUpdate time.Time
+}
+
+func (b *tokenBucket) update(rate int, now time.Time) {
+	b.tokens += now.Sub(b.lastUpdate).Seconds() * float64(rate)
+	if b.tokens > float64(rate) {
+		b.tokens = float64(rate)
+	}
+	b.lastUpdate = now
+}
+
+// The handshakeRateLimiter limits the rate of new handshakes per source IP address and per subnet.
+type handshakeRateLimiter struct {
+	mutex sync.Mutex
+
+	sourceRate int // handshakes per second, 0 if unlimited
+	subnetRate int // handshakes per second, 0 if unlimited
+
+	sources   map[string]*tokenBucket
+	subnets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	// Once the maximum number of tracked sources (or subnets) is reached,
+	// all new sources (or subnets) share a single bucket.
+	sourceOverflow tokenBucket
+	subnetOverflow tokenBucket
+}
+
+func newHandshakeRateLimiter(sourceRate, subnetRate int) *handshakeRateLimiter {
+	return &handshakeRateLimiter{
+		sourceRate: sourceRate,
+		subnetRate: subnetRate,
+		sources:    make(map[string]*tokenBucket),
+		subnets:    make(map[string]*tokenBucket),
+	}
+}
+
+// Allow checks if a new handshake from addr is allowed.
+// If it is, it counts the handshake towards the rate limits.
+func (l *handshakeRateLimiter) Allow(addr net.Addr, now time.Time) rateLimitResult {
+	if l.sourceRate == 0 && l.subnetRate == 0 {
+		return rateLimitAllowed
+	}
+	source, subnet := getSourceAndSubnet(addr)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.maybeSweep(now)
+	var sourceBucket, subnetBucket *tokenBucket
+	if l.sourceRate > 0 {
+		sourceBucket = l.getBucket(l.sources, &l.sourceOverflow, source, l.sourceRate, now)
+		if sourceBucket.tokens < 1 {
+			return rateLimitedSource
+		}
+	}
+	if l.subnetRate > 0 && len(subnet) > 0 {
+		subnetBucket = l.getBucket(l.subnets, &l.subnetOverflow, subnet, l.subnetRate, now)
+		if subnetBucket.tokens < 1 {
+			return rateLimitedSubnet
+		}
+	}
+	if sourceBucket != nil {
+		sourceBucket.tokens--
+	}
+	if subnetBucket != nil {
+		subnetBucket.tokens--
+	}
+	return rateLimitAllowed
+}
+
+// getBucket gets the token bucket for a key, and creates it if necessary.
+// It returns the overflow bucket if the maximum number of tracked keys is reached.
+func (l *handshakeRateLimiter) getBucket(buckets map[string]*tokenBucket, overflow *tokenBucket, key string, rate int, now time.Time) *tokenBucket {
+	b, ok := buckets[key]
+	if !ok {
+		if len(buckets) >= protocol.MaxTrackedHandshakeSources {
+			b = overflow
+		} else {
+			b = &tokenBucket{tokens: float64(rate), lastUpdate: now}
+			buckets[key] = b
+		}
+	}
+	b.update(rate, now)
+	return b
+}
+
+// maybeSweep deletes the token buckets that are full, since they don't limit anything.
+// To bound the amount of work done, the maps are swept at most once per second.
+func (l *handshakeRateLimiter) maybeSweep(now time.Time) {
+	if len(l.sources) < protocol.MaxTrackedHandshakeSources && len(l.subnets) < protocol.MaxTrackedHandshakeSources {
+		return
+	}
+	if now.Sub(l.lastSweep) < time.Second {
+		return
+	}
+	l.lastSweep = now
+	sweep := func(buckets map[string]*tokenBucket, rate int) {
+		for key, b := range buckets {
+			b.update(rate, now)
+			if b.tokens >= float64(rate) {
+				delete(buckets, key)
+			}
+		}
+	}
+	sweep(l.sources, l.sourceRate)
+	sweep(l.subnets, l.subnetRate)
+}
+
+// getSourceAndSubnet returns the source IP address and the subnet of addr.
+// The subnet is empty if addr is not an IP address.
+func getSourceAndSubnet(addr net.Addr) (string /* source */, string /* subnet */) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return addr.String(), ""
+	}
+	if ip := udpAddr.IP.To4(); ip != nil {
+		return string(ip), string(ip.Mask(net.CIDRMask(protocol.HandshakeRateLimitIPv4PrefixLen, 32)))
+	}
+	return string(udpAddr.IP), string(udpAddr.IP.Mask(net.CIDRMask(protocol.HandshakeRateLimitIPv6PrefixLen, 128)))
+}
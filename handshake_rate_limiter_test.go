@@ -0,0 +1,101 @@
+package quic
+
+import (
+	"net"
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handshake Rate Limiter", func() {
+	addr := func(a, b, c, d byte) net.Addr {
+		return &net.UDPAddr{IP: net.IPv4(a, b, c, d), Port: 1337}
+	}
+
+	It("doesn't limit anything if no rate is set", func() {
+		l := newHandshakeRateLimiter(0, 0)
+		now := time.Now()
+		for i := 0; i < 100; i++ {
+			Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		}
+	})
+
+	It("limits the rate per source address", func() {
+		l := newHandshakeRateLimiter(2, 0)
+		now := time.Now()
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitedSource))
+		Expect(l.Allow(addr(1, 2, 3, 5), now)).To(Equal(rateLimitAllowed))
+		// after half a second, one more handshake is allowed
+		now = now.Add(500 * time.Millisecond)
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitedSource))
+	})
+
+	It("limits the rate per subnet", func() {
+		l := newHandshakeRateLimiter(0, 2)
+		now := time.Now()
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 5), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 6), now)).To(Equal(rateLimitedSubnet))
+		Expect(l.Allow(addr(1, 2, 4, 4), now)).To(Equal(rateLimitAllowed))
+	})
+
+	It("uses /48 subnets for IPv6", func() {
+		l := newHandshakeRateLimiter(0, 1)
+		now := time.Now()
+		Expect(l.Allow(&net.UDPAddr{IP: net.ParseIP("2001:db8:1::1")}, now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:2::1")}, now)).To(Equal(rateLimitedSubnet))
+		Expect(l.Allow(&net.UDPAddr{IP: net.ParseIP("2001:db8:2::1")}, now)).To(Equal(rateLimitAllowed))
+	})
+
+	It("doesn't count handshakes that were rejected", func() {
+		l := newHandshakeRateLimiter(1, 2)
+		now := time.Now()
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitedSource))
+		Expect(l.Allow(addr(1, 2, 3, 5), now)).To(Equal(rateLimitAllowed))
+	})
+
+	It("deletes sources that are not rate limited any more", func() {
+		l := newHandshakeRateLimiter(1, 0)
+		now := time.Now()
+		for i := 0; i < protocol.MaxTrackedHandshakeSources; i++ {
+			Expect(l.Allow(addr(10, byte(i>>16), byte(i>>8), byte(i)), now)).To(Equal(rateLimitAllowed))
+		}
+		Expect(l.sources).To(HaveLen(protocol.MaxTrackedHandshakeSources))
+		// new sources are not tracked
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.sources).To(HaveLen(protocol.MaxTrackedHandshakeSources))
+		now = now.Add(time.Second)
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.sources).To(HaveLen(1))
+	})
+
+	It("rate limits sources that are not tracked using a shared bucket", func() {
+		l := newHandshakeRateLimiter(2, 0)
+		now := time.Now()
+		for i := 0; i < protocol.MaxTrackedHandshakeSources; i++ {
+			Expect(l.Allow(addr(10, byte(i>>16), byte(i>>8), byte(i)), now)).To(Equal(rateLimitAllowed))
+		}
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 5), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 3, 6), now)).To(Equal(rateLimitedSource))
+		Expect(l.sources).To(HaveLen(protocol.MaxTrackedHandshakeSources))
+	})
+
+	It("rate limits subnets that are not tracked using a shared bucket", func() {
+		l := newHandshakeRateLimiter(0, 1)
+		now := time.Now()
+		for i := 0; i < protocol.MaxTrackedHandshakeSources; i++ {
+			Expect(l.Allow(addr(10, byte(i>>8), byte(i), 1), now)).To(Equal(rateLimitAllowed))
+		}
+		Expect(l.Allow(addr(1, 2, 3, 4), now)).To(Equal(rateLimitAllowed))
+		Expect(l.Allow(addr(1, 2, 4, 4), now)).To(Equal(rateLimitedSubnet))
+		Expect(l.subnets).To(HaveLen(protocol.MaxTrackedHandshakeSources))
+	})
+})
@@ -224,7 +224,7 @@ var _ = Describe("Handshake tests", func() {
 		})
 
 		It("rejects new connection attempts if connections don't get accepted", func() {
-			for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+			for i := 0; i < protocol.DefaultMaxAcceptQueueSize; i++ {
 				sess, err := dial()
 				Expect(err).ToNot(HaveOccurred())
 				defer sess.Close()
@@ -253,7 +253,7 @@ var _ = Describe("Handshake tests", func() {
 			firstSess, err := dial()
 			Expect(err).ToNot(HaveOccurred())
 
-			for i := 1; i < protocol.MaxAcceptQueueSize; i++ {
+			for i := 1; i < protocol.DefaultMaxAcceptQueueSize; i++ {
 				sess, err := dial()
 				Expect(err).ToNot(HaveOccurred())
 				defer sess.Close()
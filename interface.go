@@ -16,6 +16,34 @@ type StreamID = protocol.StreamID
 // A VersionNumber is a QUIC version number.
 type VersionNumber = protocol.VersionNumber
 
+// A ConnectionID is a QUIC connection ID.
+type ConnectionID = protocol.ConnectionID
+
+// A CongestionControlAlgorithm is a congestion control algorithm.
+type CongestionControlAlgorithm = protocol.CongestionControlAlgorithm
+
+const (
+	// CongestionControlBBR is BBR. It is the default congestion control algorithm.
+	CongestionControlBBR = protocol.CongestionControlBBR
+	// CongestionControlCubic is Cubic.
+	CongestionControlCubic = protocol.CongestionControlCubic
+	// CongestionControlReno is NewReno.
+	CongestionControlReno = protocol.CongestionControlReno
+)
+
+// A ConnectionIDGenerator generates the connection IDs used by this endpoint.
+// It can be used to encode routing information into connection IDs, for example
+// to allow a load balancer to route packets to the right server.
+type ConnectionIDGenerator interface {
+	// GenerateConnectionID generates a new connection ID.
+	// The connection ID must be ConnectionIDLen() bytes long,
+	// and it must not be linkable to other connection IDs by an observer.
+	GenerateConnectionID() (ConnectionID, error)
+	// ConnectionIDLen returns the length of the connection IDs generated.
+	// It must return the same value for every call.
+	ConnectionIDLen() int
+}
+
 // A Token can be used to verify the ownership of the client address.
 type Token struct {
 	// IsRetryToken encodes how the client received the token. There are two ways:
@@ -26,10 +54,66 @@ type Token struct {
 	SentTime     time.Time
 }
 
+// A TokenProtector encrypts and authenticates the tokens that a server sends in Retry packets and NEW_TOKEN frames.
+// Implementations must be safe for concurrent use.
+type TokenProtector interface {
+	// NewToken protects the data. The result is sent to the client as the token.
+	NewToken(data []byte) ([]byte, error)
+	// DecodeToken decodes a token, and returns the data passed to NewToken.
+	// It returns an error if the token is invalid.
+	DecodeToken(token []byte) ([]byte, error)
+}
+
+// TransportParameters are the transport parameters sent by a peer.
+type TransportParameters struct {
+	InitialMaxStreamDataBidiLocal  uint64
+	InitialMaxStreamDataBidiRemote uint64
+	InitialMaxStreamDataUni        uint64
+	InitialMaxData                 uint64
+	MaxBidiStreamNum               uint64
+	MaxUniStreamNum                uint64
+	IdleTimeout                    time.Duration
+	MaxPacketSize                  uint64
+	DisableMigration               bool
+}
+
+// ClientInfo contains information about a client that is establishing a connection to the server.
+type ClientInfo struct {
+	// RemoteAddr is the address of the client.
+	RemoteAddr net.Addr
+	// ServerName is the server name sent in the SNI extension, if any.
+	ServerName string
+	// SupportedProtos are the application protocols offered by the client using ALPN.
+	SupportedProtos []string
+	// TransportParameters are the transport parameters sent by the client.
+	TransportParameters TransportParameters
+}
+
+// A ClientToken is a token received by the client.
+// It can be used to skip address validation on future connection attempts.
+type ClientToken struct {
+	data []byte
+}
+
+// A TokenStore stores the tokens that a client received from servers in NEW_TOKEN frames.
+// Implementations must be safe for concurrent use.
+type TokenStore interface {
+	// Pop searches for a ClientToken associated with the given key.
+	// Since tokens are not supposed to be reused, it must remove the token from the cache.
+	// It returns nil when no token is found.
+	Pop(key string) (token *ClientToken)
+
+	// Put adds a token to the cache with the given key. It might get called
+	// multiple times in a connection.
+	Put(key string, token *ClientToken)
+}
+
 // An ErrorCode is an application-defined error code.
 type ErrorCode = protocol.ApplicationErrorCode
 
 // Stream is the interface implemented by QUIC streams
+// Streams also implement io.WriterTo, such that io.Copy from a stream
+// passes the received data to the io.Writer without an intermediate buffer.
 type Stream interface {
 	// StreamID returns the stream ID.
 	StreamID() StreamID
@@ -69,6 +153,12 @@ type Stream interface {
 	// cancels the read-side of their stream.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
+	// WaitAcknowledged blocks until all data written to the stream, including the FIN,
+	// has been acknowledged by the peer. This requires Close() to be called.
+	// It returns an error if the write-side of the stream is canceled or the session is closed
+	// before all data has been acknowledged, or when the context is canceled.
+	// Warning: This API should not be considered stable and might change soon.
+	WaitAcknowledged(context.Context) error
 	// SetReadDeadline sets the deadline for future Read calls and
 	// any currently-blocked Read call.
 	// A zero value for t means Read will not time out.
@@ -83,6 +173,9 @@ type Stream interface {
 	// with the connection. It is equivalent to calling both
 	// SetReadDeadline and SetWriteDeadline.
 	SetDeadline(t time.Time) error
+	// Stats returns statistics about the stream.
+	// Warning: This API should not be considered stable and might change soon.
+	Stats() StreamStats
 }
 
 // A ReceiveStream is a unidirectional Receive Stream.
@@ -95,6 +188,9 @@ type ReceiveStream interface {
 	CancelRead(ErrorCode)
 	// see Stream.SetReadDealine
 	SetReadDeadline(t time.Time) error
+	// see Stream.Stats
+	// Only the values concerning the receive direction are set.
+	Stats() StreamStats
 }
 
 // A SendStream is a unidirectional Send Stream.
@@ -109,8 +205,37 @@ type SendStream interface {
 	CancelWrite(ErrorCode)
 	// see Stream.Context
 	Context() context.Context
+	// see Stream.WaitAcknowledged
+	WaitAcknowledged(context.Context) error
 	// see Stream.SetWriteDeadline
 	SetWriteDeadline(t time.Time) error
+	// see Stream.Stats
+	// Only the values concerning the send direction are set.
+	Stats() StreamStats
+}
+
+// StreamStats contains statistics about a stream.
+type StreamStats struct {
+	// BytesWritten is the number of bytes passed to Write.
+	BytesWritten uint64
+	// BytesSent is the number of bytes sent, not counting retransmissions.
+	BytesSent uint64
+	// BytesRetransmitted is the number of bytes that were retransmitted.
+	BytesRetransmitted uint64
+	// BytesAcked is the number of bytes that were acknowledged by the peer.
+	BytesAcked uint64
+	// StreamFlowControlBlockedTime is the time that sending was blocked by the stream-level flow control limit imposed by the peer.
+	StreamFlowControlBlockedTime time.Duration
+	// ConnectionFlowControlBlockedTime is the time that sending was blocked by the connection-level flow control limit imposed by the peer.
+	ConnectionFlowControlBlockedTime time.Duration
+	// SendWindow is the number of bytes that flow control allows to be sent on this stream, as of the last time data was sent.
+	// It takes into account both stream-level and connection-level flow control.
+	SendWindow uint64
+
+	// BytesReceived is the highest offset of data received on the stream.
+	BytesReceived uint64
+	// BytesRead is the number of bytes read from the stream.
+	BytesRead uint64
 }
 
 // StreamError is returned by Read and Write when the peer cancels the stream.
@@ -164,9 +289,40 @@ type Session interface {
 	// The context is cancelled when the session is closed.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
+	// HandshakeComplete returns a context that is cancelled when the handshake completes,
+	// or when the session is closed before that.
+	// It is useful for sessions that were accepted before the handshake completed (see Config.AcceptEarlySessions).
+	// Warning: This API should not be considered stable and might change soon.
+	HandshakeComplete() context.Context
 	// ConnectionState returns basic details about the QUIC connection.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() tls.ConnectionState
+	// SetMaxIncomingStreams changes the maximum number of concurrent bidirectional streams
+	// that the peer is allowed to open (see Config.MaxIncomingStreams).
+	// When the limit is raised, the peer is granted the new streams immediately.
+	// When it is lowered, the peer won't be allowed to open new streams until
+	// the number of open streams drops below the new limit.
+	// Warning: This API should not be considered stable and might change soon.
+	SetMaxIncomingStreams(uint64)
+	// SetMaxIncomingUniStreams changes the maximum number of concurrent unidirectional streams
+	// that the peer is allowed to open (see Config.MaxIncomingUniStreams).
+	// It works like SetMaxIncomingStreams.
+	// Warning: This API should not be considered stable and might change soon.
+	SetMaxIncomingUniStreams(uint64)
+	// MigrateTo moves the session to a new net.PacketConn, e.g. after the network interface changed.
+	// It blocks until the new path has been validated.
+	// If the validation fails, the session continues using the old net.PacketConn, and an error is returned.
+	// Only clients can migrate, and only after the handshake completed.
+	// Warning: This API should not be considered stable and might change soon.
+	MigrateTo(net.PacketConn) error
+
+	// SendMessage sends a message as an unreliable DATAGRAM frame.
+	// The message must fit into a single packet, and is not retransmitted if lost.
+	// It returns an error if the DATAGRAM extension was not negotiated.
+	SendMessage([]byte) error
+	// ReceiveMessage gets a message received in a DATAGRAM frame.
+	// It blocks until a message is received, or the session is closed.
+	ReceiveMessage() ([]byte, error)
 }
 
 // Config contains all configuration data needed for a QUIC server or client.
@@ -176,12 +332,19 @@ type Config struct {
 	// Warning: This API should not be considered stable and will change soon.
 	Versions []VersionNumber
 	// The length of the connection ID in bytes.
-	// It can be 0, or any value between 4 and 18.
+	// It can be 0 (only for clients), or any value between 4 and 20.
+	// The maximum is 18, if the development version of QUIC is used.
 	// If not set, the interpretation depends on where the Config is used:
 	// If used for dialing an address, a 0 byte connection ID will be used.
 	// If used for a server, or dialing on a packet conn, a 4 byte connection ID will be used.
 	// When dialing on a packet conn, the ConnectionIDLength value must be the same for every Dial call.
+	// If a ConnectionIDGenerator is set, this value is ignored.
 	ConnectionIDLength int
+	// ConnectionIDGenerator generates the connection IDs used by this endpoint.
+	// The length of the connection ID is determined by the generator, and must be valid for ConnectionIDLength.
+	// If a generated connection ID doesn't have this length, the connection attempt fails.
+	// If not set, random connection IDs of length ConnectionIDLength are used.
+	ConnectionIDGenerator ConnectionIDGenerator
 	// HandshakeTimeout is the maximum duration that the cryptographic handshake may take.
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 10 seconds.
@@ -199,12 +362,92 @@ type Config struct {
 	//   * else, that it was issued within the last 24 hours.
 	// This option is only valid for the server.
 	AcceptToken func(clientAddr net.Addr, token *Token) bool
+	// RetryThreshold is the number of handshakes in progress above which the server validates client addresses.
+	// Below this threshold, new connections are accepted without consulting AcceptToken,
+	// and no Retry is sent.
+	// If zero, AcceptToken is consulted for every new connection.
+	// This option is only valid for the server.
+	RetryThreshold int
+	// MaxHandshakes is the maximum number of handshakes that can be in progress at the same time.
+	// New connection attempts exceeding this limit are rejected with a SERVER_BUSY error.
+	// If zero, the number of handshakes is not limited.
+	// This option is only valid for the server.
+	MaxHandshakes int
+	// HandshakeRateLimitPerSource is the maximum number of handshakes per second that are started from a single IP address.
+	// Connection attempts exceeding this limit are dropped.
+	// If zero, the handshake rate is not limited.
+	// This option is only valid for the server.
+	HandshakeRateLimitPerSource int
+	// HandshakeRateLimitPerSubnet is the maximum number of handshakes per second that are started from a single subnet.
+	// Subnets are /24 for IPv4 and /48 for IPv6.
+	// Connection attempts exceeding this limit are dropped.
+	// If zero, the handshake rate is not limited.
+	// This option is only valid for the server.
+	HandshakeRateLimitPerSubnet int
+	// MaxAcceptQueueSize is the maximum number of sessions that the server queues for accepting.
+	// If the queue is full, new connection attempts are rejected with a SERVER_BUSY error.
+	// If not set, it defaults to 32.
+	// This option is only valid for the server.
+	MaxAcceptQueueSize int
+	// AcceptEarlySessions makes the server return sessions from Accept as soon as they are created,
+	// before the handshake completes.
+	// Session.HandshakeComplete can be used to wait for the handshake to complete.
+	// This option is only valid for the server.
+	AcceptEarlySessions bool
+	// TokenKey is used to protect the tokens that the server sends in Retry packets and NEW_TOKEN frames.
+	// Servers using the same key accept each other's tokens, and tokens remain valid after a restart.
+	// It must be at least 32 bytes long.
+	// If not set, a random key is generated for every Listen call.
+	// This option is only valid for the server.
+	TokenKey []byte
+	// PreviousTokenKeys are keys that were used as the TokenKey before the key was rotated.
+	// They are not used to protect new tokens, but tokens protected with these keys are still accepted.
+	// After rotating the key, previous keys should be kept for at least 24 hours,
+	// the validity period of tokens sent in NEW_TOKEN frames.
+	// This option is only valid for the server.
+	PreviousTokenKeys [][]byte
+	// TokenProtector protects the tokens that the server sends.
+	// If set, TokenKey and PreviousTokenKeys are ignored.
+	// This option is only valid for the server.
+	TokenProtector TokenProtector
+	// TokenStore stores the tokens received from servers in NEW_TOKEN frames.
+	// Tokens are stored using the server name as the key.
+	// They are used for the Initial packet of future connections to the same server,
+	// which allows the server to skip the address validation using a Retry.
+	// If not set, tokens are saved in an in-memory store, which is shared by all clients.
+	// This option is only valid for the client.
+	TokenStore TokenStore
+	// InitialStreamReceiveWindow is the initial stream-level flow control window for receiving data.
+	// It is advertised to the peer in the transport parameters.
+	// It must not be larger than MaxReceiveStreamFlowControlWindow.
+	// If not set, it defaults to 512 KB (or MaxReceiveStreamFlowControlWindow, if that's smaller).
+	InitialStreamReceiveWindow uint64
+	// InitialConnectionReceiveWindow is the initial connection-level flow control window for receiving data.
+	// It is advertised to the peer in the transport parameters.
+	// It must not be larger than MaxReceiveConnectionFlowControlWindow.
+	// If not set, it defaults to 768 KB (or MaxReceiveConnectionFlowControlWindow, if that's smaller).
+	InitialConnectionReceiveWindow uint64
 	// MaxReceiveStreamFlowControlWindow is the maximum stream-level flow control window for receiving data.
 	// If this value is zero, it will default to 1 MB for the server and 6 MB for the client.
 	MaxReceiveStreamFlowControlWindow uint64
 	// MaxReceiveConnectionFlowControlWindow is the connection-level flow control window for receiving data.
 	// If this value is zero, it will default to 1.5 MB for the server and 15 MB for the client.
 	MaxReceiveConnectionFlowControlWindow uint64
+	// EnableBDPAutoTuning enables auto-tuning of the receive flow control windows based on the bandwidth-delay product.
+	// The windows are set to the rate at which data is received, times the RTT, times the BDPAutoTuningHeadroom.
+	// They are never smaller than the initial windows, and never larger than the maximum windows.
+	// If not set, a window is doubled whenever it is consumed too fast.
+	EnableBDPAutoTuning bool
+	// BDPAutoTuningHeadroom is the factor by which the receive windows exceed the bandwidth-delay product.
+	// It is only used if EnableBDPAutoTuning is set.
+	// If not set, it defaults to 2.
+	BDPAutoTuningHeadroom float64
+	// ReceiveWindowBudget limits the memory used for receiving stream data, summed over all sessions using this Config.
+	// It can be shared between multiple Configs, e.g. to limit the memory used by multiple Listeners.
+	// Under memory pressure, window updates are limited, and the connection-level receive windows shrink.
+	// The initial windows are always granted, so sessions are never stalled.
+	// If not set, the memory is only limited by the maximum windows.
+	ReceiveWindowBudget *ReceiveWindowBudget
 	// MaxIncomingStreams is the maximum number of concurrent bidirectional streams that a peer is allowed to open.
 	// If not set, it will default to 100.
 	// If set to a negative value, it doesn't allow any bidirectional streams.
@@ -216,8 +459,60 @@ type Config struct {
 	// The StatelessResetKey is used to generate stateless reset tokens.
 	// If no key is configured, sending of stateless resets is disabled.
 	StatelessResetKey []byte
+	// PreviousStatelessResetKeys are keys that were used as the StatelessResetKey before the key was rotated.
+	// They are not used to generate new tokens. However, peers might still use tokens generated with these keys,
+	// so a stateless reset is sent for every previous key as well.
+	// After rotating the key, previous keys should be kept for at least the IdleTimeout.
+	// At most 2 previous keys can be used.
+	PreviousStatelessResetKeys [][]byte
+	// CongestionControl is the congestion control algorithm used for sending.
+	// If not set, BBR is used.
+	CongestionControl CongestionControlAlgorithm
+	// GetConfigForClient is called by the server when it receives the client's transport parameters.
+	// It can return a Config to override the configuration for this connection.
+	// Only the InitialStreamReceiveWindow, InitialConnectionReceiveWindow, MaxReceiveStreamFlowControlWindow,
+	// MaxReceiveConnectionFlowControlWindow, MaxIncomingStreams, MaxIncomingUniStreams, IdleTimeout
+	// and CongestionControl values are used, all other values are ignored. Values that are not set are taken from the Config used for listening.
+	// If it returns nil, the Config used for listening is used.
+	// If it returns an error, or if the resulting initial windows are larger than the maximum windows, the connection is closed.
+	// This option is only valid for the server.
+	GetConfigForClient func(*ClientInfo) (*Config, error)
 	// KeepAlive defines whether this peer will periodically send a packet to keep the connection alive.
 	KeepAlive bool
+	// EnableDatagrams enables the QUIC DATAGRAM extension (draft-pauly-quic-datagram).
+	// Support is advertised to the peer in the transport parameters.
+	// Messages can only be sent if the peer enabled DATAGRAM support as well.
+	EnableDatagrams bool
+	// KeyUpdateInterval is the maximum number of packets sent or received with one 1-RTT key,
+	// before a key update is initiated.
+	// If not set, keys are only updated when the confidentiality limit of the AEAD is reached.
+	KeyUpdateInterval uint64
+	// MaxPacketSize is the maximum size of UDP payloads that this endpoint is willing to receive.
+	// It is advertised to the peer in the max_packet_size transport parameter,
+	// and limits the size of the probe packets sent during path MTU discovery.
+	// If not set, it defaults to 1452 bytes. Values larger than 9216 bytes are reduced to 9216 bytes.
+	// When listening or dialing on a packet conn, the MaxPacketSize must be the same for every Listen / Dial call.
+	MaxPacketSize uint64
+	// DisablePathMTUDiscovery disables Path MTU Discovery (DPLPMTUD).
+	// Packets will then be at most 1252 (IPv4) / 1232 (IPv6) bytes in size.
+	// If path MTU discovery is enabled, the Don't Fragment bit is set on the packet conn (only on Linux).
+	DisablePathMTUDiscovery bool
+}
+
+// ListenerStats contains statistics about the connection attempts handled by a Listener.
+type ListenerStats struct {
+	// HandshakesInProgress is the number of handshakes currently in progress.
+	HandshakesInProgress int
+	// RetriesSent is the number of Retry packets sent.
+	RetriesSent uint64
+	// RejectedSourceRateLimit is the number of connection attempts dropped due to the per-source handshake rate limit.
+	RejectedSourceRateLimit uint64
+	// RejectedSubnetRateLimit is the number of connection attempts dropped due to the per-subnet handshake rate limit.
+	RejectedSubnetRateLimit uint64
+	// RejectedMaxHandshakes is the number of connection attempts rejected because MaxHandshakes handshakes were in progress.
+	RejectedMaxHandshakes uint64
+	// RejectedAcceptQueueFull is the number of connection attempts rejected because the accept queue was full.
+	RejectedAcceptQueueFull uint64
 }
 
 // A Listener for incoming QUIC connections
@@ -228,4 +523,17 @@ type Listener interface {
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
 	Accept() (Session, error)
+	// AcceptContext returns new sessions, like Accept.
+	// It returns the context's error when the context is done before a session is accepted.
+	AcceptContext(context.Context) (Session, error)
+	// Shutdown gracefully shuts down the listener.
+	// New connection attempts are rejected with a SERVER_BUSY error, and Accept returns an error.
+	// Sessions that were not accepted yet are closed using the error code.
+	// Shutdown then waits for all other sessions to be closed.
+	// When the context is done before, the remaining sessions are closed using the error code,
+	// and the context's error is returned.
+	// Finally, the listener is closed.
+	Shutdown(ctx context.Context, code ErrorCode) error
+	// Stats returns statistics about the connection attempts handled by the listener.
+	Stats() ListenerStats
 }
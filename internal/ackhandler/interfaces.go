@@ -16,6 +16,14 @@ type SentPacketHandler interface {
 	SetMaxAckDelay(time.Duration)
 	DropPackets(protocol.EncryptionLevel)
 	ResetForRetry() error
+	// OnConnectionMigration resets the RTT estimate and the congestion controller.
+	// It is called when the peer moved to a new path.
+	OnConnectionMigration()
+	// SetMaxDatagramSize is called when path MTU discovery changed the maximum packet size.
+	SetMaxDatagramSize(protocol.ByteCount)
+	// SetCongestionControl replaces the congestion controller.
+	// It must be called before any packet is sent.
+	SetCongestionControl(protocol.CongestionControlAlgorithm)
 
 	// The SendMode determines if and what kind of packets can be sent.
 	SendMode() SendMode
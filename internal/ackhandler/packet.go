@@ -16,6 +16,9 @@ type Packet struct {
 	Length          protocol.ByteCount
 	EncryptionLevel protocol.EncryptionLevel
 	SendTime        time.Time
+	// IsPathMTUProbePacket is set for packets sent by path MTU discovery.
+	// These packets are not tracked for loss recovery and congestion control.
+	IsPathMTUProbePacket bool
 
 	largestAcked protocol.PacketNumber // if the packet contains an ACK, the LargestAcked value of that ACK
 
@@ -75,6 +75,10 @@ type sentPacketHandler struct {
 	// The alarm timeout
 	alarm time.Time
 
+	// onFrameAcked is called for every frame contained in an acknowledged packet.
+	// A frame might be reported multiple times, if it was retransmitted.
+	onFrameAcked func(wire.Frame)
+
 	logger utils.Logger
 }
 
@@ -82,6 +86,8 @@ type sentPacketHandler struct {
 func NewSentPacketHandler(
 	initialPacketNumber protocol.PacketNumber,
 	rttStats *congestion.RTTStats,
+	congestionControl protocol.CongestionControlAlgorithm,
+	onFrameAcked func(wire.Frame),
 	logger utils.Logger,
 ) SentPacketHandler {
 	handler := &sentPacketHandler{
@@ -89,19 +95,34 @@ func NewSentPacketHandler(
 		handshakePackets: newPacketNumberSpace(0),
 		oneRTTPackets:    newPacketNumberSpace(0),
 		rttStats:         rttStats,
+		onFrameAcked:     onFrameAcked,
 		logger:           logger,
 	}
-	cc := congestion.NewBBRSender(congestion.DefaultClock{},
-		rttStats,
-		protocol.InitialCongestionWindow,
-		protocol.DefaultBBRMaxCongestionWindow,
-		func() protocol.ByteCount {
-			return handler.bytesInFlight
-		},
-	)
-	handler.congestion = cc
+	handler.SetCongestionControl(congestionControl)
 	return handler
+}
 
+func (h *sentPacketHandler) SetCongestionControl(algorithm protocol.CongestionControlAlgorithm) {
+	switch algorithm {
+	case protocol.CongestionControlCubic, protocol.CongestionControlReno:
+		h.congestion = congestion.NewCubicSender(
+			congestion.DefaultClock{},
+			h.rttStats,
+			algorithm == protocol.CongestionControlReno,
+			protocol.InitialCongestionWindow,
+			protocol.DefaultMaxCongestionWindow,
+		)
+	default:
+		h.congestion = congestion.NewBBRSender(
+			congestion.DefaultClock{},
+			h.rttStats,
+			protocol.InitialCongestionWindow,
+			protocol.DefaultBBRMaxCongestionWindow,
+			func() protocol.ByteCount {
+				return h.bytesInFlight
+			},
+		)
+	}
 }
 
 func (h *sentPacketHandler) DropPackets(encLevel protocol.EncryptionLevel) {
@@ -137,6 +158,12 @@ func (h *sentPacketHandler) SetMaxAckDelay(mad time.Duration) {
 }
 
 func (h *sentPacketHandler) SentPacket(packet *Packet) {
+	// Losing a path MTU probe packet is not a sign of congestion,
+	// and the PING frame it contains doesn't need to be retransmitted.
+	if packet.IsPathMTUProbePacket {
+		h.getPacketNumberSpace(packet.EncryptionLevel).largestSent = packet.PacketNumber
+		return
+	}
 	if isAckEliciting := h.sentPacketImpl(packet); isAckEliciting {
 		h.getPacketNumberSpace(packet.EncryptionLevel).history.SentPacket(packet)
 		h.updateLossDetectionAlarm()
@@ -494,6 +521,9 @@ func (h *sentPacketHandler) onPacketAcked(p *Packet, rcvTime time.Time) error {
 	if packet := pnSpace.history.GetPacket(p.PacketNumber); packet == nil {
 		return nil
 	}
+	for _, f := range p.Frames {
+		h.onFrameAcked(f)
+	}
 
 	// only report the acking of this packet to the congestion controller if:
 	// * it is an ack-eliciting packet
@@ -561,6 +591,15 @@ func (h *sentPacketHandler) DequeueProbePacket() (*Packet, error) {
 		if err := h.queuePacketForRetransmission(p, pnSpace); err != nil {
 			return nil, err
 		}
+		// The packet only contained DATAGRAM frames, which are never retransmitted.
+		// Send a PING frame instead, to elicit an ACK from the peer.
+		if len(h.retransmissionQueue) == 0 {
+			return &Packet{
+				PacketNumber:    p.PacketNumber,
+				Frames:          []wire.Frame{&wire.PingFrame{}},
+				EncryptionLevel: p.EncryptionLevel,
+			}, nil
+		}
 	}
 	return h.DequeuePacketForRetransmission(), nil
 }
@@ -673,10 +712,34 @@ func (h *sentPacketHandler) queuePacketForRetransmission(p *Packet, pnSpace *pac
 	if err := pnSpace.history.MarkCannotBeRetransmitted(p.PacketNumber); err != nil {
 		return err
 	}
+	// DATAGRAM frames are unreliable, and never retransmitted.
+	p.Frames = stripDatagramFrames(p.Frames)
+	if len(p.Frames) == 0 {
+		h.logger.Debugf("Not retransmitting packet %#x, since it only contained DATAGRAM frames.", p.PacketNumber)
+		return nil
+	}
 	h.retransmissionQueue = append(h.retransmissionQueue, p)
 	return nil
 }
 
+func stripDatagramFrames(frames []wire.Frame) []wire.Frame {
+	for i, f := range frames {
+		if _, ok := f.(*wire.DatagramFrame); !ok {
+			continue
+		}
+		// Only allocate a new slice if the packet actually contained a DATAGRAM frame.
+		stripped := make([]wire.Frame, i, len(frames)-1)
+		copy(stripped, frames[:i])
+		for _, f := range frames[i+1:] {
+			if _, ok := f.(*wire.DatagramFrame); !ok {
+				stripped = append(stripped, f)
+			}
+		}
+		return stripped
+	}
+	return frames
+}
+
 func (h *sentPacketHandler) computeCryptoTimeout() time.Duration {
 	duration := utils.MaxDuration(2*h.rttStats.SmoothedOrInitialRTT(), protocol.TimerGranularity)
 	// exponential backoff
@@ -689,6 +752,18 @@ func (h *sentPacketHandler) computePTOTimeout() time.Duration {
 	return duration << h.ptoCount
 }
 
+func (h *sentPacketHandler) OnConnectionMigration() {
+	h.rttStats.OnConnectionMigration()
+	h.congestion.OnConnectionMigration()
+	h.updateLossDetectionAlarm()
+}
+
+func (h *sentPacketHandler) SetMaxDatagramSize(s protocol.ByteCount) {
+	if c, ok := h.congestion.(congestion.MaxDatagramSizeSetter); ok {
+		c.SetMaxDatagramSize(s)
+	}
+}
+
 func (h *sentPacketHandler) ResetForRetry() error {
 	h.cryptoCount = 0
 	h.bytesInFlight = 0
@@ -40,15 +40,26 @@ func cryptoPacket(p *Packet) *Packet {
 	return p
 }
 
+type mockMaxDatagramSizeSetter struct {
+	*mocks.MockSendAlgorithmWithDebugInfos
+	maxDatagramSize protocol.ByteCount
+}
+
+func (m *mockMaxDatagramSizeSetter) SetMaxDatagramSize(s protocol.ByteCount) {
+	m.maxDatagramSize = s
+}
+
 var _ = Describe("SentPacketHandler", func() {
 	var (
 		handler     *sentPacketHandler
 		streamFrame wire.StreamFrame
+		ackedFrames []wire.Frame
 	)
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(42, rttStats, utils.DefaultLogger).(*sentPacketHandler)
+		ackedFrames = nil
+		handler = NewSentPacketHandler(42, rttStats, protocol.CongestionControlBBR, func(f wire.Frame) { ackedFrames = append(ackedFrames, f) }, utils.DefaultLogger).(*sentPacketHandler)
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
 			Data:     []byte{0x13, 0x37},
@@ -119,6 +130,23 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.lastSentCryptoPacketTime).To(Equal(sendTime))
 		})
 
+		It("does not store path MTU probe packets", func() {
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1}))
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2, Length: 9000, IsPathMTUProbePacket: true}))
+			Expect(handler.oneRTTPackets.largestSent).To(Equal(protocol.PacketNumber(2)))
+			expectInPacketHistory([]protocol.PacketNumber{1}, protocol.Encryption1RTT)
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(1)))
+		})
+
+		It("accepts ACKs for path MTU probe packets", func() {
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1}))
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2, Length: 9000, IsPathMTUProbePacket: true}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(handler.oneRTTPackets.largestAcked).To(Equal(protocol.PacketNumber(2)))
+			Expect(handler.bytesInFlight).To(BeZero())
+		})
+
 		It("does not store non-ack-eliciting packets", func() {
 			handler.SentPacket(nonAckElicitingPacket(&Packet{PacketNumber: 1, EncryptionLevel: protocol.Encryption1RTT}))
 			Expect(handler.oneRTTPackets.history.Len()).To(BeZero())
@@ -189,6 +217,15 @@ var _ = Describe("SentPacketHandler", func() {
 				expectInPacketHistory([]protocol.PacketNumber{1, 2, 3, 4, 5, 6, 7, 8, 9}, protocol.Encryption1RTT)
 			})
 
+			It("reports the frames contained in acknowledged packets", func() {
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 3}}}
+				Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+				Expect(ackedFrames).To(Equal([]wire.Frame{&wire.PingFrame{}, &wire.PingFrame{}}))
+				// the ACK is received a second time
+				Expect(handler.ReceivedAck(ack, 2, protocol.Encryption1RTT, time.Now())).To(Succeed())
+				Expect(ackedFrames).To(HaveLen(2))
+			})
+
 			It("handles an ACK frame with one missing packet range", func() {
 				ack := &wire.AckFrame{ // lose 4 and 5
 					AckRanges: []wire.AckRange{
@@ -421,6 +458,24 @@ var _ = Describe("SentPacketHandler", func() {
 		Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
 	})
 
+	It("uses BBR by default", func() {
+		_, isBBR := handler.congestion.(congestion.CongestionEvent)
+		Expect(isBBR).To(BeTrue())
+	})
+
+	It("uses Cubic", func() {
+		h := NewSentPacketHandler(0, &congestion.RTTStats{}, protocol.CongestionControlCubic, nil, utils.DefaultLogger).(*sentPacketHandler)
+		_, isBBR := h.congestion.(congestion.CongestionEvent)
+		Expect(isBBR).To(BeFalse())
+	})
+
+	It("replaces the congestion controller", func() {
+		handler.SetCongestionControl(protocol.CongestionControlReno)
+		_, isBBR := handler.congestion.(congestion.CongestionEvent)
+		Expect(isBBR).To(BeFalse())
+		Expect(handler.congestion.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow))
+	})
+
 	Context("congestion", func() {
 		var cong *mocks.MockSendAlgorithmWithDebugInfos
 
@@ -446,6 +501,27 @@ var _ = Describe("SentPacketHandler", func() {
 			})
 		})
 
+		It("doesn't pass path MTU probe packets to the congestion controller", func() {
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, IsPathMTUProbePacket: true}))
+			Expect(handler.bytesInFlight).To(BeZero())
+		})
+
+		It("passes the max datagram size to the congestion controller", func() {
+			c := &mockMaxDatagramSizeSetter{MockSendAlgorithmWithDebugInfos: cong}
+			handler.congestion = c
+			handler.SetMaxDatagramSize(9000)
+			Expect(c.maxDatagramSize).To(Equal(protocol.ByteCount(9000)))
+		})
+
+		It("resets the RTT estimate and the congestion controller on connection migration", func() {
+			handler.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			Expect(handler.rttStats.SmoothedRTT()).To(Equal(time.Second))
+			cong.EXPECT().OnConnectionMigration()
+			handler.OnConnectionMigration()
+			Expect(handler.rttStats.SmoothedRTT()).To(BeZero())
+		})
+
 		It("should call MaybeExitSlowStart and OnPacketAcked", func() {
 			rcvTime := time.Now().Add(-5 * time.Second)
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
@@ -767,6 +843,52 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("DATAGRAM frames", func() {
+		datagramPacket := func(p *Packet, frames ...wire.Frame) *Packet {
+			p = ackElicitingPacket(p)
+			p.Frames = frames
+			return p
+		}
+
+		It("retransmits packets that contained DATAGRAM frames and other frames", func() {
+			handler.SentPacket(datagramPacket(
+				&Packet{PacketNumber: 1},
+				&wire.DatagramFrame{Data: []byte("foobar")},
+				&wire.MaxDataFrame{ByteOffset: 0x1337},
+			))
+			losePacket(1, protocol.Encryption1RTT)
+		})
+
+		It("removes the DATAGRAM frames from retransmitted packets", func() {
+			handler.SentPacket(datagramPacket(
+				&Packet{PacketNumber: 1},
+				&wire.DatagramFrame{Data: []byte("foo")},
+				&wire.MaxDataFrame{ByteOffset: 0x1337},
+				&wire.DatagramFrame{Data: []byte("bar")},
+			))
+			handler.queuePacketForRetransmission(getPacket(1, protocol.Encryption1RTT), handler.getPacketNumberSpace(protocol.Encryption1RTT))
+			p := handler.DequeuePacketForRetransmission()
+			Expect(p).ToNot(BeNil())
+			Expect(p.Frames).To(Equal([]wire.Frame{&wire.MaxDataFrame{ByteOffset: 0x1337}}))
+		})
+
+		It("doesn't queue packets that only contained DATAGRAM frames", func() {
+			handler.SentPacket(datagramPacket(&Packet{PacketNumber: 1}, &wire.DatagramFrame{Data: []byte("foobar")}))
+			handler.queuePacketForRetransmission(getPacket(1, protocol.Encryption1RTT), handler.getPacketNumberSpace(protocol.Encryption1RTT))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+		})
+
+		It("sends a PING as a probe packet, if the packet only contained DATAGRAM frames", func() {
+			handler.SentPacket(datagramPacket(&Packet{PacketNumber: 1}, &wire.DatagramFrame{Data: []byte("foobar")}))
+			p, err := handler.DequeueProbePacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).ToNot(BeNil())
+			Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			Expect(p.Frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+			Expect(p.EncryptionLevel).To(Equal(protocol.Encryption1RTT))
+		})
+	})
+
 	Context("Delay-based loss detection", func() {
 		It("immediately detects old packets as lost when receiving an ACK", func() {
 			now := time.Now()
@@ -136,6 +136,8 @@ type bbrSender struct {
 	maxCongestionWindow protocol.ByteCount
 	// The smallest value the |congestion_window_| can achieve.
 	minCongestionWindow protocol.ByteCount
+	// The maximum size of the packets sent on the current path.
+	maxDatagramSize protocol.ByteCount
 	// The pacing gain applied during the STARTUP phase.
 	highGain float64
 	// The CWND gain applied during the STARTUP phase.
@@ -239,6 +241,7 @@ func NewBBRSender(clock Clock, rttStats *RTTStats, initialCongestionWindow, maxC
 		initialCongestionWindow:   initialCongestionWindow,
 		maxCongestionWindow:       maxCongestionWindow,
 		minCongestionWindow:       DefaultMinimumCongestionWindow,
+		maxDatagramSize:           MaxOutgoingPacketSize,
 		highGain:                  DefaultHighGain,
 		highCwndGain:              DefaultHighGain,
 		drainGain:                 1.0 / DefaultHighGain,
@@ -270,6 +273,15 @@ func (b *bbrSender) OnPacketSent(sentTime time.Time, bytesInFlight protocol.Byte
 	b.sampler.OnPacketSent(sentTime, packetNumber, bytes, bytesInFlight, isRetransmittable)
 }
 
+// SetMaxDatagramSize is called when the maximum packet size of the path changes.
+// The minimum congestion window is 4 packets of the new size.
+func (b *bbrSender) SetMaxDatagramSize(s protocol.ByteCount) {
+	b.maxDatagramSize = s
+	b.minCongestionWindow = maxByteCount(DefaultMinimumCongestionWindow, 4*s)
+	b.congestionWindow = maxByteCount(b.congestionWindow, b.minCongestionWindow)
+	b.congestionWindow = minByteCount(b.congestionWindow, b.maxCongestionWindow)
+}
+
 func (b *bbrSender) CanSend(bytesInFlight protocol.ByteCount) bool {
 	return bytesInFlight < b.GetCongestionWindow()
 }
@@ -353,8 +365,29 @@ func (b *bbrSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
 
 }
 
+// OnConnectionMigration is called when the connection is migrated to a new path.
+// The bandwidth and RTT estimates of the old path don't apply to the new path,
+// so BBR starts over in STARTUP mode.
 func (b *bbrSender) OnConnectionMigration() {
-
+	b.sampler = NewBandwidthSampler()
+	b.maxBandwidth = NewWindowedFilter(int64(BandwidthWindowSize), MaxFilter)
+	b.maxAckHeight = NewWindowedFilter(int64(BandwidthWindowSize), MaxFilter)
+	b.aggregationEpochStartTime = time.Time{}
+	b.aggregationEpochBytes = 0
+	b.minRtt = 0
+	b.minRttTimestamp = time.Time{}
+	b.congestionWindow = b.initialCongestionWindow
+	b.pacingRate = 0
+	b.isAtFullBandwidth = false
+	b.roundsWithoutBandwidthGain = 0
+	b.bandwidthAtLastRound = 0
+	b.exitProbeRttAt = time.Time{}
+	b.probeRttRoundPassed = false
+	b.recoveryState = NOT_IN_RECOVERY
+	b.recoveryWindow = b.maxCongestionWindow
+	b.startupBytesLost = 0
+	b.minRttSinceLastProbeRtt = InfiniteRTT
+	b.EnterStartupMode(b.clock.Now())
 }
 
 // Experiments
@@ -686,7 +719,7 @@ func (b *bbrSender) MaybeEnterOrExitProbeRtt(now time.Time, isRoundStart, minRtt
 			// PROBE_RTT.  The CWND during PROBE_RTT is kMinimumCongestionWindow, but
 			// we allow an extra packet since QUIC checks CWND before sending a
 			// packet.
-			if b.GetBytesInFlight() < b.ProbeRttCongestionWindow()+MaxOutgoingPacketSize {
+			if b.GetBytesInFlight() < b.ProbeRttCongestionWindow()+b.maxDatagramSize {
 				b.exitProbeRttAt = now.Add(ProbeRttTime)
 				b.probeRttRoundPassed = false
 			}
@@ -820,7 +853,7 @@ func (b *bbrSender) CalculateRecoveryWindow(ackedBytes, lostBytes protocol.ByteC
 	if b.recoveryWindow >= lostBytes {
 		b.recoveryWindow -= lostBytes
 	} else {
-		b.recoveryWindow = MaxSegmentSize
+		b.recoveryWindow = maxByteCount(MaxSegmentSize, b.maxDatagramSize)
 	}
 	// In CONSERVATION mode, just subtracting losses is sufficient.  In GROWTH,
 	// release additional |bytes_acked| to achieve a slow-start-like behavior.
@@ -0,0 +1,66 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BBR Sender", func() {
+	var (
+		sender        *bbrSender
+		clock         mockClock
+		bytesInFlight protocol.ByteCount
+	)
+
+	BeforeEach(func() {
+		clock = mockClock{}
+		bytesInFlight = 0
+		sender = NewBBRSender(
+			&clock,
+			NewRTTStats(),
+			4*protocol.DefaultTCPMSS,
+			protocol.DefaultBBRMaxCongestionWindow,
+			func() protocol.ByteCount { return bytesInFlight },
+		)
+	})
+
+	It("uses the initial congestion window", func() {
+		Expect(sender.GetCongestionWindow()).To(Equal(4 * protocol.DefaultTCPMSS))
+		Expect(sender.CanSend(4*protocol.DefaultTCPMSS - 1)).To(BeTrue())
+		Expect(sender.CanSend(4 * protocol.DefaultTCPMSS)).To(BeFalse())
+	})
+
+	Context("setting the max datagram size", func() {
+		It("increases the minimum congestion window", func() {
+			sender.SetMaxDatagramSize(9000)
+			Expect(sender.minCongestionWindow).To(Equal(protocol.ByteCount(4 * 9000)))
+			Expect(sender.GetCongestionWindow()).To(Equal(protocol.ByteCount(4 * 9000)))
+		})
+
+		It("doesn't decrease the minimum congestion window below the default", func() {
+			sender.SetMaxDatagramSize(1200)
+			Expect(sender.minCongestionWindow).To(Equal(DefaultMinimumCongestionWindow))
+			Expect(sender.GetCongestionWindow()).To(Equal(4 * protocol.DefaultTCPMSS))
+		})
+
+		It("uses the max datagram size when deciding to exit PROBE_RTT", func() {
+			sender.SetMaxDatagramSize(9000)
+			bytesInFlight = 4*9000 + 8000
+			sender.MaybeEnterOrExitProbeRtt(clock.Now(), false, true)
+			Expect(sender.mode).To(Equal(bbrMode(PROBE_RTT)))
+			Expect(sender.exitProbeRttAt).To(Equal(clock.Now().Add(ProbeRttTime)))
+		})
+
+		It("doesn't exit PROBE_RTT if more than a packet above the PROBE_RTT window is in flight", func() {
+			sender.SetMaxDatagramSize(9000)
+			bytesInFlight = 4*9000 + 9000
+			sender.MaybeEnterOrExitProbeRtt(clock.Now().Add(time.Second), false, true)
+			Expect(sender.mode).To(Equal(bbrMode(PROBE_RTT)))
+			Expect(sender.exitProbeRttAt.IsZero()).To(BeTrue())
+		})
+	})
+})
@@ -308,7 +308,7 @@ func (c *cubicSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
 	c.congestionWindow = c.minCongestionWindow
 }
 
-// OnConnectionMigration is called when the connection is migrated (?)
+// OnConnectionMigration is called when the connection is migrated to a new path.
 func (c *cubicSender) OnConnectionMigration() {
 	c.hybridSlowStart.Restart()
 	c.prr = PrrSender{}
@@ -15,12 +15,19 @@ type SendAlgorithm interface {
 	OnPacketAcked(number protocol.PacketNumber, ackedBytes protocol.ByteCount, priorInFlight protocol.ByteCount, eventTime time.Time)
 	OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, priorInFlight protocol.ByteCount)
 	OnRetransmissionTimeout(packetsRetransmitted bool)
+	OnConnectionMigration()
 }
 
 type CongestionEvent interface {
 	OnCongestionEvent(priorInFlight protocol.ByteCount, eventTime time.Time, ackedPackets, lostPackets []*protocol.Packet)
 }
 
+// A MaxDatagramSizeSetter is a congestion controller that adapts to changes of the maximum datagram size,
+// e.g. when path MTU discovery found a larger packet size.
+type MaxDatagramSizeSetter interface {
+	SetMaxDatagramSize(protocol.ByteCount)
+}
+
 // A SendAlgorithmWithDebugInfos is a SendAlgorithm that exposes some debug infos
 type SendAlgorithmWithDebugInfos interface {
 	SendAlgorithm
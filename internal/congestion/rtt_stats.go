@@ -3,6 +3,7 @@ package congestion
 import (
 	"time"
 
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 )
 
@@ -21,6 +22,8 @@ type RTTStats struct {
 	latestRTT     time.Duration
 	smoothedRTT   time.Duration
 	meanDeviation time.Duration
+
+	maxAckDelay time.Duration
 }
 
 // NewRTTStats makes a properly initialized RTTStats object
@@ -52,6 +55,17 @@ func (r *RTTStats) SmoothedOrInitialRTT() time.Duration {
 // MeanDeviation gets the mean deviation
 func (r *RTTStats) MeanDeviation() time.Duration { return r.meanDeviation }
 
+// MaxAckDelay gets the max_ack_delay advertised by the peer
+func (r *RTTStats) MaxAckDelay() time.Duration { return r.maxAckDelay }
+
+// SetMaxAckDelay sets the max_ack_delay
+func (r *RTTStats) SetMaxAckDelay(mad time.Duration) { r.maxAckDelay = mad }
+
+// PTO gets the probe timeout duration.
+func (r *RTTStats) PTO() time.Duration {
+	return r.SmoothedOrInitialRTT() + utils.MaxDuration(4*r.MeanDeviation(), protocol.TimerGranularity) + r.MaxAckDelay()
+}
+
 // UpdateRTT updates the RTT based on a new sample.
 func (r *RTTStats) UpdateRTT(sendDelta, ackDelay time.Duration, now time.Time) {
 	if sendDelta == utils.InfDuration || sendDelta <= 0 {
@@ -3,6 +3,7 @@ package congestion
 import (
 	"time"
 
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -43,6 +44,22 @@ var _ = Describe("RTT stats", func() {
 		Expect(rttStats.SmoothedOrInitialRTT()).To(Equal((300 * time.Millisecond)))
 	})
 
+	It("computes the PTO", func() {
+		maxAckDelay := 42 * time.Minute
+		rttStats.SetMaxAckDelay(maxAckDelay)
+		rtt := time.Second
+		rttStats.UpdateRTT(rtt, 0, time.Time{})
+		Expect(rttStats.SmoothedRTT()).To(Equal(rtt))
+		Expect(rttStats.MeanDeviation()).To(Equal(rtt / 2))
+		Expect(rttStats.PTO()).To(Equal(rtt + 4*(rtt/2) + maxAckDelay))
+	})
+
+	It("uses the granularity for computing the PTO for short RTTs", func() {
+		rtt := time.Microsecond
+		rttStats.UpdateRTT(rtt, 0, time.Time{})
+		Expect(rttStats.PTO()).To(Equal(rtt + protocol.TimerGranularity))
+	})
+
 	It("MinRTT", func() {
 		rttStats.UpdateRTT((200 * time.Millisecond), 0, time.Time{})
 		Expect(rttStats.MinRTT()).To(Equal((200 * time.Millisecond)))
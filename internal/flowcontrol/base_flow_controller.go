@@ -9,6 +9,14 @@ import (
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 )
 
+// AutoTuning configures the auto-tuning of the receive window.
+type AutoTuning struct {
+	// BDPHeadroom enables auto-tuning based on the bandwidth-delay product:
+	// The window is set to the rate at which data was received, times the RTT, times BDPHeadroom.
+	// If 0, the window is doubled if it is consumed too fast.
+	BDPHeadroom float64
+}
+
 type baseFlowController struct {
 	// for sending data
 	bytesSent     protocol.ByteCount
@@ -23,9 +31,17 @@ type baseFlowController struct {
 	receiveWindowSize    protocol.ByteCount
 	maxReceiveWindowSize protocol.ByteCount
 
-	epochStartTime   time.Time
-	epochStartOffset protocol.ByteCount
-	rttStats         *congestion.RTTStats
+	epochStartTime            time.Time
+	epochStartOffset          protocol.ByteCount
+	epochStartHighestReceived protocol.ByteCount
+	rttStats                  *congestion.RTTStats
+
+	initialReceiveWindowSize protocol.ByteCount
+	bdpHeadroom              float64
+
+	// memory accounts for the memory used for receiving data.
+	// The flow control credit granted to the peer (receiveWindow - highestReceived) is reserved from it.
+	memory *WindowBudget
 
 	logger utils.Logger
 }
@@ -87,12 +103,42 @@ func (c *baseFlowController) getWindowUpdate() protocol.ByteCount {
 	}
 
 	c.maybeAdjustWindowSize()
-	c.receiveWindow = c.bytesRead + c.receiveWindowSize
+	offset := c.bytesRead + c.receiveWindowSize
+	if c.memory != nil {
+		offset = c.reserveMemory(offset)
+		if offset <= c.receiveWindow {
+			return 0
+		}
+	}
+	c.receiveWindow = offset
 	return c.receiveWindow
 }
 
-// maybeAdjustWindowSize increases the receiveWindowSize if we're sending updates too often.
+// reserveMemory reserves the memory needed to increase the receive window to offset.
+// Under memory pressure, the window is only increased as far as the memory allows,
+// but the peer is always granted the initial window size.
+// It returns the new receive window.
+func (c *baseFlowController) reserveMemory(offset protocol.ByteCount) protocol.ByteCount {
+	if offset <= c.receiveWindow {
+		return c.receiveWindow
+	}
+	var forced protocol.ByteCount
+	if minOffset := utils.MinByteCount(c.bytesRead+c.initialReceiveWindowSize, offset); minOffset > c.receiveWindow {
+		forced = minOffset - c.receiveWindow
+		c.memory.ForceReserve(forced)
+	}
+	newOffset := c.receiveWindow + forced + c.memory.Reserve(offset-c.receiveWindow-forced)
+	if newOffset < offset {
+		// shrink the window, such that auto-tuning starts from the window that could actually be granted
+		c.setReceiveWindowSize(utils.MaxByteCount(newOffset-c.bytesRead, c.initialReceiveWindowSize))
+	}
+	return newOffset
+}
+
+// maybeAdjustWindowSize adjusts the receiveWindowSize.
+// By default, the window size is increased if we're sending updates too often.
 // For details about auto-tuning, see https://docs.google.com/document/d/1SExkMmGiz8VYzV3s9E35JQlJ73vhzCekKkDi85F1qCE/edit?usp=sharing.
+// If BDP-based auto-tuning is enabled, the window size is set to the bandwidth-delay product (times the headroom).
 func (c *baseFlowController) maybeAdjustWindowSize() {
 	bytesReadInEpoch := c.bytesRead - c.epochStartOffset
 	// don't do anything if less than half the window has been consumed
@@ -104,17 +150,42 @@ func (c *baseFlowController) maybeAdjustWindowSize() {
 		return
 	}
 
-	fraction := float64(bytesReadInEpoch) / float64(c.receiveWindowSize)
-	if time.Since(c.epochStartTime) < time.Duration(4*fraction*float64(rtt)) {
-		// window is consumed too fast, try to increase the window size
-		c.receiveWindowSize = utils.MinByteCount(2*c.receiveWindowSize, c.maxReceiveWindowSize)
+	if c.bdpHeadroom > 0 {
+		c.adjustWindowSizeToBDP(rtt)
+	} else {
+		fraction := float64(bytesReadInEpoch) / float64(c.receiveWindowSize)
+		if time.Since(c.epochStartTime) < time.Duration(4*fraction*float64(rtt)) {
+			// window is consumed too fast, try to increase the window size
+			c.setReceiveWindowSize(2 * c.receiveWindowSize)
+		}
 	}
 	c.startNewAutoTuningEpoch()
 }
 
+// adjustWindowSizeToBDP sets the receiveWindowSize to the bandwidth-delay product, times the headroom.
+// The bandwidth is estimated from the rate at which data was received during the current epoch.
+func (c *baseFlowController) adjustWindowSizeToBDP(rtt time.Duration) {
+	elapsed := time.Since(c.epochStartTime)
+	if elapsed <= 0 {
+		return
+	}
+	received := c.highestReceived - c.epochStartHighestReceived
+	bdp := float64(received) * float64(rtt) / float64(elapsed)
+	size := utils.MaxByteCount(protocol.ByteCount(c.bdpHeadroom*bdp), c.initialReceiveWindowSize)
+	// never shrink the window below what we already granted to the peer
+	size = utils.MaxByteCount(size, c.receiveWindow-c.bytesRead)
+	c.setReceiveWindowSize(size)
+}
+
+// setReceiveWindowSize sets the receiveWindowSize, limited by the maximum window size.
+func (c *baseFlowController) setReceiveWindowSize(size protocol.ByteCount) {
+	c.receiveWindowSize = utils.MinByteCount(size, c.maxReceiveWindowSize)
+}
+
 func (c *baseFlowController) startNewAutoTuningEpoch() {
 	c.epochStartTime = time.Now()
 	c.epochStartOffset = c.bytesRead
+	c.epochStartHighestReceived = c.highestReceived
 }
 
 func (c *baseFlowController) checkFlowControlViolation() bool {
@@ -231,5 +231,60 @@ var _ = Describe("Base Flow controller", func() {
 				Expect(controller.receiveWindowSize).To(Equal(controller.maxReceiveWindowSize)) // 5000
 			})
 		})
+
+		Context("BDP-based auto-tuning", func() {
+			var rtt time.Duration
+
+			BeforeEach(func() {
+				rtt = scaleDuration(20 * time.Millisecond)
+				controller.initialReceiveWindowSize = receiveWindowSize
+				controller.maxReceiveWindowSize = 5000
+				controller.bdpHeadroom = 2
+				controller.highestReceived = receiveWindow
+				controller.rttStats.UpdateRTT(rtt, 0, time.Now())
+				Expect(controller.rttStats.SmoothedRTT()).To(Equal(rtt))
+			})
+
+			It("sets the window size to the bandwidth-delay product", func() {
+				// receive 1600 bytes in 2 RTTs, i.e. 800 bytes per RTT
+				controller.epochStartTime = time.Now().Add(-2 * rtt)
+				controller.epochStartHighestReceived = controller.highestReceived - 1600
+				controller.epochStartOffset = controller.bytesRead
+				controller.AddBytesRead(600)
+				controller.maybeAdjustWindowSize()
+				Expect(controller.receiveWindowSize).To(BeNumerically("~", 2*800, 50))
+			})
+
+			It("doesn't increase the window size beyond the maxReceiveWindowSize", func() {
+				controller.epochStartTime = time.Now().Add(-rtt / 2)
+				controller.epochStartHighestReceived = controller.highestReceived - 5000
+				controller.epochStartOffset = controller.bytesRead
+				controller.AddBytesRead(600)
+				controller.maybeAdjustWindowSize()
+				Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(5000)))
+			})
+
+			It("shrinks the window size, but not below the initial window size", func() {
+				controller.receiveWindowSize = 3000
+				controller.bytesRead = 6000
+				controller.epochStartTime = time.Now().Add(-4 * rtt)
+				controller.epochStartHighestReceived = controller.highestReceived - 1600
+				controller.epochStartOffset = controller.bytesRead
+				controller.AddBytesRead(3500)
+				controller.maybeAdjustWindowSize()
+				Expect(controller.receiveWindowSize).To(Equal(receiveWindowSize))
+			})
+
+			It("doesn't shrink the window size below the window that was already granted", func() {
+				controller.receiveWindowSize = 3000
+				controller.bytesRead = 6000
+				controller.epochStartTime = time.Now().Add(-4 * rtt)
+				controller.epochStartHighestReceived = controller.highestReceived - 1600
+				controller.epochStartOffset = controller.bytesRead
+				controller.AddBytesRead(1600)
+				controller.maybeAdjustWindowSize()
+				Expect(controller.receiveWindowSize).To(Equal(receiveWindow - controller.bytesRead))
+			})
+		})
 	})
 })
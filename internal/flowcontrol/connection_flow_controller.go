@@ -19,20 +19,30 @@ var _ ConnectionFlowController = &connectionFlowController{}
 
 // NewConnectionFlowController gets a new flow controller for the connection
 // It is created before we receive the peer's transport paramenters, thus it starts with a sendWindow of 0.
+// If memory is set, the flow control credit granted to the peer is reserved from it.
 func NewConnectionFlowController(
 	receiveWindow protocol.ByteCount,
 	maxReceiveWindow protocol.ByteCount,
+	autoTuning AutoTuning,
+	memory *WindowBudget,
 	queueWindowUpdate func(),
 	rttStats *congestion.RTTStats,
 	logger utils.Logger,
 ) ConnectionFlowController {
+	if memory != nil {
+		// the initial window is advertised in the transport parameters, so we can't refuse it
+		memory.ForceReserve(receiveWindow)
+	}
 	return &connectionFlowController{
 		baseFlowController: baseFlowController{
-			rttStats:             rttStats,
-			receiveWindow:        receiveWindow,
-			receiveWindowSize:    receiveWindow,
-			maxReceiveWindowSize: maxReceiveWindow,
-			logger:               logger,
+			memory:                   memory,
+			rttStats:                 rttStats,
+			receiveWindow:            receiveWindow,
+			receiveWindowSize:        receiveWindow,
+			initialReceiveWindowSize: receiveWindow,
+			maxReceiveWindowSize:     maxReceiveWindow,
+			bdpHeadroom:              autoTuning.BDPHeadroom,
+			logger:                   logger,
 		},
 		queueWindowUpdate: queueWindowUpdate,
 	}
@@ -48,6 +58,10 @@ func (c *connectionFlowController) IncrementHighestReceived(increment protocol.B
 	defer c.mutex.Unlock()
 
 	c.highestReceived += increment
+	if c.memory != nil {
+		// the credit was used, the memory is now accounted for by the receiving stream
+		c.memory.Release(increment)
+	}
 	if c.checkFlowControlViolation() {
 		return qerr.Error(qerr.FlowControlError, fmt.Sprintf("Received %d bytes for the connection, allowed %d bytes", c.highestReceived, c.receiveWindow))
 	}
@@ -84,8 +98,8 @@ func (c *connectionFlowController) GetWindowUpdate() protocol.ByteCount {
 func (c *connectionFlowController) EnsureMinimumWindowSize(inc protocol.ByteCount) {
 	c.mutex.Lock()
 	if inc > c.receiveWindowSize {
+		c.setReceiveWindowSize(inc)
 		c.logger.Debugf("Increasing receive flow control window for the connection to %d kB, in response to stream flow control window increase", c.receiveWindowSize/(1<<10))
-		c.receiveWindowSize = utils.MinByteCount(inc, c.maxReceiveWindowSize)
 		c.startNewAutoTuningEpoch()
 	}
 	c.mutex.Unlock()
@@ -37,10 +37,16 @@ var _ = Describe("Connection Flow controller", func() {
 			receiveWindow := protocol.ByteCount(2000)
 			maxReceiveWindow := protocol.ByteCount(3000)
 
-			fc := NewConnectionFlowController(receiveWindow, maxReceiveWindow, nil, rttStats, utils.DefaultLogger).(*connectionFlowController)
+			fc := NewConnectionFlowController(receiveWindow, maxReceiveWindow, AutoTuning{}, nil, nil, rttStats, utils.DefaultLogger).(*connectionFlowController)
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
 			Expect(fc.maxReceiveWindowSize).To(Equal(maxReceiveWindow))
 		})
+
+		It("reserves the initial window from the memory budget", func() {
+			memory := NewWindowBudget(1000)
+			NewConnectionFlowController(2000, 3000, AutoTuning{}, memory, nil, rttStats, utils.DefaultLogger)
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(2000)))
+		})
 	})
 
 	Context("receive flow control", func() {
@@ -95,6 +101,51 @@ var _ = Describe("Connection Flow controller", func() {
 		})
 	})
 
+	Context("memory accounting", func() {
+		var memory *WindowBudget
+
+		BeforeEach(func() {
+			memory = NewWindowBudget(1000)
+			controller.memory = memory
+			controller.receiveWindow = 100
+			controller.receiveWindowSize = 60
+			controller.initialReceiveWindowSize = 40
+			controller.maxReceiveWindowSize = 1000
+			controller.bytesRead = 100 - 60
+			controller.highestReceived = 100
+		})
+
+		It("releases the credit when data is received", func() {
+			memory.Reserve(100)
+			controller.highestReceived = 0
+			Expect(controller.IncrementHighestReceived(30)).To(Succeed())
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(70)))
+		})
+
+		It("reserves memory for window updates", func() {
+			controller.AddBytesRead(30)
+			Expect(controller.GetWindowUpdate()).To(Equal(protocol.ByteCount(70 + 60)))
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(30)))
+		})
+
+		It("only grants the initial window under memory pressure", func() {
+			Expect(memory.Reserve(1000)).To(Equal(protocol.ByteCount(1000))) // used by other sessions
+			controller.AddBytesRead(30)
+			Expect(controller.GetWindowUpdate()).To(Equal(protocol.ByteCount(70 + 40)))
+			Expect(controller.receiveWindowSize).To(Equal(protocol.ByteCount(40)))
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(1000 + 10)))
+		})
+
+		It("refuses window updates under memory pressure, if the initial window is still available", func() {
+			Expect(memory.Reserve(1000)).To(Equal(protocol.ByteCount(1000))) // used by other sessions
+			controller.initialReceiveWindowSize = 20
+			controller.AddBytesRead(30)
+			Expect(controller.GetWindowUpdate()).To(BeZero())
+			Expect(controller.receiveWindow).To(Equal(protocol.ByteCount(100)))
+			Expect(memory.Used()).To(Equal(protocol.ByteCount(1000)))
+		})
+	})
+
 	Context("setting the minimum window size", func() {
 		var (
 			oldWindowSize     protocol.ByteCount
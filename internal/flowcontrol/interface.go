@@ -24,6 +24,11 @@ type StreamFlowController interface {
 	// Abandon should be called when reading from the stream is aborted early,
 	// and there won't be any further calls to AddBytesRead.
 	Abandon()
+	// for sending
+	// IsBlocked says if sending is blocked by flow control.
+	// If it is blocked, connection is true if the connection-level flow control window is exhausted,
+	// but the stream-level flow control window is not.
+	IsBlocked() (blocked bool, connection bool)
 }
 
 // The ConnectionFlowController is the flow controller for the connection.
@@ -29,6 +29,7 @@ func NewStreamFlowController(
 	cfc ConnectionFlowController,
 	receiveWindow protocol.ByteCount,
 	maxReceiveWindow protocol.ByteCount,
+	autoTuning AutoTuning,
 	initialSendWindow protocol.ByteCount,
 	queueWindowUpdate func(protocol.StreamID),
 	rttStats *congestion.RTTStats,
@@ -39,12 +40,14 @@ func NewStreamFlowController(
 		connection:        cfc.(connectionFlowControllerI),
 		queueWindowUpdate: func() { queueWindowUpdate(streamID) },
 		baseFlowController: baseFlowController{
-			rttStats:             rttStats,
-			receiveWindow:        receiveWindow,
-			receiveWindowSize:    receiveWindow,
-			maxReceiveWindowSize: maxReceiveWindow,
-			sendWindow:           initialSendWindow,
-			logger:               logger,
+			rttStats:                 rttStats,
+			receiveWindow:            receiveWindow,
+			receiveWindowSize:        receiveWindow,
+			initialReceiveWindowSize: receiveWindow,
+			maxReceiveWindowSize:     maxReceiveWindow,
+			bdpHeadroom:              autoTuning.BDPHeadroom,
+			sendWindow:               initialSendWindow,
+			logger:                   logger,
 		},
 	}
 }
@@ -110,6 +113,16 @@ func (c *streamFlowController) SendWindowSize() protocol.ByteCount {
 	return utils.MinByteCount(c.baseFlowController.sendWindowSize(), c.connection.SendWindowSize())
 }
 
+func (c *streamFlowController) IsBlocked() (bool, bool) {
+	if c.baseFlowController.sendWindowSize() == 0 {
+		return true, false
+	}
+	if c.connection.SendWindowSize() == 0 {
+		return true, true
+	}
+	return false, false
+}
+
 func (c *streamFlowController) maybeQueueWindowUpdate() {
 	c.mutex.Lock()
 	hasWindowUpdate := !c.receivedFinalOffset && c.hasWindowUpdate()
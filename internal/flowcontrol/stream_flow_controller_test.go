@@ -21,7 +21,7 @@ var _ = Describe("Stream Flow controller", func() {
 		rttStats := &congestion.RTTStats{}
 		controller = &streamFlowController{
 			streamID:   10,
-			connection: NewConnectionFlowController(1000, 1000, func() {}, rttStats, utils.DefaultLogger).(*connectionFlowController),
+			connection: NewConnectionFlowController(1000, 1000, AutoTuning{}, nil, func() {}, rttStats, utils.DefaultLogger).(*connectionFlowController),
 		}
 		controller.maxReceiveWindowSize = 10000
 		controller.rttStats = rttStats
@@ -36,8 +36,8 @@ var _ = Describe("Stream Flow controller", func() {
 		sendWindow := protocol.ByteCount(4000)
 
 		It("sets the send and receive windows", func() {
-			cc := NewConnectionFlowController(0, 0, nil, nil, utils.DefaultLogger)
-			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, nil, rttStats, utils.DefaultLogger).(*streamFlowController)
+			cc := NewConnectionFlowController(0, 0, AutoTuning{}, nil, nil, nil, utils.DefaultLogger)
+			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, AutoTuning{}, sendWindow, nil, rttStats, utils.DefaultLogger).(*streamFlowController)
 			Expect(fc.streamID).To(Equal(protocol.StreamID(5)))
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
 			Expect(fc.maxReceiveWindowSize).To(Equal(maxReceiveWindow))
@@ -51,8 +51,8 @@ var _ = Describe("Stream Flow controller", func() {
 				queued = true
 			}
 
-			cc := NewConnectionFlowController(0, 0, nil, nil, utils.DefaultLogger)
-			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, queueWindowUpdate, rttStats, utils.DefaultLogger).(*streamFlowController)
+			cc := NewConnectionFlowController(0, 0, AutoTuning{}, nil, nil, nil, utils.DefaultLogger)
+			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, AutoTuning{}, sendWindow, queueWindowUpdate, rttStats, utils.DefaultLogger).(*streamFlowController)
 			fc.AddBytesRead(receiveWindow)
 			Expect(queued).To(BeTrue())
 		})
@@ -228,5 +228,21 @@ var _ = Describe("Stream Flow controller", func() {
 			Expect(blocked).To(BeTrue())
 			Expect(controller.IsNewlyBlocked()).To(BeFalse())
 		})
+
+		It("says if it is blocked by stream-level or by connection-level flow control", func() {
+			controller.connection.UpdateSendWindow(50)
+			controller.UpdateSendWindow(100)
+			blocked, _ := controller.IsBlocked()
+			Expect(blocked).To(BeFalse())
+			controller.AddBytesSent(50)
+			blocked, connection := controller.IsBlocked()
+			Expect(blocked).To(BeTrue())
+			Expect(connection).To(BeTrue())
+			controller.connection.UpdateSendWindow(200)
+			controller.AddBytesSent(50)
+			blocked, connection = controller.IsBlocked()
+			Expect(blocked).To(BeTrue())
+			Expect(connection).To(BeFalse())
+		})
 	})
 })
@@ -0,0 +1,103 @@
+package flowcontrol
+
+import (
+	"sync"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/utils"
+)
+
+// A WindowBudget accounts for the memory used for receiving data by multiple flow controllers and streams.
+// It limits the flow control credit that is granted to the peers.
+// It is safe for concurrent use.
+type WindowBudget struct {
+	mutex sync.Mutex
+
+	parent *WindowBudget
+	limit  protocol.ByteCount // 0 means no limit
+	used   protocol.ByteCount
+	closed bool
+}
+
+// NewWindowBudget creates a new budget.
+// If limit is 0, the budget is not limited.
+func NewWindowBudget(limit protocol.ByteCount) *WindowBudget {
+	return &WindowBudget{limit: limit}
+}
+
+// NewChild creates a budget that reserves from this budget.
+// It is used to release all reservations of a session at once, when the session is closed.
+func (b *WindowBudget) NewChild() *WindowBudget {
+	return &WindowBudget{parent: b}
+}
+
+// Reserve reserves up to n bytes.
+// It returns the number of bytes that were reserved.
+func (b *WindowBudget) Reserve(n protocol.ByteCount) protocol.ByteCount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return 0
+	}
+	if b.limit > 0 {
+		if b.used >= b.limit {
+			return 0
+		}
+		n = utils.MinByteCount(n, b.limit-b.used)
+	}
+	if b.parent != nil {
+		n = b.parent.Reserve(n)
+	}
+	b.used += n
+	return n
+}
+
+// ForceReserve reserves n bytes, even if this exceeds the limit.
+// It is used for memory that is already in use, e.g. for data that was already received.
+func (b *WindowBudget) ForceReserve(n protocol.ByteCount) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+	if b.parent != nil {
+		b.parent.ForceReserve(n)
+	}
+	b.used += n
+}
+
+// Release releases n bytes.
+func (b *WindowBudget) Release(n protocol.ByteCount) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.releaseImpl(n)
+}
+
+func (b *WindowBudget) releaseImpl(n protocol.ByteCount) {
+	n = utils.MinByteCount(n, b.used)
+	b.used -= n
+	if b.parent != nil {
+		b.parent.Release(n)
+	}
+}
+
+// Close releases all reserved bytes.
+// After closing, no more bytes can be reserved.
+func (b *WindowBudget) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.releaseImpl(b.used)
+	b.closed = true
+}
+
+// Used returns the number of bytes that are currently reserved.
+func (b *WindowBudget) Used() protocol.ByteCount {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.used
+}
@@ -0,0 +1,79 @@
+package flowcontrol
+
+import (
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Window Budget", func() {
+	It("reserves bytes", func() {
+		b := NewWindowBudget(1000)
+		Expect(b.Reserve(400)).To(Equal(protocol.ByteCount(400)))
+		Expect(b.Reserve(400)).To(Equal(protocol.ByteCount(400)))
+		Expect(b.Reserve(400)).To(Equal(protocol.ByteCount(200)))
+		Expect(b.Reserve(400)).To(BeZero())
+		Expect(b.Used()).To(Equal(protocol.ByteCount(1000)))
+	})
+
+	It("doesn't limit reservations if no limit is set", func() {
+		b := NewWindowBudget(0)
+		Expect(b.Reserve(1 << 40)).To(Equal(protocol.ByteCount(1 << 40)))
+	})
+
+	It("force-reserves bytes", func() {
+		b := NewWindowBudget(1000)
+		b.Reserve(800)
+		b.ForceReserve(400)
+		Expect(b.Used()).To(Equal(protocol.ByteCount(1200)))
+		Expect(b.Reserve(100)).To(BeZero())
+	})
+
+	It("releases bytes", func() {
+		b := NewWindowBudget(1000)
+		b.Reserve(800)
+		b.Release(300)
+		Expect(b.Used()).To(Equal(protocol.ByteCount(500)))
+		b.Release(1000)
+		Expect(b.Used()).To(BeZero())
+	})
+
+	Context("children", func() {
+		It("reserves from the parent", func() {
+			b := NewWindowBudget(1000)
+			c1 := b.NewChild()
+			c2 := b.NewChild()
+			Expect(c1.Reserve(600)).To(Equal(protocol.ByteCount(600)))
+			Expect(c2.Reserve(600)).To(Equal(protocol.ByteCount(400)))
+			Expect(c1.Used()).To(Equal(protocol.ByteCount(600)))
+			Expect(c2.Used()).To(Equal(protocol.ByteCount(400)))
+			c1.Release(100)
+			Expect(b.Used()).To(Equal(protocol.ByteCount(900)))
+		})
+
+		It("releases all bytes when closed", func() {
+			b := NewWindowBudget(1000)
+			c1 := b.NewChild()
+			c2 := b.NewChild()
+			c1.Reserve(600)
+			c2.Reserve(300)
+			c1.Close()
+			Expect(b.Used()).To(Equal(protocol.ByteCount(300)))
+			Expect(c1.Reserve(100)).To(BeZero())
+			// releasing bytes from a closed child doesn't affect the parent
+			c1.Release(100)
+			Expect(b.Used()).To(Equal(protocol.ByteCount(300)))
+			c1.ForceReserve(100)
+			Expect(b.Used()).To(Equal(protocol.ByteCount(300)))
+		})
+
+		It("force-reserves from the parent", func() {
+			b := NewWindowBudget(1000)
+			c := b.NewChild()
+			c.ForceReserve(1500)
+			Expect(c.Used()).To(Equal(protocol.ByteCount(1500)))
+			Expect(b.Used()).To(Equal(protocol.ByteCount(1500)))
+		})
+	})
+})
@@ -1,7 +1,6 @@
 package handshake
 
 import (
-	"crypto/aes"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -10,6 +9,7 @@ import (
 	"sync"
 	"unsafe"
 
+	"github.com/DrakenLibra/gt-bbr/internal/congestion"
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/qerr"
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
@@ -73,6 +73,12 @@ type cryptoSetup struct {
 	messageChan chan []byte
 
 	paramsChan <-chan []byte
+	extHandler tlsExtensionHandler
+
+	// only used by the server
+	clientHelloInfo *tls.ClientHelloInfo
+	// set by SetTransportParameters, while processing the client's transport parameters
+	ourParams []byte
 
 	runner handshakeRunner
 
@@ -98,6 +104,7 @@ type cryptoSetup struct {
 	logger utils.Logger
 
 	perspective protocol.Perspective
+	version     protocol.VersionNumber
 
 	mutex sync.Mutex // protects all members below
 
@@ -112,9 +119,10 @@ type cryptoSetup struct {
 	handshakeOpener Opener
 	handshakeSealer Sealer
 
-	oneRTTStream io.Writer
-	opener       Opener
-	sealer       Sealer
+	oneRTTStream  io.Writer
+	aead          *updatableAEAD
+	has1RTTSealer bool
+	has1RTTOpener bool
 }
 
 var _ qtls.RecordLayer = &cryptoSetup{}
@@ -130,7 +138,10 @@ func NewCryptoSetupClient(
 	tp *TransportParameters,
 	runner handshakeRunner,
 	tlsConf *tls.Config,
+	rttStats *congestion.RTTStats,
+	keyUpdateInterval uint64,
 	logger utils.Logger,
+	version protocol.VersionNumber,
 ) (CryptoSetup, <-chan struct{} /* ClientHello written */, error) {
 	cs, clientHelloWritten, err := newCryptoSetup(
 		initialStream,
@@ -140,8 +151,11 @@ func NewCryptoSetupClient(
 		tp,
 		runner,
 		tlsConf,
+		rttStats,
+		keyUpdateInterval,
 		logger,
 		protocol.PerspectiveClient,
+		version,
 	)
 	if err != nil {
 		return nil, nil, err
@@ -160,7 +174,10 @@ func NewCryptoSetupServer(
 	tp *TransportParameters,
 	runner handshakeRunner,
 	tlsConf *tls.Config,
+	rttStats *congestion.RTTStats,
+	keyUpdateInterval uint64,
 	logger utils.Logger,
+	version protocol.VersionNumber,
 ) (CryptoSetup, error) {
 	cs, _, err := newCryptoSetup(
 		initialStream,
@@ -170,12 +187,23 @@ func NewCryptoSetupServer(
 		tp,
 		runner,
 		tlsConf,
+		rttStats,
+		keyUpdateInterval,
 		logger,
 		protocol.PerspectiveServer,
+		version,
 	)
 	if err != nil {
 		return nil, err
 	}
+	getConfigForClient := cs.tlsConf.GetConfigForClient
+	cs.tlsConf.GetConfigForClient = func(chi *tls.ClientHelloInfo) (*qtls.Config, error) {
+		cs.clientHelloInfo = chi
+		if getConfigForClient == nil {
+			return nil, nil
+		}
+		return getConfigForClient(chi)
+	}
 	cs.conn = qtls.Server(newConn(remoteAddr), cs.tlsConf)
 	return cs, nil
 }
@@ -188,26 +216,32 @@ func newCryptoSetup(
 	tp *TransportParameters,
 	runner handshakeRunner,
 	tlsConf *tls.Config,
+	rttStats *congestion.RTTStats,
+	keyUpdateInterval uint64,
 	logger utils.Logger,
 	perspective protocol.Perspective,
+	version protocol.VersionNumber,
 ) (*cryptoSetup, <-chan struct{} /* ClientHello written */, error) {
-	initialSealer, initialOpener, err := NewInitialAEAD(connID, perspective)
+	initialSealer, initialOpener, err := NewInitialAEAD(connID, perspective, version)
 	if err != nil {
 		return nil, nil, err
 	}
-	extHandler := newExtensionHandler(tp.Marshal(), perspective)
+	extHandler := newExtensionHandler(tp.Marshal(version), perspective)
 	cs := &cryptoSetup{
 		initialStream:          initialStream,
 		initialSealer:          initialSealer,
 		initialOpener:          initialOpener,
 		handshakeStream:        handshakeStream,
 		oneRTTStream:           oneRTTStream,
+		aead:                   newUpdatableAEAD(rttStats, keyUpdateInterval, logger, version),
 		readEncLevel:           protocol.EncryptionInitial,
 		writeEncLevel:          protocol.EncryptionInitial,
 		runner:                 runner,
 		paramsChan:             extHandler.TransportParameters(),
+		extHandler:             extHandler,
 		logger:                 logger,
 		perspective:            perspective,
+		version:                version,
 		handshakeDone:          make(chan struct{}),
 		alertChan:              make(chan uint8),
 		clientHelloWrittenChan: make(chan struct{}),
@@ -223,7 +257,7 @@ func newCryptoSetup(
 }
 
 func (h *cryptoSetup) ChangeConnectionID(id protocol.ConnectionID) error {
-	initialSealer, initialOpener, err := NewInitialAEAD(id, h.perspective)
+	initialSealer, initialOpener, err := NewInitialAEAD(id, h.perspective, h.version)
 	if err != nil {
 		return err
 	}
@@ -233,6 +267,7 @@ func (h *cryptoSetup) ChangeConnectionID(id protocol.ConnectionID) error {
 }
 
 func (h *cryptoSetup) Received1RTTAck() {
+	h.aead.SetHandshakeConfirmed()
 	// drop initial keys
 	// TODO: do this earlier
 	if h.initialOpener != nil {
@@ -250,6 +285,10 @@ func (h *cryptoSetup) Received1RTTAck() {
 	}
 }
 
+func (h *cryptoSetup) SetLargest1RTTAcked(pn protocol.PacketNumber) error {
+	return h.aead.SetLargestAcked(pn)
+}
+
 func (h *cryptoSetup) RunHandshake() {
 	// Handle errors that might occur when HandleData() is called.
 	handshakeComplete := make(chan struct{})
@@ -354,6 +393,8 @@ func (h *cryptoSetup) handleMessageForServer(msgType messageType) bool {
 			return false
 		case data := <-h.paramsChan:
 			h.runner.OnReceivedParams(data)
+			// OnReceivedParams might have changed our transport parameters
+			h.extHandler.SetTransportParameters(h.ourParams)
 		case <-h.handshakeDone:
 			return false
 		}
@@ -481,23 +522,16 @@ func (h *cryptoSetup) ReadHandshakeMessage() ([]byte, error) {
 }
 
 func (h *cryptoSetup) SetReadKey(suite *qtls.CipherSuite, trafficSecret []byte) {
-	key := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic key", suite.KeyLen())
-	iv := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic iv", suite.IVLen())
-	hpKey := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic hp", suite.KeyLen())
-	hpDecrypter, err := aes.NewCipher(hpKey)
-	if err != nil {
-		panic(fmt.Sprintf("error creating new AES cipher: %s", err))
-	}
-
 	h.mutex.Lock()
 	switch h.readEncLevel {
 	case protocol.EncryptionInitial:
 		h.readEncLevel = protocol.EncryptionHandshake
-		h.handshakeOpener = newOpener(suite.AEAD(key, iv), hpDecrypter, false)
+		h.handshakeOpener = newOpener(createAEAD(suite, trafficSecret), createHeaderProtector(suite, trafficSecret), false)
 		h.logger.Debugf("Installed Handshake Read keys")
 	case protocol.EncryptionHandshake:
 		h.readEncLevel = protocol.Encryption1RTT
-		h.opener = newOpener(suite.AEAD(key, iv), hpDecrypter, true)
+		h.aead.SetReadKey(suite, trafficSecret)
+		h.has1RTTOpener = true
 		h.logger.Debugf("Installed 1-RTT Read keys")
 	default:
 		panic("unexpected read encryption level")
@@ -507,23 +541,16 @@ func (h *cryptoSetup) SetReadKey(suite *qtls.CipherSuite, trafficSecret []byte)
 }
 
 func (h *cryptoSetup) SetWriteKey(suite *qtls.CipherSuite, trafficSecret []byte) {
-	key := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic key", suite.KeyLen())
-	iv := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic iv", suite.IVLen())
-	hpKey := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic hp", suite.KeyLen())
-	hpEncrypter, err := aes.NewCipher(hpKey)
-	if err != nil {
-		panic(fmt.Sprintf("error creating new AES cipher: %s", err))
-	}
-
 	h.mutex.Lock()
 	switch h.writeEncLevel {
 	case protocol.EncryptionInitial:
 		h.writeEncLevel = protocol.EncryptionHandshake
-		h.handshakeSealer = newSealer(suite.AEAD(key, iv), hpEncrypter, false)
+		h.handshakeSealer = newSealer(createAEAD(suite, trafficSecret), createHeaderProtector(suite, trafficSecret), false)
 		h.logger.Debugf("Installed Handshake Write keys")
 	case protocol.EncryptionHandshake:
 		h.writeEncLevel = protocol.Encryption1RTT
-		h.sealer = newSealer(suite.AEAD(key, iv), hpEncrypter, true)
+		h.aead.SetWriteKey(suite, trafficSecret)
+		h.has1RTTSealer = true
 		h.logger.Debugf("Installed 1-RTT Write keys")
 	default:
 		panic("unexpected write encryption level")
@@ -568,8 +595,8 @@ func (h *cryptoSetup) GetSealer() (protocol.EncryptionLevel, Sealer) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	if h.sealer != nil {
-		return protocol.Encryption1RTT, h.sealer
+	if h.has1RTTSealer {
+		return protocol.Encryption1RTT, h.aead
 	}
 	if h.handshakeSealer != nil {
 		return protocol.EncryptionHandshake, h.handshakeSealer
@@ -592,10 +619,10 @@ func (h *cryptoSetup) GetSealerWithEncryptionLevel(level protocol.EncryptionLeve
 		}
 		return h.handshakeSealer, nil
 	case protocol.Encryption1RTT:
-		if h.sealer == nil {
+		if !h.has1RTTSealer {
 			return nil, errNoSealer
 		}
-		return h.sealer, nil
+		return h.aead, nil
 	default:
 		return nil, errNoSealer
 	}
@@ -620,16 +647,29 @@ func (h *cryptoSetup) GetOpener(level protocol.EncryptionLevel) (Opener, error)
 			return nil, ErrKeysDropped
 		}
 		return h.handshakeOpener, nil
-	case protocol.Encryption1RTT:
-		if h.opener == nil {
-			return nil, ErrOpenerNotYetAvailable
-		}
-		return h.opener, nil
 	default:
 		return nil, fmt.Errorf("CryptoSetup: no opener with encryption level %s", level)
 	}
 }
 
+func (h *cryptoSetup) Get1RTTOpener() (ShortHeaderOpener, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.has1RTTOpener {
+		return nil, ErrOpenerNotYetAvailable
+	}
+	return h.aead, nil
+}
+
+func (h *cryptoSetup) ClientHelloInfo() *tls.ClientHelloInfo {
+	return h.clientHelloInfo
+}
+
+func (h *cryptoSetup) SetTransportParameters(tp *TransportParameters) {
+	h.ourParams = tp.Marshal(h.version)
+}
+
 func (h *cryptoSetup) ConnectionState() tls.ConnectionState {
 	cs := h.conn.ConnectionState()
 	// h.conn is a qtls.Conn, which returns a qtls.ConnectionState.
@@ -12,6 +12,7 @@ import (
 	"math/big"
 	"time"
 
+	"github.com/DrakenLibra/gt-bbr/internal/congestion"
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/qerr"
 	"github.com/DrakenLibra/gt-bbr/internal/testdata"
@@ -93,7 +94,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			NewMockHandshakeRunner(mockCtrl),
 			tlsConf,
+			&congestion.RTTStats{},
+			0,
 			utils.DefaultLogger.WithPrefix("server"),
+			protocol.VersionTLS,
 		)
 		Expect(err).ToNot(HaveOccurred())
 		qtlsConf := server.(*cryptoSetup).tlsConf
@@ -124,7 +128,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			runner,
 			testdata.GetTLSConfig(),
+			&congestion.RTTStats{},
+			0,
 			utils.DefaultLogger.WithPrefix("server"),
+			protocol.VersionTLS,
 		)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -161,7 +168,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			runner,
 			testdata.GetTLSConfig(),
+			&congestion.RTTStats{},
+			0,
 			utils.DefaultLogger.WithPrefix("server"),
+			protocol.VersionTLS,
 		)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -200,7 +210,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			runner,
 			serverConf,
+			&congestion.RTTStats{},
+			0,
 			utils.DefaultLogger.WithPrefix("server"),
+			protocol.VersionTLS,
 		)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -233,7 +246,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&TransportParameters{},
 			NewMockHandshakeRunner(mockCtrl),
 			serverConf,
+			&congestion.RTTStats{},
+			0,
 			utils.DefaultLogger.WithPrefix("server"),
+			protocol.VersionTLS,
 		)
 		Expect(err).ToNot(HaveOccurred())
 
@@ -247,6 +263,27 @@ var _ = Describe("Crypto Setup TLS", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("doesn't return a 1-RTT opener before the 1-RTT keys are available", func() {
+		_, sInitialStream, sHandshakeStream := initStreams()
+		server, err := NewCryptoSetupServer(
+			sInitialStream,
+			sHandshakeStream,
+			ioutil.Discard,
+			protocol.ConnectionID{},
+			nil,
+			&TransportParameters{},
+			NewMockHandshakeRunner(mockCtrl),
+			serverConf,
+			&congestion.RTTStats{},
+			0,
+			utils.DefaultLogger.WithPrefix("server"),
+			protocol.VersionTLS,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = server.Get1RTTOpener()
+		Expect(err).To(MatchError(ErrOpenerNotYetAvailable))
+	})
+
 	Context("doing the handshake", func() {
 		generateCert := func() tls.Certificate {
 			priv, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -311,7 +348,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				cRunner,
 				clientConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("client"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -332,7 +372,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{StatelessResetToken: &token},
 				sRunner,
 				serverConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("server"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -384,7 +427,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				runner,
 				&tls.Config{InsecureSkipVerify: true},
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("client"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -424,7 +470,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				cTransportParameters,
 				cRunner,
 				clientConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("client"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -446,7 +495,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				sTransportParameters,
 				sRunner,
 				serverConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("server"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -459,11 +511,11 @@ var _ = Describe("Crypto Setup TLS", func() {
 			Eventually(done).Should(BeClosed())
 			Expect(cTransportParametersRcvd).ToNot(BeNil())
 			clTP := &TransportParameters{}
-			Expect(clTP.Unmarshal(cTransportParametersRcvd, protocol.PerspectiveClient)).To(Succeed())
+			Expect(clTP.Unmarshal(cTransportParametersRcvd, protocol.PerspectiveClient, protocol.VersionTLS)).To(Succeed())
 			Expect(clTP.IdleTimeout).To(Equal(cTransportParameters.IdleTimeout))
 			Expect(sTransportParametersRcvd).ToNot(BeNil())
 			srvTP := &TransportParameters{}
-			Expect(srvTP.Unmarshal(sTransportParametersRcvd, protocol.PerspectiveServer)).To(Succeed())
+			Expect(srvTP.Unmarshal(sTransportParametersRcvd, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 			Expect(srvTP.IdleTimeout).To(Equal(sTransportParameters.IdleTimeout))
 		})
 
@@ -481,7 +533,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				cRunner,
 				clientConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("client"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -498,7 +553,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				sRunner,
 				serverConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("server"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -536,7 +594,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				cRunner,
 				clientConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("client"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -553,7 +614,10 @@ var _ = Describe("Crypto Setup TLS", func() {
 				&TransportParameters{},
 				sRunner,
 				serverConf,
+				&congestion.RTTStats{},
+				0,
 				utils.DefaultLogger.WithPrefix("server"),
+				protocol.VersionTLS,
 			)
 			Expect(err).ToNot(HaveOccurred())
 
@@ -39,7 +39,7 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 
 		It("computes the client key and IV", func() {
-			clientSecret, _ := computeSecrets(connID)
+			clientSecret, _ := computeSecrets(connID, protocol.VersionTLS)
 			Expect(clientSecret).To(Equal(split("8a3515a14ae3c31b9c2d6d5bc58538ca 5cd2baa119087143e60887428dcb52f6")))
 			key, hpKey, iv := computeInitialKeyAndIV(clientSecret)
 			Expect(key).To(Equal(split("98b0d7e5e7a402c67c33f350fa65ea54")))
@@ -48,7 +48,7 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 
 		It("computes the server key and IV", func() {
-			_, serverSecret := computeSecrets(connID)
+			_, serverSecret := computeSecrets(connID, protocol.VersionTLS)
 			Expect(serverSecret).To(Equal(split("47b2eaea6c266e32c0697a9e2a898bdf 5c4fb3e5ac34f0e549bf2c58581a3811")))
 			key, hpKey, iv := computeInitialKeyAndIV(serverSecret)
 			Expect(key).To(Equal(split("9a8be902a9bdd91d16064ca118045fb4")))
@@ -57,7 +57,7 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 
 		It("encrypts the client's Initial", func() {
-			sealer, _, err := NewInitialAEAD(connID, protocol.PerspectiveClient)
+			sealer, _, err := NewInitialAEAD(connID, protocol.PerspectiveClient, protocol.VersionTLS)
 			Expect(err).ToNot(HaveOccurred())
 			header := split("c3ff000012508394c8f03e51570800449f00000002")
 			data := split("060040c4010000c003036660261ff947 cea49cce6cfad687f457cf1b14531ba1 4131a0e8f309a1d0b9c4000006130113 031302010000910000000b0009000006 736572766572ff01000100000a001400 12001d00170018001901000101010201 03010400230000003300260024001d00 204cfdfcd178b784bf328cae793b136f 2aedce005ff183d7bb14952072366470 37002b0003020304000d0020001e0403 05030603020308040805080604010501 060102010402050206020202002d0002 0101001c00024001")
@@ -73,7 +73,7 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 
 		It("encrypt the server's Initial", func() {
-			sealer, _, err := NewInitialAEAD(connID, protocol.PerspectiveServer)
+			sealer, _, err := NewInitialAEAD(connID, protocol.PerspectiveServer, protocol.VersionTLS)
 			Expect(err).ToNot(HaveOccurred())
 			header := split("c1ff00001205f067a5502a4262b50040740001")
 			data := split("0d0000000018410a020000560303eefc e7f7b37ba1d1632e96677825ddf73988 cfc79825df566dc5430b9a045a120013 0100002e00330024001d00209d3c940d 89690b84d08a60993c144eca684d1081 287c834d5311bcf32bb9da1a002b0002 0304")
@@ -87,11 +87,60 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 	})
 
+	// values taken from Appendix A of draft-ietf-quic-tls-29
+	Context("using the test vector from draft-29", func() {
+		var connID protocol.ConnectionID
+
+		BeforeEach(func() {
+			connID = protocol.ConnectionID(split("0x8394c8f03e515708"))
+		})
+
+		It("computes the client key and IV", func() {
+			clientSecret, _ := computeSecrets(connID, protocol.VersionDraft29)
+			Expect(clientSecret).To(Equal(split("0088119288f1d866733ceeed15ff9d50 902cf82952eee27e9d4d4918ea371d87")))
+			key, hpKey, iv := computeInitialKeyAndIV(clientSecret)
+			Expect(key).To(Equal(split("175257a31eb09dea9366d8bb79ad80ba")))
+			Expect(iv).To(Equal(split("6b26114b9cba2b63a9e8dd4f")))
+			Expect(hpKey).To(Equal(split("9ddd12c994c0698b89374a9c077a3077")))
+		})
+
+		It("computes the server key and IV", func() {
+			_, serverSecret := computeSecrets(connID, protocol.VersionDraft29)
+			Expect(serverSecret).To(Equal(split("006f881359244dd9ad1acf85f595bad6 7c13f9f5586f5e64e1acae1d9ea8f616")))
+			key, hpKey, iv := computeInitialKeyAndIV(serverSecret)
+			Expect(key).To(Equal(split("149d0b1662ab871fbe63c49b5e655a5d")))
+			Expect(iv).To(Equal(split("bab2b12a4c76016ace47856d")))
+			Expect(hpKey).To(Equal(split("c0c499a65a60024a18a250974ea01dfa")))
+		})
+	})
+
+	It("uses a different salt for every version", func() {
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		secrets := make(map[string]protocol.VersionNumber)
+		for _, v := range protocol.SupportedVersions {
+			clientSecret, _ := computeSecrets(connID, v)
+			Expect(secrets).ToNot(HaveKey(string(clientSecret)))
+			secrets[string(clientSecret)] = v
+		}
+	})
+
+	It("doesn't work if initialized with different versions", func() {
+		connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+		clientSealer, _, err := NewInitialAEAD(connID, protocol.PerspectiveClient, protocol.VersionDraft23)
+		Expect(err).ToNot(HaveOccurred())
+		_, serverOpener, err := NewInitialAEAD(connID, protocol.PerspectiveServer, protocol.VersionDraft29)
+		Expect(err).ToNot(HaveOccurred())
+
+		clientMessage := clientSealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))
+		_, err = serverOpener.Open(nil, clientMessage, 42, []byte("aad"))
+		Expect(err).To(MatchError("cipher: message authentication failed"))
+	})
+
 	It("seals and opens", func() {
 		connectionID := protocol.ConnectionID{0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef}
-		clientSealer, clientOpener, err := NewInitialAEAD(connectionID, protocol.PerspectiveClient)
+		clientSealer, clientOpener, err := NewInitialAEAD(connectionID, protocol.PerspectiveClient, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
-		serverSealer, serverOpener, err := NewInitialAEAD(connectionID, protocol.PerspectiveServer)
+		serverSealer, serverOpener, err := NewInitialAEAD(connectionID, protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 
 		clientMessage := clientSealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))
@@ -107,9 +156,9 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 	It("doesn't work if initialized with different connection IDs", func() {
 		c1 := protocol.ConnectionID{0, 0, 0, 0, 0, 0, 0, 1}
 		c2 := protocol.ConnectionID{0, 0, 0, 0, 0, 0, 0, 2}
-		clientSealer, _, err := NewInitialAEAD(c1, protocol.PerspectiveClient)
+		clientSealer, _, err := NewInitialAEAD(c1, protocol.PerspectiveClient, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
-		_, serverOpener, err := NewInitialAEAD(c2, protocol.PerspectiveServer)
+		_, serverOpener, err := NewInitialAEAD(c2, protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 
 		clientMessage := clientSealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))
@@ -119,9 +168,9 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 
 	It("encrypts und decrypts the header", func() {
 		connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
-		clientSealer, clientOpener, err := NewInitialAEAD(connID, protocol.PerspectiveClient)
+		clientSealer, clientOpener, err := NewInitialAEAD(connID, protocol.PerspectiveClient, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
-		serverSealer, serverOpener, err := NewInitialAEAD(connID, protocol.PerspectiveServer)
+		serverSealer, serverOpener, err := NewInitialAEAD(connID, protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).ToNot(HaveOccurred())
 
 		// the first byte and the last 4 bytes should be encrypted
@@ -3,6 +3,7 @@ package handshake
 import (
 	"crypto/tls"
 	"io"
+	"time"
 
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/marten-seemann/qtls"
@@ -21,11 +22,26 @@ type Sealer interface {
 	Overhead() int
 }
 
+// ShortHeaderOpener opens a short header packet
+type ShortHeaderOpener interface {
+	Open(dst, src []byte, rcvTime time.Time, packetNumber protocol.PacketNumber, keyPhase int, associatedData []byte) ([]byte, error)
+	DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
+}
+
+// ShortHeaderSealer seals a short header packet
+type ShortHeaderSealer interface {
+	Sealer
+	// KeyPhase returns the key phase bit that has to be set on the packet.
+	// It must be called before Seal.
+	KeyPhase() int
+}
+
 // A tlsExtensionHandler sends and received the QUIC TLS extension.
 type tlsExtensionHandler interface {
 	GetExtensions(msgType uint8) []qtls.Extension
 	ReceivedExtensions(msgType uint8, exts []qtls.Extension)
 	TransportParameters() <-chan []byte
+	SetTransportParameters([]byte)
 }
 
 type handshakeRunner interface {
@@ -43,9 +59,17 @@ type CryptoSetup interface {
 
 	HandleMessage([]byte, protocol.EncryptionLevel) bool
 	Received1RTTAck()
+	SetLargest1RTTAcked(protocol.PacketNumber) error
 	ConnectionState() tls.ConnectionState
+	// ClientHelloInfo returns information about the ClientHello.
+	// It can only be used by the server, after the client's transport parameters were received.
+	ClientHelloInfo() *tls.ClientHelloInfo
+	// SetTransportParameters changes the transport parameters sent to the client.
+	// It can only be used by the server, while processing the client's transport parameters.
+	SetTransportParameters(*TransportParameters)
 
 	GetSealer() (protocol.EncryptionLevel, Sealer)
 	GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (Sealer, error)
 	GetOpener(protocol.EncryptionLevel) (Opener, error)
+	Get1RTTOpener() (ShortHeaderOpener, error)
 }
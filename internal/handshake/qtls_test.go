@@ -23,6 +23,7 @@ func (h *mockExtensionHandler) ReceivedExtensions(msgType uint8, exts []qtls.Ext
 	h.received = true
 }
 func (*mockExtensionHandler) TransportParameters() <-chan []byte { panic("not implemented") }
+func (*mockExtensionHandler) SetTransportParameters([]byte)      { panic("not implemented") }
 
 type mockClientSessionCache struct {
 	get, put string
@@ -0,0 +1,59 @@
+package handshake
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"sync"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+)
+
+// The key and the nonce used to calculate the Retry Integrity Tag.
+// They are defined in section 5.8 of draft-ietf-quic-tls-29.
+var (
+	retryKey   = [16]byte{0xcc, 0xce, 0x18, 0x7e, 0xd0, 0x9a, 0x09, 0xd0, 0x57, 0x28, 0x15, 0x5a, 0x6c, 0xb9, 0x6b, 0xe1}
+	retryNonce = [12]byte{0xe5, 0x49, 0x30, 0xf9, 0x7f, 0x21, 0x36, 0xf0, 0x53, 0x0a, 0x8c, 0x1c}
+)
+
+var retryAEAD cipher.AEAD
+
+func init() {
+	block, err := aes.NewCipher(retryKey[:])
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	retryAEAD = aead
+}
+
+var (
+	retryBuf   bytes.Buffer
+	retryMutex sync.Mutex
+)
+
+// GetRetryIntegrityTag calculates the Retry Integrity Tag of a Retry packet.
+// retry is the Retry packet, without the tag.
+// origDestConnID is the destination connection ID of the first Initial sent by the client.
+func GetRetryIntegrityTag(retry []byte, origDestConnID protocol.ConnectionID) *[16]byte {
+	retryMutex.Lock()
+	defer retryMutex.Unlock()
+
+	// The tag is calculated over the Retry Pseudo-Packet,
+	// which is the Retry packet, prefixed by the original destination connection ID.
+	retryBuf.Reset()
+	retryBuf.WriteByte(uint8(origDestConnID.Len()))
+	retryBuf.Write(origDestConnID.Bytes())
+	retryBuf.Write(retry)
+
+	var tag [16]byte
+	sealed := retryAEAD.Seal(tag[:0], retryNonce[:], nil, retryBuf.Bytes())
+	if len(sealed) != 16 {
+		panic(fmt.Sprintf("unexpected Retry Integrity Tag length: %d", len(sealed)))
+	}
+	return &tag
+}
@@ -0,0 +1,32 @@
+package handshake
+
+import (
+	"encoding/hex"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retry Integrity Check", func() {
+	decode := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		Expect(err).ToNot(HaveOccurred())
+		return b
+	}
+
+	// values taken from Appendix A.4 of draft-ietf-quic-tls-29
+	It("calculates the tag of the test vector", func() {
+		retry := decode("ffff00001d0008f067a5502a4262b5746f6b656e")
+		tag := GetRetryIntegrityTag(retry, protocol.ConnectionID(decode("8394c8f03e515708")))
+		Expect(tag[:]).To(Equal(decode("d16926d81f6f9ca2953a8aa4575e1e49")))
+	})
+
+	It("includes the original destination connection ID", func() {
+		retry := []byte("foobar")
+		tag1 := GetRetryIntegrityTag(retry, protocol.ConnectionID{1, 2, 3, 4})
+		tag2 := GetRetryIntegrityTag(retry, protocol.ConnectionID{1, 2, 3, 5})
+		Expect(*tag1).ToNot(Equal(*tag2))
+	})
+})
@@ -10,6 +10,10 @@ const quicTLSExtensionType = 0xffa5
 type extensionHandler struct {
 	ourParams  []byte
 	paramsChan chan []byte
+	// Only used by the server.
+	// Processing the client's transport parameters might change our transport parameters,
+	// so we wait until they are processed before sending the EncryptedExtensions.
+	ourParamsChan chan []byte
 
 	perspective protocol.Perspective
 }
@@ -19,9 +23,10 @@ var _ tlsExtensionHandler = &extensionHandler{}
 // newExtensionHandler creates a new extension handler
 func newExtensionHandler(params []byte, pers protocol.Perspective) tlsExtensionHandler {
 	return &extensionHandler{
-		ourParams:   params,
-		paramsChan:  make(chan []byte),
-		perspective: pers,
+		ourParams:     params,
+		paramsChan:    make(chan []byte),
+		ourParamsChan: make(chan []byte, 1),
+		perspective:   pers,
 	}
 }
 
@@ -51,6 +56,17 @@ func (h *extensionHandler) ReceivedExtensions(msgType uint8, exts []qtls.Extensi
 	}
 
 	h.paramsChan <- data
+	if h.perspective == protocol.PerspectiveServer {
+		if params := <-h.ourParamsChan; params != nil {
+			h.ourParams = params
+		}
+	}
+}
+
+// SetTransportParameters is called by the server after processing the client's transport parameters.
+// If params is nil, the transport parameters passed to newExtensionHandler are sent.
+func (h *extensionHandler) SetTransportParameters(params []byte) {
+	h.ourParamsChan <- params
 }
 
 func (h *extensionHandler) TransportParameters() <-chan []byte {
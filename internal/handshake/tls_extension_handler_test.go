@@ -60,6 +60,39 @@ var _ = Describe("TLS Extension Handler, for the server", func() {
 				Expect(data).To(Equal([]byte("raboof")))
 			})
 
+			It("waits until the transport parameters were processed", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					handlerServer.ReceivedExtensions(uint8(typeClientHello), chExts)
+					close(done)
+				}()
+
+				Eventually(handlerServer.TransportParameters()).Should(Receive())
+				Consistently(done).ShouldNot(BeClosed())
+				handlerServer.SetTransportParameters(nil)
+				Eventually(done).Should(BeClosed())
+				exts := handlerServer.GetExtensions(uint8(typeEncryptedExtensions))
+				Expect(exts).To(HaveLen(1))
+				Expect(exts[0].Data).To(Equal([]byte("foobar")))
+			})
+
+			It("sends updated transport parameters", func() {
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					handlerServer.ReceivedExtensions(uint8(typeClientHello), chExts)
+					close(done)
+				}()
+
+				Eventually(handlerServer.TransportParameters()).Should(Receive())
+				handlerServer.SetTransportParameters([]byte("updated"))
+				Eventually(done).Should(BeClosed())
+				exts := handlerServer.GetExtensions(uint8(typeEncryptedExtensions))
+				Expect(exts).To(HaveLen(1))
+				Expect(exts[0].Data).To(Equal([]byte("updated")))
+			})
+
 			It("sends nil on the channel if the extension is missing", func() {
 				go func() {
 					defer GinkgoRecover()
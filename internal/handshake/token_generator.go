@@ -33,18 +33,21 @@ type token struct {
 
 // A TokenGenerator generates tokens
 type TokenGenerator struct {
-	tokenProtector tokenProtector
+	tokenProtector TokenProtector
 }
 
-// NewTokenGenerator initializes a new TookenGenerator
+// NewTokenGenerator initializes a new TookenGenerator, using a random secret
 func NewTokenGenerator() (*TokenGenerator, error) {
 	tokenProtector, err := newTokenProtector()
 	if err != nil {
 		return nil, err
 	}
-	return &TokenGenerator{
-		tokenProtector: tokenProtector,
-	}, nil
+	return NewTokenGeneratorWithProtector(tokenProtector), nil
+}
+
+// NewTokenGeneratorWithProtector initializes a new TokenGenerator that uses the given TokenProtector
+func NewTokenGeneratorWithProtector(tokenProtector TokenProtector) *TokenGenerator {
+	return &TokenGenerator{tokenProtector: tokenProtector}
 }
 
 // NewRetryToken generates a new token for a Retry for a given source address
@@ -5,6 +5,7 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 
@@ -12,7 +13,7 @@ import (
 )
 
 // TokenProtector is used to create and verify a token
-type tokenProtector interface {
+type TokenProtector interface {
 	// NewToken creates a new token
 	NewToken([]byte) ([]byte, error)
 	// DecodeToken decodes a token
@@ -26,16 +27,33 @@ const (
 
 // tokenProtector is used to create and verify a token
 type tokenProtectorImpl struct {
-	secret []byte
+	// The first secret is used to create new tokens.
+	// Tokens created with any of the secrets are accepted.
+	secrets [][]byte
 }
 
-// newTokenProtector creates a source for source address tokens
-func newTokenProtector() (tokenProtector, error) {
+// newTokenProtector creates a source for source address tokens, using a random secret
+func newTokenProtector() (TokenProtector, error) {
 	secret := make([]byte, tokenSecretSize)
 	if _, err := rand.Read(secret); err != nil {
 		return nil, err
 	}
-	return &tokenProtectorImpl{secret: secret}, nil
+	return &tokenProtectorImpl{secrets: [][]byte{secret}}, nil
+}
+
+// NewTokenProtector creates a source for source address tokens, using the given keys.
+// New tokens are created using the first key.
+// Tokens created with any of the keys are accepted, which allows rotating the keys.
+func NewTokenProtector(keys [][]byte) (TokenProtector, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no token keys")
+	}
+	for _, key := range keys {
+		if len(key) < tokenSecretSize {
+			return nil, fmt.Errorf("token key too short: %d bytes (expected at least %d bytes)", len(key), tokenSecretSize)
+		}
+	}
+	return &tokenProtectorImpl{secrets: keys}, nil
 }
 
 // NewToken encodes data into a new token.
@@ -44,7 +62,7 @@ func (s *tokenProtectorImpl) NewToken(data []byte) ([]byte, error) {
 	if _, err := rand.Read(nonce); err != nil {
 		return nil, err
 	}
-	aead, aeadNonce, err := s.createAEAD(nonce)
+	aead, aeadNonce, err := s.createAEAD(s.secrets[0], nonce)
 	if err != nil {
 		return nil, err
 	}
@@ -57,15 +75,25 @@ func (s *tokenProtectorImpl) DecodeToken(p []byte) ([]byte, error) {
 		return nil, fmt.Errorf("Token too short: %d", len(p))
 	}
 	nonce := p[:tokenNonceSize]
-	aead, aeadNonce, err := s.createAEAD(nonce)
-	if err != nil {
-		return nil, err
+	var firstErr error
+	for _, secret := range s.secrets {
+		aead, aeadNonce, err := s.createAEAD(secret, nonce)
+		if err != nil {
+			return nil, err
+		}
+		data, err := aead.Open(nil, aeadNonce, p[tokenNonceSize:], nil)
+		if err == nil {
+			return data, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
 	}
-	return aead.Open(nil, aeadNonce, p[tokenNonceSize:], nil)
+	return nil, firstErr
 }
 
-func (s *tokenProtectorImpl) createAEAD(nonce []byte) (cipher.AEAD, []byte, error) {
-	h := hkdf.New(sha256.New, s.secret, nonce, []byte("quic-go token source"))
+func (s *tokenProtectorImpl) createAEAD(secret, nonce []byte) (cipher.AEAD, []byte, error) {
+	h := hkdf.New(sha256.New, secret, nonce, []byte("quic-go token source"))
 	key := make([]byte, 32) // use a 32 byte key, in order to select AES-256
 	if _, err := io.ReadFull(h, key); err != nil {
 		return nil, nil, err
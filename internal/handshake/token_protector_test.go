@@ -1,12 +1,14 @@
 package handshake
 
 import (
+	"bytes"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("Token Protector", func() {
-	var tp tokenProtector
+	var tp TokenProtector
 
 	BeforeEach(func() {
 		var err error
@@ -36,4 +38,59 @@ var _ = Describe("Token Protector", func() {
 		_, err := tp.DecodeToken([]byte("foobar"))
 		Expect(err).To(MatchError("Token too short: 6"))
 	})
+
+	Context("using keys", func() {
+		key := func(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+
+		It("encodes and decodes tokens using the same key", func() {
+			tp1, err := NewTokenProtector([][]byte{key(1)})
+			Expect(err).ToNot(HaveOccurred())
+			tp2, err := NewTokenProtector([][]byte{key(1)})
+			Expect(err).ToNot(HaveOccurred())
+			token, err := tp1.NewToken([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			decoded, err := tp2.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal([]byte("foobar")))
+		})
+
+		It("rejects tokens created with a different key", func() {
+			tp1, err := NewTokenProtector([][]byte{key(1)})
+			Expect(err).ToNot(HaveOccurred())
+			tp2, err := NewTokenProtector([][]byte{key(2)})
+			Expect(err).ToNot(HaveOccurred())
+			token, err := tp1.NewToken([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = tp2.DecodeToken(token)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("message authentication failed"))
+		})
+
+		It("accepts tokens created with previous keys", func() {
+			old, err := NewTokenProtector([][]byte{key(1)})
+			Expect(err).ToNot(HaveOccurred())
+			rotated, err := NewTokenProtector([][]byte{key(2), key(1)})
+			Expect(err).ToNot(HaveOccurred())
+			token, err := old.NewToken([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			decoded, err := rotated.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal([]byte("foobar")))
+			// new tokens are created using the current key
+			token, err = rotated.NewToken([]byte("raboof"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = old.DecodeToken(token)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("errors when no key is given", func() {
+			_, err := NewTokenProtector(nil)
+			Expect(err).To(MatchError("no token keys"))
+		})
+
+		It("errors when a key is too short", func() {
+			_, err := NewTokenProtector([][]byte{key(1), []byte("foobar")})
+			Expect(err).To(MatchError("token key too short: 6 bytes (expected at least 32 bytes)"))
+		})
+	})
 })
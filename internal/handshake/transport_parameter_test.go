@@ -75,11 +75,14 @@ var _ = Describe("Transport Parameters", func() {
 			OriginalConnectionID:           protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
 			AckDelayExponent:               13,
 			MaxAckDelay:                    42 * time.Millisecond,
+			ActiveConnectionIDLimit:        getRandomValue(),
+			MaxDatagramFrameSize:           protocol.ByteCount(getRandomValue()),
+			MaxPacketSize:                  9000,
 		}
-		data := params.Marshal()
+		data := params.Marshal(protocol.VersionTLS)
 
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(data, protocol.PerspectiveServer)).To(Succeed())
+		Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 		Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(params.InitialMaxStreamDataBidiLocal))
 		Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(params.InitialMaxStreamDataBidiRemote))
 		Expect(p.InitialMaxStreamDataUni).To(Equal(params.InitialMaxStreamDataUni))
@@ -92,17 +95,45 @@ var _ = Describe("Transport Parameters", func() {
 		Expect(p.OriginalConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
 		Expect(p.AckDelayExponent).To(Equal(uint8(13)))
 		Expect(p.MaxAckDelay).To(Equal(42 * time.Millisecond))
+		Expect(p.ActiveConnectionIDLimit).To(Equal(params.ActiveConnectionIDLimit))
+		Expect(p.MaxDatagramFrameSize).To(Equal(params.MaxDatagramFrameSize))
+		Expect(p.MaxPacketSize).To(BeEquivalentTo(9000))
+	})
+
+	It("uses the default max_packet_size, if none is set", func() {
+		data := (&TransportParameters{}).Marshal(protocol.VersionTLS)
+		p := &TransportParameters{}
+		Expect(p.Unmarshal(data, protocol.PerspectiveClient, protocol.VersionTLS)).To(Succeed())
+		Expect(p.MaxPacketSize).To(Equal(protocol.MaxReceivePacketSize))
+	})
+
+	It("doesn't send the active_connection_id_limit, if NEW_CONNECTION_ID frames are not supported", func() {
+		data := (&TransportParameters{}).Marshal(protocol.VersionTLS)
+		p := &TransportParameters{}
+		Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+		Expect(p.ActiveConnectionIDLimit).To(BeZero())
+		Expect(p.String()).ToNot(ContainSubstring("ActiveConnectionIDLimit"))
+		p.ActiveConnectionIDLimit = 4
+		Expect(p.String()).To(ContainSubstring("ActiveConnectionIDLimit: 4"))
+	})
+
+	It("doesn't send the max_datagram_frame_size, if DATAGRAM frames are not supported", func() {
+		data := (&TransportParameters{}).Marshal(protocol.VersionTLS)
+		p := &TransportParameters{}
+		Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+		Expect(p.MaxDatagramFrameSize).To(BeZero())
+		Expect(p.String()).ToNot(ContainSubstring("MaxDatagramFrameSize"))
 	})
 
 	It("errors if the transport parameters are too short to contain the length", func() {
-		Expect((&TransportParameters{}).Unmarshal([]byte{0}, protocol.PerspectiveClient)).To(MatchError("transport parameter data too short"))
+		Expect((&TransportParameters{}).Unmarshal([]byte{0}, protocol.PerspectiveClient, protocol.VersionTLS)).To(MatchError("transport parameter data too short"))
 	})
 
 	It("errors if the transport parameters are too short to contain the length", func() {
 		data := make([]byte, 2)
 		binary.BigEndian.PutUint16(data, 42)
 		data = append(data, make([]byte, 41)...)
-		Expect((&TransportParameters{}).Unmarshal(data, protocol.PerspectiveClient)).To(MatchError("expected transport parameters to be 42 bytes long, have 41"))
+		Expect((&TransportParameters{}).Unmarshal(data, protocol.PerspectiveClient, protocol.VersionTLS)).To(MatchError("expected transport parameters to be 42 bytes long, have 41"))
 	})
 
 	It("errors when the stateless_reset_token has the wrong length", func() {
@@ -111,7 +142,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, 15)
 		b.Write(make([]byte, 15))
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(MatchError("wrong length for stateless_reset_token: 15 (expected 16)"))
+		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("wrong length for stateless_reset_token: 15 (expected 16)"))
 	})
 
 	It("errors when the max_packet_size is too small", func() {
@@ -120,7 +151,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(1199)))
 		utils.WriteVarInt(b, 1199)
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(MatchError("invalid value for max_packet_size: 1199 (minimum 1200)"))
+		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("invalid value for max_packet_size: 1199 (minimum 1200)"))
 	})
 
 	It("errors when disable_migration has content", func() {
@@ -129,39 +160,39 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, 6)
 		b.Write([]byte("foobar"))
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(MatchError("wrong length for disable_migration: 6 (expected empty)"))
+		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("wrong length for disable_migration: 6 (expected empty)"))
 	})
 
 	It("errors when the max_ack_delay is too large", func() {
-		data := (&TransportParameters{MaxAckDelay: 1 << 14 * time.Millisecond}).Marshal()
+		data := (&TransportParameters{MaxAckDelay: 1 << 14 * time.Millisecond}).Marshal(protocol.VersionTLS)
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(data, protocol.PerspectiveServer)).To(MatchError("invalid value for max_ack_delay: 16384ms (maximum 16383ms)"))
+		Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("invalid value for max_ack_delay: 16384ms (maximum 16383ms)"))
 	})
 
 	It("doesn't send the max_ack_delay, if it has the default value", func() {
-		dataDefault := (&TransportParameters{MaxAckDelay: protocol.DefaultMaxAckDelay}).Marshal()
+		dataDefault := (&TransportParameters{MaxAckDelay: protocol.DefaultMaxAckDelay}).Marshal(protocol.VersionTLS)
 		defaultLen := len(dataDefault)
-		data := (&TransportParameters{MaxAckDelay: protocol.DefaultMaxAckDelay + time.Millisecond}).Marshal()
+		data := (&TransportParameters{MaxAckDelay: protocol.DefaultMaxAckDelay + time.Millisecond}).Marshal(protocol.VersionTLS)
 		Expect(len(data)).To(Equal(defaultLen + 2 /* parameter ID */ + 2 /* length field */ + 1 /* value */))
 	})
 
 	It("errors when the ack_delay_exponenent is too large", func() {
-		data := (&TransportParameters{AckDelayExponent: 21}).Marshal()
+		data := (&TransportParameters{AckDelayExponent: 21}).Marshal(protocol.VersionTLS)
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(data, protocol.PerspectiveServer)).To(MatchError("invalid value for ack_delay_exponent: 21 (maximum 20)"))
+		Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("invalid value for ack_delay_exponent: 21 (maximum 20)"))
 	})
 
 	It("doesn't send the ack_delay_exponent, if it has the default value", func() {
-		dataDefault := (&TransportParameters{AckDelayExponent: protocol.DefaultAckDelayExponent}).Marshal()
+		dataDefault := (&TransportParameters{AckDelayExponent: protocol.DefaultAckDelayExponent}).Marshal(protocol.VersionTLS)
 		defaultLen := len(dataDefault)
-		data := (&TransportParameters{AckDelayExponent: protocol.DefaultAckDelayExponent + 1}).Marshal()
+		data := (&TransportParameters{AckDelayExponent: protocol.DefaultAckDelayExponent + 1}).Marshal(protocol.VersionTLS)
 		Expect(len(data)).To(Equal(defaultLen + 2 /* parameter ID */ + 2 /* length field */ + 1 /* value */))
 	})
 
 	It("sets the default value for the ack_delay_exponent, when no value was sent", func() {
-		data := (&TransportParameters{AckDelayExponent: protocol.DefaultAckDelayExponent}).Marshal()
+		data := (&TransportParameters{AckDelayExponent: protocol.DefaultAckDelayExponent}).Marshal(protocol.VersionTLS)
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(data, protocol.PerspectiveServer)).To(Succeed())
+		Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 		Expect(p.AckDelayExponent).To(BeEquivalentTo(protocol.DefaultAckDelayExponent))
 	})
 
@@ -173,7 +204,7 @@ var _ = Describe("Transport Parameters", func() {
 		Expect(utils.VarIntLen(val)).ToNot(BeEquivalentTo(2))
 		utils.WriteVarInt(b, val)
 		p := &TransportParameters{}
-		err := p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)
+		err := p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("inconsistent transport parameter length"))
 	})
@@ -193,7 +224,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(0x42)))
 		utils.WriteVarInt(b, 0x42)
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(Succeed())
+		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
 		Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(protocol.ByteCount(0x1337)))
 		Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(protocol.ByteCount(0x42)))
 	})
@@ -213,7 +244,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(0x1337)))
 		utils.WriteVarInt(b, 0x1337)
 		p := &TransportParameters{}
-		err := p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)
+		err := p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("received duplicate transport parameter"))
 	})
@@ -224,7 +255,7 @@ var _ = Describe("Transport Parameters", func() {
 		utils.BigEndian.WriteUint16(b, 7)
 		b.Write([]byte("foobar"))
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(MatchError("remaining length (6) smaller than parameter length (7)"))
+		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("remaining length (6) smaller than parameter length (7)"))
 	})
 
 	It("errors if there's unprocessed data after reading", func() {
@@ -234,21 +265,149 @@ var _ = Describe("Transport Parameters", func() {
 		utils.WriteVarInt(b, 0x1337)
 		b.Write([]byte("foo"))
 		p := &TransportParameters{}
-		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(MatchError("should have read all data. Still have 3 bytes"))
+		Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer, protocol.VersionTLS)).To(MatchError("should have read all data. Still have 3 bytes"))
 	})
 
 	It("errors if the client sent a stateless_reset_token", func() {
 		var token [16]byte
 		params := &TransportParameters{StatelessResetToken: &token}
-		data := params.Marshal()
-		Expect((&TransportParameters{}).Unmarshal(data, protocol.PerspectiveClient)).To(MatchError("client sent a stateless_reset_token"))
+		data := params.Marshal(protocol.VersionTLS)
+		Expect((&TransportParameters{}).Unmarshal(data, protocol.PerspectiveClient, protocol.VersionTLS)).To(MatchError("client sent a stateless_reset_token"))
 	})
 
 	It("errors if the client sent a stateless_reset_token", func() {
 		params := &TransportParameters{
 			OriginalConnectionID: protocol.ConnectionID{0xca, 0xfe},
 		}
-		data := params.Marshal()
-		Expect((&TransportParameters{}).Unmarshal(data, protocol.PerspectiveClient)).To(MatchError("client sent an original_connection_id"))
+		data := params.Marshal(protocol.VersionTLS)
+		Expect((&TransportParameters{}).Unmarshal(data, protocol.PerspectiveClient, protocol.VersionTLS)).To(MatchError("client sent an original_connection_id"))
+	})
+
+	Context("using variable-length integers, for draft-27 and later", func() {
+		It("marshals and unmarshals", func() {
+			var token [16]byte
+			rand.Read(token[:])
+			params := &TransportParameters{
+				InitialMaxStreamDataBidiLocal: 0x1337,
+				InitialMaxData:                0xdeadbeef,
+				IdleTimeout:                   42 * time.Second,
+				DisableMigration:              true,
+				StatelessResetToken:           &token,
+				OriginalConnectionID:          protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+				InitialSourceConnectionID:     protocol.ConnectionID{0xca, 0xfe},
+				RetrySourceConnectionID:       &protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+				ActiveConnectionIDLimit:       4,
+			}
+			data := params.Marshal(protocol.VersionDraft29)
+			Expect(data).ToNot(Equal(params.Marshal(protocol.VersionTLS)))
+
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionDraft29)).To(Succeed())
+			Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(params.InitialMaxStreamDataBidiLocal))
+			Expect(p.InitialMaxData).To(Equal(params.InitialMaxData))
+			Expect(p.IdleTimeout).To(Equal(params.IdleTimeout))
+			Expect(p.DisableMigration).To(BeTrue())
+			Expect(p.StatelessResetToken).To(Equal(params.StatelessResetToken))
+			Expect(p.OriginalConnectionID).To(Equal(params.OriginalConnectionID))
+			Expect(p.InitialSourceConnectionID).To(Equal(params.InitialSourceConnectionID))
+			Expect(p.RetrySourceConnectionID).To(Equal(params.RetrySourceConnectionID))
+			Expect(p.ActiveConnectionIDLimit).To(Equal(params.ActiveConnectionIDLimit))
+		})
+
+		It("doesn't prefix the parameters with their length", func() {
+			data := (&TransportParameters{
+				AckDelayExponent: protocol.DefaultAckDelayExponent,
+				MaxAckDelay:      protocol.DefaultMaxAckDelay,
+			}).Marshal(protocol.VersionDraft29)
+			b := &bytes.Buffer{}
+			for _, id := range []transportParameterID{
+				initialMaxStreamDataBidiLocalParameterID,
+				initialMaxStreamDataBidiRemoteParameterID,
+				initialMaxStreamDataUniParameterID,
+				initialMaxDataParameterID,
+				initialMaxStreamsBidiParameterID,
+				initialMaxStreamsUniParameterID,
+				idleTimeoutParameterID,
+			} {
+				utils.WriteVarInt(b, uint64(id))
+				utils.WriteVarInt(b, 1)
+				utils.WriteVarInt(b, 0)
+			}
+			utils.WriteVarInt(b, uint64(maxPacketSizeParameterID))
+			utils.WriteVarInt(b, uint64(utils.VarIntLen(uint64(protocol.MaxReceivePacketSize))))
+			utils.WriteVarInt(b, uint64(protocol.MaxReceivePacketSize))
+			utils.WriteVarInt(b, uint64(initialSourceConnectionIDParameterID))
+			utils.WriteVarInt(b, 0)
+			Expect(data).To(Equal(b.Bytes()))
+		})
+
+		It("skips unknown parameters with large IDs", func() {
+			b := &bytes.Buffer{}
+			// write an unknown parameter, using a reserved ID
+			utils.WriteVarInt(b, 31*1337+27)
+			utils.WriteVarInt(b, 6)
+			b.Write([]byte("foobar"))
+			// write a known parameter
+			utils.WriteVarInt(b, uint64(initialMaxDataParameterID))
+			utils.WriteVarInt(b, uint64(utils.VarIntLen(0x42)))
+			utils.WriteVarInt(b, 0x42)
+			utils.WriteVarInt(b, uint64(initialSourceConnectionIDParameterID))
+			utils.WriteVarInt(b, 0)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.VersionDraft29)).To(Succeed())
+			Expect(p.InitialMaxData).To(Equal(protocol.ByteCount(0x42)))
+		})
+
+		It("errors if the parameter header is incomplete", func() {
+			b := &bytes.Buffer{}
+			utils.WriteVarInt(b, uint64(initialMaxDataParameterID))
+			utils.WriteVarInt(b, 4)
+			utils.WriteVarInt(b, 0xdeadbeef)
+			b.Write([]byte{0x40}) // the first byte of a 2 byte varint
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(b.Bytes(), protocol.PerspectiveServer, protocol.VersionDraft29)).ToNot(Succeed())
+		})
+	})
+
+	Context("authenticating the connection IDs, for draft-28 and later", func() {
+		It("sends an empty initial_source_connection_id", func() {
+			data := (&TransportParameters{}).Marshal(protocol.VersionDraft29)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(data, protocol.PerspectiveClient, protocol.VersionDraft29)).To(Succeed())
+			Expect(p.InitialSourceConnectionID).To(BeEmpty())
+			Expect(p.RetrySourceConnectionID).To(BeNil())
+		})
+
+		It("doesn't send the connection ID parameters for older versions", func() {
+			params := &TransportParameters{
+				InitialSourceConnectionID: protocol.ConnectionID{0xca, 0xfe},
+				RetrySourceConnectionID:   &protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+			}
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(params.Marshal(protocol.VersionDraft23), protocol.PerspectiveServer, protocol.VersionDraft23)).To(Succeed())
+			Expect(p.InitialSourceConnectionID).To(BeNil())
+			Expect(p.RetrySourceConnectionID).To(BeNil())
+		})
+
+		It("errors if the initial_source_connection_id is missing", func() {
+			b := &bytes.Buffer{}
+			utils.WriteVarInt(b, uint64(initialMaxDataParameterID))
+			utils.WriteVarInt(b, uint64(utils.VarIntLen(0x42)))
+			utils.WriteVarInt(b, 0x42)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(b.Bytes(), protocol.PerspectiveClient, protocol.VersionDraft29)).To(MatchError("missing initial_source_connection_id"))
+		})
+
+		It("errors if the server didn't send the original_connection_id", func() {
+			data := (&TransportParameters{InitialSourceConnectionID: protocol.ConnectionID{0xca, 0xfe}}).Marshal(protocol.VersionDraft29)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(data, protocol.PerspectiveServer, protocol.VersionDraft29)).To(MatchError("missing original_connection_id"))
+		})
+
+		It("errors if the client sent a retry_source_connection_id", func() {
+			data := (&TransportParameters{RetrySourceConnectionID: &protocol.ConnectionID{0xca, 0xfe}}).Marshal(protocol.VersionDraft29)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(data, protocol.PerspectiveClient, protocol.VersionDraft29)).To(MatchError("client sent a retry_source_connection_id"))
+		})
 	})
 })
@@ -13,7 +13,7 @@ import (
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 )
 
-type transportParameterID uint16
+type transportParameterID uint64
 
 const (
 	originalConnectionIDParameterID           transportParameterID = 0x0
@@ -29,6 +29,11 @@ const (
 	ackDelayExponentParameterID               transportParameterID = 0xa
 	maxAckDelayParameterID                    transportParameterID = 0xb
 	disableMigrationParameterID               transportParameterID = 0xc
+	activeConnectionIDLimitParameterID        transportParameterID = 0xe
+	initialSourceConnectionIDParameterID      transportParameterID = 0xf
+	retrySourceConnectionIDParameterID        transportParameterID = 0x10
+	// https://tools.ietf.org/html/draft-pauly-quic-datagram-02
+	maxDatagramFrameSizeParameterID transportParameterID = 0x20
 )
 
 // TransportParameters are parameters sent to the peer during the handshake
@@ -51,16 +56,38 @@ type TransportParameters struct {
 
 	StatelessResetToken  *[16]byte
 	OriginalConnectionID protocol.ConnectionID
+
+	// InitialSourceConnectionID and RetrySourceConnectionID are used to authenticate the connection IDs,
+	// see protocol.VersionNumber.AuthenticatesConnectionIDs.
+	// InitialSourceConnectionID is the source connection ID of the first Initial packet sent by the endpoint.
+	// RetrySourceConnectionID is the source connection ID of the Retry packet sent by the server, if any.
+	InitialSourceConnectionID protocol.ConnectionID
+	RetrySourceConnectionID   *protocol.ConnectionID
+
+	// ActiveConnectionIDLimit is the number of connection IDs the endpoint is willing to store.
+	// A value of 0 means that the endpoint doesn't support NEW_CONNECTION_ID frames.
+	ActiveConnectionIDLimit uint64
+
+	// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame the endpoint is willing to receive.
+	// A value of 0 means that DATAGRAM frames are not supported.
+	MaxDatagramFrameSize protocol.ByteCount
 }
 
-// Unmarshal the transport parameters
-func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective) error {
-	if len(data) < 2 {
-		return errors.New("transport parameter data too short")
-	}
-	length := binary.BigEndian.Uint16(data[:2])
-	if len(data)-2 < int(length) {
-		return fmt.Errorf("expected transport parameters to be %d bytes long, have %d", length, len(data)-2)
+// Unmarshal the transport parameters.
+// The encoding depends on the QUIC version, see protocol.VersionNumber.UsesVarIntTransportParameters.
+func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective, v protocol.VersionNumber) error {
+	// draft-27 and later don't prefix the transport parameters with their length
+	minParamLen := 2
+	if !v.UsesVarIntTransportParameters() {
+		if len(data) < 2 {
+			return errors.New("transport parameter data too short")
+		}
+		length := binary.BigEndian.Uint16(data[:2])
+		if len(data)-2 < int(length) {
+			return fmt.Errorf("expected transport parameters to be %d bytes long, have %d", length, len(data)-2)
+		}
+		data = data[2:]
+		minParamLen = 4
 	}
 
 	// needed to check that every parameter is only sent at most once
@@ -68,12 +95,15 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 
 	var readAckDelayExponent bool
 	var readMaxAckDelay bool
+	var readOriginalConnectionID bool
+	var readInitialSourceConnectionID bool
 
-	r := bytes.NewReader(data[2:])
-	for r.Len() >= 4 {
-		paramIDInt, _ := utils.BigEndian.ReadUint16(r)
-		paramID := transportParameterID(paramIDInt)
-		paramLen, _ := utils.BigEndian.ReadUint16(r)
+	r := bytes.NewReader(data)
+	for r.Len() >= minParamLen {
+		paramID, paramLen, err := readTransportParameterHeader(r, v)
+		if err != nil {
+			return err
+		}
 		parameterIDs = append(parameterIDs, paramID)
 		switch paramID {
 		case ackDelayExponentParameterID:
@@ -93,7 +123,9 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 			initialMaxStreamsBidiParameterID,
 			initialMaxStreamsUniParameterID,
 			idleTimeoutParameterID,
-			maxPacketSizeParameterID:
+			maxPacketSizeParameterID,
+			activeConnectionIDLimitParameterID,
+			maxDatagramFrameSizeParameterID:
 			if err := p.readNumericTransportParameter(r, paramID, int(paramLen)); err != nil {
 				return err
 			}
@@ -122,6 +154,16 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 					return errors.New("client sent an original_connection_id")
 				}
 				p.OriginalConnectionID, _ = protocol.ReadConnectionID(r, int(paramLen))
+				readOriginalConnectionID = true
+			case initialSourceConnectionIDParameterID:
+				p.InitialSourceConnectionID, _ = protocol.ReadConnectionID(r, int(paramLen))
+				readInitialSourceConnectionID = true
+			case retrySourceConnectionIDParameterID:
+				if sentBy == protocol.PerspectiveClient {
+					return errors.New("client sent a retry_source_connection_id")
+				}
+				connID, _ := protocol.ReadConnectionID(r, int(paramLen))
+				p.RetrySourceConnectionID = &connID
 			default:
 				r.Seek(int64(paramLen), io.SeekCurrent)
 			}
@@ -134,6 +176,14 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 	if !readMaxAckDelay {
 		p.MaxAckDelay = protocol.DefaultMaxAckDelay
 	}
+	if v.AuthenticatesConnectionIDs() {
+		if !readInitialSourceConnectionID {
+			return errors.New("missing initial_source_connection_id")
+		}
+		if sentBy == protocol.PerspectiveServer && !readOriginalConnectionID {
+			return errors.New("missing original_connection_id")
+		}
+	}
 
 	// check that every transport parameter was sent at most once
 	sort.Slice(parameterIDs, func(i, j int) bool { return parameterIDs[i] < parameterIDs[j] })
@@ -149,6 +199,24 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 	return nil
 }
 
+// readTransportParameterHeader reads the ID and the length of a transport parameter.
+func readTransportParameterHeader(r *bytes.Reader, v protocol.VersionNumber) (transportParameterID, uint64, error) {
+	if !v.UsesVarIntTransportParameters() {
+		paramID, _ := utils.BigEndian.ReadUint16(r)
+		paramLen, _ := utils.BigEndian.ReadUint16(r)
+		return transportParameterID(paramID), uint64(paramLen), nil
+	}
+	paramID, err := utils.ReadVarInt(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	paramLen, err := utils.ReadVarInt(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return transportParameterID(paramID), paramLen, nil
+}
+
 func (p *TransportParameters) readNumericTransportParameter(
 	r *bytes.Reader,
 	paramID transportParameterID,
@@ -193,71 +261,111 @@ func (p *TransportParameters) readNumericTransportParameter(
 			return fmt.Errorf("invalid value for max_ack_delay: %dms (maximum %dms)", maxAckDelay/time.Millisecond, (protocol.MaxMaxAckDelay-time.Millisecond)/time.Millisecond)
 		}
 		p.MaxAckDelay = maxAckDelay
+	case activeConnectionIDLimitParameterID:
+		p.ActiveConnectionIDLimit = val
+	case maxDatagramFrameSizeParameterID:
+		p.MaxDatagramFrameSize = protocol.ByteCount(val)
 	default:
 		return fmt.Errorf("TransportParameter BUG: transport parameter %d not found", paramID)
 	}
 	return nil
 }
 
-// Marshal the transport parameters
-func (p *TransportParameters) Marshal() []byte {
+// Marshal the transport parameters.
+// The encoding depends on the QUIC version, see protocol.VersionNumber.UsesVarIntTransportParameters.
+func (p *TransportParameters) Marshal(v protocol.VersionNumber) []byte {
 	b := &bytes.Buffer{}
-	b.Write([]byte{0, 0}) // length. Will be replaced later
+	if !v.UsesVarIntTransportParameters() {
+		b.Write([]byte{0, 0}) // length. Will be replaced later
+	}
 
 	// initial_max_stream_data_bidi_local
-	p.marshalVarintParam(b, initialMaxStreamDataBidiLocalParameterID, uint64(p.InitialMaxStreamDataBidiLocal))
+	p.marshalVarintParam(b, v, initialMaxStreamDataBidiLocalParameterID, uint64(p.InitialMaxStreamDataBidiLocal))
 	// initial_max_stream_data_bidi_remote
-	p.marshalVarintParam(b, initialMaxStreamDataBidiRemoteParameterID, uint64(p.InitialMaxStreamDataBidiRemote))
+	p.marshalVarintParam(b, v, initialMaxStreamDataBidiRemoteParameterID, uint64(p.InitialMaxStreamDataBidiRemote))
 	// initial_max_stream_data_uni
-	p.marshalVarintParam(b, initialMaxStreamDataUniParameterID, uint64(p.InitialMaxStreamDataUni))
+	p.marshalVarintParam(b, v, initialMaxStreamDataUniParameterID, uint64(p.InitialMaxStreamDataUni))
 	// initial_max_data
-	p.marshalVarintParam(b, initialMaxDataParameterID, uint64(p.InitialMaxData))
+	p.marshalVarintParam(b, v, initialMaxDataParameterID, uint64(p.InitialMaxData))
 	// initial_max_bidi_streams
-	p.marshalVarintParam(b, initialMaxStreamsBidiParameterID, uint64(p.MaxBidiStreamNum))
+	p.marshalVarintParam(b, v, initialMaxStreamsBidiParameterID, uint64(p.MaxBidiStreamNum))
 	// initial_max_uni_streams
-	p.marshalVarintParam(b, initialMaxStreamsUniParameterID, uint64(p.MaxUniStreamNum))
+	p.marshalVarintParam(b, v, initialMaxStreamsUniParameterID, uint64(p.MaxUniStreamNum))
 	// idle_timeout
-	p.marshalVarintParam(b, idleTimeoutParameterID, uint64(p.IdleTimeout/time.Millisecond))
+	p.marshalVarintParam(b, v, idleTimeoutParameterID, uint64(p.IdleTimeout/time.Millisecond))
 	// max_packet_size
-	p.marshalVarintParam(b, maxPacketSizeParameterID, uint64(protocol.MaxReceivePacketSize))
+	maxPacketSize := p.MaxPacketSize
+	if maxPacketSize == 0 {
+		maxPacketSize = protocol.MaxReceivePacketSize
+	}
+	p.marshalVarintParam(b, v, maxPacketSizeParameterID, uint64(maxPacketSize))
 	// max_ack_delay
 	// Only send it if is different from the default value.
 	if p.MaxAckDelay != protocol.DefaultMaxAckDelay {
-		p.marshalVarintParam(b, maxAckDelayParameterID, uint64(p.MaxAckDelay/time.Millisecond))
+		p.marshalVarintParam(b, v, maxAckDelayParameterID, uint64(p.MaxAckDelay/time.Millisecond))
 	}
 	// ack_delay_exponent
 	// Only send it if is different from the default value.
 	if p.AckDelayExponent != protocol.DefaultAckDelayExponent {
-		p.marshalVarintParam(b, ackDelayExponentParameterID, uint64(p.AckDelayExponent))
+		p.marshalVarintParam(b, v, ackDelayExponentParameterID, uint64(p.AckDelayExponent))
 	}
 	// disable_migration
 	if p.DisableMigration {
-		utils.BigEndian.WriteUint16(b, uint16(disableMigrationParameterID))
-		utils.BigEndian.WriteUint16(b, 0)
+		writeTransportParameterHeader(b, v, disableMigrationParameterID, 0)
 	}
 	if p.StatelessResetToken != nil {
-		utils.BigEndian.WriteUint16(b, uint16(statelessResetTokenParameterID))
-		utils.BigEndian.WriteUint16(b, 16)
+		writeTransportParameterHeader(b, v, statelessResetTokenParameterID, 16)
 		b.Write(p.StatelessResetToken[:])
 	}
+	// active_connection_id_limit
+	// Only send it if we accept NEW_CONNECTION_ID frames.
+	if p.ActiveConnectionIDLimit > 0 {
+		p.marshalVarintParam(b, v, activeConnectionIDLimitParameterID, p.ActiveConnectionIDLimit)
+	}
+	// max_datagram_frame_size
+	// Only send it if DATAGRAM frames are supported.
+	if p.MaxDatagramFrameSize > 0 {
+		p.marshalVarintParam(b, v, maxDatagramFrameSizeParameterID, uint64(p.MaxDatagramFrameSize))
+	}
 	// original_connection_id
 	if p.OriginalConnectionID.Len() > 0 {
-		utils.BigEndian.WriteUint16(b, uint16(originalConnectionIDParameterID))
-		utils.BigEndian.WriteUint16(b, uint16(p.OriginalConnectionID.Len()))
+		writeTransportParameterHeader(b, v, originalConnectionIDParameterID, uint64(p.OriginalConnectionID.Len()))
 		b.Write(p.OriginalConnectionID.Bytes())
 	}
+	if v.AuthenticatesConnectionIDs() {
+		// initial_source_connection_id
+		// It is sent even if the connection ID is empty.
+		writeTransportParameterHeader(b, v, initialSourceConnectionIDParameterID, uint64(p.InitialSourceConnectionID.Len()))
+		b.Write(p.InitialSourceConnectionID.Bytes())
+		// retry_source_connection_id
+		if p.RetrySourceConnectionID != nil {
+			writeTransportParameterHeader(b, v, retrySourceConnectionIDParameterID, uint64(p.RetrySourceConnectionID.Len()))
+			b.Write(p.RetrySourceConnectionID.Bytes())
+		}
+	}
 
 	data := b.Bytes()
-	binary.BigEndian.PutUint16(data[:2], uint16(b.Len()-2))
+	if !v.UsesVarIntTransportParameters() {
+		binary.BigEndian.PutUint16(data[:2], uint16(b.Len()-2))
+	}
 	return data
 }
 
-func (p *TransportParameters) marshalVarintParam(b *bytes.Buffer, id transportParameterID, val uint64) {
-	utils.BigEndian.WriteUint16(b, uint16(id))
-	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(val)))
+func (p *TransportParameters) marshalVarintParam(b *bytes.Buffer, v protocol.VersionNumber, id transportParameterID, val uint64) {
+	writeTransportParameterHeader(b, v, id, uint64(utils.VarIntLen(val)))
 	utils.WriteVarInt(b, val)
 }
 
+func writeTransportParameterHeader(b *bytes.Buffer, v protocol.VersionNumber, id transportParameterID, length uint64) {
+	if !v.UsesVarIntTransportParameters() {
+		utils.BigEndian.WriteUint16(b, uint16(id))
+		utils.BigEndian.WriteUint16(b, uint16(length))
+		return
+	}
+	utils.WriteVarInt(b, uint64(id))
+	utils.WriteVarInt(b, length)
+}
+
 // String returns a string representation, intended for logging.
 func (p *TransportParameters) String() string {
 	logString := "&handshake.TransportParameters{OriginalConnectionID: %s, InitialMaxStreamDataBidiLocal: %#x, InitialMaxStreamDataBidiRemote: %#x, InitialMaxStreamDataUni: %#x, InitialMaxData: %#x, MaxBidiStreamNum: %d, MaxUniStreamNum: %d, IdleTimeout: %s, AckDelayExponent: %d, MaxAckDelay: %s"
@@ -266,6 +374,22 @@ func (p *TransportParameters) String() string {
 		logString += ", StatelessResetToken: %#x"
 		logParams = append(logParams, *p.StatelessResetToken)
 	}
+	if p.ActiveConnectionIDLimit > 0 {
+		logString += ", ActiveConnectionIDLimit: %d"
+		logParams = append(logParams, p.ActiveConnectionIDLimit)
+	}
+	if p.MaxDatagramFrameSize > 0 {
+		logString += ", MaxDatagramFrameSize: %d"
+		logParams = append(logParams, p.MaxDatagramFrameSize)
+	}
+	if p.InitialSourceConnectionID != nil {
+		logString += ", InitialSourceConnectionID: %s"
+		logParams = append(logParams, p.InitialSourceConnectionID)
+	}
+	if p.RetrySourceConnectionID != nil {
+		logString += ", RetrySourceConnectionID: %s"
+		logParams = append(logParams, *p.RetrySourceConnectionID)
+	}
 	logString += "}"
 	return fmt.Sprintf(logString, logParams...)
 }
@@ -0,0 +1,324 @@
+package handshake
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/congestion"
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/qerr"
+	"github.com/DrakenLibra/gt-bbr/internal/utils"
+	"github.com/marten-seemann/qtls"
+)
+
+// ErrDecryptionFailed is returned when the AEAD fails to open the packet.
+var ErrDecryptionFailed = errors.New("decryption failed")
+
+// cipherSuite is the part of the qtls.CipherSuite needed to derive the packet protection keys.
+type cipherSuite interface {
+	Hash() crypto.Hash
+	KeyLen() int
+	IVLen() int
+	AEAD(key, fixedNonce []byte) cipher.AEAD
+}
+
+var _ cipherSuite = &qtls.CipherSuite{}
+
+// The updatableAEAD is the AEAD used for 1-RTT packets.
+// It implements key updates, as described in section 6 of the QUIC TLS draft.
+type updatableAEAD struct {
+	suite cipherSuite
+
+	keyPhase          uint64 // the number of key updates
+	keyUpdateInterval uint64 // the number of packets after which a key update is initiated
+
+	largestAcked            protocol.PacketNumber
+	firstSentWithCurrentKey protocol.PacketNumber
+	firstRcvdWithCurrentKey protocol.PacketNumber
+	numSentWithCurrentKey   uint64
+	numRcvdWithCurrentKey   uint64
+
+	handshakeConfirmed bool
+
+	// The AEAD of the previous key phase, used to open reordered packets.
+	// It is dropped 3 PTOs after the key update.
+	prevRcvAEAD       cipher.AEAD
+	prevRcvAEADExpiry time.Time
+
+	rcvAEAD  cipher.AEAD
+	sendAEAD cipher.AEAD
+
+	nextRcvAEAD           cipher.AEAD
+	nextSendAEAD          cipher.AEAD
+	nextRcvTrafficSecret  []byte
+	nextSendTrafficSecret []byte
+
+	// the header protection keys are not updated
+	headerDecrypter cipher.Block
+	headerEncrypter cipher.Block
+
+	rttStats *congestion.RTTStats
+
+	logger  utils.Logger
+	version protocol.VersionNumber
+
+	// use a single slice to avoid allocations
+	nonceBuf []byte
+	hpMask   []byte
+}
+
+var _ ShortHeaderOpener = &updatableAEAD{}
+var _ ShortHeaderSealer = &updatableAEAD{}
+
+// newUpdatableAEAD creates a new updatableAEAD.
+// If keyUpdateInterval is 0, a key update is only initiated when the confidentiality limit of the AEAD is reached.
+func newUpdatableAEAD(rttStats *congestion.RTTStats, keyUpdateInterval uint64, logger utils.Logger, version protocol.VersionNumber) *updatableAEAD {
+	if keyUpdateInterval == 0 || keyUpdateInterval > protocol.MaxPacketsPerKeyPhase {
+		keyUpdateInterval = protocol.MaxPacketsPerKeyPhase
+	}
+	return &updatableAEAD{
+		keyUpdateInterval:       keyUpdateInterval,
+		largestAcked:            protocol.InvalidPacketNumber,
+		firstSentWithCurrentKey: protocol.InvalidPacketNumber,
+		firstRcvdWithCurrentKey: protocol.InvalidPacketNumber,
+		rttStats:                rttStats,
+		logger:                  logger,
+		version:                 version,
+	}
+}
+
+// SetReadKey sets the initial 1-RTT read key.
+func (a *updatableAEAD) SetReadKey(suite cipherSuite, trafficSecret []byte) {
+	a.rcvAEAD = createAEAD(suite, trafficSecret)
+	a.headerDecrypter = createHeaderProtector(suite, trafficSecret)
+	if a.suite == nil {
+		a.setAEADParameters(a.rcvAEAD, suite)
+	}
+
+	a.nextRcvTrafficSecret = a.nextTrafficSecret(suite.Hash(), trafficSecret)
+	a.nextRcvAEAD = createAEAD(suite, a.nextRcvTrafficSecret)
+}
+
+// SetWriteKey sets the initial 1-RTT write key.
+func (a *updatableAEAD) SetWriteKey(suite cipherSuite, trafficSecret []byte) {
+	a.sendAEAD = createAEAD(suite, trafficSecret)
+	a.headerEncrypter = createHeaderProtector(suite, trafficSecret)
+	if a.suite == nil {
+		a.setAEADParameters(a.sendAEAD, suite)
+	}
+
+	a.nextSendTrafficSecret = a.nextTrafficSecret(suite.Hash(), trafficSecret)
+	a.nextSendAEAD = createAEAD(suite, a.nextSendTrafficSecret)
+}
+
+func (a *updatableAEAD) setAEADParameters(aead cipher.AEAD, suite cipherSuite) {
+	a.suite = suite
+	a.nonceBuf = make([]byte, aead.NonceSize())
+	a.hpMask = make([]byte, aes.BlockSize)
+}
+
+// SetHandshakeConfirmed is called when the handshake is confirmed.
+// Key updates are only initiated after that.
+func (a *updatableAEAD) SetHandshakeConfirmed() {
+	a.handshakeConfirmed = true
+}
+
+// SetLargestAcked is called when an ACK for a 1-RTT packet is received.
+// It returns an error if the peer acknowledged a packet sent in the current key phase,
+// without having updated its keys.
+func (a *updatableAEAD) SetLargestAcked(pn protocol.PacketNumber) error {
+	if a.firstSentWithCurrentKey != protocol.InvalidPacketNumber &&
+		pn >= a.firstSentWithCurrentKey && a.numRcvdWithCurrentKey == 0 && a.keyPhase > 0 {
+		return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("received ACK for key phase %d, but peer didn't update keys", a.keyPhase))
+	}
+	a.largestAcked = utils.MaxPacketNumber(a.largestAcked, pn)
+	return nil
+}
+
+func (a *updatableAEAD) rollKeys() {
+	a.keyPhase++
+	a.firstRcvdWithCurrentKey = protocol.InvalidPacketNumber
+	a.firstSentWithCurrentKey = protocol.InvalidPacketNumber
+	a.numRcvdWithCurrentKey = 0
+	a.numSentWithCurrentKey = 0
+	a.prevRcvAEAD = a.rcvAEAD
+	a.prevRcvAEADExpiry = time.Time{}
+	a.rcvAEAD = a.nextRcvAEAD
+	a.sendAEAD = a.nextSendAEAD
+
+	a.nextRcvTrafficSecret = a.nextTrafficSecret(a.suite.Hash(), a.nextRcvTrafficSecret)
+	a.nextSendTrafficSecret = a.nextTrafficSecret(a.suite.Hash(), a.nextSendTrafficSecret)
+	a.nextRcvAEAD = createAEAD(a.suite, a.nextRcvTrafficSecret)
+	a.nextSendAEAD = createAEAD(a.suite, a.nextSendTrafficSecret)
+}
+
+// startKeyDropTimer starts the timer to drop the keys of the previous key phase.
+// They are kept for 3 PTOs, so that reordered packets can still be decrypted.
+func (a *updatableAEAD) startKeyDropTimer(now time.Time) {
+	d := 3 * a.rttStats.PTO()
+	a.logger.Debugf("Starting key drop timer to drop key phase %d (in %s)", a.keyPhase-1, d)
+	a.prevRcvAEADExpiry = now.Add(d)
+}
+
+func (a *updatableAEAD) Open(dst, src []byte, rcvTime time.Time, pn protocol.PacketNumber, keyPhase int, ad []byte) ([]byte, error) {
+	if a.prevRcvAEAD != nil && !a.prevRcvAEADExpiry.IsZero() && rcvTime.After(a.prevRcvAEADExpiry) {
+		a.prevRcvAEAD = nil
+		a.prevRcvAEADExpiry = time.Time{}
+		a.logger.Debugf("Dropping key phase %d", a.keyPhase-1)
+	}
+	binary.BigEndian.PutUint64(a.nonceBuf[len(a.nonceBuf)-8:], uint64(pn))
+	if keyPhase != a.keyPhaseBit() {
+		if a.keyPhase > 0 && a.firstRcvdWithCurrentKey == protocol.InvalidPacketNumber || pn < a.firstRcvdWithCurrentKey {
+			if a.prevRcvAEAD == nil {
+				return nil, ErrKeysDropped
+			}
+			// we updated the key, but the peer hasn't updated yet
+			dec, err := a.prevRcvAEAD.Open(dst, a.nonceBuf, src, ad)
+			if err != nil {
+				return nil, ErrDecryptionFailed
+			}
+			return dec, nil
+		}
+		// try opening the packet with the next key phase
+		dec, err := a.nextRcvAEAD.Open(dst, a.nonceBuf, src, ad)
+		if err != nil {
+			return nil, ErrDecryptionFailed
+		}
+		// Opening succeeded. Check if the peer was allowed to update.
+		if a.keyPhase > 0 && a.firstSentWithCurrentKey == protocol.InvalidPacketNumber {
+			return nil, qerr.Error(qerr.ProtocolViolation, "keys updated too quickly")
+		}
+		a.rollKeys()
+		a.logger.Debugf("Peer updated keys to key phase %d", a.keyPhase)
+		// The peer initiated this key update. It's safe to drop the keys for the previous generation now.
+		a.startKeyDropTimer(rcvTime)
+		a.firstRcvdWithCurrentKey = pn
+		a.numRcvdWithCurrentKey++
+		return dec, nil
+	}
+	// The AEAD we're using here will be the qtls.aeadAESGCM13.
+	// It uses the nonce provided here and XOR it with the IV.
+	dec, err := a.rcvAEAD.Open(dst, a.nonceBuf, src, ad)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	a.numRcvdWithCurrentKey++
+	if a.firstRcvdWithCurrentKey == protocol.InvalidPacketNumber {
+		// We initiated the key update, and now we received the first packet protected with the new key phase.
+		// Therefore, we are certain that the peer rolled its keys as well. Start a timer to drop the old keys.
+		if a.keyPhase > 0 {
+			a.logger.Debugf("Peer confirmed key update to key phase %d", a.keyPhase)
+			a.startKeyDropTimer(rcvTime)
+		}
+		a.firstRcvdWithCurrentKey = pn
+	}
+	return dec, nil
+}
+
+func (a *updatableAEAD) Seal(dst, src []byte, pn protocol.PacketNumber, ad []byte) []byte {
+	if a.firstSentWithCurrentKey == protocol.InvalidPacketNumber {
+		a.firstSentWithCurrentKey = pn
+	}
+	a.numSentWithCurrentKey++
+	binary.BigEndian.PutUint64(a.nonceBuf[len(a.nonceBuf)-8:], uint64(pn))
+	// The AEAD we're using here will be the qtls.aeadAESGCM13.
+	// It uses the nonce provided here and XOR it with the IV.
+	return a.sendAEAD.Seal(dst, a.nonceBuf, src, ad)
+}
+
+func (a *updatableAEAD) updateAllowed() bool {
+	if !a.handshakeConfirmed {
+		return false
+	}
+	// the first key update is allowed as soon as the handshake is confirmed
+	return a.keyPhase == 0 ||
+		// subsequent key updates as soon as a packet sent with that key phase has been acknowledged
+		(a.firstSentWithCurrentKey != protocol.InvalidPacketNumber &&
+			a.largestAcked != protocol.InvalidPacketNumber &&
+			a.largestAcked >= a.firstSentWithCurrentKey)
+}
+
+func (a *updatableAEAD) shouldInitiateKeyUpdate() bool {
+	if !a.updateAllowed() {
+		return false
+	}
+	if a.numRcvdWithCurrentKey >= a.keyUpdateInterval {
+		a.logger.Debugf("Received %d packets with current key phase. Initiating key update to the next key phase: %d", a.numRcvdWithCurrentKey, a.keyPhase+1)
+		return true
+	}
+	if a.numSentWithCurrentKey >= a.keyUpdateInterval {
+		a.logger.Debugf("Sent %d packets with current key phase. Initiating key update to the next key phase: %d", a.numSentWithCurrentKey, a.keyPhase+1)
+		return true
+	}
+	return false
+}
+
+// KeyPhase returns the key phase bit that has to be used for the next packet.
+// It initiates a key update, if necessary.
+func (a *updatableAEAD) KeyPhase() int {
+	if a.shouldInitiateKeyUpdate() {
+		a.rollKeys()
+	}
+	return a.keyPhaseBit()
+}
+
+func (a *updatableAEAD) keyPhaseBit() int {
+	return int(a.keyPhase % 2)
+}
+
+func (a *updatableAEAD) Overhead() int {
+	return a.sendAEAD.Overhead()
+}
+
+func (a *updatableAEAD) EncryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	if len(sample) != len(a.hpMask) {
+		panic("invalid sample size")
+	}
+	a.headerEncrypter.Encrypt(a.hpMask, sample)
+	*firstByte ^= a.hpMask[0] & 0x1f
+	for i := range pnBytes {
+		pnBytes[i] ^= a.hpMask[i+1]
+	}
+}
+
+func (a *updatableAEAD) DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte) {
+	if len(sample) != len(a.hpMask) {
+		panic("invalid sample size")
+	}
+	a.headerDecrypter.Encrypt(a.hpMask, sample)
+	*firstByte ^= a.hpMask[0] & 0x1f
+	for i := range pnBytes {
+		pnBytes[i] ^= a.hpMask[i+1]
+	}
+}
+
+func createAEAD(suite cipherSuite, trafficSecret []byte) cipher.AEAD {
+	key := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic key", suite.KeyLen())
+	iv := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic iv", suite.IVLen())
+	return suite.AEAD(key, iv)
+}
+
+func createHeaderProtector(suite cipherSuite, trafficSecret []byte) cipher.Block {
+	hpKey := qtls.HkdfExpandLabel(suite.Hash(), trafficSecret, []byte{}, "quic hp", suite.KeyLen())
+	hp, err := aes.NewCipher(hpKey)
+	if err != nil {
+		panic(fmt.Sprintf("error creating new AES cipher: %s", err))
+	}
+	return hp
+}
+
+// nextTrafficSecret derives the traffic secret of the next key phase.
+// Depending on the version, the "quic ku" label or the "traffic upd" label
+// defined in section 7.2 of RFC 8446 is used.
+func (a *updatableAEAD) nextTrafficSecret(hash crypto.Hash, trafficSecret []byte) []byte {
+	label := "traffic upd"
+	if a.version.UsesQUICKeyUpdateLabel() {
+		label = "quic ku"
+	}
+	return qtls.HkdfExpandLabel(hash, trafficSecret, []byte{}, label, hash.Size())
+}
@@ -0,0 +1,234 @@
+package handshake
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/rand"
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/congestion"
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/qerr"
+	"github.com/DrakenLibra/gt-bbr/internal/utils"
+	"github.com/marten-seemann/qtls"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// the TLS_AES_128_GCM_SHA256 cipher suite
+type testCipherSuite struct{}
+
+var _ cipherSuite = &testCipherSuite{}
+
+func (testCipherSuite) Hash() crypto.Hash { return crypto.SHA256 }
+func (testCipherSuite) KeyLen() int       { return 16 }
+func (testCipherSuite) IVLen() int        { return 12 }
+func (testCipherSuite) AEAD(key, fixedNonce []byte) cipher.AEAD {
+	return qtls.AEADAESGCMTLS13(key, fixedNonce)
+}
+
+var _ = Describe("Updatable AEAD", func() {
+	var (
+		client, server *updatableAEAD
+		rttStats       *congestion.RTTStats
+	)
+
+	msg := []byte("Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua.")
+	ad := []byte("Donec in velit neque.")
+
+	getPeers := func(keyUpdateInterval uint64) (*updatableAEAD, *updatableAEAD) {
+		trafficSecret1 := make([]byte, 16)
+		trafficSecret2 := make([]byte, 16)
+		rand.Read(trafficSecret1)
+		rand.Read(trafficSecret2)
+
+		client := newUpdatableAEAD(rttStats, keyUpdateInterval, utils.DefaultLogger, protocol.VersionTLS)
+		server := newUpdatableAEAD(rttStats, keyUpdateInterval, utils.DefaultLogger, protocol.VersionTLS)
+		client.SetReadKey(&testCipherSuite{}, trafficSecret2)
+		client.SetWriteKey(&testCipherSuite{}, trafficSecret1)
+		server.SetReadKey(&testCipherSuite{}, trafficSecret1)
+		server.SetWriteKey(&testCipherSuite{}, trafficSecret2)
+		return client, server
+	}
+
+	BeforeEach(func() {
+		rttStats = congestion.NewRTTStats()
+		client, server = getPeers(0)
+	})
+
+	It("uses the confidentiality limit, if no key update interval is set", func() {
+		Expect(client.keyUpdateInterval).To(BeEquivalentTo(protocol.MaxPacketsPerKeyPhase))
+		Expect(newUpdatableAEAD(rttStats, protocol.MaxPacketsPerKeyPhase+1, utils.DefaultLogger, protocol.VersionTLS).keyUpdateInterval).To(BeEquivalentTo(protocol.MaxPacketsPerKeyPhase))
+	})
+
+	Context("message encryption", func() {
+		It("encrypts and decrypts a message", func() {
+			Expect(server.KeyPhase()).To(BeZero())
+			encrypted := server.Seal(nil, msg, 0x1337, ad)
+			opened, err := client.Open(nil, encrypted, time.Now(), 0x1337, 0, ad)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal(msg))
+		})
+
+		It("fails to open a message if the associated data is not the same", func() {
+			encrypted := client.Seal(nil, msg, 0x1337, ad)
+			_, err := server.Open(nil, encrypted, time.Now(), 0x1337, 0, []byte("wrong ad"))
+			Expect(err).To(MatchError(ErrDecryptionFailed))
+		})
+
+		It("fails to open a message if the packet number is not the same", func() {
+			encrypted := server.Seal(nil, msg, 0x1337, ad)
+			_, err := client.Open(nil, encrypted, time.Now(), 0x42, 0, ad)
+			Expect(err).To(MatchError(ErrDecryptionFailed))
+		})
+
+		It("encrypts and decrypts the header", func() {
+			var lastFiveBitsDifferent int
+			for i := 0; i < 100; i++ {
+				sample := make([]byte, 16)
+				rand.Read(sample)
+				header := []byte{0xb5, 1, 2, 3, 4, 5, 6, 7, 8, 0xde, 0xad, 0xbe, 0xef}
+				client.EncryptHeader(sample, &header[0], header[9:13])
+				if header[0]&0x1f != 0xb5&0x1f {
+					lastFiveBitsDifferent++
+				}
+				Expect(header[0] & 0xe0).To(Equal(byte(0xb5 & 0xe0)))
+				Expect(header[1:9]).To(Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}))
+				Expect(header[9:13]).ToNot(Equal([]byte{0xde, 0xad, 0xbe, 0xef}))
+				server.DecryptHeader(sample, &header[0], header[9:13])
+				Expect(header).To(Equal([]byte{0xb5, 1, 2, 3, 4, 5, 6, 7, 8, 0xde, 0xad, 0xbe, 0xef}))
+			}
+			Expect(lastFiveBitsDifferent).To(BeNumerically(">", 75))
+		})
+	})
+
+	Context("key updates", func() {
+		It("derives the next traffic secret using the label of the version", func() {
+			trafficSecret := make([]byte, 32)
+			rand.Read(trafficSecret)
+			draft29 := newUpdatableAEAD(rttStats, 0, utils.DefaultLogger, protocol.VersionDraft29)
+			Expect(draft29.nextTrafficSecret(crypto.SHA256, trafficSecret)).To(Equal(qtls.HkdfExpandLabel(crypto.SHA256, trafficSecret, []byte{}, "quic ku", 32)))
+			dev := newUpdatableAEAD(rttStats, 0, utils.DefaultLogger, protocol.VersionTLS)
+			Expect(dev.nextTrafficSecret(crypto.SHA256, trafficSecret)).To(Equal(qtls.HkdfExpandLabel(crypto.SHA256, trafficSecret, []byte{}, "traffic upd", 32)))
+		})
+
+		It("opens packets sent by the peer after it updated its keys", func() {
+			client.SetHandshakeConfirmed()
+			client.rollKeys() // initiate a key update
+			Expect(client.KeyPhase()).To(Equal(1))
+			encrypted := client.Seal(nil, msg, 1, ad)
+			opened, err := server.Open(nil, encrypted, time.Now(), 1, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal(msg))
+			Expect(server.keyPhase).To(BeEquivalentTo(1))
+			// the server's response uses the new key phase
+			Expect(server.KeyPhase()).To(Equal(1))
+			encrypted = server.Seal(nil, msg, 2, ad)
+			opened, err = client.Open(nil, encrypted, time.Now(), 2, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal(msg))
+		})
+
+		It("opens reordered packets with the keys of the previous key phase", func() {
+			encrypted0 := client.Seal(nil, msg, 1, ad)
+			_, err := server.Open(nil, client.Seal(nil, msg, 2, ad), time.Now(), 2, 0, ad)
+			Expect(err).ToNot(HaveOccurred())
+			client.SetHandshakeConfirmed()
+			client.rollKeys()
+			encrypted1 := client.Seal(nil, msg, 3, ad)
+			_, err = server.Open(nil, encrypted1, time.Now(), 3, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+			// receive the reordered packet
+			opened, err := server.Open(nil, encrypted0, time.Now(), 1, 0, ad)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opened).To(Equal(msg))
+		})
+
+		It("drops the keys of the previous key phase after 3 PTOs", func() {
+			encrypted0 := client.Seal(nil, msg, 1, ad)
+			_, err := server.Open(nil, client.Seal(nil, msg, 2, ad), time.Now(), 2, 0, ad)
+			Expect(err).ToNot(HaveOccurred())
+			client.SetHandshakeConfirmed()
+			client.rollKeys()
+			now := time.Now()
+			_, err = server.Open(nil, client.Seal(nil, msg, 3, ad), now, 3, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = server.Open(nil, encrypted0, now.Add(3*rttStats.PTO()).Add(time.Nanosecond), 1, 0, ad)
+			Expect(err).To(MatchError(ErrKeysDropped))
+		})
+
+		It("doesn't initiate key updates before the handshake is confirmed", func() {
+			client, server = getPeers(5)
+			for i := 0; i < 10; i++ {
+				Expect(client.KeyPhase()).To(BeZero())
+				client.Seal(nil, msg, protocol.PacketNumber(i), ad)
+			}
+		})
+
+		It("initiates a key update after sending the configured number of packets", func() {
+			client, server = getPeers(5)
+			client.SetHandshakeConfirmed()
+			for i := 0; i < 5; i++ {
+				Expect(client.KeyPhase()).To(BeZero())
+				encrypted := client.Seal(nil, msg, protocol.PacketNumber(i), ad)
+				_, err := server.Open(nil, encrypted, time.Now(), protocol.PacketNumber(i), 0, ad)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(client.KeyPhase()).To(Equal(1))
+			encrypted := client.Seal(nil, msg, 5, ad)
+			_, err := server.Open(nil, encrypted, time.Now(), 5, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("initiates a key update after receiving the configured number of packets", func() {
+			client, server = getPeers(5)
+			client.SetHandshakeConfirmed()
+			for i := 0; i < 5; i++ {
+				encrypted := server.Seal(nil, msg, protocol.PacketNumber(i), ad)
+				_, err := client.Open(nil, encrypted, time.Now(), protocol.PacketNumber(i), 0, ad)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(client.KeyPhase()).To(Equal(1))
+		})
+
+		It("only initiates the next key update after a packet sent with the current keys was acknowledged", func() {
+			client, server = getPeers(1)
+			client.SetHandshakeConfirmed()
+			server.SetHandshakeConfirmed()
+			client.Seal(nil, msg, 0, ad)
+			Expect(client.KeyPhase()).To(Equal(1))
+			encrypted := client.Seal(nil, msg, 1, ad)
+			_, err := server.Open(nil, encrypted, time.Now(), 1, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+			// the peer responded with the new key phase
+			Expect(server.KeyPhase()).To(Equal(1))
+			_, err = client.Open(nil, server.Seal(nil, msg, 0, ad), time.Now(), 0, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+			client.Seal(nil, msg, 2, ad)
+			Expect(client.KeyPhase()).To(Equal(1))
+			Expect(client.SetLargestAcked(1)).To(Succeed())
+			Expect(client.KeyPhase()).To(BeZero())
+		})
+
+		It("errors when the peer updates keys too quickly", func() {
+			client.SetHandshakeConfirmed()
+			client.rollKeys()
+			_, err := server.Open(nil, client.Seal(nil, msg, 1, ad), time.Now(), 1, 1, ad)
+			Expect(err).ToNot(HaveOccurred())
+			// the server hasn't sent a packet with the new keys yet
+			client.rollKeys()
+			_, err = server.Open(nil, client.Seal(nil, msg, 2, ad), time.Now(), 2, 0, ad)
+			Expect(err).To(MatchError(qerr.Error(qerr.ProtocolViolation, "keys updated too quickly")))
+		})
+
+		It("errors when the peer acknowledges a packet sent with the new keys, but doesn't update its keys", func() {
+			client.SetHandshakeConfirmed()
+			client.rollKeys()
+			client.Seal(nil, msg, 10, ad)
+			err := client.SetLargestAcked(10)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("received ACK for key phase 1, but peer didn't update keys"))
+		})
+	})
+})
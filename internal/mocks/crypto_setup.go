@@ -50,6 +50,20 @@ func (mr *MockCryptoSetupMockRecorder) ChangeConnectionID(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeConnectionID", reflect.TypeOf((*MockCryptoSetup)(nil).ChangeConnectionID), arg0)
 }
 
+// ClientHelloInfo mocks base method
+func (m *MockCryptoSetup) ClientHelloInfo() *tls.ClientHelloInfo {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClientHelloInfo")
+	ret0, _ := ret[0].(*tls.ClientHelloInfo)
+	return ret0
+}
+
+// ClientHelloInfo indicates an expected call of ClientHelloInfo
+func (mr *MockCryptoSetupMockRecorder) ClientHelloInfo() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClientHelloInfo", reflect.TypeOf((*MockCryptoSetup)(nil).ClientHelloInfo))
+}
+
 // Close mocks base method
 func (m *MockCryptoSetup) Close() error {
 	m.ctrl.T.Helper()
@@ -78,6 +92,21 @@ func (mr *MockCryptoSetupMockRecorder) ConnectionState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionState", reflect.TypeOf((*MockCryptoSetup)(nil).ConnectionState))
 }
 
+// Get1RTTOpener mocks base method
+func (m *MockCryptoSetup) Get1RTTOpener() (handshake.ShortHeaderOpener, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get1RTTOpener")
+	ret0, _ := ret[0].(handshake.ShortHeaderOpener)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get1RTTOpener indicates an expected call of Get1RTTOpener
+func (mr *MockCryptoSetupMockRecorder) Get1RTTOpener() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get1RTTOpener", reflect.TypeOf((*MockCryptoSetup)(nil).Get1RTTOpener))
+}
+
 // GetOpener mocks base method
 func (m *MockCryptoSetup) GetOpener(arg0 protocol.EncryptionLevel) (handshake.Opener, error) {
 	m.ctrl.T.Helper()
@@ -160,3 +189,29 @@ func (mr *MockCryptoSetupMockRecorder) RunHandshake() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunHandshake", reflect.TypeOf((*MockCryptoSetup)(nil).RunHandshake))
 }
+
+// SetLargest1RTTAcked mocks base method
+func (m *MockCryptoSetup) SetLargest1RTTAcked(arg0 protocol.PacketNumber) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLargest1RTTAcked", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetLargest1RTTAcked indicates an expected call of SetLargest1RTTAcked
+func (mr *MockCryptoSetupMockRecorder) SetLargest1RTTAcked(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLargest1RTTAcked", reflect.TypeOf((*MockCryptoSetup)(nil).SetLargest1RTTAcked), arg0)
+}
+
+// SetTransportParameters mocks base method
+func (m *MockCryptoSetup) SetTransportParameters(arg0 *handshake.TransportParameters) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetTransportParameters", arg0)
+}
+
+// SetTransportParameters indicates an expected call of SetTransportParameters
+func (mr *MockCryptoSetupMockRecorder) SetTransportParameters(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTransportParameters", reflect.TypeOf((*MockCryptoSetup)(nil).SetTransportParameters), arg0)
+}
@@ -124,6 +124,20 @@ func (mr *MockSessionMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockSession)(nil).Context))
 }
 
+// HandshakeComplete mocks base method
+func (m *MockSession) HandshakeComplete() context.Context {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandshakeComplete")
+	ret0, _ := ret[0].(context.Context)
+	return ret0
+}
+
+// HandshakeComplete indicates an expected call of HandshakeComplete
+func (mr *MockSessionMockRecorder) HandshakeComplete() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandshakeComplete", reflect.TypeOf((*MockSession)(nil).HandshakeComplete))
+}
+
 // LocalAddr mocks base method
 func (m *MockSession) LocalAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -138,6 +152,20 @@ func (mr *MockSessionMockRecorder) LocalAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LocalAddr", reflect.TypeOf((*MockSession)(nil).LocalAddr))
 }
 
+// MigrateTo mocks base method
+func (m *MockSession) MigrateTo(arg0 net.PacketConn) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MigrateTo", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MigrateTo indicates an expected call of MigrateTo
+func (mr *MockSessionMockRecorder) MigrateTo(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MigrateTo", reflect.TypeOf((*MockSession)(nil).MigrateTo), arg0)
+}
+
 // OpenStream mocks base method
 func (m *MockSession) OpenStream() (quic_go.Stream, error) {
 	m.ctrl.T.Helper()
@@ -198,6 +226,21 @@ func (mr *MockSessionMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockSession)(nil).OpenUniStreamSync))
 }
 
+// ReceiveMessage mocks base method
+func (m *MockSession) ReceiveMessage() ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReceiveMessage")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveMessage indicates an expected call of ReceiveMessage
+func (mr *MockSessionMockRecorder) ReceiveMessage() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveMessage", reflect.TypeOf((*MockSession)(nil).ReceiveMessage))
+}
+
 // RemoteAddr mocks base method
 func (m *MockSession) RemoteAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -211,3 +254,41 @@ func (mr *MockSessionMockRecorder) RemoteAddr() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockSession)(nil).RemoteAddr))
 }
+
+// SendMessage mocks base method
+func (m *MockSession) SendMessage(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendMessage", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendMessage indicates an expected call of SendMessage
+func (mr *MockSessionMockRecorder) SendMessage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockSession)(nil).SendMessage), arg0)
+}
+
+// SetMaxIncomingStreams mocks base method
+func (m *MockSession) SetMaxIncomingStreams(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetMaxIncomingStreams", arg0)
+}
+
+// SetMaxIncomingStreams indicates an expected call of SetMaxIncomingStreams
+func (mr *MockSessionMockRecorder) SetMaxIncomingStreams(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingStreams", reflect.TypeOf((*MockSession)(nil).SetMaxIncomingStreams), arg0)
+}
+
+// SetMaxIncomingUniStreams mocks base method
+func (m *MockSession) SetMaxIncomingUniStreams(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetMaxIncomingUniStreams", arg0)
+}
+
+// SetMaxIncomingUniStreams indicates an expected call of SetMaxIncomingUniStreams
+func (mr *MockSessionMockRecorder) SetMaxIncomingUniStreams(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingUniStreams", reflect.TypeOf((*MockSession)(nil).SetMaxIncomingUniStreams), arg0)
+}
@@ -9,6 +9,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	quic_go "github.com/DrakenLibra/gt-bbr"
 	protocol "github.com/DrakenLibra/gt-bbr/internal/protocol"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -145,6 +146,20 @@ func (mr *MockStreamMockRecorder) SetWriteDeadline(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWriteDeadline", reflect.TypeOf((*MockStream)(nil).SetWriteDeadline), arg0)
 }
 
+// Stats mocks base method
+func (m *MockStream) Stats() quic_go.StreamStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(quic_go.StreamStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockStreamMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockStream)(nil).Stats))
+}
+
 // StreamID mocks base method
 func (m *MockStream) StreamID() protocol.StreamID {
 	m.ctrl.T.Helper()
@@ -159,6 +174,20 @@ func (mr *MockStreamMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockStream)(nil).StreamID))
 }
 
+// WaitAcknowledged mocks base method
+func (m *MockStream) WaitAcknowledged(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitAcknowledged", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitAcknowledged indicates an expected call of WaitAcknowledged
+func (mr *MockStreamMockRecorder) WaitAcknowledged(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitAcknowledged", reflect.TypeOf((*MockStream)(nil).WaitAcknowledged), arg0)
+}
+
 // Write mocks base method
 func (m *MockStream) Write(arg0 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -84,6 +84,21 @@ func (mr *MockStreamFlowControllerMockRecorder) GetWindowUpdate() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWindowUpdate", reflect.TypeOf((*MockStreamFlowController)(nil).GetWindowUpdate))
 }
 
+// IsBlocked mocks base method
+func (m *MockStreamFlowController) IsBlocked() (bool, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsBlocked")
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// IsBlocked indicates an expected call of IsBlocked
+func (mr *MockStreamFlowControllerMockRecorder) IsBlocked() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBlocked", reflect.TypeOf((*MockStreamFlowController)(nil).IsBlocked))
+}
+
 // IsNewlyBlocked mocks base method
 func (m *MockStreamFlowController) IsNewlyBlocked() (bool, protocol.ByteCount) {
 	m.ctrl.T.Helper()
@@ -21,6 +21,21 @@ func GenerateConnectionID(len int) (ConnectionID, error) {
 	return ConnectionID(b), nil
 }
 
+// DefaultConnectionIDGenerator generates random connection IDs of a fixed length.
+type DefaultConnectionIDGenerator struct {
+	ConnLen int
+}
+
+// GenerateConnectionID generates a random connection ID.
+func (d *DefaultConnectionIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	return GenerateConnectionID(d.ConnLen)
+}
+
+// ConnectionIDLen returns the length of the connection IDs generated.
+func (d *DefaultConnectionIDGenerator) ConnectionIDLen() int {
+	return d.ConnLen
+}
+
 // GenerateConnectionIDForInitial generates a connection ID for the Initial packet.
 // It uses a length randomly chosen between 8 and 18 bytes.
 func GenerateConnectionIDForInitial() (ConnectionID, error) {
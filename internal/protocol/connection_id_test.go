@@ -24,6 +24,14 @@ var _ = Describe("Connection ID generation", func() {
 		Expect(c.Len()).To(Equal(5))
 	})
 
+	It("generates connection IDs using the default generator", func() {
+		g := &DefaultConnectionIDGenerator{ConnLen: 7}
+		Expect(g.ConnectionIDLen()).To(Equal(7))
+		c, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Len()).To(Equal(7))
+	})
+
 	It("generates random length destination connection IDs", func() {
 		var has8ByteConnID, has18ByteConnID bool
 		for i := 0; i < 1000; i++ {
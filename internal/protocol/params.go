@@ -26,12 +26,16 @@ const MaxUndecryptablePackets = 10
 // This is the value that Chromium is using
 const ConnectionFlowControlMultiplier = 1.5
 
-// InitialMaxStreamData is the stream-level flow control window for receiving data
+// InitialMaxStreamData is the default initial stream-level flow control window for receiving data
 const InitialMaxStreamData = (1 << 10) * 512 // 512 kb
 
-// InitialMaxData is the connection-level flow control window for receiving data
+// InitialMaxData is the default initial connection-level flow control window for receiving data
 const InitialMaxData = ConnectionFlowControlMultiplier * InitialMaxStreamData
 
+// DefaultBDPAutoTuningHeadroom is the default factor by which the receive windows exceed the bandwidth-delay product,
+// when using BDP-based auto-tuning
+const DefaultBDPAutoTuningHeadroom = 2.0
+
 // DefaultMaxReceiveStreamFlowControlWindow is the default maximum stream-level flow control window for receiving data, for the server
 const DefaultMaxReceiveStreamFlowControlWindow = 6 * (1 << 20) // 6 MB
 
@@ -56,9 +60,9 @@ const SkipPacketAveragePeriodLength PacketNumber = 500
 // MaxTrackedSkippedPackets is the maximum number of skipped packet numbers the SentPacketHandler keep track of for Optimistic ACK attack mitigation
 const MaxTrackedSkippedPackets = 10
 
-// MaxAcceptQueueSize is the maximum number of sessions that the server queues for accepting.
+// DefaultMaxAcceptQueueSize is the default maximum number of sessions that the server queues for accepting.
 // If the queue is full, new connection attempts will be rejected.
-const MaxAcceptQueueSize = 32
+const DefaultMaxAcceptQueueSize = 32
 
 // TokenValidity is the duration that a (non-retry) token is considered valid
 const TokenValidity = 24 * time.Hour
@@ -114,6 +118,14 @@ const MinStreamFrameSize ByteCount = 128
 // we send after the handshake completes.
 const MaxPostHandshakeCryptoFrameSize ByteCount = 1000
 
+// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that we accept.
+// It is advertised in the max_datagram_frame_size transport parameter.
+const MaxDatagramFrameSize ByteCount = MaxReceivePacketSize
+
+// DatagramRcvQueueLen is the length of the receive queue for DATAGRAM frames.
+// When the queue is full, newly received DATAGRAM frames are dropped.
+const DatagramRcvQueueLen = 128
+
 // MaxAckFrameSize is the maximum size for an ACK frame that we write
 // Due to the varint encoding, ACK frames can grow (almost) indefinitely large.
 // The MaxAckFrameSize should be large enough to encode many ACK range,
@@ -125,10 +137,21 @@ const MaxAckFrameSize ByteCount = 1000
 // Example: For a packet pacing delay of 20 microseconds, we would send 5 packets at once, wait for 100 microseconds, and so forth.
 const MinPacingDelay time.Duration = 100 * time.Microsecond
 
+// MaxActiveConnectionIDs is the number of connection IDs that we store for the peer.
+// It is sent to the peer in the active_connection_id_limit transport parameter.
+const MaxActiveConnectionIDs = 4
+
+// MaxIssuedConnectionIDs is the maximum number of connection IDs that we issue to the peer at any time.
+const MaxIssuedConnectionIDs = 6
+
 // DefaultConnectionIDLength is the connection ID length that is used for multiplexed connections
 // if no other value is configured.
 const DefaultConnectionIDLength = 4
 
+// AmplificationFactor is the factor by which the data sent to an unvalidated peer address
+// may exceed the data received from that address.
+const AmplificationFactor = 3
+
 // AckDelayExponent is the ack delay exponent used when sending ACKs.
 const AckDelayExponent = 3
 
@@ -142,3 +165,55 @@ const MaxAckDelay = 25 * time.Millisecond
 // MaxAckDelayInclGranularity is the max_ack_delay including the timer granularity.
 // This is the value that should be advertised to the peer.
 const MaxAckDelayInclGranularity = MaxAckDelay + TimerGranularity
+
+// MaxPacketsPerKeyPhase is the maximum number of packets that are sent or received with the same 1-RTT key.
+// When this limit is reached, a key update is initiated.
+// This is the confidentiality limit of AEAD_AES_128_GCM and AEAD_AES_256_GCM.
+const MaxPacketsPerKeyPhase = 1 << 23
+
+// MTUProbeGranularity is the precision of path MTU discovery.
+// The binary search stops once the search interval is smaller than this value.
+const MTUProbeGranularity ByteCount = 20
+
+// MaxMTUProbes is the number of probe packets of a size that are sent before path MTU discovery
+// concludes that the size is larger than the path MTU.
+const MaxMTUProbes = 3
+
+// MTURaiseInterval is the time after which path MTU discovery checks if the path MTU increased.
+const MTURaiseInterval = 10 * time.Minute
+
+// MaxTrackedMTUPackets is the maximum number of packets larger than the base packet size
+// that are tracked for detecting black holes.
+const MaxTrackedMTUPackets = 32
+
+// MaxTrackedHandshakeSources is the maximum number of source addresses and subnets that are tracked for the handshake rate limits.
+// Handshakes from sources that are not tracked share a single rate limit.
+const MaxTrackedHandshakeSources = 10000
+
+// HandshakeRateLimitIPv4PrefixLen is the prefix length of the IPv4 subnets used for the per-subnet handshake rate limit.
+const HandshakeRateLimitIPv4PrefixLen = 24
+
+// HandshakeRateLimitIPv6PrefixLen is the prefix length of the IPv6 subnets used for the per-subnet handshake rate limit.
+const HandshakeRateLimitIPv6PrefixLen = 48
+
+// DefaultTokenStoreMaxOrigins is the number of origins that the default token store saves tokens for.
+const DefaultTokenStoreMaxOrigins = 100
+
+// DefaultTokenStoreTokensPerOrigin is the number of tokens per origin that the default token store saves.
+const DefaultTokenStoreTokensPerOrigin = 4
+
+// MaxStatelessResetsPerSecond is the maximum number of stateless resets sent per second on a single packet conn.
+const MaxStatelessResetsPerSecond = 100
+
+// MaxPreviousStatelessResetKeys is the maximum number of previous stateless reset keys.
+// A stateless reset is sent for every key, each of them smaller than the packet that triggered it.
+// Limiting the number of keys ensures that we don't send more than 3 times the amount of data we received.
+const MaxPreviousStatelessResetKeys = 2
+
+// PacketBatchSize is the maximum number of packets that are read or written using a single system call.
+const PacketBatchSize = 8
+
+// MaxGSOSegments is the maximum number of packets that are coalesced into a single datagram
+// when using UDP generic segmentation offload.
+// This is the limit imposed by the Linux kernel (UDP_MAX_SEGMENTS).
+const MaxGSOSegments = 64
@@ -49,6 +49,10 @@ type ApplicationErrorCode uint16
 // Ethernet's max packet size is 1500 bytes,  1500 - 48 = 1452.
 const MaxReceivePacketSize ByteCount = 1452
 
+// MaxPacketBufferSize is the size of the buffers used for jumbo packets.
+// It is large enough to hold a packet on a link with a 9000 byte MTU.
+const MaxPacketBufferSize ByteCount = 9216
+
 // DefaultTCPMSS is the default maximum packet size used in the Linux TCP implementation.
 // Used in QUIC for congestion window computations in bytes.
 const DefaultTCPMSS ByteCount = 1460
@@ -59,9 +63,23 @@ const MinInitialPacketSize = 1200
 // MinStatelessResetSize is the minimum size of a stateless reset packet
 const MinStatelessResetSize = 1 /* first byte */ + 22 /* random bytes */ + 16 /* token */
 
+// MaxStatelessResetSize is the maximum size of a stateless reset packet that we send
+const MaxStatelessResetSize = 100
+
 // MinConnectionIDLenInitial is the minimum length of the destination connection ID on an Initial packet.
 const MinConnectionIDLenInitial = 8
 
+// MinConnIDLen is the minimum length of a non-empty connection ID used by this endpoint.
+const MinConnIDLen = 4
+
+// MaxConnIDLen is the maximum length of a connection ID.
+// It applies to versions that prefix every connection ID with its length.
+const MaxConnIDLen = 20
+
+// MaxConnIDLenCombined is the maximum length of a connection ID,
+// for versions that encode the lengths of both connection IDs in a single byte.
+const MaxConnIDLenCombined = 18
+
 // DefaultAckDelayExponent is the default ack delay exponent
 const DefaultAckDelayExponent = 3
 
@@ -73,3 +91,28 @@ const DefaultMaxAckDelay = 25 * time.Millisecond
 
 // MaxMaxAckDelay is the maximum max_ack_delay
 const MaxMaxAckDelay = 1 << 14 * time.Millisecond
+
+// A CongestionControlAlgorithm is a congestion control algorithm
+type CongestionControlAlgorithm uint8
+
+const (
+	// CongestionControlBBR is BBR
+	CongestionControlBBR CongestionControlAlgorithm = 1 + iota
+	// CongestionControlCubic is Cubic
+	CongestionControlCubic
+	// CongestionControlReno is NewReno
+	CongestionControlReno
+)
+
+func (a CongestionControlAlgorithm) String() string {
+	switch a {
+	case CongestionControlBBR:
+		return "BBR"
+	case CongestionControlCubic:
+		return "Cubic"
+	case CongestionControlReno:
+		return "Reno"
+	default:
+		return fmt.Sprintf("unknown congestion control algorithm: %d", a)
+	}
+}
@@ -15,4 +15,14 @@ var _ = Describe("Protocol", func() {
 			Expect(PacketType(10).String()).To(Equal("unknown packet type: 10"))
 		})
 	})
+
+	Context("congestion control algorithms", func() {
+		It("has the correct string representation", func() {
+			Expect(CongestionControlBBR.String()).To(Equal("BBR"))
+			Expect(CongestionControlCubic.String()).To(Equal("Cubic"))
+			Expect(CongestionControlReno.String()).To(Equal("Reno"))
+			Expect(CongestionControlAlgorithm(0).String()).To(Equal("unknown congestion control algorithm: 0"))
+			Expect(CongestionControlAlgorithm(10).String()).To(Equal("unknown congestion control algorithm: 10"))
+		})
+	})
 })
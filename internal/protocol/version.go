@@ -19,13 +19,15 @@ const (
 // The version numbers, making grepping easier
 const (
 	VersionTLS      VersionNumber = 0x51474fff
+	VersionDraft23  VersionNumber = 0xff000017
+	VersionDraft29  VersionNumber = 0xff00001d
 	VersionWhatever VersionNumber = 1 // for when the version doesn't matter
 	VersionUnknown  VersionNumber = math.MaxUint32
 )
 
 // SupportedVersions lists the versions that the server supports
 // must be in sorted descending order
-var SupportedVersions = []VersionNumber{VersionTLS}
+var SupportedVersions = []VersionNumber{VersionDraft29, VersionDraft23, VersionTLS}
 
 // IsValidVersion says if the version is known to quic-go
 func IsValidVersion(v VersionNumber) bool {
@@ -40,6 +42,10 @@ func (vn VersionNumber) String() string {
 		return "unknown"
 	case VersionTLS:
 		return "TLS dev version (WIP)"
+	case VersionDraft23:
+		return "draft-23"
+	case VersionDraft29:
+		return "draft-29"
 	default:
 		if vn.isGQUIC() {
 			return fmt.Sprintf("gQUIC %d", vn.toGQUICVersion())
@@ -53,6 +59,46 @@ func (vn VersionNumber) ToAltSvc() string {
 	return fmt.Sprintf("%d", vn)
 }
 
+// UsesVarIntTransportParameters says if transport parameter IDs and lengths are encoded as variable-length integers.
+// This is the case for draft-27 and later.
+// Earlier versions use 2 byte IDs and lengths, prefixed by the total length of the transport parameters.
+func (vn VersionNumber) UsesVarIntTransportParameters() bool {
+	return vn == VersionDraft29
+}
+
+// HasHandshakeDoneFrame says if the HANDSHAKE_DONE frame is defined.
+// It was introduced in draft-25.
+func (vn VersionNumber) HasHandshakeDoneFrame() bool {
+	return vn == VersionDraft29
+}
+
+// HasLengthPrefixedConnectionIDs says if every connection ID in the long header is preceded by a one byte length.
+// This is the case for draft-22 and later, and it is part of the version-independent properties of QUIC.
+// Only the development version encodes both connection ID lengths in a single byte.
+func (vn VersionNumber) HasLengthPrefixedConnectionIDs() bool {
+	return vn != VersionTLS
+}
+
+// UsesRetryIntegrityTag says if Retry packets end with a Retry Integrity Tag.
+// This is the case for draft-25 and later.
+// Earlier versions send the original destination connection ID in the Retry packet instead.
+func (vn VersionNumber) UsesRetryIntegrityTag() bool {
+	return vn == VersionDraft29
+}
+
+// AuthenticatesConnectionIDs says if the connection IDs used during the handshake are authenticated
+// using the initial_source_connection_id and retry_source_connection_id transport parameters.
+// This is the case for draft-28 and later.
+func (vn VersionNumber) AuthenticatesConnectionIDs() bool {
+	return vn == VersionDraft29
+}
+
+// UsesQUICKeyUpdateLabel says if the secrets for a key update are derived using the "quic ku" label.
+// This is the case for draft-24 and later. Earlier versions use the TLS 1.3 "traffic upd" label.
+func (vn VersionNumber) UsesQUICKeyUpdateLabel() bool {
+	return vn == VersionDraft29
+}
+
 func (vn VersionNumber) isGQUIC() bool {
 	return vn > gquicVersion0 && vn <= maxGquicVersion
 }
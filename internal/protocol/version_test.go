@@ -12,6 +12,8 @@ var _ = Describe("Version", func() {
 
 	It("says if a version is valid", func() {
 		Expect(IsValidVersion(VersionTLS)).To(BeTrue())
+		Expect(IsValidVersion(VersionDraft23)).To(BeTrue())
+		Expect(IsValidVersion(VersionDraft29)).To(BeTrue())
 		Expect(IsValidVersion(VersionWhatever)).To(BeFalse())
 		Expect(IsValidVersion(VersionUnknown)).To(BeFalse())
 		Expect(IsValidVersion(1234)).To(BeFalse())
@@ -19,10 +21,14 @@ var _ = Describe("Version", func() {
 
 	It("versions don't have reserved version numbers", func() {
 		Expect(isReservedVersion(VersionTLS)).To(BeFalse())
+		Expect(isReservedVersion(VersionDraft23)).To(BeFalse())
+		Expect(isReservedVersion(VersionDraft29)).To(BeFalse())
 	})
 
 	It("has the right string representation", func() {
 		Expect(VersionTLS.String()).To(ContainSubstring("TLS"))
+		Expect(VersionDraft23.String()).To(Equal("draft-23"))
+		Expect(VersionDraft29.String()).To(Equal("draft-29"))
 		Expect(VersionWhatever.String()).To(Equal("whatever"))
 		Expect(VersionUnknown.String()).To(Equal("unknown"))
 		// check with unsupported version numbers from the wiki
@@ -39,6 +45,43 @@ var _ = Describe("Version", func() {
 		Expect(IsSupportedVersion(SupportedVersions, SupportedVersions[len(SupportedVersions)-1])).To(BeTrue())
 	})
 
+	It("says which versions use variable-length integers for the transport parameters", func() {
+		Expect(VersionTLS.UsesVarIntTransportParameters()).To(BeFalse())
+		Expect(VersionDraft23.UsesVarIntTransportParameters()).To(BeFalse())
+		Expect(VersionDraft29.UsesVarIntTransportParameters()).To(BeTrue())
+	})
+
+	It("says which versions have the HANDSHAKE_DONE frame", func() {
+		Expect(VersionTLS.HasHandshakeDoneFrame()).To(BeFalse())
+		Expect(VersionDraft23.HasHandshakeDoneFrame()).To(BeFalse())
+		Expect(VersionDraft29.HasHandshakeDoneFrame()).To(BeTrue())
+	})
+
+	It("says which versions prefix every connection ID with its length", func() {
+		Expect(VersionTLS.HasLengthPrefixedConnectionIDs()).To(BeFalse())
+		Expect(VersionDraft23.HasLengthPrefixedConnectionIDs()).To(BeTrue())
+		Expect(VersionDraft29.HasLengthPrefixedConnectionIDs()).To(BeTrue())
+		Expect(VersionNumber(0x1234).HasLengthPrefixedConnectionIDs()).To(BeTrue())
+	})
+
+	It("says which versions use the Retry Integrity Tag", func() {
+		Expect(VersionTLS.UsesRetryIntegrityTag()).To(BeFalse())
+		Expect(VersionDraft23.UsesRetryIntegrityTag()).To(BeFalse())
+		Expect(VersionDraft29.UsesRetryIntegrityTag()).To(BeTrue())
+	})
+
+	It("says which versions authenticate the connection IDs", func() {
+		Expect(VersionTLS.AuthenticatesConnectionIDs()).To(BeFalse())
+		Expect(VersionDraft23.AuthenticatesConnectionIDs()).To(BeFalse())
+		Expect(VersionDraft29.AuthenticatesConnectionIDs()).To(BeTrue())
+	})
+
+	It("says which versions use the quic ku label for key updates", func() {
+		Expect(VersionTLS.UsesQUICKeyUpdateLabel()).To(BeFalse())
+		Expect(VersionDraft23.UsesQUICKeyUpdateLabel()).To(BeFalse())
+		Expect(VersionDraft29.UsesQUICKeyUpdateLabel()).To(BeTrue())
+	})
+
 	It("has supported versions in sorted order", func() {
 		for i := 0; i < len(SupportedVersions)-1; i++ {
 			Expect(SupportedVersions[i]).To(BeNumerically(">", SupportedVersions[i+1]))
@@ -92,29 +92,48 @@ func (h *ExtendedHeader) writeLongHeader(b *bytes.Buffer, v protocol.VersionNumb
 		packetType = 0x3
 	}
 	firstByte := 0xc0 | packetType<<4
-	if h.Type == protocol.PacketTypeRetry {
+	if h.Type != protocol.PacketTypeRetry {
+		// Retry packets don't have a packet number
+		firstByte |= uint8(h.PacketNumberLen - 1)
+	} else if !h.Version.HasLengthPrefixedConnectionIDs() {
 		odcil, err := encodeSingleConnIDLen(h.OrigDestConnectionID)
 		if err != nil {
 			return err
 		}
 		firstByte |= odcil
-	} else { // Retry packets don't have a packet number
-		firstByte |= uint8(h.PacketNumberLen - 1)
 	}
 
 	b.WriteByte(firstByte)
 	utils.BigEndian.WriteUint32(b, uint32(h.Version))
-	connIDLen, err := encodeConnIDLen(h.DestConnectionID, h.SrcConnectionID)
-	if err != nil {
-		return err
+	if h.Version.HasLengthPrefixedConnectionIDs() {
+		if err := writeLengthPrefixedConnectionID(b, h.DestConnectionID); err != nil {
+			return err
+		}
+		if err := writeLengthPrefixedConnectionID(b, h.SrcConnectionID); err != nil {
+			return err
+		}
+	} else {
+		connIDLen, err := encodeConnIDLen(h.DestConnectionID, h.SrcConnectionID)
+		if err != nil {
+			return err
+		}
+		b.WriteByte(connIDLen)
+		b.Write(h.DestConnectionID.Bytes())
+		b.Write(h.SrcConnectionID.Bytes())
 	}
-	b.WriteByte(connIDLen)
-	b.Write(h.DestConnectionID.Bytes())
-	b.Write(h.SrcConnectionID.Bytes())
 
 	switch h.Type {
 	case protocol.PacketTypeRetry:
-		b.Write(h.OrigDestConnectionID.Bytes())
+		// If the version uses the Retry Integrity Tag, the caller appends it to the packet.
+		if !h.Version.UsesRetryIntegrityTag() {
+			if h.Version.HasLengthPrefixedConnectionIDs() {
+				if err := writeLengthPrefixedConnectionID(b, h.OrigDestConnectionID); err != nil {
+					return err
+				}
+			} else {
+				b.Write(h.OrigDestConnectionID.Bytes())
+			}
+		}
 		b.Write(h.Token)
 		return nil
 	case protocol.PacketTypeInitial:
@@ -148,6 +167,9 @@ func (h *ExtendedHeader) writePacketNumber(b *bytes.Buffer) error {
 func (h *ExtendedHeader) GetLength(v protocol.VersionNumber) protocol.ByteCount {
 	if h.IsLongHeader {
 		length := 1 /* type byte */ + 4 /* version */ + 1 /* conn id len byte */ + protocol.ByteCount(h.DestConnectionID.Len()+h.SrcConnectionID.Len()) + protocol.ByteCount(h.PacketNumberLen) + utils.VarIntLen(uint64(h.Length))
+		if h.Version.HasLengthPrefixedConnectionIDs() {
+			length++ // every connection ID has its own length byte
+		}
 		if h.Type == protocol.PacketTypeInitial {
 			length += utils.VarIntLen(uint64(len(h.Token))) + protocol.ByteCount(len(h.Token))
 		}
@@ -202,3 +224,12 @@ func encodeSingleConnIDLen(id protocol.ConnectionID) (byte, error) {
 	}
 	return byte(len - 3), nil
 }
+
+func writeLengthPrefixedConnectionID(b *bytes.Buffer, id protocol.ConnectionID) error {
+	if id.Len() > protocol.MaxConnIDLen {
+		return fmt.Errorf("invalid connection ID length: %d bytes", id.Len())
+	}
+	b.WriteByte(uint8(id.Len()))
+	b.Write(id.Bytes())
+	return nil
+}
@@ -31,7 +31,7 @@ var _ = Describe("Header", func() {
 						Type:             protocol.PacketTypeHandshake,
 						DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe},
 						SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x0, 0x0, 0x13, 0x37},
-						Version:          0x1020304,
+						Version:          versionIETFHeader,
 						Length:           0xcafe,
 					},
 					PacketNumber:    0xdecaf,
@@ -39,7 +39,7 @@ var _ = Describe("Header", func() {
 				}).Write(buf, versionIETFHeader)).To(Succeed())
 				expected := []byte{
 					0xc0 | 0x2<<4 | 0x2,
-					0x1, 0x2, 0x3, 0x4, // version number
+					0x51, 0x47, 0x4f, 0xff, // version number
 					0x35,                               // connection ID lengths
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, // dest connection ID
 					0xde, 0xca, 0xfb, 0xad, 0x0, 0x0, 0x13, 0x37, // source connection ID
@@ -55,7 +55,7 @@ var _ = Describe("Header", func() {
 						IsLongHeader:     true,
 						SrcConnectionID:  srcConnID,
 						DestConnectionID: protocol.ConnectionID{1, 2, 3}, // connection IDs must be at least 4 bytes long
-						Version:          0x1020304,
+						Version:          versionIETFHeader,
 						Type:             0x5,
 					},
 					PacketNumber:    0xdecafbad,
@@ -70,7 +70,7 @@ var _ = Describe("Header", func() {
 						IsLongHeader:     true,
 						SrcConnectionID:  srcConnID,
 						DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, // connection IDs must be at most 18 bytes long
-						Version:          0x1020304,
+						Version:          versionIETFHeader,
 						Type:             0x5,
 					},
 					PacketNumber:    0xdecafbad,
@@ -85,7 +85,7 @@ var _ = Describe("Header", func() {
 						IsLongHeader:     true,
 						SrcConnectionID:  srcConnID,
 						DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18}, // connection IDs must be at most 18 bytes long
-						Version:          0x1020304,
+						Version:          versionIETFHeader,
 						Type:             0x5,
 					},
 					PacketNumber:    0xdecafbad,
@@ -100,7 +100,7 @@ var _ = Describe("Header", func() {
 				Expect((&ExtendedHeader{
 					Header: Header{
 						IsLongHeader: true,
-						Version:      0x1020304,
+						Version:      versionIETFHeader,
 						Type:         protocol.PacketTypeInitial,
 						Token:        token,
 					},
@@ -115,14 +115,14 @@ var _ = Describe("Header", func() {
 				token := []byte("Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat.")
 				Expect((&ExtendedHeader{Header: Header{
 					IsLongHeader:         true,
-					Version:              0x1020304,
+					Version:              versionIETFHeader,
 					Type:                 protocol.PacketTypeRetry,
 					Token:                token,
 					OrigDestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9},
 				}}).Write(buf, versionIETFHeader)).To(Succeed())
 				expected := []byte{
-					0xc0 | 0x3<<4 | 9 - 3, /* orig dest connection ID length */
-					0x1, 0x2, 0x3, 0x4,    // version number
+					0xc0 | 0x3<<4 | 9 - 3,  /* orig dest connection ID length */
+					0x51, 0x47, 0x4f, 0xff, // version number
 					0x0,                       // connection ID lengths))
 					1, 2, 3, 4, 5, 6, 7, 8, 9, // Orig Dest Connection ID
 				}
@@ -133,13 +133,110 @@ var _ = Describe("Header", func() {
 			It("refuses to write a Retry packet with an invalid Orig Destination Connection ID length", func() {
 				err := (&ExtendedHeader{Header: Header{
 					IsLongHeader:         true,
-					Version:              0x1020304,
+					Version:              versionIETFHeader,
 					Type:                 protocol.PacketTypeRetry,
 					Token:                []byte("foobar"),
 					OrigDestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, // connection IDs must be at most 18 bytes long
 				}}).Write(buf, versionIETFHeader)
 				Expect(err).To(MatchError("invalid connection ID length: 19 bytes"))
 			})
+
+			Context("versions with length-prefixed connection IDs", func() {
+				It("writes", func() {
+					Expect((&ExtendedHeader{
+						Header: Header{
+							IsLongHeader:     true,
+							Type:             protocol.PacketTypeHandshake,
+							DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe},
+							SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
+							Version:          protocol.VersionDraft29,
+							Length:           0xcafe,
+						},
+						PacketNumber:    0xdecaf,
+						PacketNumberLen: protocol.PacketNumberLen3,
+					}).Write(buf, protocol.VersionDraft29)).To(Succeed())
+					expected := []byte{
+						0xc0 | 0x2<<4 | 0x2,
+						0xff, 0x0, 0x0, 0x1d, // version number
+						6, // destination connection ID length
+						0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe,
+						4, // source connection ID length
+						0xde, 0xca, 0xfb, 0xad,
+					}
+					expected = append(expected, encodeVarInt(0xcafe)...)
+					expected = append(expected, []byte{0xd, 0xec, 0xaf}...) // packet number
+					Expect(buf.Bytes()).To(Equal(expected))
+				})
+
+				It("writes a header with a 20 byte connection ID", func() {
+					connID := protocol.ConnectionID(bytes.Repeat([]byte{0x42}, 20))
+					Expect((&ExtendedHeader{
+						Header: Header{
+							IsLongHeader:     true,
+							Type:             protocol.PacketTypeHandshake,
+							DestConnectionID: connID,
+							Version:          protocol.VersionDraft29,
+						},
+						PacketNumberLen: protocol.PacketNumberLen1,
+					}).Write(buf, protocol.VersionDraft29)).To(Succeed())
+					Expect(buf.Bytes()).To(ContainSubstring(string(append([]byte{20}, connID...))))
+				})
+
+				It("refuses to write a header with a too long connection ID", func() {
+					err := (&ExtendedHeader{
+						Header: Header{
+							IsLongHeader:    true,
+							Type:            protocol.PacketTypeHandshake,
+							SrcConnectionID: protocol.ConnectionID(bytes.Repeat([]byte{0x42}, 21)),
+							Version:         protocol.VersionDraft29,
+						},
+						PacketNumberLen: protocol.PacketNumberLen1,
+					}).Write(buf, protocol.VersionDraft29)
+					Expect(err).To(MatchError("invalid connection ID length: 21 bytes"))
+				})
+
+				It("writes a Retry packet that contains the original destination connection ID", func() {
+					Expect((&ExtendedHeader{Header: Header{
+						IsLongHeader:         true,
+						Version:              protocol.VersionDraft23,
+						Type:                 protocol.PacketTypeRetry,
+						SrcConnectionID:      protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+						Token:                []byte("foobar"),
+						OrigDestConnectionID: protocol.ConnectionID{1, 2, 3},
+					}}).Write(buf, protocol.VersionDraft23)).To(Succeed())
+					expected := []byte{
+						0xc0 | 0x3<<4,
+						0xff, 0x0, 0x0, 0x17, // version number
+						0, // destination connection ID length
+						4, // source connection ID length
+						0xde, 0xad, 0xbe, 0xef,
+						3, // original destination connection ID length
+						1, 2, 3,
+					}
+					expected = append(expected, []byte("foobar")...)
+					Expect(buf.Bytes()).To(Equal(expected))
+				})
+
+				It("writes a Retry packet without the original destination connection ID, if the Retry Integrity Tag is used", func() {
+					Expect((&ExtendedHeader{Header: Header{
+						IsLongHeader:         true,
+						Version:              protocol.VersionDraft29,
+						Type:                 protocol.PacketTypeRetry,
+						SrcConnectionID:      protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+						Token:                []byte("foobar"),
+						OrigDestConnectionID: protocol.ConnectionID{1, 2, 3},
+					}}).Write(buf, protocol.VersionDraft29)).To(Succeed())
+					expected := []byte{
+						0xc0 | 0x3<<4,
+						0xff, 0x0, 0x0, 0x1d, // version number
+						0, // destination connection ID length
+						4, // source connection ID length
+						0xde, 0xad, 0xbe, 0xef,
+					}
+					expected = append(expected, []byte("foobar")...)
+					Expect(buf.Bytes()).To(Equal(expected))
+				})
+			})
 		})
 
 		Context("short header", func() {
@@ -222,6 +319,7 @@ var _ = Describe("Header", func() {
 			h := &ExtendedHeader{
 				Header: Header{
 					IsLongHeader:     true,
+					Version:          versionIETFHeader,
 					Type:             protocol.PacketTypeHandshake,
 					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
@@ -235,10 +333,29 @@ var _ = Describe("Header", func() {
 			Expect(buf.Len()).To(Equal(expectedLen))
 		})
 
+		It("has the right length for the Long Header, for versions with length-prefixed connection IDs", func() {
+			h := &ExtendedHeader{
+				Header: Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+					Version:          protocol.VersionDraft29,
+					Length:           1,
+				},
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}
+			expectedLen := 1 /* type byte */ + 4 /* version */ + 2 /* conn ID lens */ + 8 /* dest conn id */ + 4 /* src conn id */ + 1 /* short len */ + 1 /* packet number */
+			Expect(h.GetLength(protocol.VersionDraft29)).To(BeEquivalentTo(expectedLen))
+			Expect(h.Write(buf, protocol.VersionDraft29)).To(Succeed())
+			Expect(buf.Len()).To(Equal(expectedLen))
+		})
+
 		It("has the right length for the Long Header, for a long length", func() {
 			h := &ExtendedHeader{
 				Header: Header{
 					IsLongHeader:     true,
+					Version:          versionIETFHeader,
 					Type:             protocol.PacketTypeHandshake,
 					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
@@ -256,6 +373,7 @@ var _ = Describe("Header", func() {
 			h := &ExtendedHeader{
 				Header: Header{
 					IsLongHeader:     true,
+					Version:          versionIETFHeader,
 					Type:             protocol.PacketTypeInitial,
 					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
@@ -273,6 +391,7 @@ var _ = Describe("Header", func() {
 			h := &ExtendedHeader{
 				Header: Header{
 					IsLongHeader:     true,
+					Version:          versionIETFHeader,
 					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 					SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
 					Type:             protocol.PacketTypeInitial,
@@ -11,12 +11,17 @@ import (
 type frameParser struct {
 	ackDelayExponent uint8
 
+	supportsDatagrams bool
+
 	version protocol.VersionNumber
 }
 
 // NewFrameParser creates a new frame parser.
-func NewFrameParser(v protocol.VersionNumber) FrameParser {
-	return &frameParser{version: v}
+func NewFrameParser(supportsDatagrams bool, v protocol.VersionNumber) FrameParser {
+	return &frameParser{
+		supportsDatagrams: supportsDatagrams,
+		version:           v,
+	}
 }
 
 // ParseNextFrame parses the next frame
@@ -83,6 +88,18 @@ func (p *frameParser) parseFrame(r *bytes.Reader, typeByte byte, encLevel protoc
 		frame, err = parsePathResponseFrame(r, p.version)
 	case 0x1c, 0x1d:
 		frame, err = parseConnectionCloseFrame(r, p.version)
+	case 0x1e:
+		if p.version.HasHandshakeDoneFrame() {
+			frame, err = parseHandshakeDoneFrame(r, p.version)
+			break
+		}
+		err = fmt.Errorf("unknown type byte 0x%x", typeByte)
+	case 0x30, 0x31:
+		if p.supportsDatagrams {
+			frame, err = parseDatagramFrame(r, p.version)
+			break
+		}
+		fallthrough
 	default:
 		err = fmt.Errorf("unknown type byte 0x%x", typeByte)
 	}
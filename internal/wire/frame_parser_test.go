@@ -18,7 +18,7 @@ var _ = Describe("Frame parsing", func() {
 
 	BeforeEach(func() {
 		buf = &bytes.Buffer{}
-		parser = NewFrameParser(versionIETFFrames)
+		parser = NewFrameParser(true, versionIETFFrames)
 	})
 
 	It("returns nil if there's nothing more to read", func() {
@@ -271,6 +271,41 @@ var _ = Describe("Frame parsing", func() {
 		Expect(frame).To(Equal(f))
 	})
 
+	It("unpacks DATAGRAM frames", func() {
+		f := &DatagramFrame{Data: []byte("foobar")}
+		err := f.Write(buf, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		frame, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).ToNot(BeNil())
+		Expect(frame).To(Equal(f))
+	})
+
+	It("errors when DATAGRAM frames are not supported", func() {
+		parser = NewFrameParser(false, versionIETFFrames)
+		f := &DatagramFrame{Data: []byte("foobar")}
+		Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+		_, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown type byte 0x30"))
+	})
+
+	It("unpacks HANDSHAKE_DONE frames", func() {
+		parser = NewFrameParser(true, protocol.VersionDraft29)
+		f := &HandshakeDoneFrame{}
+		Expect(f.Write(buf, protocol.VersionDraft29)).To(Succeed())
+		frame, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(f))
+	})
+
+	It("errors on HANDSHAKE_DONE frames for versions that don't define them", func() {
+		parser = NewFrameParser(true, protocol.VersionDraft23)
+		f := &HandshakeDoneFrame{}
+		Expect(f.Write(buf, protocol.VersionDraft23)).To(Succeed())
+		_, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown type byte 0x1e"))
+	})
+
 	It("errors on invalid type", func() {
 		_, err := parser.ParseNext(bytes.NewReader([]byte{0x42}), protocol.Encryption1RTT)
 		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown type byte 0x42"))
@@ -0,0 +1,28 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+)
+
+// A HandshakeDoneFrame is a HANDSHAKE_DONE frame.
+// It is only defined for versions that support it, see protocol.VersionNumber.HasHandshakeDoneFrame.
+type HandshakeDoneFrame struct{}
+
+func parseHandshakeDoneFrame(r *bytes.Reader, version protocol.VersionNumber) (*HandshakeDoneFrame, error) {
+	if _, err := r.ReadByte(); err != nil {
+		return nil, err
+	}
+	return &HandshakeDoneFrame{}, nil
+}
+
+func (f *HandshakeDoneFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error {
+	b.WriteByte(0x1e)
+	return nil
+}
+
+// Length of a written frame
+func (f *HandshakeDoneFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
+	return 1
+}
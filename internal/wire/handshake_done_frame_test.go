@@ -0,0 +1,39 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HANDSHAKE_DONE frame", func() {
+	Context("when parsing", func() {
+		It("accepts sample frame", func() {
+			b := bytes.NewReader([]byte{0x1e})
+			_, err := parseHandshakeDoneFrame(b, protocol.VersionDraft29)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors on EOFs", func() {
+			_, err := parseHandshakeDoneFrame(bytes.NewReader(nil), protocol.VersionDraft29)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame", func() {
+			b := &bytes.Buffer{}
+			frame := HandshakeDoneFrame{}
+			frame.Write(b, protocol.VersionDraft29)
+			Expect(b.Bytes()).To(Equal([]byte{0x1e}))
+		})
+
+		It("has the correct min length", func() {
+			frame := HandshakeDoneFrame{}
+			Expect(frame.Length(protocol.VersionDraft29)).To(Equal(protocol.ByteCount(1)))
+		})
+	})
+})
@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -27,7 +28,12 @@ func ParseConnectionID(data []byte, shortHeaderConnIDLen int) (protocol.Connecti
 	if len(data) < 6 {
 		return nil, io.EOF
 	}
-	destConnIDLen, _ := decodeConnIDLen(data[5])
+	var destConnIDLen int
+	if protocol.VersionNumber(binary.BigEndian.Uint32(data[1:5])).HasLengthPrefixedConnectionIDs() {
+		destConnIDLen = int(data[5])
+	} else {
+		destConnIDLen, _ = decodeConnIDLen(data[5])
+	}
 	if len(data) < 6+destConnIDLen {
 		return nil, io.EOF
 	}
@@ -139,16 +145,11 @@ func (h *Header) parseLongHeader(b *bytes.Reader) error {
 	if h.Version != 0 && h.typeByte&0x40 == 0 {
 		return errors.New("not a QUIC packet")
 	}
-	connIDLenByte, err := b.ReadByte()
-	if err != nil {
-		return err
+	if h.Version.HasLengthPrefixedConnectionIDs() {
+		err = h.parseLengthPrefixedConnectionIDs(b)
+	} else {
+		err = h.parseConnectionIDs(b)
 	}
-	dcil, scil := decodeConnIDLen(connIDLenByte)
-	h.DestConnectionID, err = protocol.ReadConnectionID(b, dcil)
-	if err != nil {
-		return err
-	}
-	h.SrcConnectionID, err = protocol.ReadConnectionID(b, scil)
 	if err != nil {
 		return err
 	}
@@ -159,6 +160,9 @@ func (h *Header) parseLongHeader(b *bytes.Reader) error {
 	if !protocol.IsSupportedVersion(protocol.SupportedVersions, h.Version) {
 		return errUnsupportedVersion
 	}
+	if h.DestConnectionID.Len() > protocol.MaxConnIDLen || h.SrcConnectionID.Len() > protocol.MaxConnIDLen {
+		return errors.New("invalid connection ID length")
+	}
 
 	switch (h.typeByte & 0x30) >> 4 {
 	case 0x0:
@@ -172,7 +176,19 @@ func (h *Header) parseLongHeader(b *bytes.Reader) error {
 	}
 
 	if h.Type == protocol.PacketTypeRetry {
-		odcil := decodeSingleConnIDLen(h.typeByte & 0xf)
+		if h.Version.UsesRetryIntegrityTag() {
+			return h.parseRetryWithIntegrityTag(b)
+		}
+		var odcil int
+		if h.Version.HasLengthPrefixedConnectionIDs() {
+			l, err := b.ReadByte()
+			if err != nil {
+				return err
+			}
+			odcil = int(l)
+		} else {
+			odcil = decodeSingleConnIDLen(h.typeByte & 0xf)
+		}
 		h.OrigDestConnectionID, err = protocol.ReadConnectionID(b, odcil)
 		if err != nil {
 			return err
@@ -206,6 +222,55 @@ func (h *Header) parseLongHeader(b *bytes.Reader) error {
 	return nil
 }
 
+// parseConnectionIDs parses the connection IDs of the development version.
+// Their lengths are encoded in a single byte.
+func (h *Header) parseConnectionIDs(b *bytes.Reader) error {
+	connIDLenByte, err := b.ReadByte()
+	if err != nil {
+		return err
+	}
+	dcil, scil := decodeConnIDLen(connIDLenByte)
+	h.DestConnectionID, err = protocol.ReadConnectionID(b, dcil)
+	if err != nil {
+		return err
+	}
+	h.SrcConnectionID, err = protocol.ReadConnectionID(b, scil)
+	return err
+}
+
+// parseLengthPrefixedConnectionIDs parses connection IDs that are each preceded by a one byte length.
+func (h *Header) parseLengthPrefixedConnectionIDs(b *bytes.Reader) error {
+	dcil, err := b.ReadByte()
+	if err != nil {
+		return err
+	}
+	h.DestConnectionID, err = protocol.ReadConnectionID(b, int(dcil))
+	if err != nil {
+		return err
+	}
+	scil, err := b.ReadByte()
+	if err != nil {
+		return err
+	}
+	h.SrcConnectionID, err = protocol.ReadConnectionID(b, int(scil))
+	return err
+}
+
+// parseRetryWithIntegrityTag parses the token of a Retry packet that ends with a Retry Integrity Tag.
+// The tag is not verified here, since this requires knowledge of the original destination connection ID.
+func (h *Header) parseRetryWithIntegrityTag(b *bytes.Reader) error {
+	tokenLen := b.Len() - 16
+	if tokenLen <= 0 {
+		return io.EOF
+	}
+	h.Token = make([]byte, tokenLen)
+	if _, err := io.ReadFull(b, h.Token); err != nil {
+		return err
+	}
+	_, err := b.Seek(16, io.SeekCurrent)
+	return err
+}
+
 func (h *Header) parseVersionNegotiationPacket(b *bytes.Reader) error {
 	if b.Len() == 0 {
 		return errors.New("Version Negoation packet has empty version list")
@@ -14,7 +14,7 @@ var _ = Describe("Header Parsing", func() {
 	appendVersion := func(data []byte, v protocol.VersionNumber) []byte {
 		offset := len(data)
 		data = append(data, []byte{0, 0, 0, 0}...)
-		binary.BigEndian.PutUint32(data[offset:], uint32(versionIETFFrames))
+		binary.BigEndian.PutUint32(data[offset:], uint32(v))
 		return data
 	}
 
@@ -204,8 +204,9 @@ var _ = Describe("Header Parsing", func() {
 			data := []byte{
 				0xc0,
 				0xde, 0xad, 0xbe, 0xef,
-				0x55, // connection ID length
+				0x8, // destination connection ID length
 				0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8,
+				0x8, // source connection ID length
 				0x8, 0x7, 0x6, 0x5, 0x4, 0x3, 0x2, 0x1,
 				'f', 'o', 'o', 'b', 'a', 'r', // unspecified bytes
 			}
@@ -348,6 +349,107 @@ var _ = Describe("Header Parsing", func() {
 			}
 		})
 
+		Context("versions with length-prefixed connection IDs", func() {
+			It("parses the connection ID", func() {
+				data := []byte{0xc0 ^ 0x2<<4}
+				data = appendVersion(data, protocol.VersionDraft29)
+				data = append(data, 20) // destination connection ID length
+				data = append(data, bytes.Repeat([]byte{0x42}, 20)...)
+				connID, err := ParseConnectionID(data, 8)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(connID).To(Equal(protocol.ConnectionID(bytes.Repeat([]byte{0x42}, 20))))
+				_, err = ParseConnectionID(data[:len(data)-1], 8)
+				Expect(err).To(MatchError(io.EOF))
+			})
+
+			It("parses a Long Header", func() {
+				destConnID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}
+				srcConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+				data := []byte{0xc0 ^ 0x1}
+				data = appendVersion(data, protocol.VersionDraft29)
+				data = append(data, uint8(destConnID.Len()))
+				data = append(data, destConnID...)
+				data = append(data, uint8(srcConnID.Len()))
+				data = append(data, srcConnID...)
+				data = append(data, encodeVarInt(6)...)  // token length
+				data = append(data, []byte("foobar")...) // token
+				data = append(data, encodeVarInt(2)...)  // length
+				hdrLen := len(data)
+				data = append(data, []byte{0x13, 0x37}...) // packet number
+				hdr, pdata, rest, err := ParsePacket(data, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(pdata).To(Equal(data))
+				Expect(rest).To(BeEmpty())
+				Expect(hdr.Type).To(Equal(protocol.PacketTypeInitial))
+				Expect(hdr.Version).To(Equal(protocol.VersionDraft29))
+				Expect(hdr.DestConnectionID).To(Equal(destConnID))
+				Expect(hdr.SrcConnectionID).To(Equal(srcConnID))
+				Expect(hdr.Token).To(Equal([]byte("foobar")))
+				Expect(hdr.ParsedLen()).To(BeEquivalentTo(hdrLen))
+				extHdr, err := hdr.ParseExtended(bytes.NewReader(data), protocol.VersionDraft29)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(extHdr.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
+			})
+
+			It("errors if a connection ID is too long", func() {
+				data := []byte{0xc0 ^ 0x2<<4}
+				data = appendVersion(data, protocol.VersionDraft29)
+				data = append(data, 21) // destination connection ID length
+				data = append(data, bytes.Repeat([]byte{0x42}, 21)...)
+				data = append(data, 0)                  // source connection ID length
+				data = append(data, encodeVarInt(0)...) // length
+				_, _, _, err := ParsePacket(data, 0)
+				Expect(err).To(MatchError("invalid connection ID length"))
+			})
+
+			It("parses a Retry packet that contains the original destination connection ID", func() {
+				data := []byte{0xc0 | 0x3<<4}
+				data = appendVersion(data, protocol.VersionDraft23)
+				data = append(data, 0)                                 // destination connection ID length
+				data = append(data, 4)                                 // source connection ID length
+				data = append(data, []byte{0xde, 0xad, 0xbe, 0xef}...) // source connection ID
+				data = append(data, 10)                                // original destination connection ID length
+				data = append(data, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}...)
+				data = append(data, []byte("foobar")...) // token
+				hdr, pdata, rest, err := ParsePacket(data, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.Type).To(Equal(protocol.PacketTypeRetry))
+				Expect(hdr.SrcConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+				Expect(hdr.OrigDestConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
+				Expect(hdr.Token).To(Equal([]byte("foobar")))
+				Expect(pdata).To(Equal(data))
+				Expect(rest).To(BeEmpty())
+			})
+
+			It("parses a Retry packet that ends with a Retry Integrity Tag", func() {
+				data := []byte{0xc0 | 0x3<<4 | 0xa /* unused bits */}
+				data = appendVersion(data, protocol.VersionDraft29)
+				data = append(data, 0)                                 // destination connection ID length
+				data = append(data, 4)                                 // source connection ID length
+				data = append(data, []byte{0xde, 0xad, 0xbe, 0xef}...) // source connection ID
+				data = append(data, []byte("foobar")...)               // token
+				data = append(data, bytes.Repeat([]byte{0x42}, 16)...) // Retry Integrity Tag
+				hdr, pdata, rest, err := ParsePacket(data, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.Type).To(Equal(protocol.PacketTypeRetry))
+				Expect(hdr.OrigDestConnectionID).To(BeEmpty())
+				Expect(hdr.Token).To(Equal([]byte("foobar")))
+				Expect(hdr.ParsedLen()).To(BeEquivalentTo(len(data)))
+				Expect(pdata).To(Equal(data))
+				Expect(rest).To(BeEmpty())
+			})
+
+			It("errors if a Retry packet is too short to contain a token and the Retry Integrity Tag", func() {
+				data := []byte{0xc0 | 0x3<<4}
+				data = appendVersion(data, protocol.VersionDraft29)
+				data = append(data, 0)                                 // destination connection ID length
+				data = append(data, 0)                                 // source connection ID length
+				data = append(data, bytes.Repeat([]byte{0x42}, 16)...) // Retry Integrity Tag
+				_, _, _, err := ParsePacket(data, 0)
+				Expect(err).To(MatchError(io.EOF))
+			})
+		})
+
 		Context("coalesced packets", func() {
 			It("cuts packets", func() {
 				buf := &bytes.Buffer{}
@@ -108,10 +108,11 @@ var _ = Describe("Frame logging", func() {
 	It("logs NEW_CONNECTION_ID frames", func() {
 		LogFrame(logger, &NewConnectionIDFrame{
 			SequenceNumber:      42,
+			RetirePriorTo:       24,
 			ConnectionID:        protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
 			StatelessResetToken: [16]byte{0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8, 0x9, 0xa, 0xb, 0xc, 0xd, 0xe, 0xf, 0x10},
 		}, false)
-		Expect(buf.String()).To(ContainSubstring("\t<- &wire.NewConnectionIDFrame{SequenceNumber: 42, ConnectionID: 0xdeadbeef, StatelessResetToken: 0x0102030405060708090a0b0c0d0e0f10}"))
+		Expect(buf.String()).To(ContainSubstring("\t<- &wire.NewConnectionIDFrame{SequenceNumber: 42, RetirePriorTo: 24, ConnectionID: 0xdeadbeef, StatelessResetToken: 0x0102030405060708090a0b0c0d0e0f10}"))
 	})
 
 	It("logs NEW_TOKEN frames", func() {
@@ -120,4 +121,12 @@ var _ = Describe("Frame logging", func() {
 		}, true)
 		Expect(buf.String()).To(ContainSubstring("\t-> &wire.NewTokenFrame{Token: 0xdeadbeef"))
 	})
+
+	It("logs DATAGRAM frames", func() {
+		LogFrame(logger, &DatagramFrame{
+			DataLenPresent: true,
+			Data:           []byte{0xde, 0xad, 0xbe, 0xef},
+		}, true)
+		Expect(buf.String()).To(ContainSubstring("\t-> &wire.DatagramFrame{DataLenPresent: true, Length: 4}"))
+	})
 })
@@ -13,6 +13,7 @@ import (
 // A NewConnectionIDFrame is a NEW_CONNECTION_ID frame
 type NewConnectionIDFrame struct {
 	SequenceNumber      uint64
+	RetirePriorTo       uint64
 	ConnectionID        protocol.ConnectionID
 	StatelessResetToken [16]byte
 }
@@ -26,6 +27,13 @@ func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewC
 	if err != nil {
 		return nil, err
 	}
+	ret, err := utils.ReadVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if ret > seq {
+		return nil, fmt.Errorf("Retire Prior To value (%d) larger than Sequence Number (%d)", ret, seq)
+	}
 	connIDLen, err := r.ReadByte()
 	if err != nil {
 		return nil, err
@@ -39,6 +47,7 @@ func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewC
 	}
 	frame := &NewConnectionIDFrame{
 		SequenceNumber: seq,
+		RetirePriorTo:  ret,
 		ConnectionID:   connID,
 	}
 	if _, err := io.ReadFull(r, frame.StatelessResetToken[:]); err != nil {
@@ -54,6 +63,7 @@ func parseNewConnectionIDFrame(r *bytes.Reader, _ protocol.VersionNumber) (*NewC
 func (f *NewConnectionIDFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
 	b.WriteByte(0x18)
 	utils.WriteVarInt(b, f.SequenceNumber)
+	utils.WriteVarInt(b, f.RetirePriorTo)
 	connIDLen := f.ConnectionID.Len()
 	if connIDLen < 4 || connIDLen > 18 {
 		return fmt.Errorf("invalid connection ID length: %d", connIDLen)
@@ -66,5 +76,5 @@ func (f *NewConnectionIDFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber)
 
 // Length of a written frame
 func (f *NewConnectionIDFrame) Length(protocol.VersionNumber) protocol.ByteCount {
-	return 1 + utils.VarIntLen(f.SequenceNumber) + 1 /* connection ID length */ + protocol.ByteCount(f.ConnectionID.Len()) + 16
+	return 1 + utils.VarIntLen(f.SequenceNumber) + utils.VarIntLen(f.RetirePriorTo) + 1 /* connection ID length */ + protocol.ByteCount(f.ConnectionID.Len()) + 16
 }
@@ -8,6 +8,7 @@ import (
 	net "net"
 	reflect "reflect"
 
+	protocol "github.com/DrakenLibra/gt-bbr/internal/protocol"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,18 +36,18 @@ func (m *MockMultiplexer) EXPECT() *MockMultiplexerMockRecorder {
 }
 
 // AddConn mocks base method
-func (m *MockMultiplexer) AddConn(arg0 net.PacketConn, arg1 int, arg2 []byte) (packetHandlerManager, error) {
+func (m *MockMultiplexer) AddConn(arg0 net.PacketConn, arg1 int, arg2 [][]byte, arg3 protocol.ByteCount, arg4 bool) (packetHandlerManager, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddConn", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "AddConn", arg0, arg1, arg2, arg3, arg4)
 	ret0, _ := ret[0].(packetHandlerManager)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddConn indicates an expected call of AddConn
-func (mr *MockMultiplexerMockRecorder) AddConn(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockMultiplexerMockRecorder) AddConn(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddConn", reflect.TypeOf((*MockMultiplexer)(nil).AddConn), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddConn", reflect.TypeOf((*MockMultiplexer)(nil).AddConn), arg0, arg1, arg2, arg3, arg4)
 }
 
 // RemoveConn mocks base method
@@ -0,0 +1,73 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/DrakenLibra/gt-bbr (interfaces: PacketConnMigrator)
+
+// Package quic is a generated GoMock package.
+package quic
+
+import (
+	net "net"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockPacketConnMigrator is a mock of PacketConnMigrator interface
+type MockPacketConnMigrator struct {
+	ctrl     *gomock.Controller
+	recorder *MockPacketConnMigratorMockRecorder
+}
+
+// MockPacketConnMigratorMockRecorder is the mock recorder for MockPacketConnMigrator
+type MockPacketConnMigratorMockRecorder struct {
+	mock *MockPacketConnMigrator
+}
+
+// NewMockPacketConnMigrator creates a new mock instance
+func NewMockPacketConnMigrator(ctrl *gomock.Controller) *MockPacketConnMigrator {
+	mock := &MockPacketConnMigrator{ctrl: ctrl}
+	mock.recorder = &MockPacketConnMigratorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockPacketConnMigrator) EXPECT() *MockPacketConnMigratorMockRecorder {
+	return m.recorder
+}
+
+// AddPacketConn mocks base method
+func (m *MockPacketConnMigrator) AddPacketConn(arg0 net.PacketConn) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddPacketConn", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddPacketConn indicates an expected call of AddPacketConn
+func (mr *MockPacketConnMigratorMockRecorder) AddPacketConn(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPacketConn", reflect.TypeOf((*MockPacketConnMigrator)(nil).AddPacketConn), arg0)
+}
+
+// RemovePacketConn mocks base method
+func (m *MockPacketConnMigrator) RemovePacketConn(arg0 net.PacketConn) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RemovePacketConn", arg0)
+}
+
+// RemovePacketConn indicates an expected call of RemovePacketConn
+func (mr *MockPacketConnMigratorMockRecorder) RemovePacketConn(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemovePacketConn", reflect.TypeOf((*MockPacketConnMigrator)(nil).RemovePacketConn), arg0)
+}
+
+// SwitchPacketConn mocks base method
+func (m *MockPacketConnMigrator) SwitchPacketConn(arg0 net.PacketConn) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SwitchPacketConn", arg0)
+}
+
+// SwitchPacketConn indicates an expected call of SwitchPacketConn
+func (mr *MockPacketConnMigratorMockRecorder) SwitchPacketConn(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SwitchPacketConn", reflect.TypeOf((*MockPacketConnMigrator)(nil).SwitchPacketConn), arg0)
+}
@@ -137,6 +137,20 @@ func (mr *MockQuicSessionMockRecorder) GetVersion() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersion", reflect.TypeOf((*MockQuicSession)(nil).GetVersion))
 }
 
+// HandshakeComplete mocks base method
+func (m *MockQuicSession) HandshakeComplete() context.Context {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandshakeComplete")
+	ret0, _ := ret[0].(context.Context)
+	return ret0
+}
+
+// HandshakeComplete indicates an expected call of HandshakeComplete
+func (mr *MockQuicSessionMockRecorder) HandshakeComplete() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandshakeComplete", reflect.TypeOf((*MockQuicSession)(nil).HandshakeComplete))
+}
+
 // LocalAddr mocks base method
 func (m *MockQuicSession) LocalAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -151,6 +165,20 @@ func (mr *MockQuicSessionMockRecorder) LocalAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LocalAddr", reflect.TypeOf((*MockQuicSession)(nil).LocalAddr))
 }
 
+// MigrateTo mocks base method
+func (m *MockQuicSession) MigrateTo(arg0 net.PacketConn) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MigrateTo", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MigrateTo indicates an expected call of MigrateTo
+func (mr *MockQuicSessionMockRecorder) MigrateTo(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MigrateTo", reflect.TypeOf((*MockQuicSession)(nil).MigrateTo), arg0)
+}
+
 // OpenStream mocks base method
 func (m *MockQuicSession) OpenStream() (Stream, error) {
 	m.ctrl.T.Helper()
@@ -211,6 +239,21 @@ func (mr *MockQuicSessionMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockQuicSession)(nil).OpenUniStreamSync))
 }
 
+// ReceiveMessage mocks base method
+func (m *MockQuicSession) ReceiveMessage() ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReceiveMessage")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveMessage indicates an expected call of ReceiveMessage
+func (mr *MockQuicSessionMockRecorder) ReceiveMessage() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveMessage", reflect.TypeOf((*MockQuicSession)(nil).ReceiveMessage))
+}
+
 // RemoteAddr mocks base method
 func (m *MockQuicSession) RemoteAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -225,6 +268,44 @@ func (mr *MockQuicSessionMockRecorder) RemoteAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockQuicSession)(nil).RemoteAddr))
 }
 
+// SendMessage mocks base method
+func (m *MockQuicSession) SendMessage(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendMessage", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendMessage indicates an expected call of SendMessage
+func (mr *MockQuicSessionMockRecorder) SendMessage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockQuicSession)(nil).SendMessage), arg0)
+}
+
+// SetMaxIncomingStreams mocks base method
+func (m *MockQuicSession) SetMaxIncomingStreams(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetMaxIncomingStreams", arg0)
+}
+
+// SetMaxIncomingStreams indicates an expected call of SetMaxIncomingStreams
+func (mr *MockQuicSessionMockRecorder) SetMaxIncomingStreams(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingStreams", reflect.TypeOf((*MockQuicSession)(nil).SetMaxIncomingStreams), arg0)
+}
+
+// SetMaxIncomingUniStreams mocks base method
+func (m *MockQuicSession) SetMaxIncomingUniStreams(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetMaxIncomingUniStreams", arg0)
+}
+
+// SetMaxIncomingUniStreams indicates an expected call of SetMaxIncomingUniStreams
+func (mr *MockQuicSessionMockRecorder) SetMaxIncomingUniStreams(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingUniStreams", reflect.TypeOf((*MockQuicSession)(nil).SetMaxIncomingUniStreams), arg0)
+}
+
 // closeForRecreating mocks base method
 func (m *MockQuicSession) closeForRecreating() protocol.PacketNumber {
 	m.ctrl.T.Helper()
@@ -77,6 +77,20 @@ func (mr *MockReceiveStreamIMockRecorder) SetReadDeadline(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadDeadline", reflect.TypeOf((*MockReceiveStreamI)(nil).SetReadDeadline), arg0)
 }
 
+// Stats mocks base method
+func (m *MockReceiveStreamI) Stats() StreamStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(StreamStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockReceiveStreamIMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockReceiveStreamI)(nil).Stats))
+}
+
 // StreamID mocks base method
 func (m *MockReceiveStreamI) StreamID() protocol.StreamID {
 	m.ctrl.T.Helper()
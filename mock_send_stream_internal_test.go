@@ -91,6 +91,20 @@ func (mr *MockSendStreamIMockRecorder) SetWriteDeadline(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWriteDeadline", reflect.TypeOf((*MockSendStreamI)(nil).SetWriteDeadline), arg0)
 }
 
+// Stats mocks base method
+func (m *MockSendStreamI) Stats() StreamStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(StreamStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockSendStreamIMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockSendStreamI)(nil).Stats))
+}
+
 // StreamID mocks base method
 func (m *MockSendStreamI) StreamID() protocol.StreamID {
 	m.ctrl.T.Helper()
@@ -105,6 +119,20 @@ func (mr *MockSendStreamIMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockSendStreamI)(nil).StreamID))
 }
 
+// WaitAcknowledged mocks base method
+func (m *MockSendStreamI) WaitAcknowledged(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitAcknowledged", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitAcknowledged indicates an expected call of WaitAcknowledged
+func (mr *MockSendStreamIMockRecorder) WaitAcknowledged(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitAcknowledged", reflect.TypeOf((*MockSendStreamI)(nil).WaitAcknowledged), arg0)
+}
+
 // Write mocks base method
 func (m *MockSendStreamI) Write(arg0 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -156,6 +184,30 @@ func (mr *MockSendStreamIMockRecorder) handleStopSendingFrame(arg0 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStopSendingFrame", reflect.TypeOf((*MockSendStreamI)(nil).handleStopSendingFrame), arg0)
 }
 
+// handleStreamFrameAcked mocks base method
+func (m *MockSendStreamI) handleStreamFrameAcked(arg0 *wire.StreamFrame) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "handleStreamFrameAcked", arg0)
+}
+
+// handleStreamFrameAcked indicates an expected call of handleStreamFrameAcked
+func (mr *MockSendStreamIMockRecorder) handleStreamFrameAcked(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamFrameAcked", reflect.TypeOf((*MockSendStreamI)(nil).handleStreamFrameAcked), arg0)
+}
+
+// handleStreamFrameRetransmitted mocks base method
+func (m *MockSendStreamI) handleStreamFrameRetransmitted(arg0 *wire.StreamFrame) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "handleStreamFrameRetransmitted", arg0)
+}
+
+// handleStreamFrameRetransmitted indicates an expected call of handleStreamFrameRetransmitted
+func (mr *MockSendStreamIMockRecorder) handleStreamFrameRetransmitted(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamFrameRetransmitted", reflect.TypeOf((*MockSendStreamI)(nil).handleStreamFrameRetransmitted), arg0)
+}
+
 // hasData mocks base method
 func (m *MockSendStreamI) hasData() bool {
 	m.ctrl.T.Helper()
@@ -146,6 +146,20 @@ func (mr *MockStreamIMockRecorder) SetWriteDeadline(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWriteDeadline", reflect.TypeOf((*MockStreamI)(nil).SetWriteDeadline), arg0)
 }
 
+// Stats mocks base method
+func (m *MockStreamI) Stats() StreamStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(StreamStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockStreamIMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockStreamI)(nil).Stats))
+}
+
 // StreamID mocks base method
 func (m *MockStreamI) StreamID() protocol.StreamID {
 	m.ctrl.T.Helper()
@@ -160,6 +174,20 @@ func (mr *MockStreamIMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockStreamI)(nil).StreamID))
 }
 
+// WaitAcknowledged mocks base method
+func (m *MockStreamI) WaitAcknowledged(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitAcknowledged", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitAcknowledged indicates an expected call of WaitAcknowledged
+func (mr *MockStreamIMockRecorder) WaitAcknowledged(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitAcknowledged", reflect.TypeOf((*MockStreamI)(nil).WaitAcknowledged), arg0)
+}
+
 // Write mocks base method
 func (m *MockStreamI) Write(arg0 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -253,6 +281,30 @@ func (mr *MockStreamIMockRecorder) handleStreamFrame(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamFrame", reflect.TypeOf((*MockStreamI)(nil).handleStreamFrame), arg0)
 }
 
+// handleStreamFrameAcked mocks base method
+func (m *MockStreamI) handleStreamFrameAcked(arg0 *wire.StreamFrame) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "handleStreamFrameAcked", arg0)
+}
+
+// handleStreamFrameAcked indicates an expected call of handleStreamFrameAcked
+func (mr *MockStreamIMockRecorder) handleStreamFrameAcked(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamFrameAcked", reflect.TypeOf((*MockStreamI)(nil).handleStreamFrameAcked), arg0)
+}
+
+// handleStreamFrameRetransmitted mocks base method
+func (m *MockStreamI) handleStreamFrameRetransmitted(arg0 *wire.StreamFrame) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "handleStreamFrameRetransmitted", arg0)
+}
+
+// handleStreamFrameRetransmitted indicates an expected call of handleStreamFrameRetransmitted
+func (mr *MockStreamIMockRecorder) handleStreamFrameRetransmitted(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handleStreamFrameRetransmitted", reflect.TypeOf((*MockStreamI)(nil).handleStreamFrameRetransmitted), arg0)
+}
+
 // hasData mocks base method
 func (m *MockStreamI) hasData() bool {
 	m.ctrl.T.Helper()
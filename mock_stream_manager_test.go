@@ -196,6 +196,42 @@ func (mr *MockStreamManagerMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockStreamManager)(nil).OpenUniStreamSync))
 }
 
+// ResetIncomingStreamLimits mocks base method
+func (m *MockStreamManager) ResetIncomingStreamLimits(arg0, arg1 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ResetIncomingStreamLimits", arg0, arg1)
+}
+
+// ResetIncomingStreamLimits indicates an expected call of ResetIncomingStreamLimits
+func (mr *MockStreamManagerMockRecorder) ResetIncomingStreamLimits(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetIncomingStreamLimits", reflect.TypeOf((*MockStreamManager)(nil).ResetIncomingStreamLimits), arg0, arg1)
+}
+
+// SetMaxIncomingStreams mocks base method
+func (m *MockStreamManager) SetMaxIncomingStreams(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetMaxIncomingStreams", arg0)
+}
+
+// SetMaxIncomingStreams indicates an expected call of SetMaxIncomingStreams
+func (mr *MockStreamManagerMockRecorder) SetMaxIncomingStreams(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingStreams", reflect.TypeOf((*MockStreamManager)(nil).SetMaxIncomingStreams), arg0)
+}
+
+// SetMaxIncomingUniStreams mocks base method
+func (m *MockStreamManager) SetMaxIncomingUniStreams(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetMaxIncomingUniStreams", arg0)
+}
+
+// SetMaxIncomingUniStreams indicates an expected call of SetMaxIncomingUniStreams
+func (mr *MockStreamManagerMockRecorder) SetMaxIncomingUniStreams(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetMaxIncomingUniStreams", reflect.TypeOf((*MockStreamManager)(nil).SetMaxIncomingUniStreams), arg0)
+}
+
 // UpdateLimits mocks base method
 func (m *MockStreamManager) UpdateLimits(arg0 *handshake.TransportParameters) error {
 	m.ctrl.T.Helper()
@@ -19,3 +19,4 @@ package quic
 //go:generate sh -c "./mockgen_private.sh quic mock_unknown_packet_handler_test.go github.com/DrakenLibra/gt-bbr unknownPacketHandler"
 //go:generate sh -c "./mockgen_private.sh quic mock_packet_handler_manager_test.go github.com/DrakenLibra/gt-bbr packetHandlerManager"
 //go:generate sh -c "./mockgen_private.sh quic mock_multiplexer_test.go github.com/DrakenLibra/gt-bbr multiplexer"
+//go:generate sh -c "./mockgen_private.sh quic mock_packet_conn_migrator_test.go github.com/DrakenLibra/gt-bbr packetConnMigrator"
@@ -0,0 +1,235 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/congestion"
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+)
+
+// mtuProbeLossThreshold is the number of packets that need to be acknowledged after a probe packet,
+// before the probe packet is declared lost.
+const mtuProbeLossThreshold = 3
+
+type sentLargePacket struct {
+	pn       protocol.PacketNumber
+	sendTime time.Time
+}
+
+// The mtuDiscoverer implements Datagram Packetization Layer Path MTU Discovery (DPLPMTUD).
+// It sends PING frames padded to the probed size, and performs a binary search between the base size,
+// which is assumed to work on every path, and the maximum size the peer is willing to receive.
+// Probe packets are not tracked by the sentPacketHandler: Losing a probe packet is not a sign of congestion.
+// When packets larger than the base size stop being acknowledged, the path is considered a black hole,
+// and it falls back to the base size.
+type mtuDiscoverer struct {
+	rttStats     *congestion.RTTStats
+	onMTUChanged func(protocol.ByteCount)
+
+	base    protocol.ByteCount // the packet size that is assumed to work on every path
+	max     protocol.ByteCount // the largest packet size that may be probed
+	current protocol.ByteCount // the packet size that is currently used
+
+	// the search interval: low is known to work, high is the largest size that might work
+	low, high     protocol.ByteCount
+	searching     bool
+	probeSize     protocol.ByteCount
+	probeFailures int
+
+	probeInFlight bool
+	probePN       protocol.PacketNumber
+	probeSentTime time.Time
+
+	// the time when the next search is started, to check if the path MTU increased
+	raiseTime time.Time
+
+	// recently sent packets larger than the base size, used for detecting black holes
+	largePackets []sentLargePacket
+}
+
+func newMTUDiscoverer(
+	rttStats *congestion.RTTStats,
+	base, max protocol.ByteCount,
+	onMTUChanged func(protocol.ByteCount),
+	now time.Time,
+) *mtuDiscoverer {
+	d := &mtuDiscoverer{
+		rttStats:     rttStats,
+		onMTUChanged: onMTUChanged,
+		base:         base,
+		max:          max,
+		current:      base,
+	}
+	d.startSearch(now)
+	return d
+}
+
+// ShouldSendProbe says if a probe packet should be sent now.
+func (d *mtuDiscoverer) ShouldSendProbe() bool {
+	return d.searching && !d.probeInFlight
+}
+
+// NextProbeSize returns the size of the next probe packet.
+func (d *mtuDiscoverer) NextProbeSize() protocol.ByteCount {
+	return d.probeSize
+}
+
+// CurrentSize returns the packet size that is currently used.
+func (d *mtuDiscoverer) CurrentSize() protocol.ByteCount {
+	return d.current
+}
+
+// SentProbe is called when a probe packet was sent.
+func (d *mtuDiscoverer) SentProbe(pn protocol.PacketNumber, now time.Time) {
+	d.probeInFlight = true
+	d.probePN = pn
+	d.probeSentTime = now
+}
+
+// SentPacket is called for every (non-probe) packet sent.
+// Packets larger than the base size are tracked for detecting black holes.
+func (d *mtuDiscoverer) SentPacket(pn protocol.PacketNumber, size protocol.ByteCount, now time.Time) {
+	if size <= d.base {
+		return
+	}
+	if len(d.largePackets) >= protocol.MaxTrackedMTUPackets {
+		d.largePackets = append(d.largePackets[:0], d.largePackets[1:]...)
+	}
+	d.largePackets = append(d.largePackets, sentLargePacket{pn: pn, sendTime: now})
+}
+
+// OnAckFrame is called for every ACK frame received for 1-RTT packets.
+func (d *mtuDiscoverer) OnAckFrame(f *wire.AckFrame, now time.Time) {
+	for i := len(d.largePackets) - 1; i >= 0; i-- {
+		if f.AcksPacket(d.largePackets[i].pn) {
+			d.largePackets = append(d.largePackets[:0], d.largePackets[i+1:]...)
+			break
+		}
+	}
+	if !d.probeInFlight {
+		return
+	}
+	if f.AcksPacket(d.probePN) {
+		d.probeInFlight = false
+		// All packets sent so far are smaller than the probe.
+		d.largePackets = d.largePackets[:0]
+		d.onProbeAcked(now)
+	} else if f.LargestAcked() >= d.probePN+mtuProbeLossThreshold {
+		d.probeInFlight = false
+		d.onProbeLost(now)
+	}
+}
+
+// GetTimeout returns the time when OnTimeout needs to be called.
+// It returns the zero value if no timer needs to be set.
+func (d *mtuDiscoverer) GetTimeout() time.Time {
+	var deadline time.Time
+	if d.probeInFlight {
+		deadline = d.probeSentTime.Add(d.lossTimeout())
+	}
+	if len(d.largePackets) > 0 {
+		if t := d.largePackets[0].sendTime.Add(d.lossTimeout()); deadline.IsZero() || t.Before(deadline) {
+			deadline = t
+		}
+	}
+	if !d.raiseTime.IsZero() && (deadline.IsZero() || d.raiseTime.Before(deadline)) {
+		deadline = d.raiseTime
+	}
+	return deadline
+}
+
+// OnTimeout is called when the timeout returned by GetTimeout expired.
+func (d *mtuDiscoverer) OnTimeout(now time.Time) {
+	if d.probeInFlight && !d.probeSentTime.Add(d.lossTimeout()).After(now) {
+		d.probeInFlight = false
+		d.onProbeLost(now)
+	}
+	if len(d.largePackets) > 0 && !d.largePackets[0].sendTime.Add(d.lossTimeout()).After(now) {
+		d.onBlackHole(now)
+	}
+	if !d.raiseTime.IsZero() && !d.raiseTime.After(now) {
+		d.startSearch(now)
+	}
+}
+
+// Reset is called when the path changed.
+// It falls back to the base size of the new path, and restarts the search.
+func (d *mtuDiscoverer) Reset(base protocol.ByteCount, now time.Time) {
+	d.base = base
+	d.largePackets = d.largePackets[:0]
+	d.probeInFlight = false
+	d.setCurrent(base)
+	d.startSearch(now)
+}
+
+func (d *mtuDiscoverer) startSearch(now time.Time) {
+	d.raiseTime = time.Time{}
+	d.low = d.current
+	d.high = d.max
+	d.probeFailures = 0
+	// Probe the maximum size first.
+	// On paths that support jumbo frames, this finds the path MTU with a single probe.
+	d.probeSize = d.high
+	d.searching = d.high >= d.low+protocol.MTUProbeGranularity
+	if !d.searching {
+		d.stopSearch(now)
+	}
+}
+
+func (d *mtuDiscoverer) onProbeAcked(now time.Time) {
+	d.low = d.probeSize
+	d.setCurrent(d.probeSize)
+	d.nextProbe(now)
+}
+
+func (d *mtuDiscoverer) onProbeLost(now time.Time) {
+	d.probeFailures++
+	if d.probeFailures < protocol.MaxMTUProbes {
+		return
+	}
+	d.high = d.probeSize - 1
+	d.nextProbe(now)
+}
+
+func (d *mtuDiscoverer) onBlackHole(now time.Time) {
+	old := d.current
+	d.largePackets = d.largePackets[:0]
+	d.probeInFlight = false
+	d.setCurrent(d.base)
+	d.raiseTime = time.Time{}
+	d.searching = true
+	d.low = d.base
+	d.high = old - 1
+	d.nextProbe(now)
+}
+
+// nextProbe continues the binary search.
+func (d *mtuDiscoverer) nextProbe(now time.Time) {
+	d.probeFailures = 0
+	if d.high < d.low+protocol.MTUProbeGranularity {
+		d.stopSearch(now)
+		return
+	}
+	d.probeSize = d.low + (d.high-d.low+1)/2
+}
+
+func (d *mtuDiscoverer) stopSearch(now time.Time) {
+	d.searching = false
+	d.probeSize = 0
+	if d.current < d.max {
+		d.raiseTime = now.Add(protocol.MTURaiseInterval)
+	}
+}
+
+func (d *mtuDiscoverer) setCurrent(s protocol.ByteCount) {
+	if s == d.current {
+		return
+	}
+	d.current = s
+	d.onMTUChanged(s)
+}
+
+func (d *mtuDiscoverer) lossTimeout() time.Duration {
+	return 3 * d.rttStats.PTO()
+}
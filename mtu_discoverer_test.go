@@ -0,0 +1,218 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/congestion"
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MTU Discoverer", func() {
+	const (
+		baseSize protocol.ByteCount = 1252
+		maxSize  protocol.ByteCount = 9000
+	)
+
+	var (
+		d        *mtuDiscoverer
+		rttStats *congestion.RTTStats
+		now      time.Time
+		pn       protocol.PacketNumber
+		mtus     []protocol.ByteCount
+	)
+
+	ackFor := func(pns ...protocol.PacketNumber) *wire.AckFrame {
+		f := &wire.AckFrame{}
+		for i := len(pns) - 1; i >= 0; i-- {
+			f.AckRanges = append(f.AckRanges, wire.AckRange{Smallest: pns[i], Largest: pns[i]})
+		}
+		return f
+	}
+
+	// sendProbe sends a probe packet, and returns its packet number and size
+	sendProbe := func() (protocol.PacketNumber, protocol.ByteCount) {
+		ExpectWithOffset(1, d.ShouldSendProbe()).To(BeTrue())
+		pn++
+		d.SentProbe(pn, now)
+		ExpectWithOffset(1, d.ShouldSendProbe()).To(BeFalse())
+		return pn, d.NextProbeSize()
+	}
+
+	loseProbe := func() {
+		for i := 0; i < protocol.MaxMTUProbes; i++ {
+			sendProbe()
+			now = now.Add(3 * rttStats.PTO())
+			ExpectWithOffset(1, d.GetTimeout()).To(Equal(now))
+			d.OnTimeout(now)
+			ExpectWithOffset(1, d.probeInFlight).To(BeFalse())
+		}
+	}
+
+	BeforeEach(func() {
+		rttStats = congestion.NewRTTStats()
+		rttStats.UpdateRTT(10*time.Millisecond, 0, time.Now())
+		now = time.Now()
+		pn = 0
+		mtus = nil
+	})
+
+	JustBeforeEach(func() {
+		d = newMTUDiscoverer(rttStats, baseSize, maxSize, func(s protocol.ByteCount) { mtus = append(mtus, s) }, now)
+	})
+
+	It("starts with the base size", func() {
+		Expect(d.CurrentSize()).To(Equal(baseSize))
+		Expect(d.GetTimeout()).To(BeZero())
+	})
+
+	It("probes the maximum size first", func() {
+		Expect(d.ShouldSendProbe()).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(maxSize))
+	})
+
+	It("uses the maximum size if the first probe is acknowledged", func() {
+		p, size := sendProbe()
+		Expect(size).To(Equal(maxSize))
+		d.OnAckFrame(ackFor(p), now)
+		Expect(d.CurrentSize()).To(Equal(maxSize))
+		Expect(mtus).To(Equal([]protocol.ByteCount{maxSize}))
+		Expect(d.ShouldSendProbe()).To(BeFalse())
+		// there's nothing left to search for
+		Expect(d.GetTimeout()).To(BeZero())
+	})
+
+	It("retransmits probes before declaring a size lost", func() {
+		for i := 0; i < protocol.MaxMTUProbes-1; i++ {
+			_, size := sendProbe()
+			Expect(size).To(Equal(maxSize))
+			now = now.Add(3 * rttStats.PTO())
+			d.OnTimeout(now)
+		}
+		_, size := sendProbe()
+		Expect(size).To(Equal(maxSize))
+		now = now.Add(3 * rttStats.PTO())
+		d.OnTimeout(now)
+		Expect(d.NextProbeSize()).To(BeNumerically("<", maxSize))
+		Expect(d.CurrentSize()).To(Equal(baseSize))
+		Expect(mtus).To(BeEmpty())
+	})
+
+	It("declares a probe lost when packets sent after it are acknowledged", func() {
+		p, _ := sendProbe()
+		d.OnAckFrame(ackFor(p+1, p+2), now)
+		Expect(d.probeInFlight).To(BeTrue())
+		d.OnAckFrame(ackFor(p+1, p+2, p+3), now)
+		Expect(d.probeInFlight).To(BeFalse())
+		Expect(d.probeFailures).To(Equal(1))
+	})
+
+	It("finds the path MTU using a binary search", func() {
+		const pathMTU protocol.ByteCount = 1500
+		for d.ShouldSendProbe() {
+			p, size := sendProbe()
+			if size <= pathMTU {
+				d.OnAckFrame(ackFor(p), now)
+			} else {
+				now = now.Add(3 * rttStats.PTO())
+				d.OnTimeout(now)
+			}
+		}
+		Expect(d.CurrentSize()).To(And(
+			BeNumerically("<=", pathMTU),
+			BeNumerically(">", pathMTU-protocol.MTUProbeGranularity),
+		))
+		for i := 1; i < len(mtus); i++ {
+			Expect(mtus[i]).To(BeNumerically(">", mtus[i-1]))
+		}
+	})
+
+	It("doesn't search if the maximum size is close to the base size", func() {
+		d = newMTUDiscoverer(rttStats, baseSize, baseSize+protocol.MTUProbeGranularity-1, func(protocol.ByteCount) {}, now)
+		Expect(d.ShouldSendProbe()).To(BeFalse())
+	})
+
+	It("restarts the search after the raise interval", func() {
+		loseProbe()
+		for d.ShouldSendProbe() {
+			p, size := sendProbe()
+			if size <= 4000 {
+				d.OnAckFrame(ackFor(p), now)
+			} else {
+				now = now.Add(3 * rttStats.PTO())
+				d.OnTimeout(now)
+			}
+		}
+		Expect(d.GetTimeout()).To(Equal(now.Add(protocol.MTURaiseInterval)))
+		now = now.Add(protocol.MTURaiseInterval)
+		d.OnTimeout(now)
+		Expect(d.ShouldSendProbe()).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(maxSize))
+	})
+
+	Context("black hole detection", func() {
+		JustBeforeEach(func() {
+			p, _ := sendProbe()
+			d.OnAckFrame(ackFor(p), now)
+			Expect(d.CurrentSize()).To(Equal(maxSize))
+		})
+
+		It("doesn't track packets smaller than the base size", func() {
+			pn++
+			d.SentPacket(pn, baseSize, now)
+			Expect(d.GetTimeout()).To(BeZero())
+		})
+
+		It("falls back to the base size if large packets are not acknowledged", func() {
+			pn++
+			d.SentPacket(pn, maxSize, now)
+			Expect(d.GetTimeout()).To(Equal(now.Add(3 * rttStats.PTO())))
+			now = now.Add(3 * rttStats.PTO())
+			d.OnTimeout(now)
+			Expect(d.CurrentSize()).To(Equal(baseSize))
+			Expect(mtus).To(Equal([]protocol.ByteCount{maxSize, baseSize}))
+			// restart the search, below the size that caused the black hole
+			Expect(d.ShouldSendProbe()).To(BeTrue())
+			Expect(d.NextProbeSize()).To(And(
+				BeNumerically(">", baseSize),
+				BeNumerically("<", maxSize),
+			))
+		})
+
+		It("doesn't fall back if large packets are acknowledged", func() {
+			for i := 0; i < 5; i++ {
+				pn++
+				d.SentPacket(pn, maxSize, now)
+			}
+			// acknowledge the last packet, the others might have been lost due to congestion
+			d.OnAckFrame(ackFor(pn), now)
+			Expect(d.GetTimeout()).To(BeZero())
+			now = now.Add(time.Hour)
+			d.OnTimeout(now)
+			Expect(d.CurrentSize()).To(Equal(maxSize))
+		})
+
+		It("limits the number of tracked packets", func() {
+			for i := 0; i < 2*protocol.MaxTrackedMTUPackets; i++ {
+				pn++
+				d.SentPacket(pn, maxSize, now.Add(time.Duration(i)*time.Millisecond))
+			}
+			Expect(d.largePackets).To(HaveLen(protocol.MaxTrackedMTUPackets))
+			Expect(d.largePackets[0].pn).To(Equal(pn - protocol.MaxTrackedMTUPackets + 1))
+		})
+	})
+
+	It("resets when the path changes", func() {
+		p, _ := sendProbe()
+		d.OnAckFrame(ackFor(p), now)
+		Expect(d.CurrentSize()).To(Equal(maxSize))
+		d.Reset(1232, now)
+		Expect(d.CurrentSize()).To(Equal(protocol.ByteCount(1232)))
+		Expect(mtus).To(Equal([]protocol.ByteCount{maxSize, 1232}))
+		Expect(d.ShouldSendProbe()).To(BeTrue())
+		Expect(d.NextProbeSize()).To(Equal(maxSize))
+	})
+})
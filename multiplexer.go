@@ -6,6 +6,7 @@ import (
 	"net"
 	"sync"
 
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 )
 
@@ -15,14 +16,16 @@ var (
 )
 
 type multiplexer interface {
-	AddConn(c net.PacketConn, connIDLen int, statelessResetKey []byte) (packetHandlerManager, error)
+	AddConn(c net.PacketConn, connIDLen int, statelessResetKeys [][]byte, maxPacketSize protocol.ByteCount, enablePMTUD bool) (packetHandlerManager, error)
 	RemoveConn(net.PacketConn) error
 }
 
 type connManager struct {
-	connIDLen         int
-	statelessResetKey []byte
-	manager           packetHandlerManager
+	connIDLen          int
+	statelessResetKeys [][]byte
+	maxPacketSize      protocol.ByteCount
+	dfSet              bool
+	manager            packetHandlerManager
 }
 
 // The connMultiplexer listens on multiple net.PacketConns and dispatches
@@ -31,7 +34,7 @@ type connMultiplexer struct {
 	mutex sync.Mutex
 
 	conns                   map[net.PacketConn]connManager
-	newPacketHandlerManager func(net.PacketConn, int, []byte, utils.Logger) packetHandlerManager // so it can be replaced in the tests
+	newPacketHandlerManager func(net.PacketConn, int, [][]byte, protocol.ByteCount, utils.Logger) packetHandlerManager // so it can be replaced in the tests
 
 	logger utils.Logger
 }
@@ -52,27 +55,45 @@ func getMultiplexer() multiplexer {
 func (m *connMultiplexer) AddConn(
 	c net.PacketConn,
 	connIDLen int,
-	statelessResetKey []byte,
+	statelessResetKeys [][]byte,
+	maxPacketSize protocol.ByteCount,
+	enablePMTUD bool,
 ) (packetHandlerManager, error) {
+	if len(statelessResetKeys) > 1+protocol.MaxPreviousStatelessResetKeys {
+		return nil, fmt.Errorf("cannot use more than %d previous stateless reset keys", protocol.MaxPreviousStatelessResetKeys)
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
 	p, ok := m.conns[c]
 	if !ok {
-		manager := m.newPacketHandlerManager(c, connIDLen, statelessResetKey, m.logger)
+		manager := m.newPacketHandlerManager(c, connIDLen, statelessResetKeys, maxPacketSize, m.logger)
 		p = connManager{
-			connIDLen:         connIDLen,
-			statelessResetKey: statelessResetKey,
-			manager:           manager,
+			connIDLen:          connIDLen,
+			statelessResetKeys: statelessResetKeys,
+			maxPacketSize:      maxPacketSize,
+			manager:            manager,
 		}
 		m.conns[c] = p
 	}
 	if p.connIDLen != connIDLen {
 		return nil, fmt.Errorf("cannot use %d byte connection IDs on a connection that is already using %d byte connction IDs", connIDLen, p.connIDLen)
 	}
-	if statelessResetKey != nil && !bytes.Equal(p.statelessResetKey, statelessResetKey) {
+	if statelessResetKeys != nil && !equalStatelessResetKeys(p.statelessResetKeys, statelessResetKeys) {
 		return nil, fmt.Errorf("cannot use different stateless reset keys on the same packet conn")
 	}
+	if p.maxPacketSize != maxPacketSize {
+		return nil, fmt.Errorf("cannot use a max packet size of %d on a connection that is already using %d", maxPacketSize, p.maxPacketSize)
+	}
+	// The socket options of the packet conn are only modified if path MTU discovery is used.
+	if enablePMTUD && !p.dfSet {
+		if err := setDF(c); err != nil {
+			m.logger.Debugf("Setting the Don't Fragment bit failed: %s", err)
+		}
+		p.dfSet = true
+		m.conns[c] = p
+	}
 	return p.manager, nil
 }
 
@@ -87,3 +108,24 @@ func (m *connMultiplexer) RemoveConn(c net.PacketConn) error {
 	delete(m.conns, c)
 	return nil
 }
+
+func equalStatelessResetKeys(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// getStatelessResetKeys returns the current stateless reset key, followed by the previous keys.
+// It returns nil if no stateless reset key is configured.
+func getStatelessResetKeys(config *Config) [][]byte {
+	if len(config.StatelessResetKey) == 0 {
+		return nil
+	}
+	return append([][]byte{config.StatelessResetKey}, config.PreviousStatelessResetKeys...)
+}
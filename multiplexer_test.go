@@ -1,6 +1,10 @@
 package quic
 
 import (
+	"fmt"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -8,23 +12,40 @@ import (
 var _ = Describe("Client Multiplexer", func() {
 	It("adds a new packet conn ", func() {
 		conn := newMockPacketConn()
-		_, err := getMultiplexer().AddConn(conn, 8, nil)
+		_, err := getMultiplexer().AddConn(conn, 8, nil, protocol.MaxReceivePacketSize, false)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
 	It("errors when adding an existing conn with a different connection ID length", func() {
 		conn := newMockPacketConn()
-		_, err := getMultiplexer().AddConn(conn, 5, nil)
+		_, err := getMultiplexer().AddConn(conn, 5, nil, protocol.MaxReceivePacketSize, false)
 		Expect(err).ToNot(HaveOccurred())
-		_, err = getMultiplexer().AddConn(conn, 6, nil)
+		_, err = getMultiplexer().AddConn(conn, 6, nil, protocol.MaxReceivePacketSize, false)
 		Expect(err).To(MatchError("cannot use 6 byte connection IDs on a connection that is already using 5 byte connction IDs"))
 	})
 
 	It("errors when adding an existing conn with a different stateless rest key", func() {
 		conn := newMockPacketConn()
-		_, err := getMultiplexer().AddConn(conn, 7, []byte("foobar"))
+		_, err := getMultiplexer().AddConn(conn, 7, [][]byte{[]byte("foobar")}, protocol.MaxReceivePacketSize, false)
 		Expect(err).ToNot(HaveOccurred())
-		_, err = getMultiplexer().AddConn(conn, 7, []byte("raboof"))
+		_, err = getMultiplexer().AddConn(conn, 7, [][]byte{[]byte("raboof")}, protocol.MaxReceivePacketSize, false)
 		Expect(err).To(MatchError("cannot use different stateless reset keys on the same packet conn"))
 	})
+
+	It("errors when using too many previous stateless reset keys", func() {
+		keys := [][]byte{[]byte("foobar")}
+		for i := 0; i <= protocol.MaxPreviousStatelessResetKeys; i++ {
+			keys = append(keys, []byte("raboof"))
+		}
+		_, err := getMultiplexer().AddConn(newMockPacketConn(), 7, keys, protocol.MaxReceivePacketSize, false)
+		Expect(err).To(MatchError(fmt.Sprintf("cannot use more than %d previous stateless reset keys", protocol.MaxPreviousStatelessResetKeys)))
+	})
+
+	It("errors when adding an existing conn with a different max packet size", func() {
+		conn := newMockPacketConn()
+		_, err := getMultiplexer().AddConn(conn, 7, nil, protocol.MaxReceivePacketSize, false)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = getMultiplexer().AddConn(conn, 7, nil, 9000, false)
+		Expect(err).To(MatchError("cannot use a max packet size of 9000 on a connection that is already using 1452"))
+	})
 })
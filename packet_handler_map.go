@@ -22,8 +22,9 @@ import (
 type packetHandlerMap struct {
 	mutex sync.RWMutex
 
-	conn      net.PacketConn
-	connIDLen int
+	conn          net.PacketConn
+	connIDLen     int
+	maxPacketSize protocol.ByteCount
 
 	handlers    map[string] /* string(ConnectionID)*/ packetHandler
 	resetTokens map[[16]byte] /* stateless reset token */ packetHandler
@@ -35,7 +36,12 @@ type packetHandlerMap struct {
 	deleteRetiredSessionsAfter time.Duration
 
 	statelessResetEnabled bool
-	statelessResetHasher  hash.Hash
+	statelessResetMutex   sync.Mutex
+	// The first hasher uses the current key, the others use previous keys.
+	statelessResetHashers []hash.Hash
+	// used to rate limit the number of stateless resets sent
+	statelessResetWindowStart time.Time
+	statelessResetCount       int
 
 	logger utils.Logger
 }
@@ -45,18 +51,24 @@ var _ packetHandlerManager = &packetHandlerMap{}
 func newPacketHandlerMap(
 	conn net.PacketConn,
 	connIDLen int,
-	statelessResetKey []byte,
+	statelessResetKeys [][]byte,
+	maxPacketSize protocol.ByteCount,
 	logger utils.Logger,
 ) packetHandlerManager {
+	hashers := make([]hash.Hash, 0, len(statelessResetKeys))
+	for _, key := range statelessResetKeys {
+		hashers = append(hashers, hmac.New(sha256.New, key))
+	}
 	m := &packetHandlerMap{
 		conn:                       conn,
 		connIDLen:                  connIDLen,
+		maxPacketSize:              maxPacketSize,
 		listening:                  make(chan struct{}),
 		handlers:                   make(map[string]packetHandler),
 		resetTokens:                make(map[[16]byte]packetHandler),
 		deleteRetiredSessionsAfter: protocol.RetiredConnectionIDDeleteTimeout,
-		statelessResetEnabled:      len(statelessResetKey) > 0,
-		statelessResetHasher:       hmac.New(sha256.New, statelessResetKey),
+		statelessResetEnabled:      len(statelessResetKeys) > 0,
+		statelessResetHashers:      hashers,
 		logger:                     logger,
 	}
 	go m.listen()
@@ -162,22 +174,31 @@ func (h *packetHandlerMap) close(e error) error {
 
 func (h *packetHandlerMap) listen() {
 	defer close(h.listening)
+	if bc := newBatchConn(h.conn); bc != nil {
+		for {
+			if err := bc.ReadPackets(h.maxPacketSize, h.handlePacket); err != nil {
+				h.close(err)
+				return
+			}
+		}
+	}
 	for {
-		buffer := getPacketBuffer()
-		data := buffer.Slice
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
+		buffer := getPacketBufferForSize(h.maxPacketSize)
+		data := buffer.Slice[:h.maxPacketSize]
+		// The packet size should not exceed the max packet size we advertised.
 		// If it does, we only read a truncated packet, which will then end up undecryptable
 		n, addr, err := h.conn.ReadFrom(data)
 		if err != nil {
 			h.close(err)
 			return
 		}
-		h.handlePacket(addr, buffer, data[:n])
+		h.handlePacket(addr, packetInfo{}, buffer, data[:n])
 	}
 }
 
 func (h *packetHandlerMap) handlePacket(
 	addr net.Addr,
+	info packetInfo,
 	buffer *packetBuffer,
 	data []byte,
 ) {
@@ -199,6 +220,7 @@ func (h *packetHandlerMap) handlePacket(
 
 	p := &receivedPacket{
 		remoteAddr: addr,
+		info:       info,
 		rcvTime:    rcvTime,
 		buffer:     buffer,
 		data:       data,
@@ -208,7 +230,12 @@ func (h *packetHandlerMap) handlePacket(
 		return
 	}
 	if data[0]&0x80 == 0 {
-		go h.maybeSendStatelessReset(p, connID)
+		num := h.numStatelessResets(p, rcvTime)
+		if num == 0 {
+			p.buffer.Release()
+			return
+		}
+		go h.sendStatelessResets(p, connID, num)
 		return
 	}
 	if h.server == nil { // no server set
@@ -246,29 +273,95 @@ func (h *packetHandlerMap) GetStatelessResetToken(connID protocol.ConnectionID)
 		rand.Read(token[:])
 		return token
 	}
-	h.statelessResetHasher.Write(connID.Bytes())
-	copy(token[:], h.statelessResetHasher.Sum(nil))
-	h.statelessResetHasher.Reset()
+	h.statelessResetMutex.Lock()
+	defer h.statelessResetMutex.Unlock()
+	return h.getStatelessResetTokenWithHasher(h.statelessResetHashers[0], connID)
+}
+
+func (h *packetHandlerMap) getStatelessResetTokenWithHasher(hasher hash.Hash, connID protocol.ConnectionID) [16]byte {
+	var token [16]byte
+	hasher.Write(connID.Bytes())
+	copy(token[:], hasher.Sum(nil))
+	hasher.Reset()
 	return token
 }
 
-func (h *packetHandlerMap) maybeSendStatelessReset(p *receivedPacket, connID protocol.ConnectionID) {
-	defer p.buffer.Release()
+// numStatelessResets decides how many stateless resets are sent in response to a packet.
+// It must be called for every packet that could trigger a stateless reset,
+// since every stateless reset sent counts towards the rate limit.
+func (h *packetHandlerMap) numStatelessResets(p *receivedPacket, now time.Time) int {
 	if !h.statelessResetEnabled {
-		return
+		return 0
 	}
 	// Don't send a stateless reset in response to very small packets.
 	// This includes packets that could be stateless resets.
-	if len(p.data) <= protocol.MinStatelessResetSize {
-		return
+	// All stateless resets sent in response to a packet are smaller than that packet in total,
+	// which prevents two endpoints from sending stateless resets back and forth.
+	num := (len(p.data) - 1) / protocol.MinStatelessResetSize
+	if num == 0 {
+		return 0
+	}
+	if num > len(h.statelessResetHashers) {
+		num = len(h.statelessResetHashers)
+	}
+	h.statelessResetMutex.Lock()
+	defer h.statelessResetMutex.Unlock()
+	if now.Sub(h.statelessResetWindowStart) >= time.Second {
+		h.statelessResetWindowStart = now
+		h.statelessResetCount = 0
 	}
-	token := h.GetStatelessResetToken(connID)
-	h.logger.Debugf("Sending stateless reset to %s (connection ID: %s). Token: %#x", p.remoteAddr, connID, token)
-	data := make([]byte, 23)
+	if remaining := protocol.MaxStatelessResetsPerSecond - h.statelessResetCount; num > remaining {
+		num = remaining
+	}
+	if num <= 0 {
+		h.logger.Debugf("Not sending a stateless reset to %s. Rate limit reached.", p.remoteAddr)
+		return 0
+	}
+	h.statelessResetCount += num
+	return num
+}
+
+// sendStatelessResets sends a stateless reset for the current and for up to num-1 previous stateless reset keys.
+// The peer might have received the stateless reset token before the key was rotated.
+func (h *packetHandlerMap) sendStatelessResets(p *receivedPacket, connID protocol.ConnectionID, num int) {
+	defer p.buffer.Release()
+	h.statelessResetMutex.Lock()
+	tokens := make([][16]byte, 0, num)
+	for _, hasher := range h.statelessResetHashers[:num] {
+		tokens = append(tokens, h.getStatelessResetTokenWithHasher(hasher, connID))
+	}
+	h.statelessResetMutex.Unlock()
+
+	// the total size of the stateless resets must be smaller than the packet that triggered them
+	remaining := protocol.ByteCount(len(p.data) - 1)
+	for i, token := range tokens {
+		// leave enough space for the stateless resets that are still to be sent
+		maxSize := remaining - protocol.ByteCount((len(tokens)-i-1)*protocol.MinStatelessResetSize)
+		h.logger.Debugf("Sending stateless reset to %s (connection ID: %s). Token: %#x", p.remoteAddr, connID, token)
+		data := getStatelessResetPacket(token, maxSize+1)
+		remaining -= protocol.ByteCount(len(data))
+		if err := writePacket(h.conn, data, p.remoteAddr, p.info.OOB()); err != nil {
+			h.logger.Debugf("Error sending Stateless Reset: %s", err)
+		}
+	}
+}
+
+// getStatelessResetPacket generates a stateless reset packet of random length.
+// The packet is at least MinStatelessResetSize bytes long, and smaller than the packet that triggered it.
+// The random length makes it harder for an observer to distinguish stateless resets from regular packets.
+func getStatelessResetPacket(token [16]byte, triggerSize protocol.ByteCount) []byte {
+	maxSize := triggerSize - 1
+	if maxSize > protocol.MaxStatelessResetSize {
+		maxSize = protocol.MaxStatelessResetSize
+	}
+	size := protocol.ByteCount(protocol.MinStatelessResetSize)
+	if maxSize > size {
+		var b [2]byte
+		rand.Read(b[:])
+		size += protocol.ByteCount(uint16(b[0])<<8|uint16(b[1])) % (maxSize - size + 1)
+	}
+	data := make([]byte, size-16)
 	rand.Read(data)
 	data[0] = (data[0] & 0x7f) | 0x40
-	data = append(data, token[:]...)
-	if _, err := h.conn.WriteTo(data, p.remoteAddr); err != nil {
-		h.logger.Debugf("Error sending Stateless Reset: %s", err)
-	}
+	return append(data, token[:]...)
 }
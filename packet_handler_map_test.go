@@ -20,8 +20,9 @@ var _ = Describe("Packet Handler Map", func() {
 		handler *packetHandlerMap
 		conn    *mockPacketConn
 
-		connIDLen         int
-		statelessResetKey []byte
+		connIDLen          int
+		statelessResetKeys [][]byte
+		maxPacketSize      protocol.ByteCount
 	)
 
 	getPacketWithLength := func(connID protocol.ConnectionID, length protocol.ByteCount) []byte {
@@ -43,14 +44,17 @@ var _ = Describe("Packet Handler Map", func() {
 		return getPacketWithLength(connID, 2)
 	}
 
+	token := func(t [16]byte) []byte { return t[:] }
+
 	BeforeEach(func() {
-		statelessResetKey = nil
+		statelessResetKeys = nil
 		connIDLen = 0
+		maxPacketSize = protocol.MaxReceivePacketSize
 	})
 
 	JustBeforeEach(func() {
 		conn = newMockPacketConn()
-		handler = newPacketHandlerMap(conn, connIDLen, statelessResetKey, utils.DefaultLogger).(*packetHandlerMap)
+		handler = newPacketHandlerMap(conn, connIDLen, statelessResetKeys, maxPacketSize, utils.DefaultLogger).(*packetHandlerMap)
 	})
 
 	AfterEach(func() {
@@ -121,8 +125,28 @@ var _ = Describe("Packet Handler Map", func() {
 			Eventually(handledPacket2).Should(BeClosed())
 		})
 
+		Context("using jumbo packets", func() {
+			BeforeEach(func() {
+				maxPacketSize = 9000
+			})
+
+			It("reads packets into large buffers", func() {
+				connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+				packetHandler := NewMockPacketHandler(mockCtrl)
+				handledPacket := make(chan struct{})
+				packetHandler.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+					Expect(p.buffer.Slice).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+					Expect(p.data).To(HaveLen(8000))
+					close(handledPacket)
+				})
+				handler.Add(connID, packetHandler)
+				conn.dataToRead <- append(getPacket(connID), make([]byte, 8000-len(getPacket(connID)))...)
+				Eventually(handledPacket).Should(BeClosed())
+			})
+		})
+
 		It("drops unparseable packets", func() {
-			handler.handlePacket(nil, nil, []byte{0, 1, 2, 3})
+			handler.handlePacket(nil, packetInfo{}, nil, []byte{0, 1, 2, 3})
 		})
 
 		It("deletes removed sessions immediately", func() {
@@ -130,7 +154,7 @@ var _ = Describe("Packet Handler Map", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			handler.Add(connID, NewMockPacketHandler(mockCtrl))
 			handler.Remove(connID)
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, packetInfo{}, nil, getPacket(connID))
 			// don't EXPECT any calls to handlePacket of the MockPacketHandler
 		})
 
@@ -140,7 +164,7 @@ var _ = Describe("Packet Handler Map", func() {
 			handler.Add(connID, NewMockPacketHandler(mockCtrl))
 			handler.Retire(connID)
 			time.Sleep(scaleDuration(30 * time.Millisecond))
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, packetInfo{}, nil, getPacket(connID))
 			// don't EXPECT any calls to handlePacket of the MockPacketHandler
 		})
 
@@ -154,13 +178,13 @@ var _ = Describe("Packet Handler Map", func() {
 			})
 			handler.Add(connID, packetHandler)
 			handler.Retire(connID)
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, packetInfo{}, nil, getPacket(connID))
 			Eventually(handled).Should(BeClosed())
 		})
 
 		It("drops packets for unknown receivers", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, packetInfo{}, nil, getPacket(connID))
 		})
 
 		It("closes the packet handlers when reading from the conn fails", func() {
@@ -187,7 +211,7 @@ var _ = Describe("Packet Handler Map", func() {
 				Expect(cid).To(Equal(connID))
 			})
 			handler.SetServer(server)
-			handler.handlePacket(nil, nil, p)
+			handler.handlePacket(nil, packetInfo{}, nil, p)
 		})
 
 		It("closes all server sessions", func() {
@@ -209,7 +233,7 @@ var _ = Describe("Packet Handler Map", func() {
 			// don't EXPECT any calls to server.handlePacket
 			handler.SetServer(server)
 			handler.CloseServer()
-			handler.handlePacket(nil, nil, p)
+			handler.handlePacket(nil, packetInfo{}, nil, p)
 		})
 	})
 
@@ -260,7 +284,7 @@ var _ = Describe("Packet Handler Map", func() {
 				p := append([]byte{0x40} /* short header packet */, connID.Bytes()...)
 				p = append(p, make([]byte, 50)...)
 				p = append(p, token[:]...)
-				handler.handlePacket(nil, nil, p)
+				handler.handlePacket(nil, packetInfo{}, nil, p)
 				// destroy() would be called from a separate go routine
 				// make sure we give it enough time to be called to cause an error here
 				time.Sleep(scaleDuration(25 * time.Millisecond))
@@ -271,7 +295,7 @@ var _ = Describe("Packet Handler Map", func() {
 			BeforeEach(func() {
 				key := make([]byte, 32)
 				rand.Read(key)
-				statelessResetKey = key
+				statelessResetKeys = [][]byte{key}
 			})
 
 			It("generates stateless reset tokens", func() {
@@ -285,27 +309,116 @@ var _ = Describe("Packet Handler Map", func() {
 			It("sends stateless resets", func() {
 				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
 				p := append([]byte{40}, make([]byte, 100)...)
-				handler.handlePacket(addr, getPacketBuffer(), p)
+				handler.handlePacket(addr, packetInfo{}, getPacketBuffer(), p)
 				var reset mockPacketConnWrite
 				Eventually(conn.dataWritten).Should(Receive(&reset))
 				Expect(reset.to).To(Equal(addr))
 				Expect(reset.data[0] & 0x80).To(BeZero()) // short header packet
-				Expect(reset.data).To(HaveLen(protocol.MinStatelessResetSize))
+				Expect(len(reset.data)).To(BeNumerically(">=", protocol.MinStatelessResetSize))
+				Expect(len(reset.data)).To(BeNumerically("<", len(p)))
+				Expect(reset.data[len(reset.data)-16:]).To(Equal(token(handler.GetStatelessResetToken(p[1:6]))))
+			})
+
+			It("sends stateless resets of random length", func() {
+				lengths := make(map[int]struct{})
+				for i := 0; i < 100; i++ {
+					data := getStatelessResetPacket([16]byte{1, 2, 3}, 1000)
+					Expect(len(data)).To(BeNumerically(">=", protocol.MinStatelessResetSize))
+					Expect(len(data)).To(BeNumerically("<=", protocol.MaxStatelessResetSize))
+					Expect(data[len(data)-16:]).To(Equal([]byte{1, 2, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}))
+					lengths[len(data)] = struct{}{}
+				}
+				Expect(len(lengths)).To(BeNumerically(">", 1))
+			})
+
+			It("sends stateless resets that are smaller than the packet that triggered them", func() {
+				for i := 0; i < 100; i++ {
+					data := getStatelessResetPacket([16]byte{}, protocol.MinStatelessResetSize+1)
+					Expect(data).To(HaveLen(protocol.MinStatelessResetSize))
+				}
+			})
+
+			It("rate limits stateless resets", func() {
+				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+				for i := 0; i < protocol.MaxStatelessResetsPerSecond+10; i++ {
+					p := append([]byte{40}, make([]byte, 100)...)
+					handler.handlePacket(addr, packetInfo{}, getPacketBuffer(), p)
+				}
+				Eventually(conn.dataWritten).Should(HaveLen(protocol.MaxStatelessResetsPerSecond))
+				Consistently(conn.dataWritten).Should(HaveLen(protocol.MaxStatelessResetsPerSecond))
 			})
 
 			It("doesn't send stateless resets for small packets", func() {
 				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
-				p := append([]byte{40}, make([]byte, protocol.MinStatelessResetSize-2)...)
-				handler.handlePacket(addr, getPacketBuffer(), p)
+				p := append([]byte{40}, make([]byte, protocol.MinStatelessResetSize-1)...)
+				handler.handlePacket(addr, packetInfo{}, getPacketBuffer(), p)
 				Consistently(conn.dataWritten).ShouldNot(Receive())
 			})
+
+			Context("with previous keys", func() {
+				var previousKey []byte
+
+				BeforeEach(func() {
+					previousKey = make([]byte, 32)
+					rand.Read(previousKey)
+					statelessResetKeys = append(statelessResetKeys, previousKey)
+				})
+
+				It("generates stateless reset tokens using the current key", func() {
+					connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0x42}
+					token := handler.GetStatelessResetToken(connID)
+					previous := newPacketHandlerMap(newMockPacketConn(), connIDLen, [][]byte{previousKey}, maxPacketSize, utils.DefaultLogger).(*packetHandlerMap)
+					defer previous.Close()
+					Expect(previous.GetStatelessResetToken(connID)).ToNot(Equal(token))
+				})
+
+				It("sends a stateless reset for every key", func() {
+					connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0x42}
+					previous := newPacketHandlerMap(newMockPacketConn(), connIDLen, [][]byte{previousKey}, maxPacketSize, utils.DefaultLogger).(*packetHandlerMap)
+					defer previous.Close()
+					addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+					p := append([]byte{40}, connID...)
+					p = append(p, make([]byte, 100)...)
+					handler.handlePacket(addr, packetInfo{}, getPacketBuffer(), p)
+					var reset1, reset2 mockPacketConnWrite
+					Eventually(conn.dataWritten).Should(Receive(&reset1))
+					Eventually(conn.dataWritten).Should(Receive(&reset2))
+					Expect(reset1.data[len(reset1.data)-16:]).To(Equal(token(handler.GetStatelessResetToken(connID))))
+					Expect(reset2.data[len(reset2.data)-16:]).To(Equal(token(previous.GetStatelessResetToken(connID))))
+					Expect(len(reset1.data) + len(reset2.data)).To(BeNumerically("<", len(p)))
+				})
+
+				It("only sends as many stateless resets as fit into the packet that triggered them", func() {
+					connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0x42}
+					addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+					p := append([]byte{40}, connID...)
+					p = append(p, make([]byte, 2*protocol.MinStatelessResetSize-len(p))...)
+					handler.handlePacket(addr, packetInfo{}, getPacketBuffer(), p)
+					var reset mockPacketConnWrite
+					Eventually(conn.dataWritten).Should(Receive(&reset))
+					Expect(reset.data[len(reset.data)-16:]).To(Equal(token(handler.GetStatelessResetToken(connID))))
+					Expect(len(reset.data)).To(BeNumerically("<", len(p)))
+					Consistently(conn.dataWritten).ShouldNot(Receive())
+				})
+
+				It("counts every stateless reset towards the rate limit", func() {
+					addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+					for i := 0; i < protocol.MaxStatelessResetsPerSecond; i++ {
+						p := append([]byte{40}, make([]byte, 100)...)
+						handler.handlePacket(addr, packetInfo{}, getPacketBuffer(), p)
+					}
+					Eventually(conn.dataWritten).Should(HaveLen(protocol.MaxStatelessResetsPerSecond))
+					Consistently(conn.dataWritten).Should(HaveLen(protocol.MaxStatelessResetsPerSecond))
+				})
+			})
+
 		})
 
 		Context("if no key is configured", func() {
 			It("doesn't send stateless resets", func() {
 				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
 				p := append([]byte{40}, make([]byte, 100)...)
-				handler.handlePacket(addr, getPacketBuffer(), p)
+				handler.handlePacket(addr, packetInfo{}, getPacketBuffer(), p)
 				Consistently(conn.dataWritten).ShouldNot(Receive())
 			})
 		})
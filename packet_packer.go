@@ -19,8 +19,10 @@ type packer interface {
 	MaybePackAckPacket() (*packedPacket, error)
 	PackRetransmission(packet *ackhandler.Packet) ([]*packedPacket, error)
 	PackConnectionClose(*wire.ConnectionCloseFrame) (*packedPacket, error)
+	PackMTUProbePacket(size protocol.ByteCount) (*packedPacket, error)
 
 	HandleTransportParameters(*handshake.TransportParameters)
+	SetMaxPacketSize(protocol.ByteCount)
 	SetToken([]byte)
 	ChangeDestConnectionID(protocol.ConnectionID)
 }
@@ -37,6 +39,8 @@ type packedPacket struct {
 	ack    *wire.AckFrame
 	frames []wire.Frame
 
+	isMTUProbePacket bool
+
 	buffer *packetBuffer
 }
 
@@ -60,13 +64,14 @@ func (p *packedPacket) IsAckEliciting() bool {
 
 func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
 	return &ackhandler.Packet{
-		PacketNumber:    p.header.PacketNumber,
-		PacketType:      p.header.Type,
-		Ack:             p.ack,
-		Frames:          p.frames,
-		Length:          protocol.ByteCount(len(p.raw)),
-		EncryptionLevel: p.EncryptionLevel(),
-		SendTime:        time.Now(),
+		PacketNumber:         p.header.PacketNumber,
+		PacketType:           p.header.Type,
+		Ack:                  p.ack,
+		Frames:               p.frames,
+		Length:               protocol.ByteCount(len(p.raw)),
+		EncryptionLevel:      p.EncryptionLevel(),
+		SendTime:             time.Now(),
+		IsPathMTUProbePacket: p.isMTUProbePacket,
 	}
 }
 
@@ -119,9 +124,10 @@ type packetPacker struct {
 
 	token []byte
 
-	pnManager packetNumberManager
-	framer    frameSource
-	acks      ackFrameSource
+	pnManager     packetNumberManager
+	framer        frameSource
+	acks          ackFrameSource
+	datagramQueue *datagramQueue // nil if DATAGRAM frames are not enabled
 
 	maxPacketSize          protocol.ByteCount
 	numNonAckElicitingAcks int
@@ -139,6 +145,7 @@ func newPacketPacker(
 	cryptoSetup sealingManager,
 	framer frameSource,
 	acks ackFrameSource,
+	datagramQueue *datagramQueue,
 	perspective protocol.Perspective,
 	version protocol.VersionNumber,
 ) *packetPacker {
@@ -152,6 +159,7 @@ func newPacketPacker(
 		version:         version,
 		framer:          framer,
 		acks:            acks,
+		datagramQueue:   datagramQueue,
 		pnManager:       packetNumberManager,
 		maxPacketSize:   getMaxPacketSize(remoteAddr),
 	}
@@ -168,6 +176,29 @@ func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*pac
 	return p.writeAndSealPacket(header, payload, encLevel, sealer)
 }
 
+// PackMTUProbePacket packs a packet that is used for path MTU discovery.
+// It contains a PING frame, and is padded to the given size.
+// The size may exceed the current maximum packet size.
+func (p *packetPacker) PackMTUProbePacket(size protocol.ByteCount) (*packedPacket, error) {
+	sealer, err := p.cryptoSetup.GetSealerWithEncryptionLevel(protocol.Encryption1RTT)
+	if err != nil {
+		return nil, err
+	}
+	ping := &wire.PingFrame{}
+	payload := payload{
+		frames: []wire.Frame{ping},
+		length: ping.Length(p.version),
+	}
+	header := p.getHeader(protocol.Encryption1RTT)
+	paddingLen := size - header.GetLength(p.version) - protocol.ByteCount(sealer.Overhead()) - payload.length
+	packet, err := p.writeAndSealPacketWithPadding(header, payload, paddingLen, size, protocol.Encryption1RTT, sealer)
+	if err != nil {
+		return nil, err
+	}
+	packet.isMTUProbePacket = true
+	return packet, nil
+}
+
 func (p *packetPacker) MaybePackAckPacket() (*packedPacket, error) {
 	ack := p.acks.GetAckFrame(protocol.Encryption1RTT)
 	if ack == nil {
@@ -194,8 +225,11 @@ func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) ([]*packedP
 		// Since we're making sure that the header can never be larger for a retransmission,
 		// we never have to split CRYPTO frames.
 		if sf, ok := f.(*wire.StreamFrame); ok {
-			sf.DataLenPresent = true
-			streamFrames = append(streamFrames, sf)
+			// Copy the STREAM frame, since it might be split below.
+			// The original packet is kept in the packet history, and might still be acknowledged.
+			sfCopy := *sf
+			sfCopy.DataLenPresent = true
+			streamFrames = append(streamFrames, &sfCopy)
 		} else {
 			controlFrames = append(controlFrames, f)
 		}
@@ -352,6 +386,20 @@ func (p *packetPacker) composeNextPacket(maxFrameSize protocol.ByteCount) (paylo
 	frames, lengthAdded := p.framer.AppendControlFrames(payload.frames, maxFrameSize-payload.length)
 	payload.length += lengthAdded
 
+	if p.datagramQueue != nil {
+		if f := p.datagramQueue.Peek(); f != nil {
+			size := f.Length(p.version)
+			if size <= maxFrameSize-payload.length {
+				frames = append(frames, f)
+				payload.length += size
+				p.datagramQueue.Pop()
+			} else if size > maxFrameSize {
+				// The DATAGRAM frame doesn't even fit into an empty packet. Drop it.
+				p.datagramQueue.Pop()
+			}
+		}
+	}
+
 	frames, lengthAdded = p.framer.AppendStreamFrames(frames, maxFrameSize-payload.length)
 	if len(frames) > 0 {
 		payload.frames = append(payload.frames, frames...)
@@ -410,17 +458,29 @@ func (p *packetPacker) writeAndSealPacket(
 	} else if payload.length < 4-pnLen {
 		paddingLen = 4 - pnLen - payload.length
 	}
-	return p.writeAndSealPacketWithPadding(header, payload, paddingLen, encLevel, sealer)
+	return p.writeAndSealPacketWithPadding(header, payload, paddingLen, p.maxPacketSize, encLevel, sealer)
 }
 
 func (p *packetPacker) writeAndSealPacketWithPadding(
 	header *wire.ExtendedHeader,
 	payload payload,
 	paddingLen protocol.ByteCount,
+	maxPacketSize protocol.ByteCount,
 	encLevel protocol.EncryptionLevel,
 	sealer handshake.Sealer,
 ) (*packedPacket, error) {
-	packetBuffer := getPacketBuffer()
+	if !header.IsLongHeader {
+		if s, ok := sealer.(handshake.ShortHeaderSealer); ok {
+			header.KeyPhase = s.KeyPhase()
+		}
+	}
+
+	var packetBuffer *packetBuffer
+	if maxPacketSize > protocol.MaxReceivePacketSize {
+		packetBuffer = getLargePacketBuffer()
+	} else {
+		packetBuffer = getPacketBuffer()
+	}
 	buffer := bytes.NewBuffer(packetBuffer.Slice[:0])
 
 	if err := header.Write(buffer, p.version); err != nil {
@@ -442,8 +502,8 @@ func (p *packetPacker) writeAndSealPacketWithPadding(
 		}
 	}
 
-	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > p.maxPacketSize {
-		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, p.maxPacketSize)
+	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > maxPacketSize {
+		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, maxPacketSize)
 	}
 
 	raw := buffer.Bytes()
@@ -483,3 +543,9 @@ func (p *packetPacker) HandleTransportParameters(params *handshake.TransportPara
 		p.maxPacketSize = utils.MinByteCount(p.maxPacketSize, params.MaxPacketSize)
 	}
 }
+
+// SetMaxPacketSize sets the maximum size of packets.
+// It is called when path MTU discovery found a new packet size.
+func (p *packetPacker) SetMaxPacketSize(s protocol.ByteCount) {
+	p.maxPacketSize = s
+}
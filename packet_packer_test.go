@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"errors"
 	"math/rand"
 	"net"
 
@@ -10,6 +11,7 @@ import (
 	"github.com/DrakenLibra/gt-bbr/internal/mocks"
 	mockackhandler "github.com/DrakenLibra/gt-bbr/internal/mocks/ackhandler"
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/utils"
 	"github.com/DrakenLibra/gt-bbr/internal/wire"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo"
@@ -79,6 +81,7 @@ var _ = Describe("Packet packer", func() {
 			sealingManager,
 			framer,
 			ackFramer,
+			nil,
 			protocol.PerspectiveServer,
 			version,
 		)
@@ -192,6 +195,30 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.raw[0:len(hdrRaw)]).To(Equal(hdrRawEncrypted))
 			Expect(p.raw[len(p.raw)-4:]).To(Equal([]byte{0xde, 0xca, 0xfb, 0xad}))
 		})
+
+		It("sets the key phase bit of short header packets", func() {
+			initialStream.EXPECT().HasData()
+			handshakeStream.EXPECT().HasData()
+			pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x1337), protocol.PacketNumberLen2)
+			pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x1337))
+			sealer := mocks.NewMockShortHeaderSealer(mockCtrl)
+			sealer.EXPECT().Overhead().Return(4).AnyTimes()
+			sealer.EXPECT().KeyPhase().Return(1)
+			sealer.EXPECT().Seal(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_, src []byte, _ protocol.PacketNumber, _ []byte) []byte {
+				return append(src, []byte{0xde, 0xca, 0xfb, 0xad}...)
+			})
+			sealer.EXPECT().EncryptHeader(gomock.Any(), gomock.Any(), gomock.Any())
+			sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+			ackFramer.EXPECT().GetAckFrame(protocol.EncryptionInitial)
+			ackFramer.EXPECT().GetAckFrame(protocol.EncryptionHandshake)
+			ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT)
+			expectAppendControlFrames()
+			expectAppendStreamFrames(&wire.StreamFrame{Data: []byte{0xde, 0xca, 0xfb, 0xad}})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.header.KeyPhase).To(Equal(1))
+			Expect(p.raw[0] & 0x4).ToNot(BeZero())
+		})
 	})
 
 	Context("packing packets", func() {
@@ -324,6 +351,53 @@ var _ = Describe("Packet packer", func() {
 				Expect(err).ToNot(HaveOccurred())
 			})
 
+			It("packs DATAGRAM frames", func() {
+				packer.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+				f := &wire.DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					Expect(packer.datagramQueue.AddAndWait(f)).To(Succeed())
+				}()
+				// make sure the DATAGRAM frame is queued before packing the packet
+				Eventually(packer.datagramQueue.sendQueue).Should(HaveLen(1))
+				pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+				pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+				sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+				ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT)
+				expectAppendControlFrames()
+				expectAppendStreamFrames()
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p).ToNot(BeNil())
+				Expect(p.frames).To(Equal([]wire.Frame{f}))
+				Eventually(done).Should(BeClosed())
+				Expect(packer.datagramQueue.Peek()).To(BeNil())
+			})
+
+			It("drops DATAGRAM frames that don't fit into a packet", func() {
+				packer.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+				f := &wire.DatagramFrame{Data: make([]byte, maxPacketSize)}
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					Expect(packer.datagramQueue.AddAndWait(f)).To(Succeed())
+				}()
+				Eventually(packer.datagramQueue.sendQueue).Should(HaveLen(1))
+				pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+				sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+				ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT)
+				expectAppendControlFrames()
+				expectAppendStreamFrames()
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p).To(BeNil())
+				Eventually(done).Should(BeClosed())
+				Expect(packer.datagramQueue.Peek()).To(BeNil())
+			})
+
 			Context("packing ACK packets", func() {
 				It("doesn't pack a packet if there's no ACK to send", func() {
 					ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT)
@@ -534,16 +608,20 @@ var _ = Describe("Packet packer", func() {
 					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2).Times(2)
 					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42)).Times(2)
 					sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.Encryption1RTT).Return(sealer, nil)
+					f := &wire.StreamFrame{
+						StreamID: 42,
+						Offset:   1337,
+						Data:     bytes.Repeat([]byte{'a'}, int(maxPacketSize)*3/2),
+					}
 					packets, err := packer.PackRetransmission(&ackhandler.Packet{
 						EncryptionLevel: protocol.Encryption1RTT,
-						Frames: []wire.Frame{&wire.StreamFrame{
-							StreamID: 42,
-							Offset:   1337,
-							Data:     bytes.Repeat([]byte{'a'}, int(maxPacketSize)*3/2),
-						}},
+						Frames:          []wire.Frame{f},
 					})
 					Expect(err).ToNot(HaveOccurred())
 					Expect(packets).To(HaveLen(2))
+					// the STREAM frame of the original packet is not modified
+					Expect(f.Offset).To(Equal(protocol.ByteCount(1337)))
+					Expect(f.DataLen()).To(Equal(maxPacketSize * 3 / 2))
 					Expect(packets[0].frames[0]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
 					Expect(packets[1].frames[0]).To(BeAssignableToTypeOf(&wire.StreamFrame{}))
 					sf1 := packets[0].frames[0].(*wire.StreamFrame)
@@ -618,7 +696,9 @@ var _ = Describe("Packet packer", func() {
 					Expect(err).ToNot(HaveOccurred())
 					Expect(packets).To(HaveLen(2))
 					Expect(len(packets[0].frames) + len(packets[1].frames)).To(Equal(len(frames))) // all frames
-					Expect(packets[1].frames).To(Equal(frames[len(packets[0].frames):]))
+					for i, f := range packets[1].frames {
+						Expect(f.(*wire.StreamFrame).StreamID).To(Equal(frames[len(packets[0].frames)+i].(*wire.StreamFrame).StreamID))
+					}
 					// check that the first packet was filled up as far as possible:
 					// if the first frame was packed into the first packet, it would have overflown the MaxPacketSize
 					Expect(len(packets[0].raw) + int(packets[1].frames[1].Length(packer.version))).To(BeNumerically(">", maxPacketSize-protocol.MinStreamFrameSize))
@@ -701,6 +781,60 @@ var _ = Describe("Packet packer", func() {
 					_, err = packer.PackPacket()
 					Expect(err).ToNot(HaveOccurred())
 				})
+
+				It("sets the max packet size found by path MTU discovery", func() {
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+					sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+					ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT)
+					packer.SetMaxPacketSize(5000)
+					expectAppendControlFrames()
+					f := &wire.StreamFrame{
+						StreamID:       5,
+						Data:           make([]byte, 4900),
+						DataLenPresent: true,
+					}
+					framer.EXPECT().AppendStreamFrames(gomock.Any(), gomock.Any()).DoAndReturn(func(fs []wire.Frame, maxLen protocol.ByteCount) ([]wire.Frame, protocol.ByteCount) {
+						Expect(maxLen).To(Equal(5000 - 1 - 8 - 2 - protocol.ByteCount(sealer.Overhead())))
+						return append(fs, f), f.Length(packer.version)
+					})
+					p, err := packer.PackPacket()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(p.buffer.Slice).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+					Expect(len(p.raw)).To(BeNumerically(">", 4900))
+				})
+			})
+
+			Context("packing path MTU probe packets", func() {
+				It("packs a PING frame, padded to the probe size", func() {
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+					sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.Encryption1RTT).Return(sealer, nil)
+					p, err := packer.PackMTUProbePacket(1500)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(p.raw).To(HaveLen(1500))
+					Expect(p.header.IsLongHeader).To(BeFalse())
+					Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+					Expect(p.buffer.Slice).To(HaveCap(int(protocol.MaxPacketBufferSize)))
+					Expect(p.isMTUProbePacket).To(BeTrue())
+					Expect(p.ToAckHandlerPacket().IsPathMTUProbePacket).To(BeTrue())
+				})
+
+				It("packs probe packets smaller than the receive buffer size", func() {
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+					sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.Encryption1RTT).Return(sealer, nil)
+					p, err := packer.PackMTUProbePacket(1400)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(p.raw).To(HaveLen(1400))
+					Expect(p.buffer.Slice).To(HaveCap(int(protocol.MaxReceivePacketSize)))
+				})
+
+				It("returns an error if 1-RTT keys are not available yet", func() {
+					sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.Encryption1RTT).Return(nil, errors.New("no keys"))
+					_, err := packer.PackMTUProbePacket(1500)
+					Expect(err).To(MatchError("no keys"))
+				})
 			})
 		})
 
@@ -823,7 +957,7 @@ var _ = Describe("Packet packer", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(firstPayloadByte).To(Equal(byte(0)))
 				// ... followed by the STREAM frame
-				frameParser := wire.NewFrameParser(packer.version)
+				frameParser := wire.NewFrameParser(false, packer.version)
 				frame, err := frameParser.ParseNext(r, protocol.Encryption1RTT)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(frame).To(Equal(f))
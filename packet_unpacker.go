@@ -3,6 +3,7 @@ package quic
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/DrakenLibra/gt-bbr/internal/handshake"
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
@@ -35,10 +36,14 @@ func newPacketUnpacker(cs handshake.CryptoSetup, version protocol.VersionNumber)
 	}
 }
 
-func (u *packetUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket, error) {
-	r := bytes.NewReader(data)
+type headerDecryptor interface {
+	DecryptHeader(sample []byte, firstByte *byte, pnBytes []byte)
+}
 
+func (u *packetUnpacker) Unpack(hdr *wire.Header, rcvTime time.Time, data []byte) (*unpackedPacket, error) {
 	var encLevel protocol.EncryptionLevel
+	var extHdr *wire.ExtendedHeader
+	var decrypted []byte
 	switch hdr.Type {
 	case protocol.PacketTypeInitial:
 		encLevel = protocol.EncryptionInitial
@@ -50,10 +55,73 @@ func (u *packetUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket,
 		}
 		encLevel = protocol.Encryption1RTT
 	}
-	opener, err := u.cs.GetOpener(encLevel)
+	if encLevel == protocol.Encryption1RTT {
+		opener, err := u.cs.Get1RTTOpener()
+		if err != nil {
+			return nil, err
+		}
+		extHdr, decrypted, err = u.unpackShortHeaderPacket(opener, hdr, rcvTime, data)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		opener, err := u.cs.GetOpener(encLevel)
+		if err != nil {
+			return nil, err
+		}
+		extHdr, decrypted, err = u.unpackLongHeaderPacket(opener, hdr, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
+	u.largestRcvdPacketNumber = utils.MaxPacketNumber(u.largestRcvdPacketNumber, extHdr.PacketNumber)
+
+	return &unpackedPacket{
+		hdr:             extHdr,
+		packetNumber:    extHdr.PacketNumber,
+		encryptionLevel: encLevel,
+		data:            decrypted,
+	}, nil
+}
+
+func (u *packetUnpacker) unpackLongHeaderPacket(opener handshake.Opener, hdr *wire.Header, data []byte) (*wire.ExtendedHeader, []byte, error) {
+	extHdr, err := u.unpackHeader(opener, hdr, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	extHdrLen := extHdr.ParsedLen() + protocol.ByteCount(extHdr.PacketNumberLen)
+	decrypted, err := opener.Open(data[extHdrLen:extHdrLen], data[extHdrLen:], extHdr.PacketNumber, data[:extHdrLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	return extHdr, decrypted, nil
+}
+
+func (u *packetUnpacker) unpackShortHeaderPacket(
+	opener handshake.ShortHeaderOpener,
+	hdr *wire.Header,
+	rcvTime time.Time,
+	data []byte,
+) (*wire.ExtendedHeader, []byte, error) {
+	extHdr, err := u.unpackHeader(opener, hdr, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	extHdrLen := extHdr.ParsedLen() + protocol.ByteCount(extHdr.PacketNumberLen)
+	decrypted, err := opener.Open(data[extHdrLen:extHdrLen], data[extHdrLen:], rcvTime, extHdr.PacketNumber, extHdr.KeyPhase, data[:extHdrLen])
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return extHdr, decrypted, nil
+}
+
+// unpackHeader removes the header protection, parses the extended header
+// and decodes the packet number.
+func (u *packetUnpacker) unpackHeader(hd headerDecryptor, hdr *wire.Header, data []byte) (*wire.ExtendedHeader, error) {
+	r := bytes.NewReader(data)
+
 	hdrLen := int(hdr.ParsedLen())
 	if len(data) < hdrLen+4+16 {
 		return nil, fmt.Errorf("Packet too small. Expected at least 20 bytes after the header, got %d", len(data)-hdrLen)
@@ -63,7 +131,7 @@ func (u *packetUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket,
 	origPNBytes := make([]byte, 4)
 	copy(origPNBytes, data[hdrLen:hdrLen+4])
 	// 2. decrypt the header, assuming a 4 byte packet number
-	opener.DecryptHeader(
+	hd.DecryptHeader(
 		data[hdrLen+4:hdrLen+4+16],
 		&data[0],
 		data[hdrLen:hdrLen+4],
@@ -79,24 +147,10 @@ func (u *packetUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket,
 		copy(data[extHdrLen:hdrLen+4], origPNBytes[int(extHdr.PacketNumberLen):])
 	}
 
-	pn := protocol.DecodePacketNumber(
+	extHdr.PacketNumber = protocol.DecodePacketNumber(
 		extHdr.PacketNumberLen,
 		u.largestRcvdPacketNumber,
 		extHdr.PacketNumber,
 	)
-
-	decrypted, err := opener.Open(data[extHdrLen:extHdrLen], data[extHdrLen:], pn, data[:extHdrLen])
-	if err != nil {
-		return nil, err
-	}
-
-	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
-	u.largestRcvdPacketNumber = utils.MaxPacketNumber(u.largestRcvdPacketNumber, pn)
-
-	return &unpackedPacket{
-		hdr:             extHdr,
-		packetNumber:    pn,
-		encryptionLevel: encLevel,
-		data:            decrypted,
-	}, nil
+	return extHdr, nil
 }
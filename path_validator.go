@@ -0,0 +1,130 @@
+package quic
+
+import (
+	"crypto/rand"
+	"net"
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+)
+
+// The pathValidator validates a new peer address using PATH_CHALLENGE and PATH_RESPONSE frames.
+// Until the new address is validated, the amount of data sent to it is limited to
+// protocol.AmplificationFactor times the amount of data received from it.
+type pathValidator struct {
+	addr          net.Addr // the address that is being validated. nil if no validation is in progress.
+	validatedAddr net.Addr // the last validated address
+	challenge     [8]byte
+	deadline      time.Time
+
+	bytesReceived protocol.ByteCount
+	bytesSent     protocol.ByteCount
+}
+
+func newPathValidator() *pathValidator {
+	return &pathValidator{}
+}
+
+// StartValidation is called when the peer moved from currentAddr to addr.
+// It returns the PATH_CHALLENGE frame that needs to be sent to the new address.
+// If the peer returned to the last validated address, no validation is necessary, and nil is returned.
+func (v *pathValidator) StartValidation(addr, currentAddr net.Addr, deadline time.Time) (*wire.PathChallengeFrame, error) {
+	if v.addr == nil {
+		v.validatedAddr = currentAddr
+	}
+	v.reset()
+	if addrsEqual(addr, v.validatedAddr) {
+		return nil, nil
+	}
+	if _, err := rand.Read(v.challenge[:]); err != nil {
+		return nil, err
+	}
+	v.addr = addr
+	v.deadline = deadline
+	return &wire.PathChallengeFrame{Data: v.challenge}, nil
+}
+
+// HandlePathResponseFrame handles a PATH_RESPONSE frame.
+// It returns true if the frame completed the validation of the new address.
+func (v *pathValidator) HandlePathResponseFrame(f *wire.PathResponseFrame) bool {
+	if v.addr == nil || f.Data != v.challenge {
+		return false
+	}
+	v.validatedAddr = v.addr
+	v.reset()
+	return true
+}
+
+// GetTimeout returns the time when the validation fails.
+// It returns the zero value if no validation is in progress.
+func (v *pathValidator) GetTimeout() time.Time {
+	return v.deadline
+}
+
+// OnTimeout is called when the validation failed.
+// It returns the last validated address.
+func (v *pathValidator) OnTimeout() net.Addr {
+	v.reset()
+	return v.validatedAddr
+}
+
+// ReceivedBytes is called for every packet received.
+func (v *pathValidator) ReceivedBytes(addr net.Addr, n protocol.ByteCount) {
+	if v.addr != nil && addrsEqual(addr, v.addr) {
+		v.bytesReceived += n
+	}
+}
+
+// SentBytes is called for every packet sent.
+func (v *pathValidator) SentBytes(n protocol.ByteCount) {
+	if v.addr != nil {
+		v.bytesSent += n
+	}
+}
+
+// AmplificationLimited says if the anti-amplification limit prohibits sending more data to the address being validated.
+func (v *pathValidator) AmplificationLimited() bool {
+	return v.addr != nil && v.bytesSent >= protocol.AmplificationFactor*v.bytesReceived
+}
+
+func (v *pathValidator) reset() {
+	v.addr = nil
+	v.deadline = time.Time{}
+	v.bytesReceived = 0
+	v.bytesSent = 0
+}
+
+// isProbingFrame says if a frame is a probing frame.
+// Packets that only contain probing frames don't cause a connection migration.
+func isProbingFrame(f wire.Frame) bool {
+	switch f.(type) {
+	case *wire.PathChallengeFrame, *wire.PathResponseFrame, *wire.NewConnectionIDFrame:
+		return true
+	default:
+		return false
+	}
+}
+
+func addrsEqual(a, b net.Addr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	udpA, okA := a.(*net.UDPAddr)
+	udpB, okB := b.(*net.UDPAddr)
+	if okA && okB {
+		return udpA.IP.Equal(udpB.IP) && udpA.Port == udpB.Port && udpA.Zone == udpB.Zone
+	}
+	return a.Network() == b.Network() && a.String() == b.String()
+}
+
+// ipsEqual says if two addresses have the same IP.
+// If only the port changed, the peer most likely experienced a NAT rebinding, and is still using the same path.
+func ipsEqual(a, b net.Addr) bool {
+	udpA, okA := a.(*net.UDPAddr)
+	udpB, okB := b.(*net.UDPAddr)
+	if !okA || !okB {
+		return addrsEqual(a, b)
+	}
+	return udpA.IP.Equal(udpB.IP)
+}
@@ -0,0 +1,109 @@
+package quic
+
+import (
+	"net"
+	"time"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Path Validator", func() {
+	var (
+		v                *pathValidator
+		oldAddr, newAddr *net.UDPAddr
+	)
+
+	BeforeEach(func() {
+		v = newPathValidator()
+		oldAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+		newAddr = &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321}
+	})
+
+	It("isn't validating anything initially", func() {
+		Expect(v.GetTimeout()).To(BeZero())
+		Expect(v.AmplificationLimited()).To(BeFalse())
+	})
+
+	It("validates a new address", func() {
+		deadline := time.Now().Add(time.Second)
+		f, err := v.StartValidation(newAddr, oldAddr, deadline)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).ToNot(BeNil())
+		Expect(v.GetTimeout()).To(Equal(deadline))
+		Expect(v.HandlePathResponseFrame(&wire.PathResponseFrame{Data: f.Data})).To(BeTrue())
+		Expect(v.GetTimeout()).To(BeZero())
+		Expect(v.validatedAddr).To(Equal(newAddr))
+	})
+
+	It("uses random challenges", func() {
+		f1, err := v.StartValidation(newAddr, oldAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		f2, err := v.StartValidation(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 4321}, newAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f1.Data).ToNot(Equal(f2.Data))
+	})
+
+	It("ignores PATH_RESPONSE frames that don't match the challenge", func() {
+		f, err := v.StartValidation(newAddr, oldAddr, time.Now().Add(time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		data := f.Data
+		data[0]++
+		Expect(v.HandlePathResponseFrame(&wire.PathResponseFrame{Data: data})).To(BeFalse())
+		Expect(v.GetTimeout()).ToNot(BeZero())
+	})
+
+	It("ignores PATH_RESPONSE frames when not validating", func() {
+		Expect(v.HandlePathResponseFrame(&wire.PathResponseFrame{})).To(BeFalse())
+	})
+
+	It("returns to the last validated address when the validation fails", func() {
+		_, err := v.StartValidation(newAddr, oldAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		// the peer moves again, before the first validation completed
+		_, err = v.StartValidation(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 4321}, newAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v.OnTimeout()).To(Equal(oldAddr))
+		Expect(v.GetTimeout()).To(BeZero())
+	})
+
+	It("doesn't validate when the peer returns to the last validated address", func() {
+		_, err := v.StartValidation(newAddr, oldAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		f, err := v.StartValidation(&net.UDPAddr{IP: oldAddr.IP, Port: oldAddr.Port}, newAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(BeNil())
+		Expect(v.GetTimeout()).To(BeZero())
+	})
+
+	It("enforces the anti-amplification limit", func() {
+		_, err := v.StartValidation(newAddr, oldAddr, time.Now())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(v.AmplificationLimited()).To(BeTrue())
+		v.ReceivedBytes(newAddr, 100)
+		v.ReceivedBytes(oldAddr, 1000) // doesn't count
+		Expect(v.AmplificationLimited()).To(BeFalse())
+		v.SentBytes(protocol.AmplificationFactor*100 - 1)
+		Expect(v.AmplificationLimited()).To(BeFalse())
+		v.SentBytes(1)
+		Expect(v.AmplificationLimited()).To(BeTrue())
+	})
+
+	It("identifies probing frames", func() {
+		Expect(isProbingFrame(&wire.PathChallengeFrame{})).To(BeTrue())
+		Expect(isProbingFrame(&wire.PathResponseFrame{})).To(BeTrue())
+		Expect(isProbingFrame(&wire.NewConnectionIDFrame{})).To(BeTrue())
+		Expect(isProbingFrame(&wire.PingFrame{})).To(BeFalse())
+		Expect(isProbingFrame(&wire.StreamFrame{})).To(BeFalse())
+	})
+
+	It("compares addresses", func() {
+		Expect(addrsEqual(oldAddr, &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234})).To(BeTrue())
+		Expect(addrsEqual(oldAddr, newAddr)).To(BeFalse())
+		Expect(ipsEqual(oldAddr, &net.UDPAddr{IP: oldAddr.IP, Port: 4321})).To(BeTrue())
+		Expect(ipsEqual(oldAddr, newAddr)).To(BeFalse())
+	})
+})
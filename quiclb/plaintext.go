@@ -0,0 +1,69 @@
+package quiclb
+
+import (
+	"errors"
+
+	quic "github.com/DrakenLibra/gt-bbr"
+)
+
+// A PlaintextGenerator generates connection IDs that contain the server ID in plaintext.
+// The connection ID consists of
+// * the first byte, containing the config rotation codepoint in the two most significant bits,
+// * the server ID,
+// * random bytes.
+// The server ID can be read by any on-path observer.
+// If that's a concern, use a StreamCipherGenerator.
+type PlaintextGenerator struct {
+	configID  uint8
+	serverID  []byte
+	connIDLen int
+}
+
+var _ quic.ConnectionIDGenerator = &PlaintextGenerator{}
+
+// NewPlaintextGenerator creates a new PlaintextGenerator.
+// connIDLen is the length of the generated connection IDs. It must be large enough to hold the server ID.
+func NewPlaintextGenerator(configID uint8, serverID []byte, connIDLen int) (*PlaintextGenerator, error) {
+	if err := checkConfigID(configID); err != nil {
+		return nil, err
+	}
+	if err := checkConnIDLen(connIDLen); err != nil {
+		return nil, err
+	}
+	if len(serverID) == 0 {
+		return nil, errors.New("empty server ID")
+	}
+	if 1+len(serverID) > connIDLen {
+		return nil, errors.New("server ID too long for the connection ID length")
+	}
+	return &PlaintextGenerator{
+		configID:  configID,
+		serverID:  append([]byte(nil), serverID...),
+		connIDLen: connIDLen,
+	}, nil
+}
+
+// GenerateConnectionID generates a new connection ID.
+func (g *PlaintextGenerator) GenerateConnectionID() (quic.ConnectionID, error) {
+	c, err := newConnID(g.configID, g.connIDLen)
+	if err != nil {
+		return nil, err
+	}
+	copy(c[1:], g.serverID)
+	return c, nil
+}
+
+// ConnectionIDLen returns the length of the connection IDs generated.
+func (g *PlaintextGenerator) ConnectionIDLen() int {
+	return g.connIDLen
+}
+
+// DecodePlaintext decodes a connection ID generated by a PlaintextGenerator.
+// It returns the config rotation codepoint and the server ID.
+// The server ID uses the memory of the connection ID.
+func DecodePlaintext(connID []byte, serverIDLen int) (uint8 /* config ID */, []byte /* server ID */, error) {
+	if len(connID) < 1+serverIDLen {
+		return 0, nil, errInvalidConnIDLen
+	}
+	return ConfigID(connID), connID[1 : 1+serverIDLen], nil
+}
@@ -0,0 +1,56 @@
+package quiclb
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plaintext encoding", func() {
+	serverID := []byte{0xde, 0xca, 0xfb, 0xad}
+
+	It("generates connection IDs", func() {
+		g, err := NewPlaintextGenerator(1, serverID, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g.ConnectionIDLen()).To(Equal(10))
+		c1, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1.Len()).To(Equal(10))
+		c2, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1).ToNot(Equal(c2))
+		for _, c := range [][]byte{c1, c2} {
+			configID, sid, err := DecodePlaintext(c, len(serverID))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configID).To(BeEquivalentTo(1))
+			Expect(sid).To(Equal(serverID))
+		}
+	})
+
+	It("doesn't modify the server ID when generating connection IDs", func() {
+		sid := []byte{1, 2, 3, 4}
+		g, err := NewPlaintextGenerator(0, sid, 8)
+		Expect(err).ToNot(HaveOccurred())
+		sid[0] = 42
+		c, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		_, decoded, err := DecodePlaintext(c, 4)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal([]byte{1, 2, 3, 4}))
+	})
+
+	It("rejects invalid parameters", func() {
+		_, err := NewPlaintextGenerator(3, serverID, 10)
+		Expect(err).To(MatchError("invalid config ID: 3"))
+		_, err = NewPlaintextGenerator(0, serverID, 19)
+		Expect(err).To(MatchError("invalid connection ID length: 19 (must be between 4 and 18 bytes)"))
+		_, err = NewPlaintextGenerator(0, serverID, 4)
+		Expect(err).To(MatchError("server ID too long for the connection ID length"))
+		_, err = NewPlaintextGenerator(0, nil, 8)
+		Expect(err).To(MatchError("empty server ID"))
+	})
+
+	It("errors when decoding a connection ID that is too short", func() {
+		_, _, err := DecodePlaintext([]byte{0, 1, 2}, 4)
+		Expect(err).To(MatchError(errInvalidConnIDLen))
+	})
+})
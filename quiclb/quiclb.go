@@ -0,0 +1,73 @@
+// Package quiclb implements connection ID generators that encode a server ID into the connection ID.
+// This allows a stateless load balancer to route packets to the server that owns the connection.
+//
+// The plaintext encoding follows the QUIC-LB draft (draft-ietf-quic-load-balancers).
+// The stream cipher encoding is a custom encoding. It is not the stream cipher algorithm of the draft,
+// so the connection IDs can only be decoded by the StreamCipherDecoder of this package.
+//
+// Servers use one of the generators as the quic.Config.ConnectionIDGenerator.
+// The load balancer uses ParseConnectionID to obtain the destination connection ID of a packet,
+// and the matching decoder to extract the server ID.
+// Note that the connection ID of the client's first Initial packet is chosen by the client,
+// so it doesn't contain a server ID. It has to be routed by other means (e.g. by hashing the connection ID).
+package quiclb
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	quic "github.com/DrakenLibra/gt-bbr"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+)
+
+const (
+	// MaxConfigID is the largest config rotation codepoint that can be used.
+	// The value 0x3 is reserved for connection IDs that don't contain routing information.
+	MaxConfigID = 2
+
+	minConnIDLen = 4
+	maxConnIDLen = 18
+)
+
+var errInvalidConnIDLen = errors.New("connection ID has an invalid length")
+
+// ParseConnectionID parses the destination connection ID of a QUIC packet.
+// connIDLen is the length of the connection IDs used by the servers,
+// which is needed to parse packets with a short header.
+func ParseConnectionID(packet []byte, connIDLen int) (quic.ConnectionID, error) {
+	return wire.ParseConnectionID(packet, connIDLen)
+}
+
+// ConfigID returns the config rotation codepoint of a connection ID.
+func ConfigID(connID []byte) uint8 {
+	if len(connID) == 0 {
+		return MaxConfigID + 1
+	}
+	return connID[0] >> 6
+}
+
+func checkConfigID(configID uint8) error {
+	if configID > MaxConfigID {
+		return fmt.Errorf("invalid config ID: %d", configID)
+	}
+	return nil
+}
+
+func checkConnIDLen(l int) error {
+	if l < minConnIDLen || l > maxConnIDLen {
+		return fmt.Errorf("invalid connection ID length: %d (must be between %d and %d bytes)", l, minConnIDLen, maxConnIDLen)
+	}
+	return nil
+}
+
+// newConnID allocates a connection ID of length l, with random content,
+// and writes the config rotation codepoint into the first byte.
+func newConnID(configID uint8, l int) (quic.ConnectionID, error) {
+	b := make([]byte, l)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	b[0] = configID<<6 | b[0]&0x3f
+	return quic.ConnectionID(b), nil
+}
@@ -0,0 +1,48 @@
+package quiclb
+
+import (
+	"bytes"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+	"github.com/DrakenLibra/gt-bbr/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QUIC-LB", func() {
+	It("parses the connection ID of a packet with a short header", func() {
+		b := &bytes.Buffer{}
+		Expect((&wire.ExtendedHeader{
+			Header:          wire.Header{DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6}},
+			PacketNumber:    0x42,
+			PacketNumberLen: protocol.PacketNumberLen2,
+		}).Write(b, protocol.VersionTLS)).To(Succeed())
+		connID, err := ParseConnectionID(b.Bytes(), 6)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6}))
+	})
+
+	It("parses the connection ID of a packet with a long header", func() {
+		b := &bytes.Buffer{}
+		Expect((&wire.ExtendedHeader{
+			Header: wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5},
+				Version:          protocol.VersionTLS,
+			},
+			PacketNumber:    0x42,
+			PacketNumberLen: protocol.PacketNumberLen2,
+		}).Write(b, protocol.VersionTLS)).To(Succeed())
+		connID, err := ParseConnectionID(b.Bytes(), 6)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}))
+	})
+
+	It("reads the config ID", func() {
+		Expect(ConfigID([]byte{0x80, 1, 2, 3})).To(BeEquivalentTo(2))
+		Expect(ConfigID([]byte{0x3f, 1, 2, 3})).To(BeZero())
+	})
+})
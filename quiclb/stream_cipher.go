@@ -0,0 +1,134 @@
+package quiclb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+
+	quic "github.com/DrakenLibra/gt-bbr"
+)
+
+const (
+	// MinNonceLen is the minimum nonce length for the stream cipher encoding.
+	MinNonceLen = 8
+	// MaxNonceLen is the maximum nonce length for the stream cipher encoding.
+	MaxNonceLen = 16
+)
+
+// A StreamCipherGenerator generates connection IDs that contain the encrypted server ID.
+// The connection ID consists of
+// * the first byte, containing the config rotation codepoint in the two most significant bits,
+// * a random nonce,
+// * the server ID, XORed with the AES-128 encryption of the (zero-padded) nonce.
+// Only load balancers that know the key can extract the server ID.
+// This encoding is specific to this package, and not compatible with the stream cipher algorithm of the QUIC-LB draft.
+// The connection IDs must be decoded using a StreamCipherDecoder.
+type StreamCipherGenerator struct {
+	configID uint8
+	serverID []byte
+	nonceLen int
+	block    cipher.Block
+}
+
+var _ quic.ConnectionIDGenerator = &StreamCipherGenerator{}
+
+// NewStreamCipherGenerator creates a new StreamCipherGenerator.
+// The key must be 16 bytes long. The nonce must be between MinNonceLen and MaxNonceLen bytes long.
+// The generated connection IDs are 1 + nonceLen + len(serverID) bytes long.
+func NewStreamCipherGenerator(configID uint8, serverID, key []byte, nonceLen int) (*StreamCipherGenerator, error) {
+	if err := checkConfigID(configID); err != nil {
+		return nil, err
+	}
+	if len(serverID) == 0 {
+		return nil, errors.New("empty server ID")
+	}
+	block, err := newStreamCipher(key, nonceLen, len(serverID))
+	if err != nil {
+		return nil, err
+	}
+	return &StreamCipherGenerator{
+		configID: configID,
+		serverID: append([]byte(nil), serverID...),
+		nonceLen: nonceLen,
+		block:    block,
+	}, nil
+}
+
+// GenerateConnectionID generates a new connection ID.
+func (g *StreamCipherGenerator) GenerateConnectionID() (quic.ConnectionID, error) {
+	c, err := newConnID(g.configID, g.ConnectionIDLen())
+	if err != nil {
+		return nil, err
+	}
+	pad := streamCipherPad(g.block, c[1:1+g.nonceLen])
+	for i, b := range g.serverID {
+		c[1+g.nonceLen+i] = b ^ pad[i]
+	}
+	return c, nil
+}
+
+// ConnectionIDLen returns the length of the connection IDs generated.
+func (g *StreamCipherGenerator) ConnectionIDLen() int {
+	return 1 + g.nonceLen + len(g.serverID)
+}
+
+// A StreamCipherDecoder decodes connection IDs generated by a StreamCipherGenerator.
+// It is safe for concurrent use.
+type StreamCipherDecoder struct {
+	nonceLen    int
+	serverIDLen int
+	block       cipher.Block
+}
+
+// NewStreamCipherDecoder creates a new StreamCipherDecoder.
+// The parameters must match the parameters used by the StreamCipherGenerator.
+func NewStreamCipherDecoder(key []byte, nonceLen, serverIDLen int) (*StreamCipherDecoder, error) {
+	block, err := newStreamCipher(key, nonceLen, serverIDLen)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamCipherDecoder{
+		nonceLen:    nonceLen,
+		serverIDLen: serverIDLen,
+		block:       block,
+	}, nil
+}
+
+// Decode decodes a connection ID.
+// It returns the config rotation codepoint and the server ID.
+func (d *StreamCipherDecoder) Decode(connID []byte) (uint8 /* config ID */, []byte /* server ID */, error) {
+	if len(connID) != 1+d.nonceLen+d.serverIDLen {
+		return 0, nil, errInvalidConnIDLen
+	}
+	pad := streamCipherPad(d.block, connID[1:1+d.nonceLen])
+	serverID := make([]byte, d.serverIDLen)
+	for i := range serverID {
+		serverID[i] = connID[1+d.nonceLen+i] ^ pad[i]
+	}
+	return ConfigID(connID), serverID, nil
+}
+
+func newStreamCipher(key []byte, nonceLen, serverIDLen int) (cipher.Block, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("invalid key length: %d (must be 16 bytes)", len(key))
+	}
+	if nonceLen < MinNonceLen || nonceLen > MaxNonceLen {
+		return nil, fmt.Errorf("invalid nonce length: %d (must be between %d and %d bytes)", nonceLen, MinNonceLen, MaxNonceLen)
+	}
+	if serverIDLen > aes.BlockSize {
+		return nil, errors.New("server ID too long")
+	}
+	if err := checkConnIDLen(1 + nonceLen + serverIDLen); err != nil {
+		return nil, err
+	}
+	return aes.NewCipher(key)
+}
+
+// streamCipherPad encrypts the nonce, padded with zeros to the AES block size.
+func streamCipherPad(block cipher.Block, nonce []byte) []byte {
+	b := make([]byte, aes.BlockSize)
+	copy(b, nonce)
+	block.Encrypt(b, b)
+	return b
+}
@@ -0,0 +1,66 @@
+package quiclb
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream cipher encoding", func() {
+	serverID := []byte{0xde, 0xca, 0xfb, 0xad}
+	key := []byte("0123456789abcdef")
+
+	It("generates connection IDs", func() {
+		g, err := NewStreamCipherGenerator(2, serverID, key, 8)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g.ConnectionIDLen()).To(Equal(13))
+		d, err := NewStreamCipherDecoder(key, 8, len(serverID))
+		Expect(err).ToNot(HaveOccurred())
+		c1, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1.Len()).To(Equal(13))
+		c2, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1).ToNot(Equal(c2))
+		// the encrypted server ID changes with the nonce
+		Expect(c1[9:]).ToNot(Equal(c2[9:]))
+		for _, c := range [][]byte{c1, c2} {
+			Expect(c[9:]).ToNot(Equal(serverID))
+			configID, sid, err := d.Decode(c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configID).To(BeEquivalentTo(2))
+			Expect(sid).To(Equal(serverID))
+		}
+	})
+
+	It("doesn't decode the server ID with the wrong key", func() {
+		g, err := NewStreamCipherGenerator(0, serverID, key, 8)
+		Expect(err).ToNot(HaveOccurred())
+		d, err := NewStreamCipherDecoder([]byte("fedcba9876543210"), 8, len(serverID))
+		Expect(err).ToNot(HaveOccurred())
+		c, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		_, sid, err := d.Decode(c)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sid).ToNot(Equal(serverID))
+	})
+
+	It("rejects invalid parameters", func() {
+		_, err := NewStreamCipherGenerator(3, serverID, key, 8)
+		Expect(err).To(MatchError("invalid config ID: 3"))
+		_, err = NewStreamCipherGenerator(0, nil, key, 8)
+		Expect(err).To(MatchError("empty server ID"))
+		_, err = NewStreamCipherGenerator(0, serverID, key[:15], 8)
+		Expect(err).To(MatchError("invalid key length: 15 (must be 16 bytes)"))
+		_, err = NewStreamCipherGenerator(0, serverID, key, 7)
+		Expect(err).To(MatchError("invalid nonce length: 7 (must be between 8 and 16 bytes)"))
+		_, err = NewStreamCipherGenerator(0, serverID, key, 16)
+		Expect(err).To(MatchError("invalid connection ID length: 21 (must be between 4 and 18 bytes)"))
+	})
+
+	It("errors when decoding a connection ID with the wrong length", func() {
+		d, err := NewStreamCipherDecoder(key, 8, len(serverID))
+		Expect(err).ToNot(HaveOccurred())
+		_, _, err = d.Decode(make([]byte, 12))
+		Expect(err).To(MatchError(errInvalidConnIDLen))
+	})
+})
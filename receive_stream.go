@@ -28,9 +28,10 @@ type receiveStream struct {
 
 	sender streamSender
 
-	frameQueue  *frameSorter
-	readOffset  protocol.ByteCount
-	finalOffset protocol.ByteCount
+	frameQueue      *frameSorter
+	readOffset      protocol.ByteCount
+	finalOffset     protocol.ByteCount
+	highestReceived protocol.ByteCount
 
 	currentFrame       []byte
 	currentFrameIsLast bool // is the currentFrame the last frame on this stream
@@ -54,18 +55,20 @@ type receiveStream struct {
 
 var _ ReceiveStream = &receiveStream{}
 var _ receiveStreamI = &receiveStream{}
+var _ io.WriterTo = &receiveStream{}
 
 func newReceiveStream(
 	streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	memory *flowcontrol.WindowBudget,
 	version protocol.VersionNumber,
 ) *receiveStream {
 	return &receiveStream{
 		streamID:       streamID,
 		sender:         sender,
 		flowController: flowController,
-		frameQueue:     newFrameSorter(),
+		frameQueue:     newFrameSorter(memory),
 		readChan:       make(chan struct{}, 1),
 		finalOffset:    protocol.MaxByteCount,
 		version:        version,
@@ -89,17 +92,8 @@ func (s *receiveStream) Read(p []byte) (int, error) {
 }
 
 func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, error) {
-	if s.finRead {
-		return false, 0, io.EOF
-	}
-	if s.canceledRead {
-		return false, 0, s.cancelReadErr
-	}
-	if s.resetRemotely {
-		return false, 0, s.resetRemotelyErr
-	}
-	if s.closedForShutdown {
-		return false, 0, s.closeForShutdownErr
+	if err := s.readErr(); err != nil {
+		return false, 0, err
 	}
 
 	bytesRead := 0
@@ -111,48 +105,8 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 			return false, bytesRead, s.closeForShutdownErr
 		}
 
-		var deadlineTimer *utils.Timer
-		for {
-			// Stop waiting on errors
-			if s.closedForShutdown {
-				return false, bytesRead, s.closeForShutdownErr
-			}
-			if s.canceledRead {
-				return false, bytesRead, s.cancelReadErr
-			}
-			if s.resetRemotely {
-				return false, bytesRead, s.resetRemotelyErr
-			}
-
-			deadline := s.deadline
-			if !deadline.IsZero() {
-				if !time.Now().Before(deadline) {
-					return false, bytesRead, errDeadline
-				}
-				if deadlineTimer == nil {
-					deadlineTimer = utils.NewTimer()
-				}
-				deadlineTimer.Reset(deadline)
-			}
-
-			if s.currentFrame != nil || s.currentFrameIsLast {
-				break
-			}
-
-			s.mutex.Unlock()
-			if deadline.IsZero() {
-				<-s.readChan
-			} else {
-				select {
-				case <-s.readChan:
-				case <-deadlineTimer.Chan():
-					deadlineTimer.SetRead()
-				}
-			}
-			s.mutex.Lock()
-			if s.currentFrame == nil {
-				s.dequeueNextFrame()
-			}
+		if err := s.waitForFrame(); err != nil {
+			return false, bytesRead, err
 		}
 
 		if bytesRead > len(p) {
@@ -165,24 +119,157 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 		s.mutex.Unlock()
 
 		m := copy(p[bytesRead:], s.currentFrame[s.readPosInFrame:])
-		s.readPosInFrame += m
 		bytesRead += m
-		s.readOffset += protocol.ByteCount(m)
 
 		s.mutex.Lock()
-		// when a RESET_STREAM was received, the was already informed about the final byteOffset for this stream
-		if !s.resetRemotely {
-			s.flowController.AddBytesRead(protocol.ByteCount(m))
-		}
-
-		if s.readPosInFrame >= len(s.currentFrame) && s.currentFrameIsLast {
-			s.finRead = true
+		if s.consumeFrameData(m) {
 			return true, bytesRead, io.EOF
 		}
 	}
 	return false, bytesRead, nil
 }
 
+// WriteTo implements io.WriterTo.
+// It writes data to w until the end of the stream is reached or an error occurs.
+// The data is passed to w directly from the received STREAM frames, without copying it into an intermediate buffer.
+// Like Read, it is not thread safe!
+func (s *receiveStream) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		s.mutex.Lock()
+		completed, n, err := s.writeToImpl(w)
+		s.mutex.Unlock()
+
+		written += int64(n)
+		if completed {
+			s.streamCompleted()
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// writeToImpl writes the data of the current frame to w.
+// It must be called after locking the mutex.
+func (s *receiveStream) writeToImpl(w io.Writer) (bool /* stream completed */, int, error) {
+	if err := s.readErr(); err != nil {
+		return false, 0, err
+	}
+	if s.currentFrame == nil || s.readPosInFrame >= len(s.currentFrame) {
+		s.dequeueNextFrame()
+	}
+	if err := s.waitForFrame(); err != nil {
+		return false, 0, err
+	}
+
+	var n int
+	if data := s.currentFrame[s.readPosInFrame:]; len(data) > 0 {
+		s.mutex.Unlock()
+		var err error
+		n, err = w.Write(data)
+		if err == nil && n < len(data) {
+			err = io.ErrShortWrite
+		}
+		s.mutex.Lock()
+		if err != nil {
+			s.consumeFrameData(n)
+			return false, n, err
+		}
+	}
+	if s.consumeFrameData(n) {
+		return true, n, io.EOF
+	}
+	return false, n, nil
+}
+
+// readErr returns the error that Read and WriteTo return before reading any data.
+// It must be called after locking the mutex.
+func (s *receiveStream) readErr() error {
+	if s.finRead {
+		return io.EOF
+	}
+	if s.canceledRead {
+		return s.cancelReadErr
+	}
+	if s.resetRemotely {
+		return s.resetRemotelyErr
+	}
+	if s.closedForShutdown {
+		return s.closeForShutdownErr
+	}
+	return nil
+}
+
+// waitForFrame blocks until a frame is available for reading, the deadline expires or the stream is closed.
+// It must be called after locking the mutex, and returns with the mutex locked.
+func (s *receiveStream) waitForFrame() error {
+	var deadlineTimer *utils.Timer
+	for {
+		// Stop waiting on errors
+		if s.closedForShutdown {
+			return s.closeForShutdownErr
+		}
+		if s.canceledRead {
+			return s.cancelReadErr
+		}
+		if s.resetRemotely {
+			return s.resetRemotelyErr
+		}
+
+		deadline := s.deadline
+		if !deadline.IsZero() {
+			if !time.Now().Before(deadline) {
+				return errDeadline
+			}
+			if deadlineTimer == nil {
+				deadlineTimer = utils.NewTimer()
+			}
+			deadlineTimer.Reset(deadline)
+		}
+
+		if s.currentFrame != nil || s.currentFrameIsLast {
+			return nil
+		}
+
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.readChan
+		} else {
+			select {
+			case <-s.readChan:
+			case <-deadlineTimer.Chan():
+				deadlineTimer.SetRead()
+			}
+		}
+		s.mutex.Lock()
+		if s.currentFrame == nil {
+			s.dequeueNextFrame()
+		}
+	}
+}
+
+// consumeFrameData marks n bytes of the current frame as read.
+// It returns true if the end of the stream was reached.
+// It must be called after locking the mutex.
+func (s *receiveStream) consumeFrameData(n int) bool /* stream completed */ {
+	s.readPosInFrame += n
+	s.readOffset += protocol.ByteCount(n)
+	// when a RESET_STREAM was received, the was already informed about the final byteOffset for this stream
+	if !s.resetRemotely {
+		s.flowController.AddBytesRead(protocol.ByteCount(n))
+	}
+
+	if s.readPosInFrame >= len(s.currentFrame) && s.currentFrameIsLast {
+		s.finRead = true
+		return true
+	}
+	return false
+}
+
 func (s *receiveStream) dequeueNextFrame() {
 	var offset protocol.ByteCount
 	offset, s.currentFrame = s.frameQueue.Pop()
@@ -205,6 +292,7 @@ func (s *receiveStream) cancelReadImpl(errorCode protocol.ApplicationErrorCode)
 		return false
 	}
 	s.canceledRead = true
+	s.frameQueue.Clear()
 	s.cancelReadErr = fmt.Errorf("Read on stream %d canceled with error code %d", s.streamID, errorCode)
 	s.signalRead()
 	s.sender.queueControlFrame(&wire.StopSendingFrame{
@@ -231,6 +319,9 @@ func (s *receiveStream) handleStreamFrameImpl(frame *wire.StreamFrame) (bool /*
 	if err := s.flowController.UpdateHighestReceived(maxOffset, frame.FinBit); err != nil {
 		return false, err
 	}
+	if maxOffset > s.highestReceived {
+		s.highestReceived = maxOffset
+	}
 	if frame.FinBit {
 		s.finalOffset = maxOffset
 	}
@@ -269,6 +360,7 @@ func (s *receiveStream) handleResetStreamFrameImpl(frame *wire.ResetStreamFrame)
 		return false, nil
 	}
 	s.resetRemotely = true
+	s.frameQueue.Clear()
 	s.resetRemotelyErr = streamCanceledError{
 		errorCode: frame.ErrorCode,
 		error:     fmt.Errorf("Stream %d was reset with error code %d", s.streamID, frame.ErrorCode),
@@ -277,6 +369,16 @@ func (s *receiveStream) handleResetStreamFrameImpl(frame *wire.ResetStreamFrame)
 	return true, nil
 }
 
+func (s *receiveStream) Stats() StreamStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return StreamStats{
+		BytesReceived: uint64(s.highestReceived),
+		BytesRead:     uint64(s.readOffset),
+	}
+}
+
 func (s *receiveStream) CloseRemote(offset protocol.ByteCount) {
 	s.handleStreamFrame(&wire.StreamFrame{FinBit: true, Offset: offset})
 }
@@ -1,11 +1,13 @@
 package quic
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"runtime"
 	"time"
 
+	"github.com/DrakenLibra/gt-bbr/internal/flowcontrol"
 	"github.com/DrakenLibra/gt-bbr/internal/mocks"
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/wire"
@@ -29,7 +31,7 @@ var _ = Describe("Receive Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newReceiveStream(streamID, mockSender, mockFC, protocol.VersionWhatever)
+		str = newReceiveStream(streamID, mockSender, mockFC, nil, protocol.VersionWhatever)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = gbytes.TimeoutReader(str, timeout)
@@ -77,6 +79,22 @@ var _ = Describe("Receive Stream", func() {
 			Expect(b).To(Equal([]byte{0xBE, 0xEF}))
 		})
 
+		It("reports the number of bytes received and read", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(4))
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foob")})).To(Succeed())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, Data: []byte("1234")})).To(Succeed())
+			b := make([]byte, 10)
+			n, err := strWithTimeout.Read(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(4))
+			stats := str.Stats()
+			Expect(stats.BytesReceived).To(Equal(uint64(10)))
+			Expect(stats.BytesRead).To(Equal(uint64(4)))
+			Expect(stats.BytesSent).To(BeZero())
+		})
+
 		It("reads all data available", func() {
 			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(2), false)
 			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), false)
@@ -446,6 +464,80 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 
+	Context("writing to an io.Writer", func() {
+		It("writes all data until the FIN", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3)).Times(2)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar"), FinBit: true})).To(Succeed())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			buf := &bytes.Buffer{}
+			n, err := str.WriteTo(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(int64(6)))
+			Expect(buf.String()).To(Equal("foobar"))
+			// subsequent reads return EOF
+			_, err = str.Read(make([]byte, 1))
+			Expect(err).To(MatchError(io.EOF))
+		})
+
+		It("doesn't copy the data of the STREAM frames", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(6))
+			data := []byte("foobar")
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: data, FinBit: true})).To(Succeed())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			w := &recordingWriter{}
+			_, err := str.WriteTo(w)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(w.writes).To(HaveLen(1))
+			Expect(&w.writes[0][0]).To(Equal(&data[0]))
+		})
+
+		It("waits until data is available", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(6))
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			buf := gbytes.NewBuffer()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				n, err := str.WriteTo(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(int64(6)))
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar"), FinBit: true})).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Expect(buf.Contents()).To(Equal([]byte("foobar")))
+		})
+
+		It("returns write errors", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(0))
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+			testErr := errors.New("test error")
+			n, err := str.WriteTo(&recordingWriter{err: testErr})
+			Expect(err).To(MatchError(testErr))
+			Expect(n).To(BeZero())
+		})
+
+		It("returns the error when reading was canceled", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			str.CancelRead(1234)
+			_, err := str.WriteTo(&bytes.Buffer{})
+			Expect(err).To(MatchError("Read on stream 1337 canceled with error code 1234"))
+		})
+
+		It("respects the read deadline", func() {
+			str.SetReadDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))
+			_, err := str.WriteTo(&bytes.Buffer{})
+			Expect(err).To(MatchError(errDeadline))
+		})
+	})
+
 	Context("stream cancelations", func() {
 		Context("canceling read", func() {
 			It("unblocks Read", func() {
@@ -525,6 +617,20 @@ var _ = Describe("Receive Stream", func() {
 				str.CancelRead(1234)
 			})
 
+			It("releases the memory of queued data", func() {
+				memory := flowcontrol.NewWindowBudget(0)
+				str.frameQueue = newFrameSorter(memory)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), false)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{
+					Offset: 4,
+					Data:   []byte("foobar"),
+				})).To(Succeed())
+				Expect(memory.Used()).To(BeEquivalentTo(10))
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				str.CancelRead(1234)
+				Expect(memory.Used()).To(BeZero())
+			})
+
 			It("completes the stream when receiving the FinBit after the stream was canceled", func() {
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
 				str.CancelRead(1234)
@@ -582,6 +688,24 @@ var _ = Describe("Receive Stream", func() {
 				Expect(err.(streamCanceledError).ErrorCode()).To(Equal(protocol.ApplicationErrorCode(1234)))
 			})
 
+			It("releases the memory of queued data", func() {
+				memory := flowcontrol.NewWindowBudget(0)
+				str.frameQueue = newFrameSorter(memory)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(10), false)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{
+					Offset: 4,
+					Data:   []byte("foobar"),
+				})).To(Succeed())
+				Expect(memory.Used()).To(BeEquivalentTo(10))
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				gomock.InOrder(
+					mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true),
+					mockFC.EXPECT().Abandon(),
+				)
+				Expect(str.handleResetStreamFrame(rst)).To(Succeed())
+				Expect(memory.Used()).To(BeZero())
+			})
+
 			It("errors when receiving a RESET_STREAM with an inconsistent offset", func() {
 				testErr := errors.New("already received a different final offset before")
 				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true).Return(testErr)
@@ -623,3 +747,16 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 })
+
+type recordingWriter struct {
+	writes [][]byte
+	err    error
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.writes = append(w.writes, p)
+	return len(p), nil
+}
@@ -19,6 +19,8 @@ type sendStreamI interface {
 	popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool)
 	closeForShutdown(error)
 	handleMaxStreamDataFrame(*wire.MaxStreamDataFrame)
+	handleStreamFrameAcked(*wire.StreamFrame)
+	handleStreamFrameRetransmitted(*wire.StreamFrame)
 }
 
 type sendStream struct {
@@ -32,6 +34,26 @@ type sendStream struct {
 
 	writeOffset protocol.ByteCount
 
+	// ackedRanges contains the (non-overlapping) byte ranges that were acknowledged by the peer
+	ackedRanges        *utils.ByteIntervalList
+	bytesAcked         protocol.ByteCount
+	bytesRetransmitted protocol.ByteCount
+	finAcked           bool
+	allDataAcked       bool // set once all data up to and including the FIN was acknowledged
+	// allDataAckedChan is closed once all data up to and including the FIN was acknowledged
+	allDataAckedChan chan struct{}
+	// writeAbortedChan is closed when writing is canceled, or the stream is closed for shutdown
+	writeAbortedChan chan struct{}
+	writeAborted     bool
+
+	// the time the stream was blocked by flow control
+	blockedSince          time.Time
+	blockedOnConnection   bool
+	streamBlockedTime     time.Duration
+	connectionBlockedTime time.Duration
+	// the send window, as of the last time the stream was scheduled for sending
+	sendWindow protocol.ByteCount
+
 	cancelWriteErr      error
 	closeForShutdownErr error
 
@@ -60,11 +82,14 @@ func newSendStream(
 	version protocol.VersionNumber,
 ) *sendStream {
 	s := &sendStream{
-		streamID:       streamID,
-		sender:         sender,
-		flowController: flowController,
-		writeChan:      make(chan struct{}, 1),
-		version:        version,
+		streamID:         streamID,
+		sender:           sender,
+		flowController:   flowController,
+		writeChan:        make(chan struct{}, 1),
+		ackedRanges:      utils.NewByteIntervalList(),
+		allDataAckedChan: make(chan struct{}),
+		writeAbortedChan: make(chan struct{}),
+		version:          version,
 	}
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 	return s
@@ -147,18 +172,14 @@ func (s *sendStream) Write(p []byte) (int, error) {
 // maxBytes is the maximum length this frame (including frame header) will have.
 func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool /* has more data to send */) {
 	s.mutex.Lock()
-	completed, frame, hasMoreData := s.popStreamFrameImpl(maxBytes)
+	frame, hasMoreData := s.popStreamFrameImpl(maxBytes)
 	s.mutex.Unlock()
-
-	if completed {
-		s.sender.onStreamCompleted(s.streamID)
-	}
 	return frame, hasMoreData
 }
 
-func (s *sendStream) popStreamFrameImpl(maxBytes protocol.ByteCount) (bool /* completed */, *wire.StreamFrame, bool /* has more data to send */) {
+func (s *sendStream) popStreamFrameImpl(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool /* has more data to send */) {
 	if s.canceledWrite || s.closeForShutdownErr != nil {
-		return false, nil, false
+		return nil, false
 	}
 
 	frame := &wire.StreamFrame{
@@ -168,7 +189,7 @@ func (s *sendStream) popStreamFrameImpl(maxBytes protocol.ByteCount) (bool /* co
 	}
 	maxDataLen := frame.MaxDataLen(maxBytes, s.version)
 	if maxDataLen == 0 { // a STREAM frame must have at least one byte of data
-		return false, nil, s.dataForWriting != nil
+		return nil, s.dataForWriting != nil
 	}
 	frame.Data, frame.FinBit = s.getDataForWriting(maxDataLen)
 	if len(frame.Data) == 0 && !frame.FinBit {
@@ -177,21 +198,43 @@ func (s *sendStream) popStreamFrameImpl(maxBytes protocol.ByteCount) (bool /* co
 		// - there's data for writing, but the stream is stream-level flow control blocked
 		// - there's data for writing, but the stream is connection-level flow control blocked
 		if s.dataForWriting == nil {
-			return false, nil, false
+			return nil, false
 		}
+		s.updateBlockedTime(s.flowController.IsBlocked())
 		if isBlocked, offset := s.flowController.IsNewlyBlocked(); isBlocked {
 			s.sender.queueControlFrame(&wire.StreamDataBlockedFrame{
 				StreamID:  s.streamID,
 				DataLimit: offset,
 			})
-			return false, nil, false
+			return nil, false
 		}
-		return false, nil, true
+		return nil, true
 	}
+	s.updateBlockedTime(false, false)
 	if frame.FinBit {
 		s.finSent = true
 	}
-	return frame.FinBit, frame, s.dataForWriting != nil
+	return frame, s.dataForWriting != nil
+}
+
+// updateBlockedTime accounts for the time spent blocked by flow control.
+// It must be called after locking the mutex.
+func (s *sendStream) updateBlockedTime(blocked, connection bool) {
+	if !s.blockedSince.IsZero() {
+		if blocked && connection == s.blockedOnConnection {
+			return
+		}
+		if s.blockedOnConnection {
+			s.connectionBlockedTime += time.Since(s.blockedSince)
+		} else {
+			s.streamBlockedTime += time.Since(s.blockedSince)
+		}
+		s.blockedSince = time.Time{}
+	}
+	if blocked {
+		s.blockedSince = time.Now()
+		s.blockedOnConnection = connection
+	}
 }
 
 func (s *sendStream) hasData() bool {
@@ -206,7 +249,8 @@ func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, boo
 		return nil, s.finishedWriting && !s.finSent
 	}
 
-	maxBytes = utils.MinByteCount(maxBytes, s.flowController.SendWindowSize())
+	s.sendWindow = s.flowController.SendWindowSize()
+	maxBytes = utils.MinByteCount(maxBytes, s.sendWindow)
 	if maxBytes == 0 {
 		return nil, false
 	}
@@ -223,10 +267,93 @@ func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, boo
 		s.signalWrite()
 	}
 	s.writeOffset += protocol.ByteCount(len(ret))
+	s.sendWindow -= protocol.ByteCount(len(ret))
 	s.flowController.AddBytesSent(protocol.ByteCount(len(ret)))
 	return ret, s.finishedWriting && s.dataForWriting == nil && !s.finSent
 }
 
+func (s *sendStream) handleStreamFrameAcked(frame *wire.StreamFrame) {
+	s.mutex.Lock()
+	completed := s.handleStreamFrameAckedImpl(frame)
+	s.mutex.Unlock()
+
+	if completed {
+		s.sender.onStreamCompleted(s.streamID)
+	}
+}
+
+// must be called after locking the mutex
+func (s *sendStream) handleStreamFrameAckedImpl(frame *wire.StreamFrame) bool /* completed */ {
+	if len(frame.Data) > 0 {
+		s.addAckedRange(frame.Offset, frame.Offset+frame.DataLen())
+	}
+	if frame.FinBit {
+		s.finAcked = true
+	}
+	// The stream is completed once all data up to and including the FIN has been acknowledged.
+	if s.allDataAcked || s.canceledWrite || !s.finAcked || s.bytesAcked != s.writeOffset {
+		return false
+	}
+	s.allDataAcked = true
+	close(s.allDataAckedChan)
+	return true
+}
+
+// addAckedRange adds a range of acknowledged data.
+// Ranges that were already acknowledged before are only counted once.
+func (s *sendStream) addAckedRange(start, end protocol.ByteCount) {
+	newlyAcked := end - start
+	var next *utils.ByteIntervalElement
+	for el := s.ackedRanges.Front(); el != nil; el = next {
+		next = el.Next()
+		if el.Value.End < start {
+			continue
+		}
+		if el.Value.Start > end {
+			s.ackedRanges.InsertBefore(utils.ByteInterval{Start: start, End: end}, el)
+			s.bytesAcked += newlyAcked
+			return
+		}
+		// the ranges overlap (or are adjacent). Merge them.
+		newlyAcked -= utils.MinByteCount(el.Value.End, end) - utils.MaxByteCount(el.Value.Start, start)
+		start = utils.MinByteCount(el.Value.Start, start)
+		end = utils.MaxByteCount(el.Value.End, end)
+		s.ackedRanges.Remove(el)
+	}
+	s.ackedRanges.PushBack(utils.ByteInterval{Start: start, End: end})
+	s.bytesAcked += newlyAcked
+}
+
+func (s *sendStream) handleStreamFrameRetransmitted(frame *wire.StreamFrame) {
+	s.mutex.Lock()
+	s.bytesRetransmitted += frame.DataLen()
+	s.mutex.Unlock()
+}
+
+func (s *sendStream) Stats() StreamStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := StreamStats{
+		BytesWritten:                     uint64(s.writeOffset) + uint64(len(s.dataForWriting)),
+		BytesSent:                        uint64(s.writeOffset),
+		BytesRetransmitted:               uint64(s.bytesRetransmitted),
+		BytesAcked:                       uint64(s.bytesAcked),
+		StreamFlowControlBlockedTime:     s.streamBlockedTime,
+		ConnectionFlowControlBlockedTime: s.connectionBlockedTime,
+		SendWindow:                       uint64(s.sendWindow),
+	}
+	// include the time the stream has been blocked so far
+	if !s.blockedSince.IsZero() {
+		if s.blockedOnConnection {
+			stats.ConnectionFlowControlBlockedTime += time.Since(s.blockedSince)
+		} else {
+			stats.StreamFlowControlBlockedTime += time.Since(s.blockedSince)
+		}
+	}
+	return stats
+}
+
 func (s *sendStream) Close() error {
 	s.mutex.Lock()
 	if s.canceledWrite {
@@ -258,6 +385,8 @@ func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, wr
 	}
 	s.canceledWrite = true
 	s.cancelWriteErr = writeErr
+	s.updateBlockedTime(false, false)
+	s.abortWrite()
 	s.signalWrite()
 	s.sender.queueControlFrame(&wire.ResetStreamFrame{
 		StreamID:   s.streamID,
@@ -299,6 +428,38 @@ func (s *sendStream) handleStopSendingFrameImpl(frame *wire.StopSendingFrame) bo
 	return s.cancelWriteImpl(errorCodeStopping, writeErr)
 }
 
+func (s *sendStream) WaitAcknowledged(ctx context.Context) error {
+	select {
+	case <-s.allDataAckedChan:
+		return nil
+	case <-s.writeAbortedChan:
+		// all data might have been acknowledged before the stream was closed for shutdown
+		select {
+		case <-s.allDataAckedChan:
+			return nil
+		default:
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.closeForShutdownErr != nil {
+			return s.closeForShutdownErr
+		}
+		return s.cancelWriteErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// abortWrite unblocks calls to WaitAcknowledged.
+// It must be called after locking the mutex.
+func (s *sendStream) abortWrite() {
+	if s.writeAborted {
+		return
+	}
+	s.writeAborted = true
+	close(s.writeAbortedChan)
+}
+
 func (s *sendStream) Context() context.Context {
 	return s.ctx
 }
@@ -318,6 +479,7 @@ func (s *sendStream) closeForShutdown(err error) {
 	s.mutex.Lock()
 	s.closedForShutdown = true
 	s.closeForShutdownErr = err
+	s.abortWrite()
 	s.mutex.Unlock()
 	s.signalWrite()
 	s.ctxCancel()
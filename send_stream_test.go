@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"runtime"
@@ -179,6 +180,7 @@ var _ = Describe("Send Stream", func() {
 		Context("flow control blocking", func() {
 			It("queues a BLOCKED frame if the stream is flow control blocked", func() {
 				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(0))
+				mockFC.EXPECT().IsBlocked().Return(true, false)
 				mockFC.EXPECT().IsNewlyBlocked().Return(true, protocol.ByteCount(12))
 				mockSender.EXPECT().queueControlFrame(&wire.StreamDataBlockedFrame{
 					StreamID:  streamID,
@@ -223,6 +225,7 @@ var _ = Describe("Send Stream", func() {
 
 				// try to pop again, this time noticing that we're blocked
 				mockFC.EXPECT().SendWindowSize()
+				mockFC.EXPECT().IsBlocked().Return(true, false)
 				// don't use offset 3 here, to make sure the BLOCKED frame contains the number returned by the flow controller
 				mockFC.EXPECT().IsNewlyBlocked().Return(true, protocol.ByteCount(10))
 				mockSender.EXPECT().queueControlFrame(&wire.StreamDataBlockedFrame{
@@ -400,7 +403,6 @@ var _ = Describe("Send Stream", func() {
 
 			It("allows FIN", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
-				mockSender.EXPECT().onStreamCompleted(streamID)
 				str.Close()
 				f, hasMoreData := str.popStreamFrame(1000)
 				Expect(f).ToNot(BeNil())
@@ -420,7 +422,6 @@ var _ = Describe("Send Stream", func() {
 				Expect(f).ToNot(BeNil())
 				Expect(f.Data).To(Equal([]byte("foo")))
 				Expect(f.FinBit).To(BeFalse())
-				mockSender.EXPECT().onStreamCompleted(streamID)
 				f, _ = str.popStreamFrame(100)
 				Expect(f.Data).To(Equal([]byte("bar")))
 				Expect(f.FinBit).To(BeTrue())
@@ -435,7 +436,6 @@ var _ = Describe("Send Stream", func() {
 
 			It("doesn't allow FIN twice", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
-				mockSender.EXPECT().onStreamCompleted(streamID)
 				str.Close()
 				f, _ := str.popStreamFrame(1000)
 				Expect(f).ToNot(BeNil())
@@ -517,6 +517,169 @@ var _ = Describe("Send Stream", func() {
 		})
 	})
 
+	Context("handling acknowledgements", func() {
+		It("completes the stream when the FIN is acknowledged", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			str.Close()
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.FinBit).To(BeTrue())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.handleStreamFrameAcked(f)
+			// completion is only reported once
+			str.handleStreamFrameAcked(f)
+		})
+
+		It("only completes the stream when all data has been acknowledged", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(3)
+			mockFC.EXPECT().AddBytesSent(gomock.Any()).Times(3)
+			str.dataForWriting = []byte("foobarbaz")
+			Expect(str.Close()).To(Succeed())
+			frameHeaderLen := protocol.ByteCount(4)
+			f1, _ := str.popStreamFrame(3 + frameHeaderLen)
+			f2, _ := str.popStreamFrame(3 + frameHeaderLen)
+			f3, _ := str.popStreamFrame(100)
+			Expect(f3.FinBit).To(BeTrue())
+			str.handleStreamFrameAcked(f3)
+			str.handleStreamFrameAcked(f1)
+			Expect(str.Stats().BytesAcked).To(Equal(uint64(f1.DataLen() + f3.DataLen())))
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.handleStreamFrameAcked(f2)
+			Expect(str.Stats().BytesAcked).To(Equal(uint64(9)))
+		})
+
+		It("counts acknowledged data only once", func() {
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			str.dataForWriting = []byte("foobar")
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			str.handleStreamFrameAcked(f)
+			str.handleStreamFrameAcked(f)
+			// a retransmission that was split into two frames
+			str.handleStreamFrameAcked(&wire.StreamFrame{StreamID: streamID, Offset: 2, Data: []byte("ob")})
+			Expect(str.Stats().BytesAcked).To(Equal(uint64(6)))
+		})
+
+		It("doesn't complete the stream after it was canceled", func() {
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			str.dataForWriting = []byte("foobar")
+			f, _ := str.popStreamFrame(1000)
+			Expect(f).ToNot(BeNil())
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.CancelWrite(1234)
+			str.handleStreamFrameAcked(f)
+		})
+	})
+
+	Context("waiting for acknowledgements", func() {
+		It("returns when all data and the FIN have been acknowledged", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			str.dataForWriting = []byte("foobar")
+			Expect(str.Close()).To(Succeed())
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.FinBit).To(BeTrue())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(str.WaitAcknowledged(context.Background())).To(Succeed())
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.handleStreamFrameAcked(f)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns an error when writing is canceled", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(str.WaitAcknowledged(context.Background())).To(MatchError("Write on stream 1337 canceled with error code 1234"))
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.CancelWrite(1234)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns an error when the stream is closed for shutdown", func() {
+			testErr := errors.New("test error")
+			str.closeForShutdown(testErr)
+			Expect(str.WaitAcknowledged(context.Background())).To(MatchError(testErr))
+		})
+
+		It("doesn't return an error when the stream is closed for shutdown after all data was acknowledged", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			str.Close()
+			f, _ := str.popStreamFrame(1000)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.handleStreamFrameAcked(f)
+			str.closeForShutdown(errors.New("test error"))
+			Expect(str.WaitAcknowledged(context.Background())).To(Succeed())
+		})
+
+		It("returns when the context is canceled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(20*time.Millisecond))
+			defer cancel()
+			Expect(str.WaitAcknowledged(ctx)).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("statistics", func() {
+		It("reports the number of bytes written, sent, acknowledged and retransmitted", func() {
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(100))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(4))
+			str.dataForWriting = []byte("foobar")
+			frameHeaderLen := protocol.ByteCount(4)
+			f, _ := str.popStreamFrame(4 + frameHeaderLen)
+			Expect(f.Data).To(Equal([]byte("foob")))
+			str.handleStreamFrameRetransmitted(&wire.StreamFrame{StreamID: streamID, Data: []byte("fo")})
+			str.handleStreamFrameAcked(&wire.StreamFrame{StreamID: streamID, Data: []byte("fo")})
+			stats := str.Stats()
+			Expect(stats.BytesWritten).To(Equal(uint64(6)))
+			Expect(stats.BytesSent).To(Equal(uint64(4)))
+			Expect(stats.BytesRetransmitted).To(Equal(uint64(2)))
+			Expect(stats.BytesAcked).To(Equal(uint64(2)))
+			Expect(stats.SendWindow).To(Equal(uint64(96)))
+			Expect(stats.BytesReceived).To(BeZero())
+			Expect(stats.BytesRead).To(BeZero())
+		})
+
+		It("reports the time spent blocked by flow control", func() {
+			str.dataForWriting = []byte("foobar")
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(0)).Times(2)
+			mockFC.EXPECT().IsBlocked().Return(true, false)
+			mockFC.EXPECT().IsNewlyBlocked()
+			f, _ := str.popStreamFrame(1000)
+			Expect(f).To(BeNil())
+			time.Sleep(scaleDuration(20 * time.Millisecond))
+			// now blocked on the connection-level flow control window
+			mockFC.EXPECT().IsBlocked().Return(true, true)
+			mockFC.EXPECT().IsNewlyBlocked()
+			f, _ = str.popStreamFrame(1000)
+			Expect(f).To(BeNil())
+			time.Sleep(scaleDuration(10 * time.Millisecond))
+			stats := str.Stats()
+			Expect(stats.StreamFlowControlBlockedTime).To(BeNumerically(">=", scaleDuration(20*time.Millisecond)))
+			Expect(stats.ConnectionFlowControlBlockedTime).To(BeNumerically(">=", scaleDuration(10*time.Millisecond)))
+			// unblock the stream
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(100))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+			f, _ = str.popStreamFrame(1000)
+			Expect(f).ToNot(BeNil())
+			blockedTime := str.Stats().ConnectionFlowControlBlockedTime
+			time.Sleep(scaleDuration(10 * time.Millisecond))
+			Expect(str.Stats().ConnectionFlowControlBlockedTime).To(Equal(blockedTime))
+		})
+	})
+
 	Context("stream cancelations", func() {
 		Context("canceling writing", func() {
 			It("queues a RESET_STREAM frame", func() {
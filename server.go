@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -56,6 +57,8 @@ type quicSession interface {
 
 type sessionRunner interface {
 	OnHandshakeComplete(Session)
+	Add(protocol.ConnectionID, packetHandler)
+	GetStatelessResetToken(protocol.ConnectionID) [16]byte
 	Retire(protocol.ConnectionID)
 	Remove(protocol.ConnectionID)
 	AddResetToken([16]byte, packetHandler)
@@ -74,6 +77,14 @@ var _ sessionRunner = &runner{}
 
 // A Listener of QUIC
 type server struct {
+	// statistics, to be used as atomics
+	// They are placed at the beginning of the struct to ensure 64 bit alignment.
+	retriesSent             uint64
+	rejectedSourceRateLimit uint64
+	rejectedSubnetRateLimit uint64
+	rejectedMaxHandshakes   uint64
+	rejectedAcceptQueueFull uint64
+
 	mutex sync.Mutex
 
 	tlsConf *tls.Config
@@ -100,12 +111,25 @@ type server struct {
 
 	sessionRunner sessionRunner
 
+	handshakeRateLimiter *handshakeRateLimiter
+
+	sessionsMutex      sync.Mutex
+	sessions           map[Session]struct{} // all sessions that are still running
+	sessionsInCreation int                  // sessions that are being created, but not yet added to sessions
+	handshakes         map[Session]struct{} // sessions that haven't completed the handshake yet
+	drained            chan struct{}        // closed when all sessions have finished after shutting down
+
+	shutdownChan      chan struct{} // closed when Shutdown is called
+	shutdownErrorCode ErrorCode
+
 	logger utils.Logger
 }
 
 var _ Listener = &server{}
 var _ unknownPacketHandler = &server{}
 
+var errServerShuttingDown = errors.New("server shutting down")
+
 // ListenAddr creates a QUIC server listening on a given address.
 // The tls.Config must not be nil and must contain a certificate configuration.
 // The quic.Config may be nil, in that case the default values will be used.
@@ -145,13 +169,19 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server,
 		return nil, errors.New("quic: NextProtos not set in tls.Config")
 	}
 	config = populateServerConfig(config)
+	if err := validateReceiveWindows(config); err != nil {
+		return nil, err
+	}
 	for _, v := range config.Versions {
 		if !protocol.IsValidVersion(v) {
 			return nil, fmt.Errorf("%s is not a valid QUIC version", v)
 		}
 	}
+	if err := validateConnectionIDLength(config, protocol.PerspectiveServer); err != nil {
+		return nil, err
+	}
 
-	sessionHandler, err := getMultiplexer().AddConn(conn, config.ConnectionIDLength, config.StatelessResetKey)
+	sessionHandler, err := getMultiplexer().AddConn(conn, config.ConnectionIDLength, getStatelessResetKeys(config), protocol.ByteCount(config.MaxPacketSize), !config.DisablePathMTUDiscovery)
 	if err != nil {
 		return nil, err
 	}
@@ -163,7 +193,15 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server,
 		sessionQueue:   make(chan Session),
 		errorChan:      make(chan struct{}),
 		newSession:     newSession,
-		logger:         utils.DefaultLogger.WithPrefix("server"),
+		handshakeRateLimiter: newHandshakeRateLimiter(
+			config.HandshakeRateLimitPerSource,
+			config.HandshakeRateLimitPerSubnet,
+		),
+		sessions:     make(map[Session]struct{}),
+		handshakes:   make(map[Session]struct{}),
+		drained:      make(chan struct{}),
+		shutdownChan: make(chan struct{}),
+		logger:       utils.DefaultLogger.WithPrefix("server"),
 	}
 	if err := s.setup(); err != nil {
 		return nil, err
@@ -177,23 +215,28 @@ func (s *server) setup() error {
 	s.sessionRunner = &runner{
 		packetHandlerManager: s.sessionHandler,
 		onHandshakeCompleteImpl: func(sess Session) {
-			go func() {
-				atomic.AddInt32(&s.sessionQueueLen, 1)
-				defer atomic.AddInt32(&s.sessionQueueLen, -1)
-				select {
-				case s.sessionQueue <- sess:
-					// blocks until the session is accepted
-				case <-sess.Context().Done():
-					// don't pass sessions that were already closed to Accept()
-				}
-			}()
+			s.removeHandshake(sess)
+			if !s.config.AcceptEarlySessions {
+				s.enqueueSession(sess)
+			}
 		},
 	}
-	tokenGenerator, err := handshake.NewTokenGenerator()
-	if err != nil {
-		return err
+	switch {
+	case s.config.TokenProtector != nil:
+		s.tokenGenerator = handshake.NewTokenGeneratorWithProtector(s.config.TokenProtector)
+	case len(s.config.TokenKey) > 0:
+		tokenProtector, err := handshake.NewTokenProtector(append([][]byte{s.config.TokenKey}, s.config.PreviousTokenKeys...))
+		if err != nil {
+			return err
+		}
+		s.tokenGenerator = handshake.NewTokenGeneratorWithProtector(tokenProtector)
+	default:
+		tokenGenerator, err := handshake.NewTokenGenerator()
+		if err != nil {
+			return err
+		}
+		s.tokenGenerator = tokenGenerator
 	}
-	s.tokenGenerator = tokenGenerator
 	return nil
 }
 
@@ -262,37 +305,218 @@ func populateServerConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	maxPacketSize := protocol.ByteCount(config.MaxPacketSize)
+	if maxPacketSize == 0 {
+		maxPacketSize = protocol.MaxReceivePacketSize
+	} else if maxPacketSize < protocol.MinInitialPacketSize {
+		maxPacketSize = protocol.MinInitialPacketSize
+	} else if maxPacketSize > protocol.MaxPacketBufferSize {
+		maxPacketSize = protocol.MaxPacketBufferSize
+	}
 	connIDLen := config.ConnectionIDLength
 	if connIDLen == 0 {
 		connIDLen = protocol.DefaultConnectionIDLength
 	}
+	connIDGenerator := config.ConnectionIDGenerator
+	if connIDGenerator == nil {
+		connIDGenerator = &protocol.DefaultConnectionIDGenerator{ConnLen: connIDLen}
+	} else {
+		connIDLen = connIDGenerator.ConnectionIDLen()
+	}
+	congestionControl := config.CongestionControl
+	if congestionControl == 0 {
+		congestionControl = protocol.CongestionControlBBR
+	}
+	bdpAutoTuningHeadroom := config.BDPAutoTuningHeadroom
+	if bdpAutoTuningHeadroom <= 0 {
+		bdpAutoTuningHeadroom = protocol.DefaultBDPAutoTuningHeadroom
+	}
+	maxAcceptQueueSize := config.MaxAcceptQueueSize
+	if maxAcceptQueueSize <= 0 {
+		maxAcceptQueueSize = protocol.DefaultMaxAcceptQueueSize
+	}
 
 	return &Config{
 		Versions:                              versions,
 		HandshakeTimeout:                      handshakeTimeout,
 		IdleTimeout:                           idleTimeout,
 		AcceptToken:                           verifyToken,
+		RetryThreshold:                        config.RetryThreshold,
+		MaxHandshakes:                         config.MaxHandshakes,
+		HandshakeRateLimitPerSource:           config.HandshakeRateLimitPerSource,
+		HandshakeRateLimitPerSubnet:           config.HandshakeRateLimitPerSubnet,
+		MaxAcceptQueueSize:                    maxAcceptQueueSize,
+		AcceptEarlySessions:                   config.AcceptEarlySessions,
+		TokenKey:                              config.TokenKey,
+		PreviousTokenKeys:                     config.PreviousTokenKeys,
+		TokenProtector:                        config.TokenProtector,
 		KeepAlive:                             config.KeepAlive,
+		EnableDatagrams:                       config.EnableDatagrams,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+		InitialStreamReceiveWindow:            config.InitialStreamReceiveWindow,
+		InitialConnectionReceiveWindow:        config.InitialConnectionReceiveWindow,
+		EnableBDPAutoTuning:                   config.EnableBDPAutoTuning,
+		BDPAutoTuningHeadroom:                 bdpAutoTuningHeadroom,
+		ReceiveWindowBudget:                   config.ReceiveWindowBudget,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
 		ConnectionIDLength:                    connIDLen,
+		ConnectionIDGenerator:                 connIDGenerator,
 		StatelessResetKey:                     config.StatelessResetKey,
+		PreviousStatelessResetKeys:            config.PreviousStatelessResetKeys,
+		KeyUpdateInterval:                     config.KeyUpdateInterval,
+		MaxPacketSize:                         uint64(maxPacketSize),
+		DisablePathMTUDiscovery:               config.DisablePathMTUDiscovery,
+		CongestionControl:                     congestionControl,
+		GetConfigForClient:                    config.GetConfigForClient,
+	}
+}
+
+// populateConfigForClient applies the values of the Config returned by GetConfigForClient.
+// Values that are not set are taken from the (populated) Config used for listening.
+// Initial windows that were not set explicitly are derived from the resulting maximum windows.
+// It errors if an explicitly set initial window is larger than the maximum window.
+func populateConfigForClient(config, clientConfig *Config) (*Config, error) {
+	c := *config
+	if clientConfig.MaxReceiveStreamFlowControlWindow != 0 {
+		c.MaxReceiveStreamFlowControlWindow = clientConfig.MaxReceiveStreamFlowControlWindow
+	}
+	if clientConfig.MaxReceiveConnectionFlowControlWindow != 0 {
+		c.MaxReceiveConnectionFlowControlWindow = clientConfig.MaxReceiveConnectionFlowControlWindow
+	}
+	if clientConfig.InitialStreamReceiveWindow != 0 {
+		c.InitialStreamReceiveWindow = clientConfig.InitialStreamReceiveWindow
+	}
+	if clientConfig.InitialConnectionReceiveWindow != 0 {
+		c.InitialConnectionReceiveWindow = clientConfig.InitialConnectionReceiveWindow
+	}
+	if err := validateReceiveWindows(&c); err != nil {
+		return nil, err
+	}
+	if clientConfig.MaxIncomingStreams > 0 {
+		c.MaxIncomingStreams = clientConfig.MaxIncomingStreams
+	} else if clientConfig.MaxIncomingStreams < 0 {
+		c.MaxIncomingStreams = 0
+	}
+	if clientConfig.MaxIncomingUniStreams > 0 {
+		c.MaxIncomingUniStreams = clientConfig.MaxIncomingUniStreams
+	} else if clientConfig.MaxIncomingUniStreams < 0 {
+		c.MaxIncomingUniStreams = 0
+	}
+	if clientConfig.IdleTimeout != 0 {
+		c.IdleTimeout = clientConfig.IdleTimeout
+	}
+	if clientConfig.CongestionControl != 0 {
+		c.CongestionControl = clientConfig.CongestionControl
+	}
+	return &c, nil
+}
+
+// Stats returns statistics about the connection attempts handled by the server
+func (s *server) Stats() ListenerStats {
+	return ListenerStats{
+		HandshakesInProgress:    s.numHandshakes(),
+		RetriesSent:             atomic.LoadUint64(&s.retriesSent),
+		RejectedSourceRateLimit: atomic.LoadUint64(&s.rejectedSourceRateLimit),
+		RejectedSubnetRateLimit: atomic.LoadUint64(&s.rejectedSubnetRateLimit),
+		RejectedMaxHandshakes:   atomic.LoadUint64(&s.rejectedMaxHandshakes),
+		RejectedAcceptQueueFull: atomic.LoadUint64(&s.rejectedAcceptQueueFull),
 	}
 }
 
 // Accept returns newly openend sessions
 func (s *server) Accept() (Session, error) {
+	return s.AcceptContext(context.Background())
+}
+
+// AcceptContext returns newly openend sessions, or the context's error when the context is done
+func (s *server) AcceptContext(ctx context.Context) (Session, error) {
 	var sess Session
 	select {
 	case sess = <-s.sessionQueue:
 		return sess, nil
 	case <-s.errorChan:
 		return nil, s.serverError
+	case <-s.shutdownChan:
+		// The server might also have been closed already.
+		select {
+		case <-s.errorChan:
+			return nil, s.serverError
+		default:
+		}
+		return nil, errServerShuttingDown
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
+// enqueueSession passes a session to Accept.
+func (s *server) enqueueSession(sess Session) {
+	atomic.AddInt32(&s.sessionQueueLen, 1)
+	go func() {
+		defer atomic.AddInt32(&s.sessionQueueLen, -1)
+		select {
+		case s.sessionQueue <- sess:
+			// blocks until the session is accepted
+		case <-sess.Context().Done():
+			// don't pass sessions that were already closed to Accept()
+		case <-s.shutdownChan:
+			// Sessions can't be accepted any more after the server started shutting down.
+			sess.CloseWithError(s.shutdownErrorCode, errServerShuttingDown.Error())
+		}
+	}()
+}
+
+// Shutdown gracefully shuts down the server.
+func (s *server) Shutdown(ctx context.Context, code ErrorCode) error {
+	s.mutex.Lock()
+	if s.closed || s.isShuttingDown() {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.shutdownErrorCode = code
+	close(s.shutdownChan)
+	s.mutex.Unlock()
+
+	s.sessionsMutex.Lock()
+	s.maybeSignalDrained()
+	s.sessionsMutex.Unlock()
+
+	var err error
+	select {
+	case <-s.drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.closeSessions(code)
+	}
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// closeSessions closes all sessions with an application error
+func (s *server) closeSessions(code ErrorCode) {
+	s.sessionsMutex.Lock()
+	sessions := make([]Session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.sessionsMutex.Unlock()
+
+	var wg sync.WaitGroup
+	for _, sess := range sessions {
+		wg.Add(1)
+		go func(sess Session) {
+			// CloseWithError blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
+			sess.CloseWithError(code, errServerShuttingDown.Error())
+			wg.Done()
+		}(sess)
+	}
+	wg.Wait()
+}
+
 // Close the server
 func (s *server) Close() error {
 	s.mutex.Lock()
@@ -388,6 +612,11 @@ func (s *server) handleInitialImpl(p *receivedPacket, hdr *wire.Header) (quicSes
 		return nil, nil, errors.New("too short connection ID")
 	}
 
+	if s.isShuttingDown() {
+		s.logger.Debugf("Rejecting new connection. Server is shutting down.")
+		return nil, nil, s.sendServerBusy(p, hdr)
+	}
+
 	var token *Token
 	var origDestConnectionID protocol.ConnectionID
 	if len(hdr.Token) > 0 {
@@ -401,25 +630,47 @@ func (s *server) handleInitialImpl(p *receivedPacket, hdr *wire.Header) (quicSes
 			origDestConnectionID = c.OriginalDestConnectionID
 		}
 	}
-	if !s.config.AcceptToken(p.remoteAddr, token) {
+	numHandshakes := s.numHandshakes()
+	// Only validate the client's address if enough handshakes are in progress.
+	if numHandshakes >= s.config.RetryThreshold && !s.config.AcceptToken(p.remoteAddr, token) {
 		// Log the Initial packet now.
 		// If no Retry is sent, the packet will be logged by the session.
 		(&wire.ExtendedHeader{Header: *hdr}).Log(s.logger)
-		return nil, nil, s.sendRetry(p.remoteAddr, hdr)
+		atomic.AddUint64(&s.retriesSent, 1)
+		return nil, nil, s.sendRetry(p, hdr)
 	}
 
-	if queueLen := atomic.LoadInt32(&s.sessionQueueLen); queueLen >= protocol.MaxAcceptQueueSize {
-		s.logger.Debugf("Rejecting new connection. Server currently busy. Accept queue length: %d (max %d)", queueLen, protocol.MaxAcceptQueueSize)
-		return nil, nil, s.sendServerBusy(p.remoteAddr, hdr)
+	switch s.handshakeRateLimiter.Allow(p.remoteAddr, p.rcvTime) {
+	case rateLimitedSource:
+		s.logger.Debugf("Dropping Initial from %s. Handshake rate limit for the source address reached.", p.remoteAddr)
+		atomic.AddUint64(&s.rejectedSourceRateLimit, 1)
+		return nil, nil, nil
+	case rateLimitedSubnet:
+		s.logger.Debugf("Dropping Initial from %s. Handshake rate limit for the subnet reached.", p.remoteAddr)
+		atomic.AddUint64(&s.rejectedSubnetRateLimit, 1)
+		return nil, nil, nil
 	}
 
-	connID, err := protocol.GenerateConnectionID(s.config.ConnectionIDLength)
+	if s.config.MaxHandshakes > 0 && numHandshakes >= s.config.MaxHandshakes {
+		s.logger.Debugf("Rejecting new connection. Server currently busy. Handshakes in progress: %d (max %d)", numHandshakes, s.config.MaxHandshakes)
+		atomic.AddUint64(&s.rejectedMaxHandshakes, 1)
+		return nil, nil, s.sendServerBusy(p, hdr)
+	}
+
+	if queueLen := atomic.LoadInt32(&s.sessionQueueLen); queueLen >= int32(s.config.MaxAcceptQueueSize) {
+		s.logger.Debugf("Rejecting new connection. Server currently busy. Accept queue length: %d (max %d)", queueLen, s.config.MaxAcceptQueueSize)
+		atomic.AddUint64(&s.rejectedAcceptQueueFull, 1)
+		return nil, nil, s.sendServerBusy(p, hdr)
+	}
+
+	connID, err := generateConnectionIDWith(s.config.ConnectionIDGenerator)
 	if err != nil {
 		return nil, nil, err
 	}
 	s.logger.Debugf("Changing connection ID to %s.", connID)
 	sess, err := s.createNewSession(
 		p.remoteAddr,
+		p.info,
 		origDestConnectionID,
 		hdr.DestConnectionID,
 		hdr.SrcConnectionID,
@@ -429,35 +680,71 @@ func (s *server) handleInitialImpl(p *receivedPacket, hdr *wire.Header) (quicSes
 	if err != nil {
 		return nil, nil, err
 	}
+	if sess == nil {
+		s.logger.Debugf("Rejecting new connection. Server is shutting down.")
+		return nil, nil, s.sendServerBusy(p, hdr)
+	}
 	sess.handlePacket(p)
+	if s.config.AcceptEarlySessions {
+		s.enqueueSession(sess)
+	}
 	return sess, connID, nil
 }
 
+// createNewSession creates a new session and starts its run loop.
+// It returns nil if the server is shutting down.
 func (s *server) createNewSession(
 	remoteAddr net.Addr,
+	info packetInfo,
 	origDestConnID protocol.ConnectionID,
 	clientDestConnID protocol.ConnectionID,
 	destConnID protocol.ConnectionID,
 	srcConnID protocol.ConnectionID,
 	version protocol.VersionNumber,
 ) (quicSession, error) {
+	// Shutdown might have been called after handleInitialImpl checked for it.
+	// Once all sessions have finished, Shutdown closes the server, so no new sessions must be added.
+	s.sessionsMutex.Lock()
+	if s.isShuttingDown() {
+		s.sessionsMutex.Unlock()
+		return nil, nil
+	}
+	s.sessionsInCreation++
+	s.sessionsMutex.Unlock()
+
 	token := s.sessionHandler.GetStatelessResetToken(srcConnID)
+	initialStreamReceiveWindow, initialConnectionReceiveWindow := getInitialReceiveWindows(s.config)
 	params := &handshake.TransportParameters{
-		InitialMaxStreamDataBidiLocal:  protocol.InitialMaxStreamData,
-		InitialMaxStreamDataBidiRemote: protocol.InitialMaxStreamData,
-		InitialMaxStreamDataUni:        protocol.InitialMaxStreamData,
-		InitialMaxData:                 protocol.InitialMaxData,
+		InitialMaxStreamDataBidiLocal:  protocol.ByteCount(initialStreamReceiveWindow),
+		InitialMaxStreamDataBidiRemote: protocol.ByteCount(initialStreamReceiveWindow),
+		InitialMaxStreamDataUni:        protocol.ByteCount(initialStreamReceiveWindow),
+		InitialMaxData:                 protocol.ByteCount(initialConnectionReceiveWindow),
 		IdleTimeout:                    s.config.IdleTimeout,
 		MaxBidiStreamNum:               protocol.StreamNum(s.config.MaxIncomingStreams),
 		MaxUniStreamNum:                protocol.StreamNum(s.config.MaxIncomingUniStreams),
 		MaxAckDelay:                    protocol.MaxAckDelayInclGranularity,
 		AckDelayExponent:               protocol.AckDelayExponent,
-		DisableMigration:               true,
+		ActiveConnectionIDLimit:        protocol.MaxActiveConnectionIDs,
+		MaxPacketSize:                  protocol.ByteCount(s.config.MaxPacketSize),
 		StatelessResetToken:            &token,
 		OriginalConnectionID:           origDestConnID,
+		InitialSourceConnectionID:      srcConnID,
+	}
+	if version.AuthenticatesConnectionIDs() {
+		if origDestConnID == nil {
+			// No Retry was performed.
+			params.OriginalConnectionID = clientDestConnID
+		} else {
+			// The client uses the source connection ID of our Retry packet.
+			retrySrcConnID := clientDestConnID
+			params.RetrySourceConnectionID = &retrySrcConnID
+		}
+	}
+	if s.config.EnableDatagrams {
+		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
 	}
 	sess, err := s.newSession(
-		&conn{pconn: s.conn, currentAddr: remoteAddr},
+		newConn(s.conn, remoteAddr, info),
 		s.sessionRunner,
 		clientDestConnID,
 		destConnID,
@@ -469,19 +756,71 @@ func (s *server) createNewSession(
 		s.logger,
 		version,
 	)
+	s.sessionsMutex.Lock()
+	defer s.sessionsMutex.Unlock()
+	s.sessionsInCreation--
 	if err != nil {
+		s.maybeSignalDrained()
 		return nil, err
 	}
-	go sess.run()
+	s.sessions[sess] = struct{}{}
+	s.handshakes[sess] = struct{}{}
+	go func() {
+		sess.run()
+		s.removeSession(sess)
+	}()
 	return sess, nil
 }
 
-func (s *server) sendRetry(remoteAddr net.Addr, hdr *wire.Header) error {
-	token, err := s.tokenGenerator.NewRetryToken(remoteAddr, hdr.DestConnectionID)
+func (s *server) removeSession(sess Session) {
+	s.sessionsMutex.Lock()
+	defer s.sessionsMutex.Unlock()
+	delete(s.sessions, sess)
+	// the session might have been closed before completing the handshake
+	delete(s.handshakes, sess)
+	s.maybeSignalDrained()
+}
+
+// maybeSignalDrained closes the drained channel when shutting down and all sessions have finished.
+// It must be called with the sessionsMutex held.
+func (s *server) maybeSignalDrained() {
+	if len(s.sessions) > 0 || s.sessionsInCreation > 0 || !s.isShuttingDown() {
+		return
+	}
+	select {
+	case <-s.drained:
+	default:
+		close(s.drained)
+	}
+}
+
+func (s *server) removeHandshake(sess Session) {
+	s.sessionsMutex.Lock()
+	delete(s.handshakes, sess)
+	s.sessionsMutex.Unlock()
+}
+
+func (s *server) numHandshakes() int {
+	s.sessionsMutex.Lock()
+	defer s.sessionsMutex.Unlock()
+	return len(s.handshakes)
+}
+
+func (s *server) isShuttingDown() bool {
+	select {
+	case <-s.shutdownChan:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *server) sendRetry(p *receivedPacket, hdr *wire.Header) error {
+	token, err := s.tokenGenerator.NewRetryToken(p.remoteAddr, hdr.DestConnectionID)
 	if err != nil {
 		return err
 	}
-	connID, err := protocol.GenerateConnectionID(s.config.ConnectionIDLength)
+	connID, err := generateConnectionIDWith(s.config.ConnectionIDGenerator)
 	if err != nil {
 		return err
 	}
@@ -499,14 +838,18 @@ func (s *server) sendRetry(remoteAddr net.Addr, hdr *wire.Header) error {
 	if err := replyHdr.Write(buf, hdr.Version); err != nil {
 		return err
 	}
-	if _, err := s.conn.WriteTo(buf.Bytes(), remoteAddr); err != nil {
+	if hdr.Version.UsesRetryIntegrityTag() {
+		tag := handshake.GetRetryIntegrityTag(buf.Bytes(), hdr.DestConnectionID)
+		buf.Write(tag[:])
+	}
+	if err := writePacket(s.conn, buf.Bytes(), p.remoteAddr, p.info.OOB()); err != nil {
 		s.logger.Debugf("Error sending Retry: %s", err)
 	}
 	return nil
 }
 
-func (s *server) sendServerBusy(remoteAddr net.Addr, hdr *wire.Header) error {
-	sealer, _, err := handshake.NewInitialAEAD(hdr.DestConnectionID, protocol.PerspectiveServer)
+func (s *server) sendServerBusy(p *receivedPacket, hdr *wire.Header) error {
+	sealer, _, err := handshake.NewInitialAEAD(hdr.DestConnectionID, protocol.PerspectiveServer, hdr.Version)
 	if err != nil {
 		return err
 	}
@@ -546,7 +889,7 @@ func (s *server) sendServerBusy(remoteAddr net.Addr, hdr *wire.Header) error {
 
 	replyHdr.Log(s.logger)
 	wire.LogFrame(s.logger, ccf, true)
-	if _, err := s.conn.WriteTo(raw, remoteAddr); err != nil {
+	if err := writePacket(s.conn, raw, p.remoteAddr, p.info.OOB()); err != nil {
 		s.logger.Debugf("Error rejecting connection: %s", err)
 	}
 	return nil
@@ -559,7 +902,7 @@ func (s *server) sendVersionNegotiationPacket(p *receivedPacket, hdr *wire.Heade
 		s.logger.Debugf("Error composing Version Negotiation: %s", err)
 		return
 	}
-	if _, err := s.conn.WriteTo(data, p.remoteAddr); err != nil {
+	if err := writePacket(s.conn, data, p.remoteAddr, p.info.OOB()); err != nil {
 		s.logger.Debugf("Error sending Version Negotiation: %s", err)
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"net"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/DrakenLibra/gt-bbr/internal/handshake"
@@ -15,11 +16,25 @@ import (
 	"github.com/DrakenLibra/gt-bbr/internal/testdata"
 	"github.com/DrakenLibra/gt-bbr/internal/utils"
 	"github.com/DrakenLibra/gt-bbr/internal/wire"
+	"github.com/golang/mock/gomock"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
+type mockTokenProtector struct {
+	called bool
+}
+
+func (p *mockTokenProtector) NewToken(data []byte) ([]byte, error) {
+	p.called = true
+	return data, nil
+}
+
+func (p *mockTokenProtector) DecodeToken(token []byte) ([]byte, error) {
+	return token, nil
+}
+
 var _ = Describe("Server", func() {
 	var (
 		conn    *mockPacketConn
@@ -31,7 +46,7 @@ var _ = Describe("Server", func() {
 		Expect((&wire.ExtendedHeader{
 			Header:          *hdr,
 			PacketNumberLen: protocol.PacketNumberLen3,
-		}).Write(buf, protocol.VersionTLS)).To(Succeed())
+		}).Write(buf, hdr.Version)).To(Succeed())
 		return &receivedPacket{
 			data:   append(buf.Bytes(), data...),
 			buffer: getPacketBuffer(),
@@ -79,6 +94,9 @@ var _ = Describe("Server", func() {
 		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
 		Expect(reflect.ValueOf(server.config.AcceptToken)).To(Equal(reflect.ValueOf(defaultAcceptToken)))
 		Expect(server.config.KeepAlive).To(BeFalse())
+		Expect(server.config.MaxPacketSize).To(BeEquivalentTo(protocol.MaxReceivePacketSize))
+		Expect(server.config.MaxAcceptQueueSize).To(Equal(protocol.DefaultMaxAcceptQueueSize))
+		Expect(server.config.AcceptEarlySessions).To(BeFalse())
 		// stop the listener
 		Expect(ln.Close()).To(Succeed())
 	})
@@ -93,6 +111,8 @@ var _ = Describe("Server", func() {
 			IdleTimeout:       42 * time.Minute,
 			KeepAlive:         true,
 			StatelessResetKey: []byte("foobar"),
+			KeyUpdateInterval: 1000,
+			MaxPacketSize:     9000,
 		}
 		ln, err := Listen(conn, tlsConf, &config)
 		Expect(err).ToNot(HaveOccurred())
@@ -104,10 +124,145 @@ var _ = Describe("Server", func() {
 		Expect(reflect.ValueOf(server.config.AcceptToken)).To(Equal(reflect.ValueOf(acceptToken)))
 		Expect(server.config.KeepAlive).To(BeTrue())
 		Expect(server.config.StatelessResetKey).To(Equal([]byte("foobar")))
+		Expect(server.config.KeyUpdateInterval).To(BeEquivalentTo(1000))
+		Expect(server.config.MaxPacketSize).To(BeEquivalentTo(9000))
 		// stop the listener
 		Expect(ln.Close()).To(Succeed())
 	})
 
+	It("uses the default initial flow control windows", func() {
+		streamWindow, connWindow := getInitialReceiveWindows(populateServerConfig(&Config{}))
+		Expect(streamWindow).To(BeEquivalentTo(protocol.InitialMaxStreamData))
+		Expect(connWindow).To(BeEquivalentTo(protocol.InitialMaxData))
+	})
+
+	It("doesn't use default initial flow control windows larger than the maximum windows", func() {
+		streamWindow, connWindow := getInitialReceiveWindows(populateServerConfig(&Config{
+			MaxReceiveStreamFlowControlWindow:     1000,
+			MaxReceiveConnectionFlowControlWindow: 2000,
+		}))
+		Expect(streamWindow).To(BeEquivalentTo(1000))
+		Expect(connWindow).To(BeEquivalentTo(2000))
+	})
+
+	It("uses the receive window auto-tuning options", func() {
+		config := populateServerConfig(&Config{})
+		Expect(config.EnableBDPAutoTuning).To(BeFalse())
+		Expect(config.BDPAutoTuningHeadroom).To(Equal(protocol.DefaultBDPAutoTuningHeadroom))
+		Expect(config.ReceiveWindowBudget).To(BeNil())
+		budget := NewReceiveWindowBudget(1 << 20)
+		config = populateServerConfig(&Config{
+			EnableBDPAutoTuning:   true,
+			BDPAutoTuningHeadroom: 3,
+			ReceiveWindowBudget:   budget,
+		})
+		Expect(config.EnableBDPAutoTuning).To(BeTrue())
+		Expect(config.BDPAutoTuningHeadroom).To(Equal(3.0))
+		Expect(config.ReceiveWindowBudget).To(BeIdenticalTo(budget))
+	})
+
+	It("errors when the initial flow control windows are larger than the maximum windows", func() {
+		_, err := Listen(conn, tlsConf, &Config{
+			InitialStreamReceiveWindow:        2000,
+			MaxReceiveStreamFlowControlWindow: 1000,
+		})
+		Expect(err).To(MatchError("quic: InitialStreamReceiveWindow (2000) larger than MaxReceiveStreamFlowControlWindow (1000)"))
+		_, err = Listen(conn, tlsConf, &Config{
+			InitialConnectionReceiveWindow:        2000,
+			MaxReceiveConnectionFlowControlWindow: 1000,
+		})
+		Expect(err).To(MatchError("quic: InitialConnectionReceiveWindow (2000) larger than MaxReceiveConnectionFlowControlWindow (1000)"))
+	})
+
+	It("errors when the connection ID length is invalid", func() {
+		_, err := Listen(conn, tlsConf, &Config{
+			Versions:              []protocol.VersionNumber{protocol.VersionDraft29},
+			ConnectionIDGenerator: &protocol.DefaultConnectionIDGenerator{ConnLen: 0},
+		})
+		Expect(err).To(MatchError("quic: invalid connection ID length: 0 (must be between 4 and 20 bytes)"))
+		_, err = Listen(conn, tlsConf, &Config{
+			Versions:           []protocol.VersionNumber{protocol.VersionDraft29, protocol.VersionTLS},
+			ConnectionIDLength: 20,
+		})
+		Expect(err).To(MatchError("quic: invalid connection ID length: 20 (must be between 4 and 18 bytes)"))
+	})
+
+	It("uses the length of the connection IDs generated by the ConnectionIDGenerator", func() {
+		config := populateServerConfig(&Config{
+			ConnectionIDLength:    8,
+			ConnectionIDGenerator: &protocol.DefaultConnectionIDGenerator{ConnLen: 6},
+		})
+		Expect(config.ConnectionIDLength).To(Equal(6))
+	})
+
+	Context("token keys", func() {
+		key := func(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+
+		listen := func(config *Config) *server {
+			conn := newMockPacketConn()
+			conn.addr = &net.UDPAddr{}
+			ln, err := Listen(conn, tlsConf, config)
+			Expect(err).ToNot(HaveOccurred())
+			return ln.(*server)
+		}
+
+		It("accepts tokens issued by a different server using the same key", func() {
+			s1 := listen(&Config{TokenKey: key(1)})
+			defer s1.Close()
+			s2 := listen(&Config{TokenKey: key(1)})
+			defer s2.Close()
+			token, err := s1.tokenGenerator.NewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337})
+			Expect(err).ToNot(HaveOccurred())
+			t, err := s2.tokenGenerator.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t.RemoteAddr).To(Equal("192.168.0.1"))
+		})
+
+		It("accepts tokens issued using a previous key", func() {
+			s1 := listen(&Config{TokenKey: key(1)})
+			defer s1.Close()
+			s2 := listen(&Config{TokenKey: key(2), PreviousTokenKeys: [][]byte{key(1)}})
+			defer s2.Close()
+			token, err := s1.tokenGenerator.NewRetryToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}, protocol.ConnectionID{1, 2, 3, 4})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = s2.tokenGenerator.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			// tokens issued with the new key are rejected by servers using the old key
+			token, err = s2.tokenGenerator.NewRetryToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}, protocol.ConnectionID{1, 2, 3, 4})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = s1.tokenGenerator.DecodeToken(token)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("rejects tokens issued by a server using a random key", func() {
+			s1 := listen(&Config{})
+			defer s1.Close()
+			s2 := listen(&Config{})
+			defer s2.Close()
+			token, err := s1.tokenGenerator.NewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = s2.tokenGenerator.DecodeToken(token)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("uses the TokenProtector", func() {
+			tp := &mockTokenProtector{}
+			s := listen(&Config{TokenKey: key(1), TokenProtector: tp})
+			defer s.Close()
+			token, err := s.tokenGenerator.NewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tp.called).To(BeTrue())
+			t, err := s.tokenGenerator.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t.RemoteAddr).To(Equal("192.168.0.1"))
+		})
+
+		It("errors when the token key is too short", func() {
+			_, err := Listen(newMockPacketConn(), tlsConf, &Config{TokenKey: []byte("foobar")})
+			Expect(err).To(MatchError("token key too short: 6 bytes (expected at least 32 bytes)"))
+		})
+	})
+
 	It("listens on a given address", func() {
 		addr := "127.0.0.1:13579"
 		ln, err := ListenAddr(addr, tlsConf, &Config{})
@@ -280,6 +435,29 @@ var _ = Describe("Server", func() {
 			Expect(replyHdr.Token).ToNot(BeEmpty())
 		})
 
+		It("replies with a Retry packet that ends with a Retry Integrity Tag, for draft-29", func() {
+			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return false }
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionDraft29,
+			}
+			packet := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			packet.remoteAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+			serv.handlePacket(packet)
+			var write mockPacketConnWrite
+			Eventually(conn.dataWritten).Should(Receive(&write))
+			replyHdr := parseHeader(write.data)
+			Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+			Expect(replyHdr.DestConnectionID).To(Equal(hdr.SrcConnectionID))
+			Expect(replyHdr.Token).ToNot(BeEmpty())
+			tagStart := len(write.data) - 16
+			tag := handshake.GetRetryIntegrityTag(write.data[:tagStart], hdr.DestConnectionID)
+			Expect(write.data[tagStart:]).To(Equal(tag[:]))
+		})
+
 		It("creates a session, if no Token is required", func() {
 			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
 			hdr := &wire.Header{
@@ -328,6 +506,155 @@ var _ = Describe("Server", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("advertises the initial flow control windows", func() {
+			serv.config.InitialStreamReceiveWindow = 1 << 20
+			serv.config.InitialConnectionReceiveWindow = 3 << 20
+			var params *handshake.TransportParameters
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				p *handshake.TransportParameters,
+				_ *handshake.TokenGenerator,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				params = p
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().run().MaxTimes(1)
+				return sess, nil
+			}
+			_, err := serv.createNewSession(&net.UDPAddr{}, packetInfo{}, nil, nil, nil, nil, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(params.InitialMaxStreamDataBidiLocal).To(Equal(protocol.ByteCount(1 << 20)))
+			Expect(params.InitialMaxStreamDataBidiRemote).To(Equal(protocol.ByteCount(1 << 20)))
+			Expect(params.InitialMaxStreamDataUni).To(Equal(protocol.ByteCount(1 << 20)))
+			Expect(params.InitialMaxData).To(Equal(protocol.ByteCount(3 << 20)))
+		})
+
+		Context("authenticating the connection IDs, for draft-29", func() {
+			var params *handshake.TransportParameters
+
+			BeforeEach(func() {
+				serv.newSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					p *handshake.TransportParameters,
+					_ *handshake.TokenGenerator,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					params = p
+					sess := NewMockQuicSession(mockCtrl)
+					sess.EXPECT().run().MaxTimes(1)
+					return sess, nil
+				}
+			})
+
+			It("sends the connection IDs, if no Retry was performed", func() {
+				clientDestConnID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+				srcConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+				_, err := serv.createNewSession(&net.UDPAddr{}, packetInfo{}, nil, clientDestConnID, protocol.ConnectionID{5, 4, 3, 2, 1}, srcConnID, protocol.VersionDraft29)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.OriginalConnectionID).To(Equal(clientDestConnID))
+				Expect(params.InitialSourceConnectionID).To(Equal(srcConnID))
+				Expect(params.RetrySourceConnectionID).To(BeNil())
+			})
+
+			It("sends the connection IDs, if a Retry was performed", func() {
+				origDestConnID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+				clientDestConnID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+				srcConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+				_, err := serv.createNewSession(&net.UDPAddr{}, packetInfo{}, origDestConnID, clientDestConnID, protocol.ConnectionID{5, 4, 3, 2, 1}, srcConnID, protocol.VersionDraft29)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.OriginalConnectionID).To(Equal(origDestConnID))
+				Expect(params.InitialSourceConnectionID).To(Equal(srcConnID))
+				Expect(params.RetrySourceConnectionID).To(Equal(&clientDestConnID))
+			})
+		})
+
+		It("uses the ConnectionIDGenerator for new sessions", func() {
+			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+			serv.config.ConnectionIDGenerator = &protocol.DefaultConnectionIDGenerator{ConnLen: 11}
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			run := make(chan struct{})
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				srcConnID protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ *handshake.TokenGenerator,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				Expect(srcConnID.Len()).To(Equal(11))
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(p)
+				sess.EXPECT().run().Do(func() { close(run) })
+				return sess, nil
+			}
+			_, connID, err := serv.handleInitialImpl(p, hdr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID.Len()).To(Equal(11))
+			Eventually(run).Should(BeClosed())
+		})
+
+		It("sends packets from the local address that the Initial was received on", func() {
+			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			p.info = packetInfo{addr: net.IPv4(192, 168, 1, 2), ifIndex: 3}
+			run := make(chan struct{})
+			serv.newSession = func(
+				c connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ *handshake.TokenGenerator,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				Expect(c.LocalAddr()).To(Equal(&net.UDPAddr{IP: p.info.addr}))
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(p)
+				sess.EXPECT().run().Do(func() { close(run) })
+				return sess, nil
+			}
+			_, _, err := serv.handleInitialImpl(p, hdr)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(run).Should(BeClosed())
+		})
+
 		It("rejects new connection attempts if the accept queue is full", func() {
 			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
 			senderAddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}
@@ -363,8 +690,8 @@ var _ = Describe("Server", func() {
 			}
 
 			var wg sync.WaitGroup
-			wg.Add(protocol.MaxAcceptQueueSize)
-			for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+			wg.Add(protocol.DefaultMaxAcceptQueueSize)
+			for i := 0; i < protocol.DefaultMaxAcceptQueueSize; i++ {
 				go func() {
 					defer GinkgoRecover()
 					defer wg.Done()
@@ -384,6 +711,130 @@ var _ = Describe("Server", func() {
 			Expect(rejectHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
 		})
 
+		Context("admission control", func() {
+			var (
+				hdr        *wire.Header
+				sessRun    chan struct{} // closed to make the run loop of the sessions return
+				numCreated int32
+			)
+
+			getInitial := func(remoteAddr net.Addr) *receivedPacket {
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = remoteAddr
+				p.rcvTime = time.Now()
+				return p
+			}
+
+			BeforeEach(func() {
+				hdr = &wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+					Version:          protocol.VersionTLS,
+				}
+				sessRun = make(chan struct{})
+				numCreated = 0
+				serv.newSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TransportParameters,
+					_ *handshake.TokenGenerator,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					atomic.AddInt32(&numCreated, 1)
+					sess := NewMockQuicSession(mockCtrl)
+					sess.EXPECT().handlePacket(gomock.Any())
+					sess.EXPECT().run().Do(func() { <-sessRun })
+					return sess, nil
+				}
+			})
+
+			AfterEach(func() {
+				close(sessRun)
+				Eventually(func() int { return serv.Stats().HandshakesInProgress }).Should(BeZero())
+			})
+
+			It("counts the handshakes in progress", func() {
+				serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+				sess, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				_, _, err = serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 43}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.Stats().HandshakesInProgress).To(Equal(2))
+				sess.(*MockQuicSession).EXPECT().Context().Return(context.Background()).AnyTimes()
+				serv.sessionRunner.OnHandshakeComplete(sess)
+				Expect(serv.Stats().HandshakesInProgress).To(Equal(1))
+			})
+
+			It("only sends a Retry when the number of handshakes exceeds the RetryThreshold", func() {
+				serv.config.RetryThreshold = 1
+				serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return false }
+				sess, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).ToNot(BeNil())
+				Expect(serv.Stats().RetriesSent).To(BeZero())
+				sess, _, err = serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 43}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).To(BeNil())
+				var write mockPacketConnWrite
+				Expect(conn.dataWritten).To(Receive(&write))
+				Expect(parseHeader(write.data).Type).To(Equal(protocol.PacketTypeRetry))
+				Expect(serv.Stats().RetriesSent).To(BeEquivalentTo(1))
+				Expect(atomic.LoadInt32(&numCreated)).To(BeEquivalentTo(1))
+			})
+
+			It("rejects connection attempts when MaxHandshakes handshakes are in progress", func() {
+				serv.config.MaxHandshakes = 1
+				serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+				_, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				sess, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 43}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).To(BeNil())
+				var reject mockPacketConnWrite
+				Expect(conn.dataWritten).To(Receive(&reject))
+				Expect(parseHeader(reject.data).Type).To(Equal(protocol.PacketTypeInitial))
+				Expect(serv.Stats().RejectedMaxHandshakes).To(BeEquivalentTo(1))
+				Expect(atomic.LoadInt32(&numCreated)).To(BeEquivalentTo(1))
+			})
+
+			It("drops connection attempts exceeding the per-source rate limit", func() {
+				serv.handshakeRateLimiter = newHandshakeRateLimiter(1, 0)
+				serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+				_, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				sess, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 43}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).To(BeNil())
+				// a different IP address
+				_, _, err = serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 5), Port: 42}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.dataWritten).ToNot(Receive())
+				Expect(serv.Stats().RejectedSourceRateLimit).To(BeEquivalentTo(1))
+				Expect(atomic.LoadInt32(&numCreated)).To(BeEquivalentTo(2))
+			})
+
+			It("drops connection attempts exceeding the per-subnet rate limit", func() {
+				serv.handshakeRateLimiter = newHandshakeRateLimiter(0, 1)
+				serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+				_, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				sess, _, err := serv.handleInitialImpl(getInitial(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 5), Port: 42}), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).To(BeNil())
+				Expect(conn.dataWritten).ToNot(Receive())
+				Expect(serv.Stats().RejectedSubnetRateLimit).To(BeEquivalentTo(1))
+				Expect(atomic.LoadInt32(&numCreated)).To(BeEquivalentTo(1))
+			})
+		})
+
 		It("doesn't accept new sessions if they were closed in the mean time", func() {
 			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
 			senderAddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}
@@ -509,13 +960,117 @@ var _ = Describe("Server", func() {
 				sess.EXPECT().Context().Return(context.Background())
 				return sess, nil
 			}
-			_, err := serv.createNewSession(&net.UDPAddr{}, nil, nil, nil, nil, protocol.VersionWhatever)
+			_, err := serv.createNewSession(&net.UDPAddr{}, packetInfo{}, nil, nil, nil, nil, protocol.VersionWhatever)
 			Expect(err).ToNot(HaveOccurred())
 			Consistently(done).ShouldNot(BeClosed())
 			close(completeHandshake)
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("returns AcceptContext when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := serv.AcceptContext(ctx)
+				Expect(err).To(MatchError(context.Canceled))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("accepts new sessions before the handshake completes, if configured", func() {
+			serv.config.AcceptEarlySessions = true
+			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+			sess := NewMockQuicSession(mockCtrl)
+			run := make(chan struct{})
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ *handshake.TokenGenerator,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				sess.EXPECT().handlePacket(gomock.Any())
+				sess.EXPECT().run().Do(func() { close(run) })
+				sess.EXPECT().Context().Return(context.Background())
+				return sess, nil
+			}
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			_, _, err := serv.handleInitialImpl(getPacket(hdr, make([]byte, protocol.MinInitialPacketSize)), hdr)
+			Expect(err).ToNot(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			s, err := serv.AcceptContext(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(sess))
+			Eventually(run).Should(BeClosed())
+		})
+
+		It("uses the configured accept queue size", func() {
+			serv.config.MaxAcceptQueueSize = 2
+			serv.config.AcceptToken = func(_ net.Addr, _ *Token) bool { return true }
+			runs := make(chan struct{}, 3)
+			serv.newSession = func(
+				_ connection,
+				runner sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ *handshake.TokenGenerator,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(gomock.Any())
+				sess.EXPECT().run().Do(func() { runs <- struct{}{} })
+				sess.EXPECT().Context().Return(context.Background())
+				runner.OnHandshakeComplete(sess)
+				return sess, nil
+			}
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			for i := 0; i < 2; i++ {
+				sess, _, err := serv.handleInitialImpl(getPacket(hdr, make([]byte, protocol.MinInitialPacketSize)), hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).ToNot(BeNil())
+			}
+			sess, _, err := serv.handleInitialImpl(getPacket(hdr, make([]byte, protocol.MinInitialPacketSize)), hdr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess).To(BeNil())
+			Eventually(conn.dataWritten).Should(Receive())
+			Expect(serv.Stats().RejectedAcceptQueueFull).To(BeEquivalentTo(1))
+			// accepting a session makes space in the queue
+			_, err = serv.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			sess, _, err = serv.handleInitialImpl(getPacket(hdr, make([]byte, protocol.MinInitialPacketSize)), hdr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess).ToNot(BeNil())
+			Eventually(runs).Should(HaveLen(3))
+		})
+
 		It("never blocks when calling the onHandshakeComplete callback", func() {
 			const num = 50
 
@@ -543,7 +1098,7 @@ var _ = Describe("Server", func() {
 
 			go func() {
 				for i := 0; i < num; i++ {
-					_, err := serv.createNewSession(&net.UDPAddr{}, nil, nil, nil, nil, protocol.VersionWhatever)
+					_, err := serv.createNewSession(&net.UDPAddr{}, packetInfo{}, nil, nil, nil, nil, protocol.VersionWhatever)
 					Expect(err).ToNot(HaveOccurred())
 				}
 			}()
@@ -553,6 +1108,219 @@ var _ = Describe("Server", func() {
 	})
 })
 
+var _ = Describe("Server shutdown", func() {
+	var (
+		serv *server
+		conn *mockPacketConn
+	)
+
+	BeforeEach(func() {
+		conn = newMockPacketConn()
+		conn.addr = &net.UDPAddr{}
+		tlsConf := testdata.GetTLSConfig()
+		tlsConf.NextProtos = []string{"proto1"}
+		ln, err := Listen(conn, tlsConf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		serv = ln.(*server)
+	})
+
+	AfterEach(func() {
+		Expect(serv.Close()).To(Succeed())
+	})
+
+	// newSession sets up the server to create sessions whose run loop returns when run is closed
+	newSession := func(onHandshakeComplete bool) (*MockQuicSession, chan struct{}) {
+		sess := NewMockQuicSession(mockCtrl)
+		run := make(chan struct{})
+		serv.newSession = func(
+			_ connection,
+			runner sessionRunner,
+			_ protocol.ConnectionID,
+			_ protocol.ConnectionID,
+			_ protocol.ConnectionID,
+			_ *Config,
+			_ *tls.Config,
+			_ *handshake.TransportParameters,
+			_ *handshake.TokenGenerator,
+			_ utils.Logger,
+			_ protocol.VersionNumber,
+		) (quicSession, error) {
+			sess.EXPECT().run().Do(func() { <-run })
+			if onHandshakeComplete {
+				sess.EXPECT().Context().Return(context.Background())
+				runner.OnHandshakeComplete(sess)
+			}
+			return sess, nil
+		}
+		_, err := serv.createNewSession(&net.UDPAddr{}, packetInfo{}, nil, nil, nil, nil, protocol.VersionWhatever)
+		Expect(err).ToNot(HaveOccurred())
+		return sess, run
+	}
+
+	It("shuts down immediately if there are no sessions", func() {
+		Expect(serv.Shutdown(context.Background(), 42)).To(Succeed())
+		_, err := serv.Accept()
+		Expect(err).To(MatchError("server closed"))
+	})
+
+	It("rejects new connection attempts while shutting down", func() {
+		_, run := newSession(false)
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(serv.Shutdown(context.Background(), 42)).To(Succeed())
+			close(done)
+		}()
+		Eventually(serv.isShuttingDown).Should(BeTrue())
+		hdr := &wire.Header{
+			IsLongHeader:     true,
+			Type:             protocol.PacketTypeInitial,
+			SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+			DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			Version:          protocol.VersionTLS,
+		}
+		buf := &bytes.Buffer{}
+		Expect((&wire.ExtendedHeader{Header: *hdr, PacketNumberLen: protocol.PacketNumberLen3}).Write(buf, protocol.VersionTLS)).To(Succeed())
+		p := &receivedPacket{
+			remoteAddr: &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42},
+			data:       append(buf.Bytes(), make([]byte, protocol.MinInitialPacketSize)...),
+			buffer:     getPacketBuffer(),
+		}
+		sess, _, err := serv.handleInitialImpl(p, hdr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess).To(BeNil())
+		var reject mockPacketConnWrite
+		Expect(conn.dataWritten).To(Receive(&reject))
+		replyHdr, _, _, err := wire.ParsePacket(reject.data, 0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replyHdr.Type).To(Equal(protocol.PacketTypeInitial))
+		close(run)
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("doesn't create a session when shutting down while handling an Initial", func() {
+		serv.newSession = func(
+			_ connection,
+			_ sessionRunner,
+			_ protocol.ConnectionID,
+			_ protocol.ConnectionID,
+			_ protocol.ConnectionID,
+			_ *Config,
+			_ *tls.Config,
+			_ *handshake.TransportParameters,
+			_ *handshake.TokenGenerator,
+			_ utils.Logger,
+			_ protocol.VersionNumber,
+		) (quicSession, error) {
+			Fail("shouldn't create a session")
+			return nil, nil
+		}
+		// Shutdown is called after handleInitialImpl checked if the server is shutting down
+		Expect(serv.Shutdown(context.Background(), 42)).To(Succeed())
+		sess, err := serv.createNewSession(
+			&net.UDPAddr{},
+			packetInfo{},
+			nil,
+			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+			protocol.ConnectionID{8, 7, 6, 5},
+			protocol.ConnectionID{1, 2, 3, 4},
+			protocol.VersionTLS,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess).To(BeNil())
+		Expect(serv.sessions).To(BeEmpty())
+	})
+
+	It("waits for sessions that are being created when shutting down", func() {
+		run := make(chan struct{})
+		done := make(chan struct{})
+		serv.newSession = func(
+			_ connection,
+			_ sessionRunner,
+			_ protocol.ConnectionID,
+			_ protocol.ConnectionID,
+			_ protocol.ConnectionID,
+			_ *Config,
+			_ *tls.Config,
+			_ *handshake.TransportParameters,
+			_ *handshake.TokenGenerator,
+			_ utils.Logger,
+			_ protocol.VersionNumber,
+		) (quicSession, error) {
+			go func() {
+				defer GinkgoRecover()
+				Expect(serv.Shutdown(context.Background(), 42)).To(Succeed())
+				close(done)
+			}()
+			Eventually(serv.isShuttingDown).Should(BeTrue())
+			sess := NewMockQuicSession(mockCtrl)
+			sess.EXPECT().run().Do(func() { <-run })
+			return sess, nil
+		}
+		sess, err := serv.createNewSession(
+			&net.UDPAddr{},
+			packetInfo{},
+			nil,
+			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+			protocol.ConnectionID{8, 7, 6, 5},
+			protocol.ConnectionID{1, 2, 3, 4},
+			protocol.VersionTLS,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess).ToNot(BeNil())
+		// the session's run loop hasn't returned yet
+		Expect(done).ToNot(BeClosed())
+		close(run)
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("waits for sessions to finish", func() {
+		_, run := newSession(false)
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(serv.Shutdown(context.Background(), 42)).To(Succeed())
+			close(done)
+		}()
+		Eventually(serv.isShuttingDown).Should(BeTrue())
+		_, err := serv.Accept()
+		Expect(err).To(MatchError(errServerShuttingDown))
+		// the session's run loop hasn't returned yet
+		Expect(done).ToNot(BeClosed())
+		close(run)
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("closes sessions that were not accepted yet", func() {
+		sess, run := newSession(true)
+		closed := make(chan struct{})
+		sess.EXPECT().CloseWithError(ErrorCode(42), "server shutting down").Do(func(ErrorCode, string) {
+			close(run)
+			close(closed)
+		})
+		Expect(serv.Shutdown(context.Background(), 42)).To(Succeed())
+		Expect(closed).To(BeClosed())
+	})
+
+	It("closes the remaining sessions when the context is done", func() {
+		sess, run := newSession(false)
+		sess.EXPECT().CloseWithError(ErrorCode(1337), "server shutting down").Do(func(ErrorCode, string) { close(run) })
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			Expect(serv.Shutdown(ctx, 1337)).To(MatchError(context.Canceled))
+			close(done)
+		}()
+		Eventually(serv.isShuttingDown).Should(BeTrue())
+		Expect(done).ToNot(BeClosed())
+		cancel()
+		Eventually(done).Should(BeClosed())
+		_, err := serv.Accept()
+		Expect(err).To(MatchError("server closed"))
+	})
+})
+
 var _ = Describe("default source address verification", func() {
 	It("accepts a token", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
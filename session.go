@@ -3,6 +3,7 @@ package quic
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -23,7 +24,7 @@ import (
 )
 
 type unpacker interface {
-	Unpack(hdr *wire.Header, data []byte) (*unpackedPacket, error)
+	Unpack(hdr *wire.Header, rcvTime time.Time, data []byte) (*unpackedPacket, error)
 }
 
 type streamGetter interface {
@@ -43,6 +44,9 @@ type streamManager interface {
 	DeleteStream(protocol.StreamID) error
 	UpdateLimits(*handshake.TransportParameters) error
 	HandleMaxStreamsFrame(*wire.MaxStreamsFrame) error
+	SetMaxIncomingStreams(uint64)
+	SetMaxIncomingUniStreams(uint64)
+	ResetIncomingStreamLimits(maxIncomingBidiStreams, maxIncomingUniStreams uint64)
 	CloseWithError(error)
 }
 
@@ -50,12 +54,16 @@ type cryptoStreamHandler interface {
 	RunHandshake()
 	ChangeConnectionID(protocol.ConnectionID) error
 	Received1RTTAck()
+	SetLargest1RTTAcked(protocol.PacketNumber) error
 	io.Closer
 	ConnectionState() tls.ConnectionState
+	ClientHelloInfo() *tls.ClientHelloInfo
+	SetTransportParameters(*handshake.TransportParameters)
 }
 
 type receivedPacket struct {
 	remoteAddr net.Addr
+	info       packetInfo // the local address the packet was received on, if known
 	rcvTime    time.Time
 	data       []byte
 
@@ -65,6 +73,7 @@ type receivedPacket struct {
 func (p *receivedPacket) Clone() *receivedPacket {
 	return &receivedPacket{
 		remoteAddr: p.remoteAddr,
+		info:       p.info,
 		rcvTime:    p.rcvTime,
 		data:       p.data,
 		buffer:     p.buffer,
@@ -91,12 +100,34 @@ type closeError struct {
 
 var errCloseForRecreating = errors.New("closing session in order to recreate it")
 
+// A packetConnMigrator passes packets received on a new net.PacketConn to a session.
+// It is implemented by the sessionRunner of client sessions.
+type packetConnMigrator interface {
+	// AddPacketConn starts passing packets received on the net.PacketConn to the session.
+	AddPacketConn(net.PacketConn) error
+	// RemovePacketConn is called when migrating to the net.PacketConn failed.
+	RemovePacketConn(net.PacketConn)
+	// SwitchPacketConn is called when the session migrated to the net.PacketConn.
+	// Packets received on the old net.PacketConn aren't passed to the session any more.
+	SwitchPacketConn(net.PacketConn)
+}
+
+// A localMigration is a migration to a new net.PacketConn, initiated by the client.
+type localMigration struct {
+	pconn     net.PacketConn
+	oldPconn  net.PacketConn
+	challenge [8]byte
+	deadline  time.Time
+	result    chan error
+}
+
 // A Session is a QUIC session
 type session struct {
 	sessionRunner sessionRunner
 
 	destConnID     protocol.ConnectionID
-	origDestConnID protocol.ConnectionID // if the server sends a Retry, this is the connection ID we used initially
+	origDestConnID protocol.ConnectionID // the destination connection ID used on the first Initial packet, only set for clients
+	retrySrcConnID protocol.ConnectionID // the source connection ID of the Retry packet, if the server sent a Retry
 	srcConnID      protocol.ConnectionID
 
 	perspective    protocol.Perspective
@@ -105,6 +136,11 @@ type session struct {
 	config         *Config
 
 	conn connection
+	// Packets sent during one call to sendPackets are collected,
+	// and then written to the connection at once.
+	batchPackets bool
+	packetBatch  []*packedPacket
+	rawBatch     [][]byte
 
 	streamsMap streamManager
 
@@ -115,8 +151,15 @@ type session struct {
 	receivedPacketHandler ackhandler.ReceivedPacketHandler
 	framer                framer
 	windowUpdateQueue     *windowUpdateQueue
+	datagramQueue         *datagramQueue // nil if DATAGRAM frames are not enabled
 	connFlowController    flowcontrol.ConnectionFlowController
+	receiveMemory         *flowcontrol.WindowBudget // nil if no ReceiveWindowBudget is configured
 	tokenGenerator        *handshake.TokenGenerator // only set for the server
+	tokenStoreKey         string                    // only set for the client
+	pathValidator         *pathValidator
+	mtuDiscoverer         *mtuDiscoverer // nil if path MTU discovery is disabled, or before the handshake completes
+	connIDManager         *connIDManager
+	connIDGenerator       *connIDGenerator
 
 	unpacker    unpacker
 	frameParser wire.FrameParser
@@ -127,6 +170,9 @@ type session struct {
 	receivedPackets  chan *receivedPacket
 	sendingScheduled chan struct{}
 
+	migrationChan  chan *localMigration
+	localMigration *localMigration // the migration that is currently being validated
+
 	closeOnce sync.Once
 	closed    utils.AtomicBool
 	// closeChan is used to notify the run loop that it should terminate
@@ -137,6 +183,9 @@ type session struct {
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 
+	handshakeCtx       context.Context
+	handshakeCtxCancel context.CancelFunc
+
 	undecryptablePackets []*receivedPacket
 
 	clientHelloWritten    <-chan struct{}
@@ -145,6 +194,9 @@ type session struct {
 
 	receivedRetry       bool
 	receivedFirstPacket bool
+	// the largest packet number of all 1-RTT packets received
+	// Only a packet with a new largest packet number can cause a connection migration.
+	largestRcvdAppDataPacket protocol.PacketNumber
 
 	sessionCreationTime time.Time
 	// The idle timeout is set based on the max of the time we received the last packet...
@@ -155,6 +207,8 @@ type session struct {
 	pacingDeadline time.Time
 
 	peerParams *handshake.TransportParameters
+	// only used by the server, to apply the Config returned by Config.GetConfigForClient
+	ourParams *handshake.TransportParameters
 
 	timer *utils.Timer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
@@ -188,15 +242,17 @@ var newSession = func(
 		destConnID:            destConnID,
 		tokenGenerator:        tokenGenerator,
 		perspective:           protocol.PerspectiveServer,
+		ourParams:             params,
 		handshakeCompleteChan: make(chan struct{}),
 		logger:                logger,
 		version:               v,
 	}
 	s.preSetup()
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(0, s.rttStats, s.logger)
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(0, s.rttStats, s.config.CongestionControl, s.onFrameAcked, s.logger)
 	s.streamsMap = newStreamsMap(
 		s,
 		s.newFlowController,
+		s.receiveMemory,
 		uint64(s.config.MaxIncomingStreams),
 		uint64(s.config.MaxIncomingUniStreams),
 		s.perspective,
@@ -220,7 +276,10 @@ var newSession = func(
 			onHandshakeComplete: func() { close(s.handshakeCompleteChan) },
 		},
 		tlsConf,
+		s.rttStats,
+		s.config.KeyUpdateInterval,
 		logger,
+		s.version,
 	)
 	if err != nil {
 		return nil, err
@@ -236,6 +295,7 @@ var newSession = func(
 		cs,
 		s.framer,
 		s.receivedPacketHandler,
+		s.datagramQueue,
 		s.perspective,
 		s.version,
 	)
@@ -268,6 +328,7 @@ var newClientSession = func(
 		config:                conf,
 		srcConnID:             srcConnID,
 		destConnID:            destConnID,
+		origDestConnID:        destConnID,
 		perspective:           protocol.PerspectiveClient,
 		handshakeCompleteChan: make(chan struct{}),
 		logger:                logger,
@@ -275,7 +336,7 @@ var newClientSession = func(
 		version:               v,
 	}
 	s.preSetup()
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(initialPacketNumber, s.rttStats, s.logger)
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(initialPacketNumber, s.rttStats, s.config.CongestionControl, s.onFrameAcked, s.logger)
 	initialStream := newCryptoStream()
 	handshakeStream := newCryptoStream()
 	oneRTTStream := newPostHandshakeCryptoStream(s.framer)
@@ -293,7 +354,10 @@ var newClientSession = func(
 			onHandshakeComplete: func() { close(s.handshakeCompleteChan) },
 		},
 		tlsConf,
+		s.rttStats,
+		s.config.KeyUpdateInterval,
 		logger,
+		s.version,
 	)
 	if err != nil {
 		return nil, err
@@ -305,6 +369,7 @@ var newClientSession = func(
 	s.streamsMap = newStreamsMap(
 		s,
 		s.newFlowController,
+		s.receiveMemory,
 		uint64(s.config.MaxIncomingStreams),
 		uint64(s.config.MaxIncomingUniStreams),
 		s.perspective,
@@ -321,23 +386,55 @@ var newClientSession = func(
 		cs,
 		s.framer,
 		s.receivedPacketHandler,
+		s.datagramQueue,
 		s.perspective,
 		s.version,
 	)
+	if tlsConf != nil {
+		s.tokenStoreKey = tlsConf.ServerName
+	}
+	if len(s.tokenStoreKey) == 0 {
+		s.tokenStoreKey = conn.RemoteAddr().String()
+	}
+	if s.config.TokenStore != nil {
+		if token := s.config.TokenStore.Pop(s.tokenStoreKey); token != nil {
+			s.packer.SetToken(token.data)
+		}
+	}
 	return s, s.postSetup()
 }
 
 func (s *session) preSetup() {
-	s.frameParser = wire.NewFrameParser(s.version)
+	s.frameParser = wire.NewFrameParser(s.config.EnableDatagrams, s.version)
 	s.rttStats = &congestion.RTTStats{}
-	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.logger, s.version)
-	s.connFlowController = flowcontrol.NewConnectionFlowController(
-		protocol.InitialMaxData,
-		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
-		s.onHasConnectionWindowUpdate,
-		s.rttStats,
-		s.logger,
+	s.pathValidator = newPathValidator()
+	s.largestRcvdAppDataPacket = protocol.InvalidPacketNumber
+	s.migrationChan = make(chan *localMigration)
+	s.connIDManager = newConnIDManager(
+		s.destConnID,
+		func(token [16]byte) { s.sessionRunner.AddResetToken(token, s) },
+		func(token [16]byte) { s.sessionRunner.RemoveResetToken(token) },
+		func(connID protocol.ConnectionID) { s.packer.ChangeDestConnectionID(connID) },
+		s.queueControlFrame,
+	)
+	s.connIDGenerator = newConnIDGenerator(
+		s.srcConnID,
+		s.config.ConnectionIDGenerator,
+		func(connID protocol.ConnectionID) [16]byte {
+			s.sessionRunner.Add(connID, s)
+			return s.sessionRunner.GetStatelessResetToken(connID)
+		},
+		func(connID protocol.ConnectionID) { s.sessionRunner.Retire(connID) },
+		s.queueControlFrame,
 	)
+	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.logger, s.version)
+	if s.config.ReceiveWindowBudget != nil {
+		s.receiveMemory = s.config.ReceiveWindowBudget.budget.NewChild()
+	}
+	s.connFlowController = s.newConnectionFlowController()
+	if s.config.EnableDatagrams {
+		s.datagramQueue = newDatagramQueue(s.scheduleSending, s.logger)
+	}
 }
 
 func (s *session) postSetup() error {
@@ -346,6 +443,7 @@ func (s *session) postSetup() error {
 	s.sendingScheduled = make(chan struct{}, 1)
 	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.handshakeCtx, s.handshakeCtxCancel = context.WithCancel(context.Background())
 
 	s.timer = utils.NewTimer()
 	now := time.Now()
@@ -359,6 +457,7 @@ func (s *session) postSetup() error {
 // run the session main loop
 func (s *session) run() error {
 	defer s.ctxCancel()
+	defer s.handshakeCtxCancel()
 
 	go s.cryptoStreamHandler.RunHandshake()
 
@@ -406,6 +505,8 @@ runLoop:
 			}
 		case <-s.handshakeCompleteChan:
 			s.handleHandshakeComplete()
+		case m := <-s.migrationChan:
+			s.startLocalMigration(m)
 		}
 
 		now := time.Now()
@@ -416,6 +517,17 @@ runLoop:
 				s.closeLocal(err)
 			}
 		}
+		if timeout := s.pathValidator.GetTimeout(); !timeout.IsZero() && !timeout.After(now) {
+			s.handlePathValidationTimeout()
+		}
+		if s.mtuDiscoverer != nil {
+			if timeout := s.mtuDiscoverer.GetTimeout(); !timeout.IsZero() && !timeout.After(now) {
+				s.mtuDiscoverer.OnTimeout(now)
+			}
+		}
+		if s.localMigration != nil && !s.localMigration.deadline.After(now) {
+			s.handleLocalMigrationTimeout()
+		}
 
 		var pacingDeadline time.Time
 		if s.pacingDeadline.IsZero() { // the timer didn't have a pacing deadline set
@@ -448,6 +560,12 @@ runLoop:
 		}
 	}
 
+	if s.localMigration != nil {
+		s.localMigration.result <- closeErr.err
+		s.localMigration = nil
+	}
+	s.connIDGenerator.RetireAll()
+	s.connIDManager.RemoveStatelessResetTokens()
 	s.handleCloseError(closeErr)
 	s.closed.Set(true)
 	s.logger.Infof("Connection %s closed.", s.srcConnID)
@@ -459,6 +577,10 @@ func (s *session) Context() context.Context {
 	return s.ctx
 }
 
+func (s *session) HandshakeComplete() context.Context {
+	return s.handshakeCtx
+}
+
 func (s *session) ConnectionState() tls.ConnectionState {
 	return s.cryptoStreamHandler.ConnectionState()
 }
@@ -484,6 +606,17 @@ func (s *session) maybeResetTimer() {
 	if !s.pacingDeadline.IsZero() {
 		deadline = utils.MinTime(deadline, s.pacingDeadline)
 	}
+	if validationDeadline := s.pathValidator.GetTimeout(); !validationDeadline.IsZero() {
+		deadline = utils.MinTime(deadline, validationDeadline)
+	}
+	if s.localMigration != nil {
+		deadline = utils.MinTime(deadline, s.localMigration.deadline)
+	}
+	if s.mtuDiscoverer != nil {
+		if mtuDeadline := s.mtuDiscoverer.GetTimeout(); !mtuDeadline.IsZero() {
+			deadline = utils.MinTime(deadline, mtuDeadline)
+		}
+	}
 
 	s.timer.Reset(deadline)
 }
@@ -495,6 +628,7 @@ func (s *session) idleTimeoutStartTime() time.Time {
 func (s *session) handleHandshakeComplete() {
 	s.handshakeComplete = true
 	s.handshakeCompleteChan = nil // prevent this case from ever being selected again
+	s.handshakeCtxCancel()
 	s.sessionRunner.OnHandshakeComplete(s)
 
 	// The client completes the handshake first (after sending the CFIN).
@@ -502,11 +636,47 @@ func (s *session) handleHandshakeComplete() {
 	// in order to stop retransmitting handshake packets.
 	// They will stop retransmitting handshake packets when receiving the first 1-RTT packet.
 	if s.perspective == protocol.PerspectiveServer {
+		// Send a token that the client can use for future connection attempts, allowing us to skip the Retry.
 		token, err := s.tokenGenerator.NewToken(s.conn.RemoteAddr())
 		if err != nil {
 			s.closeLocal(err)
+		} else {
+			s.queueControlFrame(&wire.NewTokenFrame{Token: token})
 		}
-		s.queueControlFrame(&wire.NewTokenFrame{Token: token})
+		if s.version.HasHandshakeDoneFrame() {
+			s.queueControlFrame(&wire.HandshakeDoneFrame{})
+		}
+	}
+
+	if !s.config.DisablePathMTUDiscovery {
+		maxPacketSize := protocol.ByteCount(s.config.MaxPacketSize)
+		if s.peerParams != nil && s.peerParams.MaxPacketSize != 0 {
+			maxPacketSize = utils.MinByteCount(maxPacketSize, s.peerParams.MaxPacketSize)
+		}
+		s.mtuDiscoverer = newMTUDiscoverer(s.rttStats, s.basePacketSize(), maxPacketSize, s.onMTUChanged, time.Now())
+	}
+}
+
+// basePacketSize is the packet size that is assumed to work on the current path.
+func (s *session) basePacketSize() protocol.ByteCount {
+	size := getMaxPacketSize(s.conn.RemoteAddr())
+	if s.peerParams != nil && s.peerParams.MaxPacketSize != 0 {
+		size = utils.MinByteCount(size, s.peerParams.MaxPacketSize)
+	}
+	return size
+}
+
+func (s *session) onMTUChanged(size protocol.ByteCount) {
+	s.logger.Debugf("Setting the maximum packet size to %d bytes.", size)
+	s.packer.SetMaxPacketSize(size)
+	s.sentPacketHandler.SetMaxDatagramSize(size)
+}
+
+// resetPathMTU is called when the path changed.
+// It falls back to the base packet size, and restarts path MTU discovery.
+func (s *session) resetPathMTU() {
+	if s.mtuDiscoverer != nil {
+		s.mtuDiscoverer.Reset(s.basePacketSize(), time.Now())
 	}
 }
 
@@ -578,7 +748,7 @@ func (s *session) handleSinglePacket(p *receivedPacket, hdr *wire.Header) bool /
 		return false
 	}
 
-	packet, err := s.unpacker.Unpack(hdr, p.data)
+	packet, err := s.unpacker.Unpack(hdr, p.rcvTime, p.data)
 	if err != nil {
 		switch err {
 		case handshake.ErrKeysDropped:
@@ -589,6 +759,11 @@ func (s *session) handleSinglePacket(p *receivedPacket, hdr *wire.Header) bool /
 			wasQueued = true
 			s.tryQueueingUndecryptablePacket(p)
 		default:
+			if qErr, ok := err.(*qerr.QuicError); ok {
+				// The peer violated the key update rules.
+				s.closeLocal(qErr)
+				return false
+			}
 			// This might be a packet injected by an attacker.
 			// Drop it.
 			s.logger.Debugf("Dropping packet that could not be unpacked. Unpack error: %s", err)
@@ -601,7 +776,7 @@ func (s *session) handleSinglePacket(p *receivedPacket, hdr *wire.Header) bool /
 		packet.hdr.Log(s.logger)
 	}
 
-	if err := s.handleUnpackedPacket(packet, p.rcvTime); err != nil {
+	if err := s.handleUnpackedPacket(packet, p); err != nil {
 		s.closeLocal(err)
 		return false
 	}
@@ -618,7 +793,14 @@ func (s *session) handleRetryPacket(p *receivedPacket, hdr *wire.Header) bool /*
 		return false
 	}
 	(&wire.ExtendedHeader{Header: *hdr}).Log(s.logger)
-	if !hdr.OrigDestConnectionID.Equal(s.destConnID) {
+	if s.version.UsesRetryIntegrityTag() {
+		tagStart := len(p.data) - 16
+		tag := handshake.GetRetryIntegrityTag(p.data[:tagStart], s.destConnID)
+		if !bytes.Equal(p.data[tagStart:], tag[:]) {
+			s.logger.Debugf("Ignoring spoofed Retry. Integrity Tag doesn't match.")
+			return false
+		}
+	} else if !hdr.OrigDestConnectionID.Equal(s.destConnID) {
 		s.logger.Debugf("Ignoring spoofed Retry. Original Destination Connection ID: %s, expected: %s", hdr.OrigDestConnectionID, s.destConnID)
 		return false
 	}
@@ -634,8 +816,8 @@ func (s *session) handleRetryPacket(p *receivedPacket, hdr *wire.Header) bool /*
 	}
 	s.logger.Debugf("<- Received Retry")
 	s.logger.Debugf("Switching destination connection ID to: %s", hdr.SrcConnectionID)
-	s.origDestConnID = s.destConnID
 	s.destConnID = hdr.SrcConnectionID
+	s.retrySrcConnID = hdr.SrcConnectionID
 	s.receivedRetry = true
 	if err := s.sentPacketHandler.ResetForRetry(); err != nil {
 		s.closeLocal(err)
@@ -643,12 +825,13 @@ func (s *session) handleRetryPacket(p *receivedPacket, hdr *wire.Header) bool /*
 	}
 	s.cryptoStreamHandler.ChangeConnectionID(s.destConnID)
 	s.packer.SetToken(hdr.Token)
+	s.connIDManager.ChangeInitialConnID(s.destConnID)
 	s.packer.ChangeDestConnectionID(s.destConnID)
 	s.scheduleSending()
 	return true
 }
 
-func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time) error {
+func (s *session) handleUnpackedPacket(packet *unpackedPacket, p *receivedPacket) error {
 	if len(packet.data) == 0 {
 		return qerr.Error(qerr.ProtocolViolation, "empty packet")
 	}
@@ -657,16 +840,17 @@ func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time
 	if s.perspective == protocol.PerspectiveClient && !s.receivedFirstPacket && packet.hdr.IsLongHeader && !packet.hdr.SrcConnectionID.Equal(s.destConnID) {
 		s.logger.Debugf("Received first packet. Switching destination connection ID to: %s", packet.hdr.SrcConnectionID)
 		s.destConnID = packet.hdr.SrcConnectionID
+		s.connIDManager.ChangeInitialConnID(s.destConnID)
 		s.packer.ChangeDestConnectionID(s.destConnID)
 	}
 
 	s.receivedFirstPacket = true
-	s.lastPacketReceivedTime = rcvTime
+	s.lastPacketReceivedTime = p.rcvTime
 	s.firstAckElicitingPacketAfterIdleSentTime = time.Time{}
 	s.keepAlivePingSent = false
 
 	r := bytes.NewReader(packet.data)
-	var isAckEliciting bool
+	var isAckEliciting, isNonProbing bool
 	for {
 		frame, err := s.frameParser.ParseNext(r, packet.encryptionLevel)
 		if err != nil {
@@ -678,18 +862,144 @@ func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time
 		if ackhandler.IsFrameAckEliciting(frame) {
 			isAckEliciting = true
 		}
-		if err := s.handleFrame(frame, packet.packetNumber, packet.encryptionLevel); err != nil {
+		if !isProbingFrame(frame) {
+			isNonProbing = true
+		}
+		if err := s.handleFrame(frame, packet.packetNumber, packet.encryptionLevel, packet.hdr.DestConnectionID); err != nil {
 			return err
 		}
 	}
 
-	if err := s.receivedPacketHandler.ReceivedPacket(packet.packetNumber, packet.encryptionLevel, rcvTime, isAckEliciting); err != nil {
+	if err := s.receivedPacketHandler.ReceivedPacket(packet.packetNumber, packet.encryptionLevel, p.rcvTime, isAckEliciting); err != nil {
+		return err
+	}
+
+	if packet.encryptionLevel == protocol.Encryption1RTT && packet.packetNumber > s.largestRcvdAppDataPacket {
+		s.largestRcvdAppDataPacket = packet.packetNumber
+		// Only the client can migrate.
+		// Packets that only contain probing frames don't cause a migration.
+		if s.perspective == protocol.PerspectiveServer && s.handshakeComplete && isNonProbing &&
+			p.remoteAddr != nil && !addrsEqual(p.remoteAddr, s.conn.RemoteAddr()) {
+			if err := s.handlePeerAddressChange(p.remoteAddr); err != nil {
+				return err
+			}
+		}
+	}
+	s.pathValidator.ReceivedBytes(p.remoteAddr, protocol.ByteCount(len(p.data)))
+	return nil
+}
+
+func (s *session) handlePeerAddressChange(addr net.Addr) error {
+	oldAddr := s.conn.RemoteAddr()
+	s.logger.Infof("Peer migrated from %s to %s.", oldAddr, addr)
+	s.conn.SetCurrentRemoteAddr(addr)
+	// If only the port changed, the peer most likely experienced a NAT rebinding.
+	// The path is still the same, so there's no need to reset the RTT and congestion state.
+	if !ipsEqual(oldAddr, addr) {
+		s.sentPacketHandler.OnConnectionMigration()
+		s.resetPathMTU()
+		// Use a new connection ID on the new path, so that the paths can't be linked by an observer.
+		s.connIDManager.SwitchConnectionID()
+	}
+	f, err := s.pathValidator.StartValidation(addr, oldAddr, time.Now().Add(s.pathValidationTimeout()))
+	if err != nil {
 		return err
 	}
+	if f != nil {
+		s.logger.Debugf("Validating new peer address %s.", addr)
+		s.queueControlFrame(f)
+	}
 	return nil
 }
 
-func (s *session) handleFrame(f wire.Frame, pn protocol.PacketNumber, encLevel protocol.EncryptionLevel) error {
+func (s *session) handlePathValidationTimeout() {
+	addr := s.pathValidator.OnTimeout()
+	oldAddr := s.conn.RemoteAddr()
+	s.logger.Infof("Validation of peer address %s failed. Returning to %s.", oldAddr, addr)
+	s.conn.SetCurrentRemoteAddr(addr)
+	if !ipsEqual(oldAddr, addr) {
+		s.sentPacketHandler.OnConnectionMigration()
+		s.resetPathMTU()
+	}
+}
+
+func (s *session) MigrateTo(pconn net.PacketConn) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return errors.New("only clients can migrate")
+	}
+	m := &localMigration{
+		pconn:  pconn,
+		result: make(chan error, 1),
+	}
+	select {
+	case s.migrationChan <- m:
+	case <-s.ctx.Done():
+		return errors.New("session closed")
+	}
+	return <-m.result
+}
+
+func (s *session) startLocalMigration(m *localMigration) {
+	if !s.handshakeComplete {
+		m.result <- errors.New("cannot migrate before the handshake completed")
+		return
+	}
+	if s.localMigration != nil {
+		m.result <- errors.New("a migration is already in progress")
+		return
+	}
+	if s.peerParams.DisableMigration {
+		m.result <- errors.New("the peer disabled connection migration")
+		return
+	}
+	migrator, ok := s.sessionRunner.(packetConnMigrator)
+	if !ok {
+		m.result <- errors.New("migration not supported")
+		return
+	}
+	if _, err := rand.Read(m.challenge[:]); err != nil {
+		m.result <- err
+		return
+	}
+	if err := migrator.AddPacketConn(m.pconn); err != nil {
+		m.result <- err
+		return
+	}
+	s.logger.Infof("Migrating from %s to %s.", s.conn.LocalAddr(), m.pconn.LocalAddr())
+	// Use a new connection ID on the new path, so that the paths can't be linked by an observer.
+	// If the server didn't provide any connection IDs, we have to keep using the current one.
+	if !s.connIDManager.SwitchConnectionID() {
+		s.logger.Debugf("No unused connection ID available. Using the current connection ID on the new path.")
+	}
+	m.oldPconn = s.conn.SetPacketConn(m.pconn)
+	m.deadline = time.Now().Add(s.pathValidationTimeout())
+	s.localMigration = m
+	s.sentPacketHandler.OnConnectionMigration()
+	s.resetPathMTU()
+	// The PING frame makes this a non-probing packet, so the server switches to our new address.
+	s.queueControlFrame(&wire.PathChallengeFrame{Data: m.challenge})
+	s.queueControlFrame(&wire.PingFrame{})
+}
+
+func (s *session) handleLocalMigrationTimeout() {
+	m := s.localMigration
+	s.localMigration = nil
+	s.logger.Infof("Validation of the path from %s failed. Returning to %s.", m.pconn.LocalAddr(), m.oldPconn.LocalAddr())
+	s.conn.SetPacketConn(m.oldPconn)
+	s.sessionRunner.(packetConnMigrator).RemovePacketConn(m.pconn)
+	s.sentPacketHandler.OnConnectionMigration()
+	s.resetPathMTU()
+	// make the server switch back to our old address
+	s.queueControlFrame(&wire.PingFrame{})
+	m.result <- errors.New("path validation failed")
+}
+
+// pathValidationTimeout is three times the PTO
+func (s *session) pathValidationTimeout() time.Duration {
+	return 3 * s.rttStats.PTO()
+}
+
+func (s *session) handleFrame(f wire.Frame, pn protocol.PacketNumber, encLevel protocol.EncryptionLevel, destConnID protocol.ConnectionID) error {
 	var err error
 	wire.LogFrame(s.logger, f, false)
 	switch frame := f.(type) {
@@ -718,13 +1028,17 @@ func (s *session) handleFrame(f wire.Frame, pn protocol.PacketNumber, encLevel p
 	case *wire.PathChallengeFrame:
 		s.handlePathChallengeFrame(frame)
 	case *wire.PathResponseFrame:
-		// since we don't send PATH_CHALLENGEs, we don't expect PATH_RESPONSEs
-		err = errors.New("unexpected PATH_RESPONSE frame")
+		s.handlePathResponseFrame(frame)
 	case *wire.NewTokenFrame:
+		err = s.handleNewTokenFrame(frame)
 	case *wire.NewConnectionIDFrame:
+		err = s.handleNewConnectionIDFrame(frame)
 	case *wire.RetireConnectionIDFrame:
-		// since we don't send new connection IDs, we don't expect retirements
-		err = errors.New("unexpected RETIRE_CONNECTION_ID frame")
+		err = s.handleRetireConnectionIDFrame(frame, destConnID)
+	case *wire.DatagramFrame:
+		err = s.handleDatagramFrame(frame, encLevel)
+	case *wire.HandshakeDoneFrame:
+		err = s.handleHandshakeDoneFrame(encLevel)
 	default:
 		err = fmt.Errorf("unexpected frame type: %s", reflect.ValueOf(&frame).Elem().Type().Name())
 	}
@@ -847,17 +1161,80 @@ func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	return nil
 }
 
+func (s *session) handleNewConnectionIDFrame(frame *wire.NewConnectionIDFrame) error {
+	return s.connIDManager.Add(frame)
+}
+
+func (s *session) handleRetireConnectionIDFrame(frame *wire.RetireConnectionIDFrame, destConnID protocol.ConnectionID) error {
+	return s.connIDGenerator.Retire(frame.SequenceNumber, destConnID)
+}
+
 func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) {
 	s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
 }
 
+func (s *session) handlePathResponseFrame(frame *wire.PathResponseFrame) {
+	if m := s.localMigration; m != nil && frame.Data == m.challenge {
+		s.localMigration = nil
+		s.logger.Infof("Migrated to %s.", m.pconn.LocalAddr())
+		s.sessionRunner.(packetConnMigrator).SwitchPacketConn(m.pconn)
+		m.result <- nil
+		return
+	}
+	// PATH_RESPONSEs that don't match the current PATH_CHALLENGE might belong to an earlier validation.
+	// Just ignore them.
+	if s.pathValidator.HandlePathResponseFrame(frame) {
+		s.logger.Debugf("Validated peer address %s.", s.conn.RemoteAddr())
+	}
+}
+
+func (s *session) handleNewTokenFrame(frame *wire.NewTokenFrame) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return qerr.Error(qerr.ProtocolViolation, "received a NEW_TOKEN frame from the client")
+	}
+	if s.config.TokenStore != nil {
+		s.config.TokenStore.Put(s.tokenStoreKey, &ClientToken{data: frame.Token})
+	}
+	return nil
+}
+
+func (s *session) handleHandshakeDoneFrame(encLevel protocol.EncryptionLevel) error {
+	if s.perspective == protocol.PerspectiveServer {
+		return qerr.Error(qerr.ProtocolViolation, "received a HANDSHAKE_DONE frame from the client")
+	}
+	if encLevel != protocol.Encryption1RTT {
+		return qerr.Error(qerr.ProtocolViolation, "received an unencrypted HANDSHAKE_DONE frame")
+	}
+	// The HANDSHAKE_DONE frame confirms the handshake, just like receiving an acknowledgement for a 1-RTT packet.
+	s.cryptoStreamHandler.Received1RTTAck()
+	return nil
+}
+
+func (s *session) handleDatagramFrame(frame *wire.DatagramFrame, encLevel protocol.EncryptionLevel) error {
+	if s.datagramQueue == nil {
+		return qerr.Error(qerr.ProtocolViolation, "received a DATAGRAM frame, although DATAGRAM support is disabled")
+	}
+	if encLevel < protocol.Encryption1RTT {
+		return qerr.Error(qerr.ProtocolViolation, "received an unencrypted DATAGRAM frame")
+	}
+	if frame.Length(s.version) > protocol.MaxDatagramFrameSize {
+		return qerr.Error(qerr.ProtocolViolation, "DATAGRAM frame too large")
+	}
+	s.datagramQueue.HandleDatagramFrame(frame)
+	return nil
+}
+
 func (s *session) handleAckFrame(frame *wire.AckFrame, pn protocol.PacketNumber, encLevel protocol.EncryptionLevel) error {
 	if err := s.sentPacketHandler.ReceivedAck(frame, pn, encLevel, s.lastPacketReceivedTime); err != nil {
 		return err
 	}
 	if encLevel == protocol.Encryption1RTT {
+		if s.mtuDiscoverer != nil {
+			s.mtuDiscoverer.OnAckFrame(frame, s.lastPacketReceivedTime)
+		}
 		s.receivedPacketHandler.IgnoreBelow(s.sentPacketHandler.GetLowestPacketNotConfirmedAcked())
 		s.cryptoStreamHandler.Received1RTTAck()
+		return s.cryptoStreamHandler.SetLargest1RTTAcked(frame.LargestAcked())
 	}
 	return nil
 }
@@ -935,6 +1312,13 @@ func (s *session) handleCloseError(closeErr closeError) {
 	}
 
 	s.streamsMap.CloseWithError(quicErr)
+	if s.datagramQueue != nil {
+		s.datagramQueue.CloseWithError(quicErr)
+	}
+	// no more data will be received, so the receive windows don't need to be reserved any more
+	if s.receiveMemory != nil {
+		s.receiveMemory.Close()
+	}
 
 	if !closeErr.sendClose {
 		return
@@ -976,34 +1360,148 @@ func (s *session) processTransportParameters(data []byte) {
 	s.frameParser.SetAckDelayExponent(params.AckDelayExponent)
 	s.connFlowController.UpdateSendWindow(params.InitialMaxData)
 	s.sentPacketHandler.SetMaxAckDelay(params.MaxAckDelay)
+	s.rttStats.SetMaxAckDelay(params.MaxAckDelay)
 	if params.StatelessResetToken != nil {
-		s.sessionRunner.AddResetToken(*params.StatelessResetToken, s)
+		s.connIDManager.SetStatelessResetToken(*params.StatelessResetToken)
+	}
+	if err := s.connIDGenerator.SetMaxActiveConnIDs(params.ActiveConnectionIDLimit); err != nil {
+		s.closeLocal(err)
 	}
 }
 
 func (s *session) processTransportParametersForClient(data []byte) (*handshake.TransportParameters, error) {
 	params := &handshake.TransportParameters{}
-	if err := params.Unmarshal(data, s.perspective.Opposite()); err != nil {
+	if err := params.Unmarshal(data, s.perspective.Opposite(), s.version); err != nil {
 		return nil, err
 	}
 
+	if s.version.AuthenticatesConnectionIDs() {
+		if err := s.checkConnectionIDsForClient(params); err != nil {
+			return nil, err
+		}
+		return params, nil
+	}
+
 	// check the Retry token
-	if !params.OriginalConnectionID.Equal(s.origDestConnID) {
-		return nil, fmt.Errorf("expected original_connection_id to equal %s, is %s", s.origDestConnID, params.OriginalConnectionID)
+	var origDestConnID protocol.ConnectionID
+	if s.receivedRetry {
+		origDestConnID = s.origDestConnID
+	}
+	if !params.OriginalConnectionID.Equal(origDestConnID) {
+		return nil, fmt.Errorf("expected original_connection_id to equal %s, is %s", origDestConnID, params.OriginalConnectionID)
 	}
 
 	return params, nil
 }
 
+// checkConnectionIDsForClient checks that the connection IDs in the server's transport parameters
+// match the connection IDs used during the handshake.
+func (s *session) checkConnectionIDsForClient(params *handshake.TransportParameters) error {
+	if !params.OriginalConnectionID.Equal(s.origDestConnID) {
+		return qerr.Error(qerr.TransportParameterError, fmt.Sprintf("expected original_connection_id to equal %s, is %s", s.origDestConnID, params.OriginalConnectionID))
+	}
+	if !params.InitialSourceConnectionID.Equal(s.destConnID) {
+		return qerr.Error(qerr.TransportParameterError, fmt.Sprintf("expected initial_source_connection_id to equal %s, is %s", s.destConnID, params.InitialSourceConnectionID))
+	}
+	if !s.receivedRetry {
+		if params.RetrySourceConnectionID != nil {
+			return qerr.Error(qerr.TransportParameterError, "received retry_source_connection_id, although no Retry was performed")
+		}
+		return nil
+	}
+	if params.RetrySourceConnectionID == nil {
+		return qerr.Error(qerr.TransportParameterError, "missing retry_source_connection_id")
+	}
+	if !params.RetrySourceConnectionID.Equal(s.retrySrcConnID) {
+		return qerr.Error(qerr.TransportParameterError, fmt.Sprintf("expected retry_source_connection_id to equal %s, is %s", s.retrySrcConnID, *params.RetrySourceConnectionID))
+	}
+	return nil
+}
+
 func (s *session) processTransportParametersForServer(data []byte) (*handshake.TransportParameters, error) {
 	params := &handshake.TransportParameters{}
-	if err := params.Unmarshal(data, s.perspective.Opposite()); err != nil {
+	if err := params.Unmarshal(data, s.perspective.Opposite(), s.version); err != nil {
 		return nil, err
 	}
+	if s.version.AuthenticatesConnectionIDs() && !params.InitialSourceConnectionID.Equal(s.destConnID) {
+		return nil, qerr.Error(qerr.TransportParameterError, fmt.Sprintf("expected initial_source_connection_id to equal %s, is %s", s.destConnID, params.InitialSourceConnectionID))
+	}
+	if s.config.GetConfigForClient != nil {
+		if err := s.applyConfigForClient(params); err != nil {
+			return nil, err
+		}
+	}
 	return params, nil
 }
 
+// applyConfigForClient calls Config.GetConfigForClient, and applies the returned Config to this session.
+// It is called before our transport parameters are sent, and before any stream was opened.
+func (s *session) applyConfigForClient(params *handshake.TransportParameters) error {
+	info := &ClientInfo{
+		RemoteAddr: s.RemoteAddr(),
+		TransportParameters: TransportParameters{
+			InitialMaxStreamDataBidiLocal:  uint64(params.InitialMaxStreamDataBidiLocal),
+			InitialMaxStreamDataBidiRemote: uint64(params.InitialMaxStreamDataBidiRemote),
+			InitialMaxStreamDataUni:        uint64(params.InitialMaxStreamDataUni),
+			InitialMaxData:                 uint64(params.InitialMaxData),
+			MaxBidiStreamNum:               uint64(params.MaxBidiStreamNum),
+			MaxUniStreamNum:                uint64(params.MaxUniStreamNum),
+			IdleTimeout:                    params.IdleTimeout,
+			MaxPacketSize:                  uint64(params.MaxPacketSize),
+			DisableMigration:               params.DisableMigration,
+		},
+	}
+	if chi := s.cryptoStreamHandler.ClientHelloInfo(); chi != nil {
+		info.ServerName = chi.ServerName
+		info.SupportedProtos = chi.SupportedProtos
+	}
+	conf, err := s.config.GetConfigForClient(info)
+	if err != nil {
+		return err
+	}
+	if conf == nil {
+		return nil
+	}
+	config, err := populateConfigForClient(s.config, conf)
+	if err != nil {
+		return err
+	}
+	_, oldInitialConnectionReceiveWindow := getInitialReceiveWindows(s.config)
+	s.config = config
+	s.sentPacketHandler.SetCongestionControl(s.config.CongestionControl)
+	s.streamsMap.ResetIncomingStreamLimits(uint64(s.config.MaxIncomingStreams), uint64(s.config.MaxIncomingUniStreams))
+	if s.receiveMemory != nil {
+		// No data was received yet, so the old connection flow controller only reserved its initial window.
+		s.receiveMemory.Release(protocol.ByteCount(oldInitialConnectionReceiveWindow))
+	}
+	s.connFlowController = s.newConnectionFlowController()
+	s.windowUpdateQueue = newWindowUpdateQueue(s.streamsMap, s.connFlowController, s.framer.QueueControlFrame)
+
+	initialStreamReceiveWindow, initialConnectionReceiveWindow := getInitialReceiveWindows(s.config)
+	s.ourParams.InitialMaxStreamDataBidiLocal = protocol.ByteCount(initialStreamReceiveWindow)
+	s.ourParams.InitialMaxStreamDataBidiRemote = protocol.ByteCount(initialStreamReceiveWindow)
+	s.ourParams.InitialMaxStreamDataUni = protocol.ByteCount(initialStreamReceiveWindow)
+	s.ourParams.InitialMaxData = protocol.ByteCount(initialConnectionReceiveWindow)
+	s.ourParams.MaxBidiStreamNum = protocol.StreamNum(s.config.MaxIncomingStreams)
+	s.ourParams.MaxUniStreamNum = protocol.StreamNum(s.config.MaxIncomingUniStreams)
+	s.ourParams.IdleTimeout = s.config.IdleTimeout
+	s.cryptoStreamHandler.SetTransportParameters(s.ourParams)
+	return nil
+}
+
+// sendPackets sends as many packets as allowed by congestion control and pacing.
+// The packets are written to the connection at once.
 func (s *session) sendPackets() error {
+	s.batchPackets = true
+	err := s.sendPacketBurst()
+	s.batchPackets = false
+	if flushErr := s.flushPackets(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func (s *session) sendPacketBurst() error {
 	s.pacingDeadline = time.Time{}
 
 	sendMode := s.sentPacketHandler.SendMode()
@@ -1011,10 +1509,21 @@ func (s *session) sendPackets() error {
 		return nil
 	}
 
+	if s.mtuDiscoverer != nil && sendMode == ackhandler.SendAny && s.mtuDiscoverer.ShouldSendProbe() && !s.pathValidator.AmplificationLimited() {
+		if err := s.sendMTUProbePacket(); err != nil {
+			return err
+		}
+	}
+
 	numPackets := s.sentPacketHandler.ShouldSendNumPackets()
 	var numPacketsSent int
 sendLoop:
 	for {
+		// Until the peer's new address is validated, the amount of data we send is limited.
+		if s.pathValidator.AmplificationLimited() {
+			s.logger.Debugf("Amplification limited. Waiting for more data from the peer.")
+			break
+		}
 		switch sendMode {
 		case ackhandler.SendNone:
 			break sendLoop
@@ -1094,6 +1603,7 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	s.onFramesRetransmitted(retransmitPacket.Frames)
 	ackhandlerPackets := make([]*ackhandler.Packet, len(packets))
 	for i, packet := range packets {
 		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
@@ -1118,6 +1628,7 @@ func (s *session) sendProbePacket() error {
 	if err != nil {
 		return err
 	}
+	s.onFramesRetransmitted(p.Frames)
 	ackhandlerPackets := make([]*ackhandler.Packet, len(packets))
 	for i, packet := range packets {
 		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
@@ -1131,6 +1642,18 @@ func (s *session) sendProbePacket() error {
 	return nil
 }
 
+func (s *session) sendMTUProbePacket() error {
+	size := s.mtuDiscoverer.NextProbeSize()
+	packet, err := s.packer.PackMTUProbePacket(size)
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf("Sending a path MTU probe packet of %d bytes.", size)
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.mtuDiscoverer.SentProbe(packet.header.PacketNumber, time.Now())
+	return s.sendPackedPacket(packet)
+}
+
 func (s *session) sendPacket() (bool, error) {
 	if isBlocked, offset := s.connFlowController.IsNewlyBlocked(); isBlocked {
 		s.framer.QueueControlFrame(&wire.DataBlockedFrame{DataLimit: offset})
@@ -1149,12 +1672,56 @@ func (s *session) sendPacket() (bool, error) {
 }
 
 func (s *session) sendPackedPacket(packet *packedPacket) error {
-	defer packet.buffer.Release()
 	if s.firstAckElicitingPacketAfterIdleSentTime.IsZero() && packet.IsAckEliciting() {
 		s.firstAckElicitingPacketAfterIdleSentTime = time.Now()
 	}
 	s.logPacket(packet)
-	return s.conn.Write(packet.raw)
+	s.pathValidator.SentBytes(protocol.ByteCount(len(packet.raw)))
+	if s.mtuDiscoverer != nil && !packet.isMTUProbePacket && packet.IsAckEliciting() {
+		s.mtuDiscoverer.SentPacket(packet.header.PacketNumber, protocol.ByteCount(len(packet.raw)), time.Now())
+	}
+	if s.batchPackets {
+		s.packetBatch = append(s.packetBatch, packet)
+		return nil
+	}
+	defer packet.buffer.Release()
+	if err := s.conn.Write(packet.raw); err != nil {
+		// The packet was larger than the MTU of the local interface.
+		// Treat it like a packet lost on the path.
+		if isMsgSizeErr(err) {
+			s.logger.Debugf("Sending packet 0x%x failed, it is larger than the MTU: %s", packet.header.PacketNumber, err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// flushPackets writes the packets collected during sendPackets.
+func (s *session) flushPackets() error {
+	if len(s.packetBatch) == 0 {
+		return nil
+	}
+	s.rawBatch = s.rawBatch[:0]
+	for _, p := range s.packetBatch {
+		s.rawBatch = append(s.rawBatch, p.raw)
+	}
+	err := s.conn.WritePackets(s.rawBatch)
+	for i, p := range s.packetBatch {
+		p.buffer.Release()
+		s.packetBatch[i] = nil
+	}
+	s.packetBatch = s.packetBatch[:0]
+	if err != nil {
+		// At least one packet was larger than the MTU of the local interface.
+		// Treat it like a packet lost on the path.
+		if isMsgSizeErr(err) {
+			s.logger.Debugf("Sending packets failed, at least one packet is larger than the MTU: %s", err)
+			return nil
+		}
+		return err
+	}
+	return nil
 }
 
 func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
@@ -1216,6 +1783,65 @@ func (s *session) OpenUniStreamSync() (SendStream, error) {
 	return s.streamsMap.OpenUniStreamSync()
 }
 
+func (s *session) SendMessage(p []byte) error {
+	if s.datagramQueue == nil {
+		return errors.New("DATAGRAM support disabled")
+	}
+	f := &wire.DatagramFrame{DataLenPresent: true}
+	// The transport parameters are only available once the handshake completes.
+	select {
+	case <-s.handshakeCompleteChan:
+		maxSize := s.peerParams.MaxDatagramFrameSize
+		if maxSize == 0 {
+			return errors.New("peer doesn't support DATAGRAM frames")
+		}
+		if maxDataLen := f.MaxDataLen(maxSize, s.version); protocol.ByteCount(len(p)) > maxDataLen {
+			return fmt.Errorf("message too large (maximum: %d bytes)", maxDataLen)
+		}
+	case <-s.ctx.Done():
+		// The datagram queue was closed, and will return the close error.
+	}
+	f.Data = make([]byte, len(p))
+	copy(f.Data, p)
+	return s.datagramQueue.AddAndWait(f)
+}
+
+func (s *session) ReceiveMessage() ([]byte, error) {
+	if s.datagramQueue == nil {
+		return nil, errors.New("DATAGRAM support disabled")
+	}
+	return s.datagramQueue.Receive()
+}
+
+func (s *session) SetMaxIncomingStreams(num uint64) {
+	s.streamsMap.SetMaxIncomingStreams(num)
+}
+
+func (s *session) SetMaxIncomingUniStreams(num uint64) {
+	s.streamsMap.SetMaxIncomingUniStreams(num)
+}
+
+func (s *session) newConnectionFlowController() flowcontrol.ConnectionFlowController {
+	_, initialWindow := getInitialReceiveWindows(s.config)
+	return flowcontrol.NewConnectionFlowController(
+		protocol.ByteCount(initialWindow),
+		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
+		s.autoTuning(),
+		s.receiveMemory,
+		s.onHasConnectionWindowUpdate,
+		s.rttStats,
+		s.logger,
+	)
+}
+
+func (s *session) autoTuning() flowcontrol.AutoTuning {
+	var autoTuning flowcontrol.AutoTuning
+	if s.config.EnableBDPAutoTuning {
+		autoTuning.BDPHeadroom = s.config.BDPAutoTuningHeadroom
+	}
+	return autoTuning
+}
+
 func (s *session) newFlowController(id protocol.StreamID) flowcontrol.StreamFlowController {
 	var initialSendWindow protocol.ByteCount
 	if s.peerParams != nil {
@@ -1229,11 +1855,13 @@ func (s *session) newFlowController(id protocol.StreamID) flowcontrol.StreamFlow
 			}
 		}
 	}
+	initialReceiveWindow, _ := getInitialReceiveWindows(s.config)
 	return flowcontrol.NewStreamFlowController(
 		id,
 		s.connFlowController,
-		protocol.InitialMaxStreamData,
+		protocol.ByteCount(initialReceiveWindow),
 		protocol.ByteCount(s.config.MaxReceiveStreamFlowControlWindow),
+		s.autoTuning(),
 		initialSendWindow,
 		s.onHasStreamWindowUpdate,
 		s.rttStats,
@@ -1289,6 +1917,33 @@ func (s *session) onHasStreamData(id protocol.StreamID) {
 	s.scheduleSending()
 }
 
+// onFrameAcked is called by the sentPacketHandler for every frame in an acknowledged packet
+func (s *session) onFrameAcked(f wire.Frame) {
+	frame, ok := f.(*wire.StreamFrame)
+	if !ok {
+		return
+	}
+	str, err := s.streamsMap.GetOrOpenSendStream(frame.StreamID)
+	if err != nil || str == nil { // the stream can be nil if it was already completed
+		return
+	}
+	str.handleStreamFrameAcked(frame)
+}
+
+func (s *session) onFramesRetransmitted(frames []wire.Frame) {
+	for _, f := range frames {
+		frame, ok := f.(*wire.StreamFrame)
+		if !ok {
+			continue
+		}
+		str, err := s.streamsMap.GetOrOpenSendStream(frame.StreamID)
+		if err != nil || str == nil {
+			continue
+		}
+		str.handleStreamFrameRetransmitted(frame)
+	}
+}
+
 func (s *session) onStreamCompleted(id protocol.StreamID) {
 	if err := s.streamsMap.DeleteStream(id); err != nil {
 		s.closeLocal(err)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/tls"
 	"errors"
 	"net"
 	"runtime/pprof"
@@ -14,6 +15,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/DrakenLibra/gt-bbr/internal/ackhandler"
+	"github.com/DrakenLibra/gt-bbr/internal/flowcontrol"
 	"github.com/DrakenLibra/gt-bbr/internal/handshake"
 	"github.com/DrakenLibra/gt-bbr/internal/mocks"
 	mockackhandler "github.com/DrakenLibra/gt-bbr/internal/mocks/ackhandler"
@@ -25,9 +27,11 @@ import (
 )
 
 type mockConnection struct {
+	pconn      net.PacketConn
 	remoteAddr net.Addr
 	localAddr  net.Addr
 	written    chan []byte
+	numBatches int
 }
 
 func newMockConnection() *mockConnection {
@@ -47,11 +51,25 @@ func (m *mockConnection) Write(p []byte) error {
 	}
 	return nil
 }
+func (m *mockConnection) WritePackets(packets [][]byte) error {
+	m.numBatches++
+	for _, p := range packets {
+		if err := m.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 func (m *mockConnection) Read([]byte) (int, net.Addr, error) { panic("not implemented") }
 
 func (m *mockConnection) SetCurrentRemoteAddr(addr net.Addr) {
 	m.remoteAddr = addr
 }
+func (m *mockConnection) SetPacketConn(pconn net.PacketConn) net.PacketConn {
+	old := m.pconn
+	m.pconn = pconn
+	return old
+}
 func (m *mockConnection) LocalAddr() net.Addr  { return m.localAddr }
 func (m *mockConnection) RemoteAddr() net.Addr { return m.remoteAddr }
 func (*mockConnection) Close() error           { panic("not implemented") }
@@ -59,7 +77,7 @@ func (*mockConnection) Close() error           { panic("not implemented") }
 func areSessionsRunning() bool {
 	var b bytes.Buffer
 	pprof.Lookup("goroutine").WriteTo(&b, 1)
-	return strings.Contains(b.String(), "quic-go.(*session).run")
+	return strings.Contains(b.String(), "gt-bbr.(*session).run")
 }
 
 var _ = Describe("Session", func() {
@@ -164,6 +182,7 @@ var _ = Describe("Session", func() {
 
 			It("tells the ReceivedPacketHandler to ignore low ranges", func() {
 				cryptoSetup.EXPECT().Received1RTTAck()
+				cryptoSetup.EXPECT().SetLargest1RTTAcked(protocol.PacketNumber(3))
 				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 3}}}
 				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 				sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
@@ -174,6 +193,21 @@ var _ = Describe("Session", func() {
 				sess.receivedPacketHandler = rph
 				Expect(sess.handleAckFrame(ack, 0, protocol.Encryption1RTT)).To(Succeed())
 			})
+
+			It("returns the error when the peer acknowledges a packet with the new keys, but doesn't update its keys", func() {
+				testErr := qerr.Error(qerr.ProtocolViolation, "peer didn't update keys")
+				cryptoSetup.EXPECT().Received1RTTAck()
+				cryptoSetup.EXPECT().SetLargest1RTTAcked(protocol.PacketNumber(3)).Return(testErr)
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 3}}}
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+				sph.EXPECT().GetLowestPacketNotConfirmedAcked()
+				sess.sentPacketHandler = sph
+				rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+				rph.EXPECT().IgnoreBelow(gomock.Any())
+				sess.receivedPacketHandler = rph
+				Expect(sess.handleAckFrame(ack, 0, protocol.Encryption1RTT)).To(MatchError(testErr))
+			})
 		})
 
 		Context("handling RESET_STREAM frames", func() {
@@ -208,7 +242,7 @@ var _ = Describe("Session", func() {
 				Expect(sess.handleFrame(&wire.ResetStreamFrame{
 					StreamID:  3,
 					ErrorCode: 42,
-				}, 0, protocol.EncryptionUnspecified)).To(Succeed())
+				}, 0, protocol.EncryptionUnspecified, nil)).To(Succeed())
 			})
 		})
 
@@ -243,7 +277,7 @@ var _ = Describe("Session", func() {
 				Expect(sess.handleFrame(&wire.MaxStreamDataFrame{
 					StreamID:   10,
 					ByteOffset: 1337,
-				}, 0, protocol.EncryptionUnspecified)).To(Succeed())
+				}, 0, protocol.EncryptionUnspecified, nil)).To(Succeed())
 			})
 		})
 
@@ -285,40 +319,149 @@ var _ = Describe("Session", func() {
 				Expect(sess.handleFrame(&wire.StopSendingFrame{
 					StreamID:  3,
 					ErrorCode: 1337,
-				}, 0, protocol.EncryptionUnspecified)).To(Succeed())
+				}, 0, protocol.EncryptionUnspecified, nil)).To(Succeed())
+			})
+		})
+
+		Context("handling acknowledged frames", func() {
+			It("passes acknowledged STREAM frames to the stream", func() {
+				f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+				str := NewMockSendStreamI(mockCtrl)
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(5)).Return(str, nil)
+				str.EXPECT().handleStreamFrameAcked(f)
+				sess.onFrameAcked(f)
+			})
+
+			It("ignores acknowledged STREAM frames for a closed stream", func() {
+				streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(3)).Return(nil, nil)
+				sess.onFrameAcked(&wire.StreamFrame{StreamID: 3})
+			})
+
+			It("ignores other frames", func() {
+				sess.onFrameAcked(&wire.PingFrame{})
 			})
 		})
 
 		It("handles PING frames", func() {
-			err := sess.handleFrame(&wire.PingFrame{}, 0, protocol.EncryptionUnspecified)
+			err := sess.handleFrame(&wire.PingFrame{}, 0, protocol.EncryptionUnspecified, nil)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("rejects PATH_RESPONSE frames", func() {
-			err := sess.handleFrame(&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}, 0, protocol.EncryptionUnspecified)
-			Expect(err).To(MatchError("unexpected PATH_RESPONSE frame"))
+		It("doesn't allow servers to migrate", func() {
+			Expect(sess.MigrateTo(newMockPacketConn())).To(MatchError("only clients can migrate"))
+		})
+
+		It("ignores PATH_RESPONSE frames that don't match a PATH_CHALLENGE", func() {
+			err := sess.handleFrame(&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}, 0, protocol.EncryptionUnspecified, nil)
+			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("handles PATH_CHALLENGE frames", func() {
 			data := [8]byte{1, 2, 3, 4, 5, 6, 7, 8}
-			err := sess.handleFrame(&wire.PathChallengeFrame{Data: data}, 0, protocol.EncryptionUnspecified)
+			err := sess.handleFrame(&wire.PathChallengeFrame{Data: data}, 0, protocol.EncryptionUnspecified, nil)
 			Expect(err).ToNot(HaveOccurred())
 			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
 			Expect(frames).To(Equal([]wire.Frame{&wire.PathResponseFrame{Data: data}}))
 		})
 
+		It("rejects NEW_TOKEN frames", func() {
+			err := sess.handleFrame(&wire.NewTokenFrame{Token: []byte("foobar")}, 0, protocol.Encryption1RTT, nil)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: received a NEW_TOKEN frame from the client"))
+		})
+
+		It("rejects HANDSHAKE_DONE frames", func() {
+			err := sess.handleFrame(&wire.HandshakeDoneFrame{}, 0, protocol.Encryption1RTT, nil)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: received a HANDSHAKE_DONE frame from the client"))
+		})
+
+		It("handles NEW_CONNECTION_ID frames", func() {
+			sessionRunner.EXPECT().AddResetToken([16]byte{0xa}, sess)
+			Expect(sess.handleFrame(&wire.NewConnectionIDFrame{
+				SequenceNumber:      1,
+				ConnectionID:        protocol.ConnectionID{1, 2, 3, 4},
+				StatelessResetToken: [16]byte{0xa},
+			}, 0, protocol.Encryption1RTT, nil)).To(Succeed())
+			Expect(sess.connIDManager.queue).To(HaveLen(1))
+			Expect(sess.connIDManager.queue[0].ConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4}))
+		})
+
+		It("handles RETIRE_CONNECTION_ID frames", func() {
+			sessionRunner.EXPECT().Retire(sess.srcConnID)
+			sessionRunner.EXPECT().Add(gomock.Any(), sess)
+			sessionRunner.EXPECT().GetStatelessResetToken(gomock.Any())
+			Expect(sess.handleFrame(&wire.RetireConnectionIDFrame{SequenceNumber: 0}, 0, protocol.Encryption1RTT, protocol.ConnectionID{0xde, 0xad})).To(Succeed())
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(HaveLen(1))
+			Expect(frames[0]).To(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+			Expect(frames[0].(*wire.NewConnectionIDFrame).SequenceNumber).To(BeEquivalentTo(1))
+		})
+
+		It("rejects RETIRE_CONNECTION_ID frames that retire the connection ID they were sent with", func() {
+			err := sess.handleFrame(&wire.RetireConnectionIDFrame{SequenceNumber: 0}, 0, protocol.Encryption1RTT, sess.srcConnID)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("was used as the Destination Connection ID on this packet"))
+		})
+
+		Context("handling DATAGRAM frames", func() {
+			It("rejects DATAGRAM frames, if DATAGRAM support is disabled", func() {
+				err := sess.handleFrame(&wire.DatagramFrame{Data: []byte("foobar")}, 0, protocol.Encryption1RTT, nil)
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: received a DATAGRAM frame, although DATAGRAM support is disabled"))
+			})
+
+			It("passes DATAGRAM frames to the datagram queue", func() {
+				sess.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+				Expect(sess.handleFrame(&wire.DatagramFrame{Data: []byte("foobar")}, 0, protocol.Encryption1RTT, nil)).To(Succeed())
+				data, err := sess.ReceiveMessage()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+
+			It("rejects unencrypted DATAGRAM frames", func() {
+				sess.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+				err := sess.handleFrame(&wire.DatagramFrame{Data: []byte("foobar")}, 0, protocol.EncryptionHandshake, nil)
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: received an unencrypted DATAGRAM frame"))
+			})
+
+			It("rejects DATAGRAM frames that are too large", func() {
+				sess.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+				f := &wire.DatagramFrame{Data: make([]byte, protocol.MaxDatagramFrameSize)}
+				err := sess.handleFrame(f, 0, protocol.Encryption1RTT, nil)
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: DATAGRAM frame too large"))
+			})
+		})
+
+		It("errors when sending messages, if DATAGRAM support is disabled", func() {
+			Expect(sess.SendMessage([]byte("foobar"))).To(MatchError("DATAGRAM support disabled"))
+			_, err := sess.ReceiveMessage()
+			Expect(err).To(MatchError("DATAGRAM support disabled"))
+		})
+
+		It("errors when sending messages, if the peer doesn't support DATAGRAM frames", func() {
+			sess.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+			sess.peerParams = &handshake.TransportParameters{}
+			close(sess.handshakeCompleteChan)
+			Expect(sess.SendMessage([]byte("foobar"))).To(MatchError("peer doesn't support DATAGRAM frames"))
+		})
+
+		It("errors when sending messages that are too large", func() {
+			sess.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+			sess.peerParams = &handshake.TransportParameters{MaxDatagramFrameSize: 100}
+			close(sess.handshakeCompleteChan)
+			Expect(sess.SendMessage(make([]byte, 100))).To(MatchError("message too large (maximum: 97 bytes)"))
+		})
+
 		It("handles BLOCKED frames", func() {
-			err := sess.handleFrame(&wire.DataBlockedFrame{}, 0, protocol.EncryptionUnspecified)
+			err := sess.handleFrame(&wire.DataBlockedFrame{}, 0, protocol.EncryptionUnspecified, nil)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("handles STREAM_BLOCKED frames", func() {
-			err := sess.handleFrame(&wire.StreamDataBlockedFrame{}, 0, protocol.EncryptionUnspecified)
+			err := sess.handleFrame(&wire.StreamDataBlockedFrame{}, 0, protocol.EncryptionUnspecified, nil)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
 		It("handles STREAM_ID_BLOCKED frames", func() {
-			err := sess.handleFrame(&wire.StreamsBlockedFrame{}, 0, protocol.EncryptionUnspecified)
+			err := sess.handleFrame(&wire.StreamsBlockedFrame{}, 0, protocol.EncryptionUnspecified, nil)
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -337,7 +480,7 @@ var _ = Describe("Session", func() {
 				ErrorCode:    qerr.StreamLimitError,
 				ReasonPhrase: "foobar",
 			}
-			Expect(sess.handleFrame(ccf, 0, protocol.EncryptionUnspecified)).To(Succeed())
+			Expect(sess.handleFrame(ccf, 0, protocol.EncryptionUnspecified, nil)).To(Succeed())
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
 
@@ -357,7 +500,7 @@ var _ = Describe("Session", func() {
 				ReasonPhrase:       "foobar",
 				IsApplicationError: true,
 			}
-			Expect(sess.handleFrame(ccf, 0, protocol.EncryptionUnspecified)).To(Succeed())
+			Expect(sess.handleFrame(ccf, 0, protocol.EncryptionUnspecified, nil)).To(Succeed())
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
 	})
@@ -375,6 +518,59 @@ var _ = Describe("Session", func() {
 		Expect(str).To(Equal(mstr))
 	})
 
+	It("cancels the HandshakeComplete context when the handshake completes", func() {
+		sessionRunner.EXPECT().OnHandshakeComplete(gomock.Any())
+		sess.config.DisablePathMTUDiscovery = true
+		Expect(sess.HandshakeComplete().Done()).ToNot(BeClosed())
+		sess.handleHandshakeComplete()
+		Expect(sess.HandshakeComplete().Done()).To(BeClosed())
+	})
+
+	It("sends a HANDSHAKE_DONE frame when the handshake completes, for versions that support it", func() {
+		sessionRunner.EXPECT().OnHandshakeComplete(gomock.Any())
+		sess.config.DisablePathMTUDiscovery = true
+		sess.version = protocol.VersionDraft29
+		sess.handleHandshakeComplete()
+		frames, _ := sess.framer.AppendControlFrames(nil, protocol.MaxByteCount)
+		Expect(frames).To(HaveLen(2))
+		Expect(frames).To(ContainElement(&wire.HandshakeDoneFrame{}))
+	})
+
+	It("doesn't send a HANDSHAKE_DONE frame for versions that don't support it", func() {
+		sessionRunner.EXPECT().OnHandshakeComplete(gomock.Any())
+		sess.config.DisablePathMTUDiscovery = true
+		sess.version = protocol.VersionDraft23
+		sess.handleHandshakeComplete()
+		frames, _ := sess.framer.AppendControlFrames(nil, protocol.MaxByteCount)
+		Expect(frames).To(HaveLen(1))
+		Expect(frames[0]).To(BeAssignableToTypeOf(&wire.NewTokenFrame{}))
+	})
+
+	It("reserves the receive memory from the receive window budget", func() {
+		budget := NewReceiveWindowBudget(1 << 20)
+		conf := populateServerConfig(&Config{ReceiveWindowBudget: budget})
+		tokenGenerator, err := handshake.NewTokenGenerator()
+		Expect(err).ToNot(HaveOccurred())
+		s, err := newSession(
+			mconn,
+			sessionRunner,
+			nil,
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+			conf,
+			nil, // tls.Config
+			&handshake.TransportParameters{},
+			tokenGenerator,
+			utils.DefaultLogger,
+			protocol.VersionTLS,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.(*session).receiveMemory).ToNot(BeNil())
+		// the initial connection-level window is granted to the peer
+		_, initialConnectionReceiveWindow := getInitialReceiveWindows(conf)
+		Expect(budget.Used()).To(BeEquivalentTo(initialConnectionReceiveWindow))
+	})
+
 	Context("closing", func() {
 		var (
 			runErr         error
@@ -422,6 +618,20 @@ var _ = Describe("Session", func() {
 			Expect(sess.Context().Done()).To(BeClosed())
 		})
 
+		It("releases the receive window budget", func() {
+			budget := NewReceiveWindowBudget(1 << 20)
+			sess.receiveMemory = budget.budget.NewChild()
+			sess.receiveMemory.ForceReserve(1000)
+			Expect(budget.Used()).To(BeEquivalentTo(1000))
+			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.NoError, ""))
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			Expect(sess.Close()).To(Succeed())
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(budget.Used()).To(BeZero())
+		})
+
 		It("closes streams with proper error", func() {
 			testErr := errors.New("test error")
 			streamManager.EXPECT().CloseWithError(qerr.Error(0x1337, testErr.Error()))
@@ -523,7 +733,7 @@ var _ = Describe("Session", func() {
 				PacketNumberLen: protocol.PacketNumberLen1,
 			}
 			rcvTime := time.Now().Add(-10 * time.Second)
-			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
 				packetNumber:    0x1337,
 				encryptionLevel: protocol.EncryptionInitial,
 				hdr:             hdr,
@@ -546,7 +756,7 @@ var _ = Describe("Session", func() {
 			rcvTime := time.Now().Add(-10 * time.Second)
 			buf := &bytes.Buffer{}
 			Expect((&wire.PingFrame{}).Write(buf, sess.version)).To(Succeed())
-			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
 				packetNumber:    0x1337,
 				encryptionLevel: protocol.EncryptionHandshake,
 				hdr:             hdr,
@@ -560,8 +770,105 @@ var _ = Describe("Session", func() {
 			Expect(sess.handlePacketImpl(packet)).To(BeTrue())
 		})
 
+		Context("connection migration", func() {
+			var (
+				sph     *mockackhandler.MockSentPacketHandler
+				oldAddr *net.UDPAddr
+			)
+
+			BeforeEach(func() {
+				sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sess.sentPacketHandler = sph
+				sess.handshakeComplete = true
+				oldAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+				mconn.remoteAddr = oldAddr
+			})
+
+			receivePacket := func(pn protocol.PacketNumber, frame wire.Frame, addr net.Addr) {
+				hdr := &wire.ExtendedHeader{
+					Header:          wire.Header{DestConnectionID: sess.srcConnID},
+					PacketNumber:    pn,
+					PacketNumberLen: protocol.PacketNumberLen2,
+				}
+				buf := &bytes.Buffer{}
+				Expect(frame.Write(buf, sess.version)).To(Succeed())
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+					packetNumber:    pn,
+					encryptionLevel: protocol.Encryption1RTT,
+					hdr:             hdr,
+					data:            buf.Bytes(),
+				}, nil)
+				packet := getPacket(hdr, nil)
+				packet.remoteAddr = addr
+				Expect(sess.handlePacketImpl(packet)).To(BeTrue())
+			}
+
+			getPathChallenge := func() *wire.PathChallengeFrame {
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				ExpectWithOffset(1, frames).To(HaveLen(1))
+				ExpectWithOffset(1, frames[0]).To(BeAssignableToTypeOf(&wire.PathChallengeFrame{}))
+				return frames[0].(*wire.PathChallengeFrame)
+			}
+
+			It("migrates to a new address and validates it", func() {
+				newAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321}
+				sph.EXPECT().OnConnectionMigration()
+				receivePacket(10, &wire.PingFrame{}, newAddr)
+				Expect(mconn.remoteAddr).To(Equal(newAddr))
+				challenge := getPathChallenge()
+				Expect(sess.pathValidator.GetTimeout()).ToNot(BeZero())
+				sess.handlePathResponseFrame(&wire.PathResponseFrame{Data: challenge.Data})
+				Expect(sess.pathValidator.GetTimeout()).To(BeZero())
+			})
+
+			It("doesn't reset the congestion state on a NAT rebinding", func() {
+				newAddr := &net.UDPAddr{IP: oldAddr.IP, Port: 4321}
+				receivePacket(10, &wire.PingFrame{}, newAddr)
+				Expect(mconn.remoteAddr).To(Equal(newAddr))
+				getPathChallenge()
+			})
+
+			It("doesn't migrate for packets that only contain probing frames", func() {
+				newAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321}
+				receivePacket(10, &wire.PathChallengeFrame{}, newAddr)
+				Expect(mconn.remoteAddr).To(Equal(oldAddr))
+			})
+
+			It("doesn't migrate for reordered packets", func() {
+				receivePacket(10, &wire.PingFrame{}, oldAddr)
+				receivePacket(9, &wire.PingFrame{}, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321})
+				Expect(mconn.remoteAddr).To(Equal(oldAddr))
+			})
+
+			It("doesn't migrate before the handshake is complete", func() {
+				sess.handshakeComplete = false
+				receivePacket(10, &wire.PingFrame{}, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321})
+				Expect(mconn.remoteAddr).To(Equal(oldAddr))
+			})
+
+			It("returns to the old address if the validation fails", func() {
+				newAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321}
+				sph.EXPECT().OnConnectionMigration().Times(2)
+				receivePacket(10, &wire.PingFrame{}, newAddr)
+				Expect(mconn.remoteAddr).To(Equal(newAddr))
+				sess.handlePathValidationTimeout()
+				Expect(mconn.remoteAddr).To(Equal(oldAddr))
+			})
+
+			It("stops sending when amplification limited", func() {
+				newAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4321}
+				sph.EXPECT().OnConnectionMigration()
+				receivePacket(10, &wire.PingFrame{}, newAddr)
+				sess.pathValidator.SentBytes(10000)
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny)
+				sph.EXPECT().ShouldSendNumPackets().Return(1)
+				Expect(sess.sendPackets()).To(Succeed())
+				Expect(mconn.written).To(BeEmpty())
+			})
+		})
+
 		It("drops a packet when unpacking fails", func() {
-			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, errors.New("unpack error"))
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("unpack error"))
 			streamManager.EXPECT().CloseWithError(gomock.Any())
 			cryptoSetup.EXPECT().Close()
 			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
@@ -581,8 +888,29 @@ var _ = Describe("Session", func() {
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
 
+		It("closes the session when unpacking fails because of a protocol violation", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, qerr.Error(qerr.ProtocolViolation, "keys updated too quickly"))
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().MaxTimes(1)
+				err := sess.run()
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: keys updated too quickly"))
+				close(done)
+			}()
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			sess.handlePacket(getPacket(&wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}, nil))
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("rejects packets with empty payload", func() {
-			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
 				hdr:  &wire.ExtendedHeader{},
 				data: []byte{}, // no payload
 			}, nil)
@@ -645,7 +973,7 @@ var _ = Describe("Session", func() {
 			Expect(sess.srcConnID).ToNot(Equal(hdr2.SrcConnectionID))
 			// Send one packet, which might change the connection ID.
 			// only EXPECT one call to the unpacker
-			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
 				encryptionLevel: protocol.Encryption1RTT,
 				hdr:             hdr1,
 				data:            []byte{0}, // one PADDING frame
@@ -668,7 +996,7 @@ var _ = Describe("Session", func() {
 				PacketNumberLen: protocol.PacketNumberLen1,
 				PacketNumber:    1,
 			}
-			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, handshake.ErrOpenerNotYetAvailable)
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, handshake.ErrOpenerNotYetAvailable)
 			packet := getPacket(hdr, nil)
 			Expect(sess.handlePacketImpl(packet)).To(BeFalse())
 			Expect(sess.undecryptablePackets).To(Equal([]*receivedPacket{packet}))
@@ -676,7 +1004,7 @@ var _ = Describe("Session", func() {
 
 		Context("updating the remote address", func() {
 			It("doesn't support connection migration", func() {
-				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
 					encryptionLevel: protocol.Encryption1RTT,
 					hdr:             &wire.ExtendedHeader{},
 					data:            []byte{0}, // one PADDING frame
@@ -716,7 +1044,7 @@ var _ = Describe("Session", func() {
 
 			It("cuts packets to the right length", func() {
 				hdrLen, packet := getPacketWithLength(sess.srcConnID, 456)
-				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, _ time.Time, data []byte) (*unpackedPacket, error) {
 					Expect(data).To(HaveLen(hdrLen + 456 - 3))
 					return &unpackedPacket{
 						encryptionLevel: protocol.EncryptionHandshake,
@@ -728,7 +1056,7 @@ var _ = Describe("Session", func() {
 
 			It("handles coalesced packets", func() {
 				hdrLen1, packet1 := getPacketWithLength(sess.srcConnID, 456)
-				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, _ time.Time, data []byte) (*unpackedPacket, error) {
 					Expect(data).To(HaveLen(hdrLen1 + 456 - 3))
 					return &unpackedPacket{
 						encryptionLevel: protocol.EncryptionHandshake,
@@ -736,7 +1064,7 @@ var _ = Describe("Session", func() {
 					}, nil
 				})
 				hdrLen2, packet2 := getPacketWithLength(sess.srcConnID, 123)
-				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, _ time.Time, data []byte) (*unpackedPacket, error) {
 					Expect(data).To(HaveLen(hdrLen2 + 123 - 3))
 					return &unpackedPacket{
 						encryptionLevel: protocol.EncryptionHandshake,
@@ -751,8 +1079,8 @@ var _ = Describe("Session", func() {
 				hdrLen1, packet1 := getPacketWithLength(sess.srcConnID, 456)
 				hdrLen2, packet2 := getPacketWithLength(sess.srcConnID, 123)
 				gomock.InOrder(
-					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, handshake.ErrOpenerNotYetAvailable),
-					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, handshake.ErrOpenerNotYetAvailable),
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, _ time.Time, data []byte) (*unpackedPacket, error) {
 						Expect(data).To(HaveLen(hdrLen2 + 123 - 3))
 						return &unpackedPacket{
 							encryptionLevel: protocol.EncryptionHandshake,
@@ -771,7 +1099,7 @@ var _ = Describe("Session", func() {
 				wrongConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
 				Expect(sess.srcConnID).ToNot(Equal(wrongConnID))
 				hdrLen1, packet1 := getPacketWithLength(sess.srcConnID, 456)
-				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, _ time.Time, data []byte) (*unpackedPacket, error) {
 					Expect(data).To(HaveLen(hdrLen1 + 456 - 3))
 					return &unpackedPacket{
 						encryptionLevel: protocol.EncryptionHandshake,
@@ -877,6 +1205,9 @@ var _ = Describe("Session", func() {
 			retransmissions := []*packedPacket{getPacket(1337), getPacket(1338)}
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().DequeuePacketForRetransmission().Return(packet)
+			str := NewMockSendStreamI(mockCtrl)
+			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(0x5)).Return(str, nil)
+			str.EXPECT().handleStreamFrameRetransmitted(packet.Frames[0])
 			packer.EXPECT().PackRetransmission(packet).Return(retransmissions, nil)
 			sph.EXPECT().SentPacketsAsRetransmission(gomock.Any(), protocol.PacketNumber(42)).Do(func(packets []*ackhandler.Packet, _ protocol.PacketNumber) {
 				Expect(packets).To(HaveLen(2))
@@ -910,6 +1241,97 @@ var _ = Describe("Session", func() {
 			Expect(sess.sendPackets()).To(Succeed())
 		})
 
+		Context("path MTU discovery", func() {
+			It("starts when the handshake completes", func() {
+				sessionRunner.EXPECT().OnHandshakeComplete(sess)
+				sess.handleHandshakeComplete()
+				Expect(sess.mtuDiscoverer).ToNot(BeNil())
+				Expect(sess.mtuDiscoverer.CurrentSize()).To(Equal(protocol.ByteCount(protocol.MaxPacketSizeIPv6)))
+				Expect(sess.mtuDiscoverer.NextProbeSize()).To(Equal(protocol.MaxReceivePacketSize))
+			})
+
+			It("doesn't probe larger than the peer's max_packet_size", func() {
+				sess.config.MaxPacketSize = 9000
+				sess.peerParams = &handshake.TransportParameters{MaxPacketSize: 5000}
+				sessionRunner.EXPECT().OnHandshakeComplete(sess)
+				sess.handleHandshakeComplete()
+				Expect(sess.mtuDiscoverer.NextProbeSize()).To(Equal(protocol.ByteCount(5000)))
+			})
+
+			It("doesn't start if it is disabled", func() {
+				sess.config.DisablePathMTUDiscovery = true
+				sessionRunner.EXPECT().OnHandshakeComplete(sess)
+				sess.handleHandshakeComplete()
+				Expect(sess.mtuDiscoverer).To(BeNil())
+			})
+
+			It("sends probe packets", func() {
+				sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, protocol.MaxPacketSizeIPv6, 1452, sess.onMTUChanged, time.Now())
+				probe := getPacket(10)
+				probe.isMTUProbePacket = true
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny).Times(2)
+				sph.EXPECT().ShouldSendNumPackets().Return(2)
+				gomock.InOrder(
+					packer.EXPECT().PackMTUProbePacket(protocol.ByteCount(1452)).Return(probe, nil),
+					sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+						Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(10)))
+						Expect(p.IsPathMTUProbePacket).To(BeTrue())
+					}),
+					packer.EXPECT().PackPacket().Return(getPacket(11), nil),
+					sph.EXPECT().SentPacket(gomock.Any()),
+					packer.EXPECT().PackPacket(),
+				)
+				sess.sentPacketHandler = sph
+				Expect(sess.sendPackets()).To(Succeed())
+				Expect(mconn.written).To(HaveLen(2))
+				Expect(sess.mtuDiscoverer.ShouldSendProbe()).To(BeFalse())
+			})
+
+			It("doesn't send probe packets when congestion limited", func() {
+				sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, protocol.MaxPacketSizeIPv6, 1452, sess.onMTUChanged, time.Now())
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().SendMode().Return(ackhandler.SendAck)
+				sph.EXPECT().ShouldSendNumPackets().Return(1)
+				packer.EXPECT().MaybePackAckPacket()
+				sess.sentPacketHandler = sph
+				Expect(sess.sendPackets()).To(Succeed())
+				Expect(sess.mtuDiscoverer.ShouldSendProbe()).To(BeTrue())
+			})
+
+			It("increases the packet size when a probe packet is acknowledged", func() {
+				sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, protocol.MaxPacketSizeIPv6, 1452, sess.onMTUChanged, time.Now())
+				sess.mtuDiscoverer.SentProbe(10, time.Now())
+				cryptoSetup.EXPECT().Received1RTTAck()
+				cryptoSetup.EXPECT().SetLargest1RTTAcked(protocol.PacketNumber(10))
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+				sph.EXPECT().GetLowestPacketNotConfirmedAcked()
+				sph.EXPECT().SetMaxDatagramSize(protocol.ByteCount(1452))
+				packer.EXPECT().SetMaxPacketSize(protocol.ByteCount(1452))
+				sess.sentPacketHandler = sph
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 10, Largest: 10}}}
+				Expect(sess.handleAckFrame(ack, 0, protocol.Encryption1RTT)).To(Succeed())
+				Expect(sess.mtuDiscoverer.CurrentSize()).To(Equal(protocol.ByteCount(1452)))
+			})
+		})
+
+		It("writes all packets sent in one burst at once", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().SendMode().Return(ackhandler.SendAny).Times(3)
+			sph.EXPECT().ShouldSendNumPackets().Return(3)
+			sph.EXPECT().TimeUntilSend()
+			sph.EXPECT().SentPacket(gomock.Any()).Times(3)
+			packer.EXPECT().PackPacket().Return(getPacket(10), nil)
+			packer.EXPECT().PackPacket().Return(getPacket(11), nil)
+			packer.EXPECT().PackPacket().Return(getPacket(12), nil)
+			sess.sentPacketHandler = sph
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(mconn.written).To(HaveLen(3))
+			Expect(mconn.numBatches).To(Equal(1))
+			Expect(sess.packetBatch).To(BeEmpty())
+		})
+
 		It("doesn't send when the SentPacketHandler doesn't allow it", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().SendMode().Return(ackhandler.SendNone)
@@ -1124,6 +1546,7 @@ var _ = Describe("Session", func() {
 	})
 
 	It("sends a 1-RTT packet when the handshake completes", func() {
+		sess.config.DisablePathMTUDiscovery = true
 		done := make(chan struct{})
 		gomock.InOrder(
 			sessionRunner.EXPECT().OnHandshakeComplete(gomock.Any()),
@@ -1218,7 +1641,7 @@ var _ = Describe("Session", func() {
 			}
 			streamManager.EXPECT().UpdateLimits(params)
 			packer.EXPECT().HandleTransportParameters(params)
-			sess.processTransportParameters(params.Marshal())
+			sess.processTransportParameters(params.Marshal(sess.version))
 			// make the go routine return
 			streamManager.EXPECT().CloseWithError(gomock.Any())
 			sessionRunner.EXPECT().Retire(gomock.Any())
@@ -1227,6 +1650,180 @@ var _ = Describe("Session", func() {
 			sess.Close()
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
+
+		It("issues new connection IDs, up to the peer's active_connection_id_limit", func() {
+			params := &handshake.TransportParameters{
+				ActiveConnectionIDLimit: 3,
+				MaxPacketSize:           protocol.MaxReceivePacketSize,
+			}
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			packer.EXPECT().HandleTransportParameters(gomock.Any())
+			sessionRunner.EXPECT().Add(gomock.Any(), sess).Times(2)
+			sessionRunner.EXPECT().GetStatelessResetToken(gomock.Any()).Times(2)
+			sess.processTransportParameters(params.Marshal(sess.version))
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(HaveLen(2))
+			for _, f := range frames {
+				Expect(f).To(BeAssignableToTypeOf(&wire.NewConnectionIDFrame{}))
+			}
+		})
+	})
+
+	Context("per-connection configuration", func() {
+		var params *handshake.TransportParameters
+
+		BeforeEach(func() {
+			params = &handshake.TransportParameters{
+				InitialMaxData:   0x5000,
+				MaxBidiStreamNum: 7,
+				// marshaling always sets it to this value
+				MaxPacketSize: protocol.MaxReceivePacketSize,
+			}
+		})
+
+		It("applies the Config returned by GetConfigForClient", func() {
+			var info *ClientInfo
+			conf := populateServerConfig(&Config{
+				GetConfigForClient: func(i *ClientInfo) (*Config, error) {
+					info = i
+					return &Config{
+						MaxIncomingStreams:                    5,
+						MaxIncomingUniStreams:                 -1,
+						IdleTimeout:                           42 * time.Second,
+						MaxReceiveConnectionFlowControlWindow: 1 << 20,
+						InitialStreamReceiveWindow:            1 << 10,
+						InitialConnectionReceiveWindow:        1 << 19,
+						CongestionControl:                     CongestionControlCubic,
+					}, nil
+				},
+			})
+			sess.config = conf
+			cryptoSetup.EXPECT().ClientHelloInfo().Return(&tls.ClientHelloInfo{
+				ServerName:      "quic.clemente.io",
+				SupportedProtos: []string{"proto1", "proto2"},
+			})
+			streamManager.EXPECT().ResetIncomingStreamLimits(uint64(5), uint64(0))
+			cryptoSetup.EXPECT().SetTransportParameters(gomock.Any()).Do(func(p *handshake.TransportParameters) {
+				Expect(p.MaxBidiStreamNum).To(Equal(protocol.StreamNum(5)))
+				Expect(p.MaxUniStreamNum).To(BeZero())
+				Expect(p.IdleTimeout).To(Equal(42 * time.Second))
+				Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(protocol.ByteCount(1 << 10)))
+				Expect(p.InitialMaxData).To(Equal(protocol.ByteCount(1 << 19)))
+			})
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			packer.EXPECT().HandleTransportParameters(gomock.Any())
+			sess.processTransportParameters(params.Marshal(sess.version))
+			Expect(info).ToNot(BeNil())
+			Expect(info.RemoteAddr).To(Equal(mconn.RemoteAddr()))
+			Expect(info.ServerName).To(Equal("quic.clemente.io"))
+			Expect(info.SupportedProtos).To(Equal([]string{"proto1", "proto2"}))
+			Expect(info.TransportParameters.InitialMaxData).To(BeEquivalentTo(0x5000))
+			Expect(info.TransportParameters.MaxBidiStreamNum).To(BeEquivalentTo(7))
+			Expect(sess.config.IdleTimeout).To(Equal(42 * time.Second))
+			Expect(sess.config.MaxReceiveConnectionFlowControlWindow).To(BeEquivalentTo(1 << 20))
+			Expect(sess.config.CongestionControl).To(Equal(CongestionControlCubic))
+			// values that were not overridden are taken from the listener's config
+			Expect(sess.config.MaxReceiveStreamFlowControlWindow).To(Equal(conf.MaxReceiveStreamFlowControlWindow))
+			// the listener's config is not modified
+			Expect(conf.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+			Expect(conf.CongestionControl).To(Equal(CongestionControlBBR))
+		})
+
+		It("reserves the receive memory for the new connection-level window", func() {
+			conf := populateServerConfig(&Config{
+				GetConfigForClient: func(*ClientInfo) (*Config, error) {
+					return &Config{InitialConnectionReceiveWindow: 1 << 20}, nil
+				},
+			})
+			sess.config = conf
+			memory := flowcontrol.NewWindowBudget(0)
+			sess.receiveMemory = memory.NewChild()
+			// the initial window reserved by the listener's connection flow controller
+			_, initialConnectionReceiveWindow := getInitialReceiveWindows(conf)
+			sess.receiveMemory.ForceReserve(protocol.ByteCount(initialConnectionReceiveWindow))
+			cryptoSetup.EXPECT().ClientHelloInfo().Return(&tls.ClientHelloInfo{})
+			streamManager.EXPECT().ResetIncomingStreamLimits(gomock.Any(), gomock.Any())
+			cryptoSetup.EXPECT().SetTransportParameters(gomock.Any())
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			packer.EXPECT().HandleTransportParameters(gomock.Any())
+			sess.processTransportParameters(params.Marshal(sess.version))
+			Expect(memory.Used()).To(BeEquivalentTo(1 << 20))
+		})
+
+		It("uses the listener's Config if GetConfigForClient returns nil", func() {
+			conf := populateServerConfig(&Config{
+				GetConfigForClient: func(*ClientInfo) (*Config, error) { return nil, nil },
+			})
+			sess.config = conf
+			cryptoSetup.EXPECT().ClientHelloInfo()
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			packer.EXPECT().HandleTransportParameters(gomock.Any())
+			sess.processTransportParameters(params.Marshal(sess.version))
+			Expect(sess.config).To(Equal(conf))
+		})
+
+		It("errors if GetConfigForClient returns an error", func() {
+			testErr := errors.New("unknown tenant")
+			sess.config = populateServerConfig(&Config{
+				GetConfigForClient: func(*ClientInfo) (*Config, error) { return nil, testErr },
+			})
+			cryptoSetup.EXPECT().ClientHelloInfo()
+			_, err := sess.processTransportParametersForServer(params.Marshal(sess.version))
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("derives the default initial windows from the maximum windows returned by GetConfigForClient", func() {
+			sess.config = populateServerConfig(&Config{
+				GetConfigForClient: func(*ClientInfo) (*Config, error) {
+					return &Config{
+						MaxReceiveStreamFlowControlWindow:     256 << 10,
+						MaxReceiveConnectionFlowControlWindow: 384 << 10,
+					}, nil
+				},
+			})
+			cryptoSetup.EXPECT().ClientHelloInfo().Return(&tls.ClientHelloInfo{})
+			streamManager.EXPECT().ResetIncomingStreamLimits(gomock.Any(), gomock.Any())
+			cryptoSetup.EXPECT().SetTransportParameters(gomock.Any()).Do(func(p *handshake.TransportParameters) {
+				Expect(p.InitialMaxStreamDataBidiLocal).To(Equal(protocol.ByteCount(256 << 10)))
+				Expect(p.InitialMaxStreamDataBidiRemote).To(Equal(protocol.ByteCount(256 << 10)))
+				Expect(p.InitialMaxStreamDataUni).To(Equal(protocol.ByteCount(256 << 10)))
+				Expect(p.InitialMaxData).To(Equal(protocol.ByteCount(384 << 10)))
+			})
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			packer.EXPECT().HandleTransportParameters(gomock.Any())
+			sess.processTransportParameters(params.Marshal(sess.version))
+			Expect(sess.config.InitialStreamReceiveWindow).To(BeZero())
+		})
+
+		It("errors if the Config returned by GetConfigForClient has an initial window larger than the maximum window", func() {
+			sess.config = populateServerConfig(&Config{
+				GetConfigForClient: func(*ClientInfo) (*Config, error) {
+					return &Config{
+						MaxReceiveConnectionFlowControlWindow: 1 << 20,
+						InitialConnectionReceiveWindow:        2 << 20,
+					}, nil
+				},
+			})
+			cryptoSetup.EXPECT().ClientHelloInfo()
+			_, err := sess.processTransportParametersForServer(params.Marshal(sess.version))
+			Expect(err).To(MatchError("quic: InitialConnectionReceiveWindow (2097152) larger than MaxReceiveConnectionFlowControlWindow (1048576)"))
+		})
+
+		It("errors if the client's initial_source_connection_id doesn't match", func() {
+			sess.version = protocol.VersionDraft29
+			params := &handshake.TransportParameters{InitialSourceConnectionID: protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}}
+			_, err := sess.processTransportParametersForServer(params.Marshal(sess.version))
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.TransportParameterError))
+			Expect(err.(*qerr.QuicError).ErrorMessage).To(ContainSubstring("expected initial_source_connection_id to equal"))
+		})
+
+		It("accepts the client's initial_source_connection_id", func() {
+			sess.version = protocol.VersionDraft29
+			params := &handshake.TransportParameters{InitialSourceConnectionID: sess.destConnID}
+			_, err := sess.processTransportParametersForServer(params.Marshal(sess.version))
+			Expect(err).ToNot(HaveOccurred())
+		})
 	})
 
 	Context("keep-alives", func() {
@@ -1468,6 +2065,16 @@ var _ = Describe("Session", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(str).To(Equal(mstr))
 		})
+
+		It("changes the limit for incoming streams", func() {
+			streamManager.EXPECT().SetMaxIncomingStreams(uint64(42))
+			sess.SetMaxIncomingStreams(42)
+		})
+
+		It("changes the limit for incoming unidirectional streams", func() {
+			streamManager.EXPECT().SetMaxIncomingUniStreams(uint64(42))
+			sess.SetMaxIncomingUniStreams(42)
+		})
 	})
 
 	It("returns the local address", func() {
@@ -1527,9 +2134,149 @@ var _ = Describe("Client Session", func() {
 		sess.cryptoStreamHandler = cryptoSetup
 	})
 
+	Context("handling HANDSHAKE_DONE frames", func() {
+		It("confirms the handshake", func() {
+			cryptoSetup.EXPECT().Received1RTTAck()
+			Expect(sess.handleFrame(&wire.HandshakeDoneFrame{}, 0, protocol.Encryption1RTT, nil)).To(Succeed())
+		})
+
+		It("rejects HANDSHAKE_DONE frames that are not sent in 1-RTT packets", func() {
+			err := sess.handleFrame(&wire.HandshakeDoneFrame{}, 0, protocol.EncryptionHandshake, nil)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: received an unencrypted HANDSHAKE_DONE frame"))
+		})
+	})
+
+	Context("handling tokens", func() {
+		It("saves tokens received in NEW_TOKEN frames", func() {
+			tokenStore := NewLRUTokenStore(10, 4)
+			sess.config.TokenStore = tokenStore
+			sess.tokenStoreKey = "quic.clemente.io"
+			Expect(sess.handleFrame(&wire.NewTokenFrame{Token: []byte("foobar")}, 0, protocol.Encryption1RTT, nil)).To(Succeed())
+			Expect(tokenStore.Pop("quic.clemente.io")).To(Equal(&ClientToken{data: []byte("foobar")}))
+		})
+
+		It("uses a token from the token store for the Initial", func() {
+			tokenStore := NewLRUTokenStore(10, 4)
+			tokenStore.Put("quic.clemente.io", &ClientToken{data: []byte("foobar")})
+			conf := populateClientConfig(&Config{TokenStore: tokenStore}, true)
+			sessP, err := newClientSession(
+				mconn,
+				sessionRunner,
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				conf,
+				&tls.Config{ServerName: "quic.clemente.io"},
+				42, // initial packet number
+				&handshake.TransportParameters{},
+				protocol.VersionTLS,
+				utils.DefaultLogger,
+				protocol.VersionTLS,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sessP.(*session).packer.(*packetPacker).token).To(Equal([]byte("foobar")))
+			Expect(tokenStore.Pop("quic.clemente.io")).To(BeNil())
+		})
+	})
+
+	Context("migrating to a new net.PacketConn", func() {
+		var (
+			migrator *MockPacketConnMigrator
+			sph      *mockackhandler.MockSentPacketHandler
+			oldPconn *mockPacketConn
+		)
+
+		BeforeEach(func() {
+			migrator = NewMockPacketConnMigrator(mockCtrl)
+			sess.sessionRunner = struct {
+				*MockSessionRunner
+				*MockPacketConnMigrator
+			}{sessionRunner, migrator}
+			sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sess.sentPacketHandler = sph
+			sess.handshakeComplete = true
+			sess.peerParams = &handshake.TransportParameters{}
+			oldPconn = newMockPacketConn()
+			mconn.pconn = oldPconn
+		})
+
+		newMigration := func() *localMigration {
+			return &localMigration{pconn: newMockPacketConn(), result: make(chan error, 1)}
+		}
+
+		It("migrates when the new path is validated", func() {
+			m := newMigration()
+			migrator.EXPECT().AddPacketConn(m.pconn)
+			sph.EXPECT().OnConnectionMigration()
+			sess.startLocalMigration(m)
+			Expect(mconn.pconn).To(Equal(m.pconn))
+			Expect(m.result).ToNot(Receive())
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(ConsistOf(
+				&wire.PathChallengeFrame{Data: m.challenge},
+				&wire.PingFrame{},
+			))
+			// a PATH_RESPONSE that doesn't match the challenge
+			data := m.challenge
+			data[0]++
+			sess.handlePathResponseFrame(&wire.PathResponseFrame{Data: data})
+			Expect(m.result).ToNot(Receive())
+			migrator.EXPECT().SwitchPacketConn(m.pconn)
+			sess.handlePathResponseFrame(&wire.PathResponseFrame{Data: m.challenge})
+			Expect(m.result).To(Receive(BeNil()))
+			Expect(mconn.pconn).To(Equal(m.pconn))
+		})
+
+		It("returns to the old net.PacketConn when the validation fails", func() {
+			m := newMigration()
+			migrator.EXPECT().AddPacketConn(m.pconn)
+			sph.EXPECT().OnConnectionMigration().Times(2)
+			sess.startLocalMigration(m)
+			Expect(m.deadline).ToNot(BeZero())
+			migrator.EXPECT().RemovePacketConn(m.pconn)
+			sess.handleLocalMigrationTimeout()
+			Expect(mconn.pconn).To(Equal(oldPconn))
+			Expect(m.result).To(Receive(MatchError("path validation failed")))
+		})
+
+		It("doesn't migrate before the handshake completed", func() {
+			sess.handshakeComplete = false
+			m := newMigration()
+			sess.startLocalMigration(m)
+			Expect(m.result).To(Receive(MatchError("cannot migrate before the handshake completed")))
+			Expect(mconn.pconn).To(Equal(oldPconn))
+		})
+
+		It("doesn't migrate if the server disabled migration", func() {
+			sess.peerParams.DisableMigration = true
+			m := newMigration()
+			sess.startLocalMigration(m)
+			Expect(m.result).To(Receive(MatchError("the peer disabled connection migration")))
+			Expect(mconn.pconn).To(Equal(oldPconn))
+		})
+
+		It("doesn't start a second migration while the first one is still being validated", func() {
+			m := newMigration()
+			migrator.EXPECT().AddPacketConn(m.pconn)
+			sph.EXPECT().OnConnectionMigration()
+			sess.startLocalMigration(m)
+			m2 := newMigration()
+			sess.startLocalMigration(m2)
+			Expect(m2.result).To(Receive(MatchError("a migration is already in progress")))
+			Expect(mconn.pconn).To(Equal(m.pconn))
+		})
+
+		It("returns the error when adding the net.PacketConn fails", func() {
+			m := newMigration()
+			migrator.EXPECT().AddPacketConn(m.pconn).Return(errors.New("add error"))
+			sess.startLocalMigration(m)
+			Expect(m.result).To(Receive(MatchError("add error")))
+			Expect(mconn.pconn).To(Equal(oldPconn))
+		})
+	})
+
 	It("changes the connection ID when receiving the first packet from the server", func() {
 		unpacker := NewMockUnpacker(mockCtrl)
-		unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, data []byte) (*unpackedPacket, error) {
+		unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, _ time.Time, data []byte) (*unpackedPacket, error) {
 			return &unpackedPacket{
 				encryptionLevel: protocol.Encryption1RTT,
 				hdr:             &wire.ExtendedHeader{Header: *hdr},
@@ -1610,6 +2357,34 @@ var _ = Describe("Client Session", func() {
 			}
 			Expect(sess.handlePacketImpl(getPacket(hdr, nil))).To(BeFalse())
 		})
+
+		Context("using the Retry Integrity Tag", func() {
+			getRetryPacket := func(origDestConnID protocol.ConnectionID) *receivedPacket {
+				validRetryHdr.Version = protocol.VersionDraft29
+				validRetryHdr.OrigDestConnectionID = nil
+				p := getPacket(validRetryHdr, nil)
+				tag := handshake.GetRetryIntegrityTag(p.data, origDestConnID)
+				p.data = append(p.data, tag[:]...)
+				return p
+			}
+
+			BeforeEach(func() {
+				sess.version = protocol.VersionDraft29
+			})
+
+			It("handles Retry packets", func() {
+				cryptoSetup.EXPECT().ChangeConnectionID(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+				packer.EXPECT().SetToken([]byte("foobar"))
+				packer.EXPECT().ChangeDestConnectionID(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+				Expect(sess.handlePacketImpl(getRetryPacket(sess.destConnID))).To(BeTrue())
+				Expect(sess.retrySrcConnID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
+			})
+
+			It("ignores Retry packets with an invalid Retry Integrity Tag", func() {
+				Expect(sess.handlePacketImpl(getRetryPacket(protocol.ConnectionID{1, 2, 3, 4}))).To(BeFalse())
+				Expect(sess.receivedRetry).To(BeFalse())
+			})
+		})
 	})
 
 	Context("transport parameters", func() {
@@ -1634,18 +2409,82 @@ var _ = Describe("Client Session", func() {
 				OriginalConnectionID: protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
 				StatelessResetToken:  &[16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
 			}
-			_, err := sess.processTransportParametersForClient(params.Marshal())
+			_, err := sess.processTransportParametersForClient(params.Marshal(sess.version))
 			Expect(err).To(MatchError("expected original_connection_id to equal (empty), is 0xdecafbad"))
 		})
 
 		It("errors if the TransportParameters contain an original_connection_id, although no Retry was performed", func() {
 			sess.origDestConnID = protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+			sess.receivedRetry = true
 			params := &handshake.TransportParameters{
 				OriginalConnectionID: protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad},
 				StatelessResetToken:  &[16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
 			}
-			_, err := sess.processTransportParametersForClient(params.Marshal())
+			_, err := sess.processTransportParametersForClient(params.Marshal(sess.version))
 			Expect(err).To(MatchError("expected original_connection_id to equal 0xdeadbeef, is 0xdecafbad"))
 		})
+
+		Context("authenticating the connection IDs", func() {
+			var params *handshake.TransportParameters
+
+			BeforeEach(func() {
+				sess.version = protocol.VersionDraft29
+				sess.destConnID = protocol.ConnectionID{0xca, 0xfe}
+				params = &handshake.TransportParameters{
+					OriginalConnectionID:      sess.origDestConnID,
+					InitialSourceConnectionID: protocol.ConnectionID{0xca, 0xfe},
+					StatelessResetToken:       &[16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16},
+				}
+			})
+
+			expectTransportParameterError := func(msg string) {
+				_, err := sess.processTransportParametersForClient(params.Marshal(sess.version))
+				Expect(err).To(HaveOccurred())
+				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.TransportParameterError))
+				Expect(err.(*qerr.QuicError).ErrorMessage).To(Equal(msg))
+			}
+
+			It("accepts the connection IDs used in the handshake", func() {
+				_, err := sess.processTransportParametersForClient(params.Marshal(sess.version))
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("errors if the original_connection_id doesn't match", func() {
+				params.OriginalConnectionID = protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+				expectTransportParameterError("expected original_connection_id to equal 0x0807060504030201, is 0xdecafbad")
+			})
+
+			It("errors if the initial_source_connection_id doesn't match", func() {
+				params.InitialSourceConnectionID = protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+				expectTransportParameterError("expected initial_source_connection_id to equal 0xcafe, is 0xdecafbad")
+			})
+
+			It("errors if the retry_source_connection_id is sent, although no Retry was performed", func() {
+				params.RetrySourceConnectionID = &protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+				expectTransportParameterError("received retry_source_connection_id, although no Retry was performed")
+			})
+
+			Context("after a Retry", func() {
+				BeforeEach(func() {
+					sess.receivedRetry = true
+					sess.retrySrcConnID = protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+				})
+
+				It("accepts the retry_source_connection_id", func() {
+					params.RetrySourceConnectionID = &protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+					_, err := sess.processTransportParametersForClient(params.Marshal(sess.version))
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("errors if the retry_source_connection_id is missing", func() {
+					expectTransportParameterError("missing retry_source_connection_id")
+				})
+
+				It("errors if the retry_source_connection_id doesn't match", func() {
+					params.RetrySourceConnectionID = &protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+					expectTransportParameterError("expected retry_source_connection_id to equal 0xdeadbeef, is 0xdecafbad")
+				})
+			})
+		})
 	})
 })
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"io"
 	"net"
 	"sync"
 	"time"
@@ -53,6 +54,8 @@ type streamI interface {
 	handleStopSendingFrame(*wire.StopSendingFrame)
 	popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool)
 	handleMaxStreamDataFrame(*wire.MaxStreamDataFrame)
+	handleStreamFrameAcked(*wire.StreamFrame)
+	handleStreamFrameRetransmitted(*wire.StreamFrame)
 }
 
 var _ receiveStreamI = (streamI)(nil)
@@ -74,6 +77,7 @@ type stream struct {
 }
 
 var _ Stream = &stream{}
+var _ io.WriterTo = &stream{}
 
 type deadlineError struct{}
 
@@ -97,6 +101,7 @@ var _ StreamError = &streamCanceledError{}
 func newStream(streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	memory *flowcontrol.WindowBudget,
 	version protocol.VersionNumber,
 ) *stream {
 	s := &stream{sender: sender, version: version}
@@ -119,7 +124,7 @@ func newStream(streamID protocol.StreamID,
 			s.completedMutex.Unlock()
 		},
 	}
-	s.receiveStream = *newReceiveStream(streamID, senderForReceiveStream, flowController, version)
+	s.receiveStream = *newReceiveStream(streamID, senderForReceiveStream, flowController, memory, version)
 	return s
 }
 
@@ -142,6 +147,14 @@ func (s *stream) SetDeadline(t time.Time) error {
 	return nil
 }
 
+func (s *stream) Stats() StreamStats {
+	stats := s.sendStream.Stats()
+	receiveStats := s.receiveStream.Stats()
+	stats.BytesReceived = receiveStats.BytesReceived
+	stats.BytesRead = receiveStats.BytesRead
+	return stats
+}
+
 // CloseForShutdown closes a stream abruptly.
 // It makes Read and Write unblock (and return the error) immediately.
 // The peer will NOT be informed about this: the stream is closed without sending a FIN or RST.
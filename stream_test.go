@@ -39,7 +39,7 @@ var _ = Describe("Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newStream(streamID, mockSender, mockFC, protocol.VersionWhatever)
+		str = newStream(streamID, mockSender, mockFC, nil, protocol.VersionWhatever)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = struct {
@@ -76,6 +76,17 @@ var _ = Describe("Stream", func() {
 		})
 	})
 
+	It("reports statistics for both directions", func() {
+		mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+		Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+		str.sendStream.dataForWriting = []byte("foo")
+		stats := str.Stats()
+		Expect(stats.BytesReceived).To(Equal(uint64(6)))
+		Expect(stats.BytesRead).To(BeZero())
+		Expect(stats.BytesWritten).To(Equal(uint64(3)))
+		Expect(stats.BytesSent).To(BeZero())
+	})
+
 	Context("completing", func() {
 		It("is not completed when only the receive side is completed", func() {
 			// don't EXPECT a call to mockSender.onStreamCompleted()
@@ -45,9 +45,11 @@ var errTooManyOpenStreams = errors.New("too many open streams")
 
 type streamsMap struct {
 	perspective protocol.Perspective
+	version     protocol.VersionNumber
 
 	sender            streamSender
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController
+	memory            *flowcontrol.WindowBudget // accounts for the data buffered by receive streams, may be nil
 
 	outgoingBidiStreams *outgoingBidiStreamsMap
 	outgoingUniStreams  *outgoingUniStreamsMap
@@ -60,6 +62,7 @@ var _ streamManager = &streamsMap{}
 func newStreamsMap(
 	sender streamSender,
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController,
+	memory *flowcontrol.WindowBudget,
 	maxIncomingBidiStreams uint64,
 	maxIncomingUniStreams uint64,
 	perspective protocol.Perspective,
@@ -67,24 +70,18 @@ func newStreamsMap(
 ) streamManager {
 	m := &streamsMap{
 		perspective:       perspective,
+		version:           version,
 		newFlowController: newFlowController,
+		memory:            memory,
 		sender:            sender,
 	}
 	m.outgoingBidiStreams = newOutgoingBidiStreamsMap(
 		func(num protocol.StreamNum) streamI {
 			id := num.StreamID(protocol.StreamTypeBidi, perspective)
-			return newStream(id, m.sender, m.newFlowController(id), version)
+			return newStream(id, m.sender, m.newFlowController(id), m.memory, version)
 		},
 		sender.queueControlFrame,
 	)
-	m.incomingBidiStreams = newIncomingBidiStreamsMap(
-		func(num protocol.StreamNum) streamI {
-			id := num.StreamID(protocol.StreamTypeBidi, perspective.Opposite())
-			return newStream(id, m.sender, m.newFlowController(id), version)
-		},
-		maxIncomingBidiStreams,
-		sender.queueControlFrame,
-	)
 	m.outgoingUniStreams = newOutgoingUniStreamsMap(
 		func(num protocol.StreamNum) sendStreamI {
 			id := num.StreamID(protocol.StreamTypeUni, perspective)
@@ -92,15 +89,27 @@ func newStreamsMap(
 		},
 		sender.queueControlFrame,
 	)
+	m.initIncomingStreams(maxIncomingBidiStreams, maxIncomingUniStreams)
+	return m
+}
+
+func (m *streamsMap) initIncomingStreams(maxIncomingBidiStreams, maxIncomingUniStreams uint64) {
+	m.incomingBidiStreams = newIncomingBidiStreamsMap(
+		func(num protocol.StreamNum) streamI {
+			id := num.StreamID(protocol.StreamTypeBidi, m.perspective.Opposite())
+			return newStream(id, m.sender, m.newFlowController(id), m.memory, m.version)
+		},
+		maxIncomingBidiStreams,
+		m.sender.queueControlFrame,
+	)
 	m.incomingUniStreams = newIncomingUniStreamsMap(
 		func(num protocol.StreamNum) receiveStreamI {
-			id := num.StreamID(protocol.StreamTypeUni, perspective.Opposite())
-			return newReceiveStream(id, m.sender, m.newFlowController(id), version)
+			id := num.StreamID(protocol.StreamTypeUni, m.perspective.Opposite())
+			return newReceiveStream(id, m.sender, m.newFlowController(id), m.memory, m.version)
 		},
 		maxIncomingUniStreams,
-		sender.queueControlFrame,
+		m.sender.queueControlFrame,
 	)
-	return m
 }
 
 func (m *streamsMap) OpenStream() (Stream, error) {
@@ -236,6 +245,21 @@ func (m *streamsMap) UpdateLimits(p *handshake.TransportParameters) error {
 	return nil
 }
 
+func (m *streamsMap) SetMaxIncomingStreams(num uint64) {
+	m.incomingBidiStreams.SetMaxStreams(num)
+}
+
+func (m *streamsMap) SetMaxIncomingUniStreams(num uint64) {
+	m.incomingUniStreams.SetMaxStreams(num)
+}
+
+// ResetIncomingStreamLimits sets the number of streams that the peer is allowed to open.
+// In contrast to SetMaxIncomingStreams, the limit can also be decreased, and no MAX_STREAMS frame is queued.
+// It must only be called before the stream limits are sent to the peer.
+func (m *streamsMap) ResetIncomingStreamLimits(maxIncomingBidiStreams, maxIncomingUniStreams uint64) {
+	m.initIncomingStreams(maxIncomingBidiStreams, maxIncomingUniStreams)
+}
+
 func (m *streamsMap) CloseWithError(err error) {
 	m.outgoingBidiStreams.CloseWithError(err)
 	m.outgoingUniStreams.CloseWithError(err)
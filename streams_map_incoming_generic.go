@@ -146,18 +146,46 @@ func (m *incomingItemsMap) deleteStream(num protocol.StreamNum) error {
 	}
 
 	delete(m.streams, num)
-	// queue a MAX_STREAM_ID frame, giving the peer the option to open a new stream
-	if m.maxNumStreams > uint64(len(m.streams)) {
-		numNewStreams := m.maxNumStreams - uint64(len(m.streams))
-		m.maxStream = m.nextStreamToOpen + protocol.StreamNum(numNewStreams) - 1
-		m.queueMaxStreamID(&wire.MaxStreamsFrame{
-			Type:         streamTypeGeneric,
-			MaxStreamNum: m.maxStream,
-		})
-	}
+	m.maybeQueueMaxStreams()
 	return nil
 }
 
+// SetMaxStreams sets the maximum number of concurrent streams that the peer is allowed to open.
+// When the limit is raised, a MAX_STREAMS frame is queued immediately.
+// When it is lowered, the peer won't be allowed to open new streams until
+// the number of open streams drops below the new limit.
+func (m *incomingItemsMap) SetMaxStreams(num uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.maxNumStreams = num
+	m.maybeQueueMaxStreams()
+}
+
+// maybeQueueMaxStreams queues a MAX_STREAMS frame, giving the peer the option to open new streams.
+// The stream limit is never decreased.
+// It must be called after locking the mutex.
+func (m *incomingItemsMap) maybeQueueMaxStreams() {
+	if m.maxNumStreams <= uint64(len(m.streams)) {
+		return
+	}
+	numNewStreams := m.maxNumStreams - uint64(len(m.streams))
+	// Clamp the number of new streams before adding, so that calculating the maximum stream can't overflow.
+	// The peer can't open streams beyond MaxStreamCount, so nextStreamToOpen is at most MaxStreamCount + 1.
+	if maxNewStreams := uint64(protocol.MaxStreamCount - m.nextStreamToOpen + 1); numNewStreams > maxNewStreams {
+		numNewStreams = maxNewStreams
+	}
+	maxStream := m.nextStreamToOpen + protocol.StreamNum(numNewStreams) - 1
+	if maxStream <= m.maxStream {
+		return
+	}
+	m.maxStream = maxStream
+	m.queueMaxStreamID(&wire.MaxStreamsFrame{
+		Type:         streamTypeGeneric,
+		MaxStreamNum: m.maxStream,
+	})
+}
+
 func (m *incomingItemsMap) CloseWithError(err error) {
 	m.mutex.Lock()
 	m.closeErr = err
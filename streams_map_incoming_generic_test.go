@@ -2,6 +2,7 @@ package quic
 
 import (
 	"errors"
+	"math"
 
 	"github.com/DrakenLibra/gt-bbr/internal/protocol"
 	"github.com/DrakenLibra/gt-bbr/internal/wire"
@@ -203,4 +204,63 @@ var _ = Describe("Streams Map (incoming)", func() {
 		})
 		Expect(m.DeleteStream(4)).To(Succeed())
 	})
+
+	Context("changing the stream limit", func() {
+		It("sends a MAX_STREAMS frame when the limit is raised", func() {
+			_, err := m.GetOrOpenStream(2)
+			Expect(err).ToNot(HaveOccurred())
+			mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{
+				Type:         streamTypeGeneric,
+				MaxStreamNum: 10,
+			})
+			m.SetMaxStreams(10)
+			_, err = m.GetOrOpenStream(10)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = m.GetOrOpenStream(11)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("doesn't grant new streams when the limit is lowered", func() {
+			_, err := m.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				_, err := m.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+			}
+			// don't EXPECT any calls to queueControlFrame
+			m.SetMaxStreams(3)
+			Expect(m.DeleteStream(1)).To(Succeed())
+			Expect(m.DeleteStream(2)).To(Succeed())
+			// now there are 3 open streams
+			mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{
+				Type:         streamTypeGeneric,
+				MaxStreamNum: 6,
+			})
+			Expect(m.DeleteStream(3)).To(Succeed())
+		})
+
+		It("doesn't send a MAX_STREAMS frame when the limit is lowered below the streams already granted", func() {
+			// don't EXPECT any calls to queueControlFrame
+			m.SetMaxStreams(2)
+			// the peer is still allowed to open the streams it was granted before
+			_, err := m.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("doesn't grant more than the maximum stream count", func() {
+			_, err := m.GetOrOpenStream(5)
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < 5; i++ {
+				_, err := m.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+			}
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			Expect(m.DeleteStream(1)).To(Succeed())
+			mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{
+				Type:         streamTypeGeneric,
+				MaxStreamNum: protocol.MaxStreamCount,
+			})
+			m.SetMaxStreams(math.MaxUint64)
+		})
+	})
 })
@@ -88,7 +88,7 @@ var _ = Describe("Streams Map", func() {
 
 			BeforeEach(func() {
 				mockSender = NewMockStreamSender(mockCtrl)
-				m = newStreamsMap(mockSender, newFlowController, MaxBidiStreamNum, MaxUniStreamNum, perspective, protocol.VersionWhatever).(*streamsMap)
+				m = newStreamsMap(mockSender, newFlowController, nil, MaxBidiStreamNum, MaxUniStreamNum, perspective, protocol.VersionWhatever).(*streamsMap)
 			})
 
 			Context("opening", func() {
@@ -413,6 +413,34 @@ var _ = Describe("Streams Map", func() {
 					})
 					Expect(m.DeleteStream(ids.firstIncomingUniStream)).To(Succeed())
 				})
+
+				It("sends a MAX_STREAMS frame when the bidirectional stream limit is raised", func() {
+					mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{
+						Type:         protocol.StreamTypeBidi,
+						MaxStreamNum: MaxBidiStreamNum + 10,
+					})
+					m.SetMaxIncomingStreams(MaxBidiStreamNum + 10)
+				})
+
+				It("sends a MAX_STREAMS frame when the unidirectional stream limit is raised", func() {
+					mockSender.EXPECT().queueControlFrame(&wire.MaxStreamsFrame{
+						Type:         protocol.StreamTypeUni,
+						MaxStreamNum: MaxUniStreamNum + 10,
+					})
+					m.SetMaxIncomingUniStreams(MaxUniStreamNum + 10)
+				})
+			})
+
+			It("resets the incoming stream limits", func() {
+				m.ResetIncomingStreamLimits(1, 2)
+				_, err := m.GetOrOpenSendStream(ids.firstIncomingBidiStream)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.GetOrOpenSendStream(ids.firstIncomingBidiStream + 4)
+				Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("peer tried to open stream %d (current limit: %d)", ids.firstIncomingBidiStream+4, ids.firstIncomingBidiStream)))
+				_, err = m.GetOrOpenReceiveStream(ids.firstIncomingUniStream + 4)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.GetOrOpenReceiveStream(ids.firstIncomingUniStream + 8)
+				Expect(err).To(HaveOccurred())
 			})
 
 			It("closes", func() {
@@ -0,0 +1,139 @@
+package quic
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/DrakenLibra/gt-bbr/internal/protocol"
+)
+
+type singleOriginTokenStore struct {
+	tokens []*ClientToken
+	len    int
+	p      int
+}
+
+func newSingleOriginTokenStore(size int) *singleOriginTokenStore {
+	return &singleOriginTokenStore{tokens: make([]*ClientToken, size)}
+}
+
+func (s *singleOriginTokenStore) Add(token *ClientToken) {
+	s.tokens[s.p] = token
+	s.p = s.index(s.p + 1)
+	if s.len < len(s.tokens) {
+		s.len++
+	}
+}
+
+func (s *singleOriginTokenStore) Pop() *ClientToken {
+	s.p = s.index(s.p - 1)
+	token := s.tokens[s.p]
+	s.tokens[s.p] = nil
+	s.len--
+	return token
+}
+
+func (s *singleOriginTokenStore) Len() int {
+	return s.len
+}
+
+func (s *singleOriginTokenStore) index(i int) int {
+	mod := len(s.tokens)
+	return (i + mod) % mod
+}
+
+type lruTokenStoreEntry struct {
+	key   string
+	cache *singleOriginTokenStore
+}
+
+type lruTokenStore struct {
+	mutex sync.Mutex
+
+	m                map[string]*list.Element
+	q                *list.List
+	capacity         int
+	singleOriginSize int
+}
+
+var _ TokenStore = &lruTokenStore{}
+
+// NewLRUTokenStore creates a new LRU cache for tokens received by the client.
+// maxOrigins specifies how many origins this cache is saving tokens for.
+// tokensPerOrigin specifies the maximum number of tokens per origin.
+// If either of them is 0 (or negative), no tokens are stored.
+func NewLRUTokenStore(maxOrigins, tokensPerOrigin int) TokenStore {
+	return &lruTokenStore{
+		m:                make(map[string]*list.Element),
+		q:                list.New(),
+		capacity:         maxOrigins,
+		singleOriginSize: tokensPerOrigin,
+	}
+}
+
+func (s *lruTokenStore) Put(key string, token *ClientToken) {
+	if s.capacity <= 0 || s.singleOriginSize <= 0 {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if el, ok := s.m[key]; ok {
+		entry := el.Value.(*lruTokenStoreEntry)
+		entry.cache.Add(token)
+		s.q.MoveToFront(el)
+		return
+	}
+
+	if s.q.Len() < s.capacity {
+		entry := &lruTokenStoreEntry{
+			key:   key,
+			cache: newSingleOriginTokenStore(s.singleOriginSize),
+		}
+		entry.cache.Add(token)
+		s.m[key] = s.q.PushFront(entry)
+		return
+	}
+
+	// The cache is full. Reuse the least recently used entry.
+	el := s.q.Back()
+	entry := el.Value.(*lruTokenStoreEntry)
+	delete(s.m, entry.key)
+	entry.key = key
+	entry.cache = newSingleOriginTokenStore(s.singleOriginSize)
+	entry.cache.Add(token)
+	s.m[key] = el
+	s.q.MoveToFront(el)
+}
+
+func (s *lruTokenStore) Pop(key string) *ClientToken {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	el, ok := s.m[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*lruTokenStoreEntry)
+	token := entry.cache.Pop()
+	if entry.cache.Len() == 0 {
+		s.q.Remove(el)
+		delete(s.m, key)
+	}
+	return token
+}
+
+var (
+	defaultTokenStoreOnce sync.Once
+	defaultTokenStore     TokenStore
+)
+
+// getDefaultTokenStore returns the token store that is used if no TokenStore is configured.
+// It is shared by all clients.
+func getDefaultTokenStore() TokenStore {
+	defaultTokenStoreOnce.Do(func() {
+		defaultTokenStore = NewLRUTokenStore(protocol.DefaultTokenStoreMaxOrigins, protocol.DefaultTokenStoreTokensPerOrigin)
+	})
+	return defaultTokenStore
+}